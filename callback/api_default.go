@@ -28,6 +28,7 @@ import (
 	"github.com/free5gc/smf/logger"
 	stats "github.com/free5gc/smf/metrics"
 	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
+	"github.com/free5gc/smf/producer"
 	"github.com/free5gc/smf/transaction"
 )
 
@@ -65,7 +66,33 @@ func HTTPSmPolicyUpdateNotification(c *gin.Context) {
 }
 
 func SmPolicyControlTerminationRequestNotification(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{})
+	logger.PduSessLog.Info("Recieve SM Policy Termination Notification")
+	stats.IncrementSvcPcfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmPolicyTerminationNotification), "In", "", "")
+
+	var request models.TerminationNotification
+	if err := c.ShouldBindJSON(&request); err != nil {
+		problemDetail := "[Request Body] " + err.Error()
+		logger.PduSessLog.Errorln(problemDetail)
+		c.JSON(http.StatusBadRequest, models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: problemDetail,
+		})
+		return
+	}
+
+	txn := transaction.NewTransaction(request, nil, svcmsgtypes.SmfMsgType(svcmsgtypes.SmPolicyTerminationNotification))
+	txn.CtxtKey = c.Params.ByName("smContextRef")
+	go txn.StartTxnLifeCycle(fsm.SmfTxnFsmHandle)
+	<-txn.Status //wait for txn to complete at SMF
+	HTTPResponse := txn.Rsp.(*http_wrapper.Response)
+
+	stats.IncrementSvcPcfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmPolicyTerminationNotification), "Out", http.StatusText(HTTPResponse.Status), "")
+	if HTTPResponse.Status == http.StatusNoContent {
+		c.Status(http.StatusNoContent)
+	} else {
+		c.JSON(HTTPResponse.Status, HTTPResponse.Body)
+	}
 }
 
 func N1N2FailureNotification(c *gin.Context) {
@@ -87,3 +114,58 @@ func N1N2FailureNotification(c *gin.Context) {
 	stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.N1N2MessageTransferFailureNotification), "Out", http.StatusText(http.StatusNoContent), "")
 	c.Status(http.StatusNoContent)
 }
+
+func HTTPUdmDeregistrationNotification(c *gin.Context) {
+	logger.PduSessLog.Info("Recieve UDM Deregistration Notification")
+	stats.IncrementSvcUdmMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.UdmDeregistrationNotification), "In", "", "")
+
+	var request models.DeregistrationData
+	if err := c.ShouldBindJSON(&request); err != nil {
+		problemDetail := "[Request Body] " + err.Error()
+		logger.PduSessLog.Errorln(problemDetail)
+		c.JSON(http.StatusBadRequest, models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: problemDetail,
+		})
+		return
+	}
+
+	HTTPResponse := producer.HandleUdmDeregistrationNotification(c.Params.ByName("smContextRef"), request)
+	stats.IncrementSvcUdmMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.UdmDeregistrationNotification), "Out", http.StatusText(HTTPResponse.Status), "")
+	if HTTPResponse.Status == http.StatusNoContent {
+		c.Status(http.StatusNoContent)
+	} else {
+		c.JSON(HTTPResponse.Status, HTTPResponse.Body)
+	}
+}
+
+func HTTPSdmDataChangeNotification(c *gin.Context) {
+	logger.PduSessLog.Info("Recieve SDM Data Change Notification")
+	stats.IncrementSvcUdmMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SdmDataChangeNotification), "In", "", "")
+
+	var request models.ModificationNotification
+	if err := c.ShouldBindJSON(&request); err != nil {
+		problemDetail := "[Request Body] " + err.Error()
+		logger.PduSessLog.Errorln(problemDetail)
+		c.JSON(http.StatusBadRequest, models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: problemDetail,
+		})
+		return
+	}
+
+	txn := transaction.NewTransaction(request, nil, svcmsgtypes.SmfMsgType(svcmsgtypes.SdmDataChangeNotification))
+	txn.CtxtKey = c.Params.ByName("smContextRef")
+	go txn.StartTxnLifeCycle(fsm.SmfTxnFsmHandle)
+	<-txn.Status //wait for txn to complete at SMF
+	HTTPResponse := txn.Rsp.(*http_wrapper.Response)
+
+	stats.IncrementSvcUdmMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SdmDataChangeNotification), "Out", http.StatusText(HTTPResponse.Status), "")
+	if HTTPResponse.Status == http.StatusNoContent {
+		c.Status(http.StatusNoContent)
+	} else {
+		c.JSON(HTTPResponse.Status, HTTPResponse.Body)
+	}
+}
@@ -81,4 +81,16 @@ var routes = Routes{
 		"/sm-n1n2failnotify/:smContextRef",
 		N1N2FailureNotification,
 	},
+	{
+		"UdmDeregistrationNotification",
+		"POST",
+		"/udm-dereg/:smContextRef",
+		HTTPUdmDeregistrationNotification,
+	},
+	{
+		"SdmDataChangeNotification",
+		"POST",
+		"/sdm-notify/:smContextRef",
+		HTTPSdmDataChangeNotification,
+	},
 }
@@ -20,6 +20,7 @@ import (
 	"github.com/free5gc/openapi"
 	"github.com/free5gc/openapi/Nnrf_NFDiscovery"
 	"github.com/free5gc/openapi/Nudm_SubscriberDataManagement"
+	"github.com/free5gc/openapi/Nudm_UEContextManagement"
 	"github.com/free5gc/openapi/models"
 	smf_context "github.com/free5gc/smf/context"
 	"github.com/free5gc/smf/logger"
@@ -137,6 +138,43 @@ func SendNFDeregistration() error {
 	return nil
 }
 
+//SendNFStatusUpdate updates NF status of SMF profile in NRF(Nnrf_NFManagement NFUpdate)
+func SendNFStatusUpdate(status models.NfStatus) error {
+	patchItem := []models.PatchItem{
+		{
+			Op:    models.PatchOperation_REPLACE,
+			Path:  "/nfStatus",
+			Value: status,
+		},
+	}
+
+	_, res, err := smf_context.SMF_Self().
+		NFManagementClient.
+		NFInstanceIDDocumentApi.
+		UpdateNFInstance(context.TODO(), smf_context.SMF_Self().NfInstanceID, patchItem)
+	metrics.IncrementSvcNrfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NnrfNFUpdate), "Out", "", "")
+
+	if err != nil || res == nil {
+		logger.ConsumerLog.Errorf("NRF NF status update to [%v] failed, %v", status, err)
+		metrics.IncrementSvcNrfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NnrfNFUpdate), "In", "Failure", "")
+		return fmt.Errorf("NRF NF status update failure")
+	}
+	defer func() {
+		if resCloseErr := res.Body.Close(); resCloseErr != nil {
+			logger.ConsumerLog.Errorf("UpdateNFInstance response body cannot close: %+v", resCloseErr)
+		}
+	}()
+
+	metrics.IncrementSvcNrfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NnrfNFUpdate), "In", http.StatusText(res.StatusCode), "")
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNoContent {
+		logger.ConsumerLog.Errorf("NRF NF status update failure, status [%v]", http.StatusText(res.StatusCode))
+		return fmt.Errorf("NRF NF status update failure, [%v]", http.StatusText(res.StatusCode))
+	}
+
+	logger.ConsumerLog.Infof("NRF NF status updated to [%v]", status)
+	return nil
+}
+
 func SendNFDiscoveryUDM() (*models.ProblemDetails, error) {
 	localVarOptionals := Nnrf_NFDiscovery.SearchNFInstancesParamOpts{}
 
@@ -167,6 +205,11 @@ func SendNFDiscoveryUDM() (*models.ProblemDetails, error) {
 				SDMConf.SetBasePath(service.ApiPrefix)
 				smf_context.SMF_Self().SubscriberDataManagementClient = Nudm_SubscriberDataManagement.NewAPIClient(SDMConf)
 			}
+			if service.ServiceName == models.ServiceName_NUDM_UECM {
+				UECMConf := Nudm_UEContextManagement.NewConfiguration()
+				UECMConf.SetBasePath(service.ApiPrefix)
+				smf_context.SMF_Self().UEContextManagementClient = Nudm_UEContextManagement.NewAPIClient(UECMConf)
+			}
 		}
 
 		if smf_context.SMF_Self().SubscriberDataManagementClient == nil {
@@ -282,6 +325,63 @@ func SendNFDiscoveryServingAMF(smContext *smf_context.SMContext) (*models.Proble
 	return nil, nil
 }
 
+//SendNFDiscoveryHSMF finds H-SMF of home-routed session serving DNN and HPLMN S-NSSAI of UE
+func SendNFDiscoveryHSMF(smContext *smf_context.SMContext) (*models.ProblemDetails, error) {
+	targetNfType := models.NfType_SMF
+	requesterNfType := models.NfType_SMF
+
+	snssai := smContext.Snssai
+	if smContext.HplmnSnssai != nil {
+		snssai = smContext.HplmnSnssai
+	}
+	localVarOptionals := Nnrf_NFDiscovery.SearchNFInstancesParamOpts{
+		ServiceNames: optional.NewInterface([]models.ServiceName{models.ServiceName_NSMF_PDUSESSION}),
+		Dnn:          optional.NewString(smContext.Dnn),
+		Snssais:      optional.NewInterface(openapi.MarshToJsonString([]models.Snssai{*snssai})),
+		Supi:         optional.NewString(smContext.Supi),
+	}
+
+	// Check data
+	result, httpResp, localErr := smf_context.SMF_Self().
+		NFDiscoveryClient.
+		NFInstancesStoreApi.
+		SearchNFInstances(context.TODO(), targetNfType, requesterNfType, &localVarOptionals)
+	metrics.IncrementSvcNrfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NnrfNFDiscoverySmf), "Out", "", "")
+
+	if localErr == nil {
+		metrics.IncrementSvcNrfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NnrfNFDiscoverySmf), "In", http.StatusText(httpResp.StatusCode), "")
+		for _, profile := range result.NfInstances {
+			if profile.NfInstanceId == smf_context.SMF_Self().NfInstanceID || profile.NfServices == nil {
+				continue
+			}
+			for _, service := range *profile.NfServices {
+				if service.ServiceName == models.ServiceName_NSMF_PDUSESSION {
+					smContext.SubConsumerLog.Infof("send NF Discovery H-SMF Successful, H-SMF[%v]", profile.NfInstanceId)
+					smContext.SetHsmf(profile.NfInstanceId, service.ApiPrefix)
+					return nil, nil
+				}
+			}
+		}
+		return nil, openapi.ReportError("no H-SMF found")
+	} else if httpResp != nil {
+		defer func() {
+			if resCloseErr := httpResp.Body.Close(); resCloseErr != nil {
+				logger.ConsumerLog.Errorf("SearchNFInstances response body cannot close: %+v", resCloseErr)
+			}
+		}()
+		if httpResp.Status != localErr.Error() {
+			metrics.IncrementSvcNrfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NnrfNFDiscoverySmf), "In", http.StatusText(httpResp.StatusCode), httpResp.Status)
+			return nil, localErr
+		}
+		metrics.IncrementSvcNrfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NnrfNFDiscoverySmf), "In", http.StatusText(httpResp.StatusCode), localErr.Error())
+		problem := localErr.(openapi.GenericOpenAPIError).Model().(models.ProblemDetails)
+		return &problem, nil
+	} else {
+		metrics.IncrementSvcNrfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NnrfNFDiscoverySmf), "In", "Failure", "NoResponse")
+		return nil, openapi.ReportError("server no response")
+	}
+}
+
 func SendDeregisterNFInstance() (*models.ProblemDetails, error) {
 	logger.ConsumerLog.Infof("Send Deregister NFInstance")
 
@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/free5gc/openapi/Nsmf_EventExposure"
+	"github.com/free5gc/openapi/models"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/logger"
+	"github.com/free5gc/smf/metrics"
+	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
+)
+
+//SendSmfEventExposureNotification delivers event notification to subscriber
+func SendSmfEventExposureNotification(uri string, request models.NsmfEventExposureNotification) error {
+	configuration := Nsmf_EventExposure.NewConfiguration()
+	client := Nsmf_EventExposure.NewAPIClient(configuration)
+
+	metrics.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmfEventExposureNotify), "Out", "", "")
+	_, httpResp, err := client.DefaultCallbackApi.SmfEventExposureNotification(context.Background(), uri, request)
+	if err != nil || httpResp == nil {
+		logger.ConsumerLog.Warnf("SMF event exposure notification to [%v] failed, %v", uri, err)
+		metrics.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmfEventExposureNotify), "In", "Failure", "")
+		return fmt.Errorf("SMF event exposure notification failure")
+	}
+	defer func() {
+		if resCloseErr := httpResp.Body.Close(); resCloseErr != nil {
+			logger.ConsumerLog.Errorf("SmfEventExposureNotification response body cannot close: %+v", resCloseErr)
+		}
+	}()
+
+	metrics.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmfEventExposureNotify), "In", http.StatusText(httpResp.StatusCode), "")
+	if httpResp.StatusCode != http.StatusNoContent && httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("SMF event exposure notification failure, [%v]", http.StatusText(httpResp.StatusCode))
+	}
+
+	logger.ConsumerLog.Debugf("SMF event exposure notification [%v] sent to [%v]", request.NotifId, uri)
+	return nil
+}
@@ -0,0 +1,202 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/antihax/optional"
+
+	"github.com/free5gc/openapi"
+	"github.com/free5gc/openapi/Nsmf_PDUSession"
+	"github.com/free5gc/openapi/models"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/metrics"
+	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
+)
+
+//SendVsmfPduSessionUpdate sends H-SMF initiated Update of home-routed PDU session to V-SMF
+func SendVsmfPduSessionUpdate(smContext *smf_context.SMContext, request smf_context.VsmfUpdateRequest) error {
+	if !smContext.IsHsmf() || smContext.Vsmf.VsmfPduSessionUri == "" {
+		return fmt.Errorf("V-SMF PDU session uri unknown")
+	}
+
+	configuration := Nsmf_PDUSession.NewConfiguration()
+	headerParams := map[string]string{
+		"Content-Type": "application/json",
+		"Accept":       "application/json",
+	}
+	var postBody interface{} = request.JsonData
+	if request.BinaryDataN1SmInfoToUe != nil {
+		headerParams["Content-Type"] = "multipart/related"
+		postBody = &request
+	}
+
+	uri := smContext.Vsmf.VsmfPduSessionUri + "/modify"
+	httpReq, err := openapi.PrepareRequest(context.Background(), configuration, uri, http.MethodPost,
+		postBody, headerParams, url.Values{}, url.Values{}, "", "", nil)
+	if err != nil {
+		return err
+	}
+
+	metrics.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionUpdate), "Out", "", "")
+	httpRsp, err := openapi.CallAPI(configuration, httpReq)
+	if err != nil || httpRsp == nil {
+		smContext.SubConsumerLog.Warnf("V-SMF PDU session update to [%v] failed, %v", uri, err)
+		metrics.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionUpdate), "In", "Failure", "")
+		return fmt.Errorf("V-SMF PDU session update failure")
+	}
+	defer func() {
+		if rspCloseErr := httpRsp.Body.Close(); rspCloseErr != nil {
+			smContext.SubConsumerLog.Errorf("V-SMF PDU session update response body cannot close: %+v", rspCloseErr)
+		}
+	}()
+
+	metrics.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionUpdate), "In", http.StatusText(httpRsp.StatusCode), "")
+	if httpRsp.StatusCode != http.StatusOK && httpRsp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("V-SMF PDU session update failure, [%v]", http.StatusText(httpRsp.StatusCode))
+	}
+
+	smContext.SubConsumerLog.Infof("V-SMF PDU session update [%v] sent", request.JsonData.RequestIndication)
+	return nil
+}
+
+//SendHsmfPduSessionCreate creates home-routed PDU session at H-SMF, returns created data and
+//N1 SM info to UE. N1 SM info is also returned if H-SMF rejects with it
+func SendHsmfPduSessionCreate(smContext *smf_context.SMContext, createData *models.PduSessionCreateData,
+	n1SmInfoFromUe []byte) (*models.PduSessionCreatedData, []byte, error) {
+	//Generated client can't encode N1 of models.PostPduSessionsRequest
+	configuration := Nsmf_PDUSession.NewConfiguration()
+	configuration.SetBasePath(smContext.Hsmf.ApiRoot)
+	headerParams := map[string]string{
+		"Content-Type": "multipart/related",
+		"Accept":       "application/json",
+	}
+	request := &smf_context.PduSessionCreateRequest{
+		JsonData:                 createData,
+		BinaryDataN1SmInfoFromUe: n1SmInfoFromUe,
+	}
+
+	httpReq, err := openapi.PrepareRequest(context.Background(), configuration,
+		configuration.BasePath()+"/pdu-sessions", http.MethodPost,
+		request, headerParams, url.Values{}, url.Values{}, "", "", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metrics.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionCreate), "Out", "", "")
+	httpRsp, err := openapi.CallAPI(configuration, httpReq)
+	if err != nil || httpRsp == nil {
+		smContext.SubConsumerLog.Warnf("H-SMF PDU session create failed, %v", err)
+		metrics.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionCreate), "In", "Failure", "NoResponse")
+		return nil, nil, fmt.Errorf("H-SMF PDU session create failure")
+	}
+	defer func() {
+		if rspCloseErr := httpRsp.Body.Close(); rspCloseErr != nil {
+			smContext.SubConsumerLog.Errorf("H-SMF PDU session create response body cannot close: %+v", rspCloseErr)
+		}
+	}()
+	body, err := ioutil.ReadAll(httpRsp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metrics.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionCreate), "In", http.StatusText(httpRsp.StatusCode), "")
+	contentType := httpRsp.Header.Get("Content-Type")
+	if httpRsp.StatusCode != http.StatusCreated {
+		var errRsp models.PostPduSessionsErrorResponse
+		if openapi.KindOfMediaType(contentType) == openapi.MediaKindMultipartRelated {
+			if err := openapi.Deserialize(&errRsp, body, contentType); err != nil {
+				smContext.SubConsumerLog.Warnf("H-SMF PDU session create error response decode failed, %v", err)
+			}
+		}
+		return nil, errRsp.BinaryDataN1SmInfoToUe,
+			fmt.Errorf("H-SMF PDU session create failure, [%v]", http.StatusText(httpRsp.StatusCode))
+	}
+
+	var rsp models.PostPduSessionsResponse
+	if openapi.KindOfMediaType(contentType) == openapi.MediaKindMultipartRelated {
+		err = openapi.Deserialize(&rsp, body, contentType)
+	} else {
+		rsp.JsonData = new(models.PduSessionCreatedData)
+		err = openapi.Deserialize(rsp.JsonData, body, contentType)
+	}
+	if err != nil || rsp.JsonData == nil {
+		return nil, nil, fmt.Errorf("H-SMF PDU session created data missing, %v", err)
+	}
+	smContext.Hsmf.PduSessionUri = httpRsp.Header.Get("Location")
+	if smContext.Hsmf.PduSessionUri == "" {
+		return nil, nil, fmt.Errorf("H-SMF PDU session location missing")
+	}
+
+	smContext.SubConsumerLog.Infof("H-SMF PDU session [%v] created", smContext.Hsmf.PduSessionUri)
+	return rsp.JsonData, rsp.BinaryDataN1SmInfoToUe, nil
+}
+
+//SendHsmfPduSessionUpdate sends V-SMF initiated Update of home-routed PDU session to H-SMF,
+//returns N1 SM info to UE if any
+func SendHsmfPduSessionUpdate(smContext *smf_context.SMContext, updateData *models.HsmfUpdateData,
+	n1SmInfoFromUe []byte) ([]byte, error) {
+	request := models.UpdatePduSessionRequest{JsonData: updateData}
+	if n1SmInfoFromUe != nil {
+		updateData.N1SmInfoFromUe = &models.RefToBinaryData{ContentId: smf_context.N1SmInfoFromUe}
+		request.BinaryDataN1SmInfoFromUe = n1SmInfoFromUe
+	}
+
+	metrics.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionUpdate), "Out", "", "")
+	rsp, httpRsp, err := smContext.Hsmf.Client.IndividualPDUSessionHSMFApi.
+		UpdatePduSession(context.Background(), smContext.HsmfPduSessionRef(), request)
+	if err != nil {
+		var n1SmInfoToUe []byte
+		if apiErr, ok := err.(openapi.GenericOpenAPIError); ok {
+			if errRsp, ok := apiErr.Model().(models.UpdatePduSessionErrorResponse); ok {
+				n1SmInfoToUe = errRsp.BinaryDataN1SmInfoToUe
+			}
+		}
+		if httpRsp != nil {
+			metrics.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionUpdate), "In", http.StatusText(httpRsp.StatusCode), err.Error())
+		} else {
+			metrics.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionUpdate), "In", "Failure", "NoResponse")
+		}
+		smContext.SubConsumerLog.Warnf("H-SMF PDU session update failed, %v", err)
+		return n1SmInfoToUe, fmt.Errorf("H-SMF PDU session update failure, %v", err)
+	}
+
+	metrics.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionUpdate), "In", http.StatusText(httpRsp.StatusCode), "")
+	smContext.SubConsumerLog.Infof("H-SMF PDU session update [%v] sent", updateData.RequestIndication)
+	return rsp.BinaryDataN1SmInfoToUe, nil
+}
+
+//SendHsmfPduSessionRelease releases home-routed PDU session at H-SMF
+func SendHsmfPduSessionRelease(smContext *smf_context.SMContext, releaseData *models.ReleaseData) error {
+	var optionals *Nsmf_PDUSession.ReleasePduSessionParamOpts
+	if releaseData != nil {
+		optionals = &Nsmf_PDUSession.ReleasePduSessionParamOpts{
+			ReleaseData: optional.NewInterface(*releaseData),
+		}
+	}
+
+	metrics.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionRelease), "Out", "", "")
+	httpRsp, err := smContext.Hsmf.Client.IndividualPDUSessionHSMFApi.
+		ReleasePduSession(context.Background(), smContext.HsmfPduSessionRef(), optionals)
+	if err != nil {
+		if httpRsp != nil {
+			metrics.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionRelease), "In", http.StatusText(httpRsp.StatusCode), err.Error())
+		} else {
+			metrics.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionRelease), "In", "Failure", "NoResponse")
+		}
+		smContext.SubConsumerLog.Warnf("H-SMF PDU session release failed, %v", err)
+		return fmt.Errorf("H-SMF PDU session release failure, %v", err)
+	}
+
+	metrics.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionRelease), "In", http.StatusText(httpRsp.StatusCode), "")
+	smContext.Hsmf.Released = true
+	smContext.SubConsumerLog.Infof("H-SMF PDU session released")
+	return nil
+}
@@ -0,0 +1,157 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package consumer_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/http2_util"
+	"github.com/free5gc/openapi"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/consumer"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+)
+
+var (
+	n1FromUe = []byte{0x2e, 0x05, 0x01, 0xc1}
+	n1ToUe   = []byte{0x2e, 0x05, 0x01, 0xc2}
+)
+
+//stubHsmf answers Nsmf_PDUSession Create/Update/Release as H-SMF,
+//Create for SUPI imsi-reject is rejected with N1 SM info
+func stubHsmf(t *testing.T) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	group := router.Group("/nsmf-pdusession/v1")
+	var server *httptest.Server
+
+	group.POST("/pdu-sessions", func(c *gin.Context) {
+		var request context.PduSessionCreateRequest
+		if err := c.ShouldBindWith(&request, openapi.MultipartRelatedBinding{}); err != nil {
+			c.JSON(http.StatusBadRequest, models.ProblemDetails{Status: http.StatusBadRequest, Detail: err.Error()})
+			return
+		}
+		require.Equal(t, n1FromUe, request.BinaryDataN1SmInfoFromUe)
+
+		if request.JsonData.Supi == "imsi-reject" {
+			c.Render(http.StatusForbidden, openapi.MultipartRelatedRender{Data: models.PostPduSessionsErrorResponse{
+				JsonData: &models.PduSessionCreateError{
+					Error:        &models.ProblemDetails{Status: http.StatusForbidden, Cause: "REQUEST_REJECTED"},
+					N1SmInfoToUe: &models.RefToBinaryData{ContentId: context.N1SmInfoToUe},
+				},
+				BinaryDataN1SmInfoToUe: n1ToUe,
+			}})
+			return
+		}
+
+		c.Header("Location", server.URL+"/nsmf-pdusession/v1/pdu-sessions/hsmf-ref-1")
+		c.Render(http.StatusCreated, openapi.MultipartRelatedRender{Data: models.PostPduSessionsResponse{
+			JsonData: &models.PduSessionCreatedData{
+				PduSessionType: models.PduSessionType_IPV4,
+				SscMode:        context.DefaultSscMode,
+				HcnTunnelInfo:  &models.TunnelInfo{Ipv4Addr: "10.200.200.101", GtpTeid: "00000001"},
+				SessionAmbr:    &models.Ambr{Uplink: "1 Gbps", Downlink: "1 Gbps"},
+				QosFlowsSetupList: []models.QosFlowSetupItem{
+					{Qfi: 9},
+				},
+				HSmfInstanceId: "hsmf-instance",
+				UeIpv4Address:  "10.60.0.1",
+				N1SmInfoToUe:   &models.RefToBinaryData{ContentId: context.N1SmInfoToUe},
+			},
+			BinaryDataN1SmInfoToUe: n1ToUe,
+		}})
+	})
+
+	group.POST("/pdu-sessions/:pduSessionRef/modify", func(c *gin.Context) {
+		var request models.UpdatePduSessionRequest
+		if err := c.ShouldBindWith(&request, openapi.MultipartRelatedBinding{}); err != nil {
+			c.JSON(http.StatusBadRequest, models.ProblemDetails{Status: http.StatusBadRequest, Detail: err.Error()})
+			return
+		}
+		require.Equal(t, "hsmf-ref-1", c.Param("pduSessionRef"))
+		require.Equal(t, models.RequestIndication_UE_REQ_PDU_SES_REL, request.JsonData.RequestIndication)
+		require.Equal(t, n1FromUe, request.BinaryDataN1SmInfoFromUe)
+
+		c.Render(http.StatusOK, openapi.MultipartRelatedRender{Data: models.UpdatePduSessionResponse{
+			JsonData: &models.HsmfUpdatedData{
+				N1SmInfoToUe: &models.RefToBinaryData{ContentId: context.N1SmInfoToUe},
+			},
+			BinaryDataN1SmInfoToUe: n1ToUe,
+		}})
+	})
+
+	group.POST("/pdu-sessions/:pduSessionRef/release", func(c *gin.Context) {
+		require.Equal(t, "hsmf-ref-1", c.Param("pduSessionRef"))
+		c.Status(http.StatusNoContent)
+	})
+
+	server = startStubServer(t, router)
+	return server
+}
+
+//startStubServer serves stub NF over HTTP/2 cleartext used by openapi clients
+func startStubServer(t *testing.T, router *gin.Engine) *httptest.Server {
+	h2Server, err := http2_util.NewServer("", "", router)
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(router)
+	server.Config = h2Server
+	server.Start()
+	return server
+}
+
+func TestHsmfPduSession(t *testing.T) {
+	server := stubHsmf(t)
+	defer server.Close()
+
+	smContext := smctxtest.NewSMContext(t, "imsi-3102600007487", 10)
+	smContext.SetHsmf("", server.URL+"/nsmf-pdusession/v1")
+	require.True(t, smContext.IsVsmf())
+
+	createData := &models.PduSessionCreateData{
+		Supi:           "imsi-3102600007487",
+		PduSessionId:   10,
+		Dnn:            "internet",
+		N1SmInfoFromUe: &models.RefToBinaryData{ContentId: context.N1SmInfoFromUe},
+	}
+	createdData, n1, err := consumer.SendHsmfPduSessionCreate(smContext, createData, n1FromUe)
+	require.NoError(t, err)
+	require.Equal(t, n1ToUe, n1)
+	require.Equal(t, "10.60.0.1", createdData.UeIpv4Address)
+	require.Equal(t, "hsmf-ref-1", smContext.HsmfPduSessionRef())
+
+	n1, err = consumer.SendHsmfPduSessionUpdate(smContext, &models.HsmfUpdateData{
+		RequestIndication: models.RequestIndication_UE_REQ_PDU_SES_REL,
+	}, n1FromUe)
+	require.NoError(t, err)
+	require.Equal(t, n1ToUe, n1)
+
+	require.NoError(t, consumer.SendHsmfPduSessionRelease(smContext, &models.ReleaseData{}))
+	require.True(t, smContext.Hsmf.Released)
+}
+
+func TestHsmfPduSessionCreateReject(t *testing.T) {
+	server := stubHsmf(t)
+	defer server.Close()
+
+	smContext := smctxtest.NewSMContext(t, "imsi-reject", 11)
+	smContext.SetHsmf("", server.URL+"/nsmf-pdusession/v1")
+
+	createData := &models.PduSessionCreateData{
+		Supi:           "imsi-reject",
+		PduSessionId:   11,
+		N1SmInfoFromUe: &models.RefToBinaryData{ContentId: context.N1SmInfoFromUe},
+	}
+	createdData, n1, err := consumer.SendHsmfPduSessionCreate(smContext, createData, n1FromUe)
+	require.Error(t, err)
+	require.Nil(t, createdData)
+	require.Equal(t, n1ToUe, n1)
+	require.Empty(t, smContext.Hsmf.PduSessionUri)
+}
@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/antihax/optional"
+
+	"github.com/free5gc/openapi"
+	"github.com/free5gc/openapi/Nudm_SubscriberDataManagement"
+	"github.com/free5gc/openapi/models"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/metrics"
+	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
+)
+
+//SendSdmSubscription subscribes to changes of SM subscription data of PDU session's DNN and S-NSSAI at UDM
+func SendSdmSubscription(smContext *smf_context.SMContext) error {
+	self := smf_context.SMF_Self()
+	client := self.SubscriberDataManagementClient
+	if client == nil {
+		return fmt.Errorf("UDM SDM service not found")
+	}
+
+	subscription := models.SdmSubscription{
+		NfInstanceId: self.NfInstanceID,
+		CallbackReference: fmt.Sprintf("%s://%s:%d/nsmf-callback/sdm-notify/%s",
+			self.URIScheme, self.RegisterIPv4, self.SBIPort, smContext.Ref),
+		MonitoredResourceUris: []string{smContext.Supi + "/sm-data"},
+		SingleNssai:           smContext.Snssai,
+		Dnn:                   smContext.Dnn,
+		PlmnId:                smContext.ServingNetwork,
+	}
+
+	metrics.IncrementSvcUdmMsgStats(self.NfInstanceID, string(svcmsgtypes.SdmSubscribe), "Out", "", "")
+	rsp, httpRsp, err := client.SubscriptionCreationApi.Subscribe(context.Background(), smContext.Supi, subscription)
+	if err != nil {
+		if httpRsp != nil {
+			metrics.IncrementSvcUdmMsgStats(self.NfInstanceID, string(svcmsgtypes.SdmSubscribe), "In", http.StatusText(httpRsp.StatusCode), err.Error())
+		} else {
+			metrics.IncrementSvcUdmMsgStats(self.NfInstanceID, string(svcmsgtypes.SdmSubscribe), "In", "Failure", "NoResponse")
+		}
+		smContext.SubConsumerLog.Warnf("UDM SDM subscription failed, %v", err)
+		return fmt.Errorf("UDM SDM subscription failure, %v", err)
+	}
+
+	metrics.IncrementSvcUdmMsgStats(self.NfInstanceID, string(svcmsgtypes.SdmSubscribe), "In", http.StatusText(httpRsp.StatusCode), "")
+	//Subscription id is last segment of Location if body lacks it
+	smContext.SdmSubscriptionId = rsp.SubscriptionId
+	if smContext.SdmSubscriptionId == "" {
+		if location := httpRsp.Header.Get("Location"); location != "" {
+			smContext.SdmSubscriptionId = path.Base(location)
+		}
+	}
+	if smContext.SdmSubscriptionId == "" {
+		return fmt.Errorf("UDM SDM subscription id missing")
+	}
+
+	smContext.SubConsumerLog.Infof("UDM SDM subscription [%v] created", smContext.SdmSubscriptionId)
+	return nil
+}
+
+//SendSdmUnsubscription removes SM subscription data change subscription of PDU session at UDM
+func SendSdmUnsubscription(smContext *smf_context.SMContext) error {
+	self := smf_context.SMF_Self()
+	client := self.SubscriberDataManagementClient
+	if smContext.SdmSubscriptionId == "" || client == nil {
+		return nil
+	}
+	subscriptionId := smContext.SdmSubscriptionId
+	smContext.SdmSubscriptionId = ""
+
+	metrics.IncrementSvcUdmMsgStats(self.NfInstanceID, string(svcmsgtypes.SdmUnsubscribe), "Out", "", "")
+	httpRsp, err := client.SubscriptionDeletionApi.Unsubscribe(context.Background(), smContext.Supi, subscriptionId)
+	if err != nil {
+		if httpRsp != nil {
+			metrics.IncrementSvcUdmMsgStats(self.NfInstanceID, string(svcmsgtypes.SdmUnsubscribe), "In", http.StatusText(httpRsp.StatusCode), err.Error())
+		} else {
+			metrics.IncrementSvcUdmMsgStats(self.NfInstanceID, string(svcmsgtypes.SdmUnsubscribe), "In", "Failure", "NoResponse")
+		}
+		smContext.SubConsumerLog.Warnf("UDM SDM unsubscription failed, %v", err)
+		return fmt.Errorf("UDM SDM unsubscription failure, %v", err)
+	}
+
+	metrics.IncrementSvcUdmMsgStats(self.NfInstanceID, string(svcmsgtypes.SdmUnsubscribe), "In", http.StatusText(httpRsp.StatusCode), "")
+	smContext.SubConsumerLog.Infof("UDM SDM subscription [%v] removed", subscriptionId)
+	return nil
+}
+
+//SendSmDataRetrieval fetches current DNN configuration of PDU session from UDM,
+//nil configuration means DNN is no longer subscribed
+func SendSmDataRetrieval(smContext *smf_context.SMContext) (*models.DnnConfiguration, error) {
+	self := smf_context.SMF_Self()
+	client := self.SubscriberDataManagementClient
+	if client == nil {
+		return nil, fmt.Errorf("UDM SDM service not found")
+	}
+
+	smDataParams := &Nudm_SubscriberDataManagement.GetSmDataParamOpts{
+		Dnn:         optional.NewString(smContext.Dnn),
+		SingleNssai: optional.NewInterface(openapi.MarshToJsonString(smContext.Snssai)),
+	}
+	if smContext.ServingNetwork != nil {
+		smDataParams.PlmnId = optional.NewInterface(smContext.ServingNetwork.Mcc + smContext.ServingNetwork.Mnc)
+	}
+
+	metrics.IncrementSvcUdmMsgStats(self.NfInstanceID, string(svcmsgtypes.SmSubscriptionDataRetrieval), "Out", "", "")
+	sessSubData, httpRsp, err := client.SessionManagementSubscriptionDataRetrievalApi.
+		GetSmData(context.Background(), smContext.Supi, smDataParams)
+	if err != nil {
+		if httpRsp != nil {
+			metrics.IncrementSvcUdmMsgStats(self.NfInstanceID, string(svcmsgtypes.SmSubscriptionDataRetrieval), "In", http.StatusText(httpRsp.StatusCode), err.Error())
+			//Subscription data gone altogether
+			if httpRsp.StatusCode == http.StatusNotFound {
+				return nil, nil
+			}
+		} else {
+			metrics.IncrementSvcUdmMsgStats(self.NfInstanceID, string(svcmsgtypes.SmSubscriptionDataRetrieval), "In", "Failure", "NoResponse")
+		}
+		return nil, fmt.Errorf("SM subscription data retrieval failure, %v", err)
+	}
+
+	metrics.IncrementSvcUdmMsgStats(self.NfInstanceID, string(svcmsgtypes.SmSubscriptionDataRetrieval), "In", http.StatusText(httpRsp.StatusCode), "")
+	for _, subData := range sessSubData {
+		if dnnConfiguration, ok := subData.DnnConfigurations[smContext.Dnn]; ok {
+			return &dnnConfiguration, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package consumer_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/Nudm_SubscriberDataManagement"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/consumer"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+)
+
+func TestSdmSubscription(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	group := router.Group("/nudm-sdm/v1")
+	subscriptions := make(map[string]models.SdmSubscription)
+	dnnConfigurations := map[string]models.DnnConfiguration{
+		"internet": {SessionAmbr: &models.Ambr{Uplink: "100 Mbps", Downlink: "200 Mbps"}},
+	}
+	group.POST("/:supi/sdm-subscriptions", func(c *gin.Context) {
+		var subscription models.SdmSubscription
+		require.NoError(t, c.ShouldBindJSON(&subscription))
+		subscriptions["sub-1"] = subscription
+		c.Header("Location", "/nudm-sdm/v1/"+c.Param("supi")+"/sdm-subscriptions/sub-1")
+		c.JSON(http.StatusCreated, subscription)
+	})
+	group.DELETE("/:supi/sdm-subscriptions/:subscriptionId", func(c *gin.Context) {
+		delete(subscriptions, c.Param("subscriptionId"))
+		c.Status(http.StatusNoContent)
+	})
+	group.GET("/:supi/sm-data", func(c *gin.Context) {
+		require.Equal(t, "internet", c.Query("dnn"))
+		c.JSON(http.StatusOK, []models.SessionManagementSubscriptionData{
+			{SingleNssai: &models.Snssai{Sst: 1, Sd: "010203"}, DnnConfigurations: dnnConfigurations},
+		})
+	})
+	server := startStubServer(t, router)
+	defer server.Close()
+
+	self := context.SMF_Self()
+	defer func(client *Nudm_SubscriberDataManagement.APIClient) {
+		self.SubscriberDataManagementClient = client
+	}(self.SubscriberDataManagementClient)
+	configuration := Nudm_SubscriberDataManagement.NewConfiguration()
+	configuration.SetBasePath(server.URL)
+	self.SubscriberDataManagementClient = Nudm_SubscriberDataManagement.NewAPIClient(configuration)
+
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 6,
+		smctxtest.WithDnn("internet", &models.Snssai{Sst: 1, Sd: "010203"}))
+	smContext.ServingNetwork = &models.PlmnId{Mcc: "208", Mnc: "93"}
+
+	require.NoError(t, consumer.SendSdmSubscription(smContext))
+	require.Equal(t, "sub-1", smContext.SdmSubscriptionId)
+	subscription := subscriptions["sub-1"]
+	require.Equal(t, "internet", subscription.Dnn)
+	require.Equal(t, []string{"imsi-2089300007487/sm-data"}, subscription.MonitoredResourceUris)
+	require.True(t, strings.HasSuffix(subscription.CallbackReference, "/nsmf-callback/sdm-notify/"+smContext.Ref))
+
+	dnnConfiguration, err := consumer.SendSmDataRetrieval(smContext)
+	require.NoError(t, err)
+	require.Equal(t, "200 Mbps", dnnConfiguration.SessionAmbr.Downlink)
+
+	//DNN removed from subscription
+	delete(dnnConfigurations, "internet")
+	dnnConfiguration, err = consumer.SendSmDataRetrieval(smContext)
+	require.NoError(t, err)
+	require.Nil(t, dnnConfiguration)
+
+	require.NoError(t, consumer.SendSdmUnsubscription(smContext))
+	require.Empty(t, smContext.SdmSubscriptionId)
+	require.Empty(t, subscriptions)
+}
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/free5gc/openapi/models"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/metrics"
+	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
+)
+
+//SendUeContextManagementRegistration registers SMF as serving SMF of PDU session at UDM.
+//Caller records registration in SM context
+func SendUeContextManagementRegistration(smContext *smf_context.SMContext) error {
+	client := smf_context.SMF_Self().UEContextManagementClient
+	if client == nil {
+		return fmt.Errorf("UDM UECM service not found")
+	}
+
+	self := smf_context.SMF_Self()
+	registration := models.SmfRegistration{
+		SmfInstanceId: self.NfInstanceID,
+		PduSessionId:  smContext.PDUSessionID,
+		SingleNssai:   smContext.Snssai,
+		Dnn:           smContext.Dnn,
+		PlmnId:        smContext.ServingNetwork,
+	}
+
+	metrics.IncrementSvcUdmMsgStats(self.NfInstanceID, string(svcmsgtypes.SmfRegistration), "Out", "", "")
+	_, httpRsp, err := client.SMFRegistrationApi.SmfRegistrationsPduSessionId(context.Background(),
+		smContext.Supi, smContext.PDUSessionID, registration)
+	if err != nil {
+		if httpRsp != nil {
+			metrics.IncrementSvcUdmMsgStats(self.NfInstanceID, string(svcmsgtypes.SmfRegistration), "In", http.StatusText(httpRsp.StatusCode), err.Error())
+		} else {
+			metrics.IncrementSvcUdmMsgStats(self.NfInstanceID, string(svcmsgtypes.SmfRegistration), "In", "Failure", "NoResponse")
+		}
+		smContext.SubConsumerLog.Warnf("UDM SMF registration failed, %v", err)
+		return fmt.Errorf("UDM SMF registration failure, %v", err)
+	}
+
+	metrics.IncrementSvcUdmMsgStats(self.NfInstanceID, string(svcmsgtypes.SmfRegistration), "In", http.StatusText(httpRsp.StatusCode), "")
+	smContext.SubConsumerLog.Infof("UDM SMF registration success")
+	return nil
+}
+
+//SendUeContextManagementDeregistration removes SMF registration of PDU session at UDM
+func SendUeContextManagementDeregistration(smContext *smf_context.SMContext) error {
+	client := smf_context.SMF_Self().UEContextManagementClient
+	if client == nil {
+		return fmt.Errorf("UDM UECM service not found")
+	}
+
+	metrics.IncrementSvcUdmMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmfDeregistration), "Out", "", "")
+	httpRsp, err := client.SMFDeregistrationApi.Deregistration(context.Background(), smContext.Supi, smContext.PDUSessionID)
+	if err != nil {
+		if httpRsp != nil {
+			metrics.IncrementSvcUdmMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmfDeregistration), "In", http.StatusText(httpRsp.StatusCode), err.Error())
+		} else {
+			metrics.IncrementSvcUdmMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmfDeregistration), "In", "Failure", "NoResponse")
+		}
+		smContext.SubConsumerLog.Warnf("UDM SMF deregistration failed, %v", err)
+		return fmt.Errorf("UDM SMF deregistration failure, %v", err)
+	}
+
+	metrics.IncrementSvcUdmMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmfDeregistration), "In", http.StatusText(httpRsp.StatusCode), "")
+	smContext.SubConsumerLog.Infof("UDM SMF deregistration success")
+	return nil
+}
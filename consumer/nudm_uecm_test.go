@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package consumer_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/Nudm_UEContextManagement"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/consumer"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+)
+
+func TestUeContextManagementRegistration(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	registrations := make(map[string]map[string]interface{})
+	router.PUT("/nudm-uecm/v1/:ueId/registrations/smf-registrations/:pduSessionId", func(c *gin.Context) {
+		var registration map[string]interface{}
+		require.NoError(t, c.ShouldBindJSON(&registration))
+		registrations[c.Param("ueId")+"/"+c.Param("pduSessionId")] = registration
+		c.JSON(http.StatusCreated, registration)
+	})
+	router.DELETE("/nudm-uecm/v1/:ueId/registrations/smf-registrations/:pduSessionId", func(c *gin.Context) {
+		delete(registrations, c.Param("ueId")+"/"+c.Param("pduSessionId"))
+		c.Status(http.StatusNoContent)
+	})
+	server := startStubServer(t, router)
+	defer server.Close()
+
+	self := context.SMF_Self()
+	defer func(client *Nudm_UEContextManagement.APIClient) {
+		self.UEContextManagementClient = client
+	}(self.UEContextManagementClient)
+	configuration := Nudm_UEContextManagement.NewConfiguration()
+	configuration.SetBasePath(server.URL)
+	self.UEContextManagementClient = Nudm_UEContextManagement.NewAPIClient(configuration)
+
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 5,
+		smctxtest.WithDnn("internet", &models.Snssai{Sst: 1, Sd: "010203"}))
+	smContext.ServingNetwork = &models.PlmnId{Mcc: "208", Mnc: "93"}
+
+	require.NoError(t, consumer.SendUeContextManagementRegistration(smContext))
+	registration := registrations["imsi-2089300007487/5"]
+	require.NotNil(t, registration)
+	require.Equal(t, "internet", registration["dnn"])
+	require.Equal(t, float64(5), registration["pduSessionId"])
+
+	require.NoError(t, consumer.SendUeContextManagementDeregistration(smContext))
+	require.Empty(t, registrations)
+
+	//UECM service of UDM not discovered
+	self.UEContextManagementClient = nil
+	require.Error(t, consumer.SendUeContextManagementRegistration(smContext))
+}
@@ -16,6 +16,8 @@ import (
 	"github.com/free5gc/openapi/models"
 	smf_context "github.com/free5gc/smf/context"
 	"github.com/free5gc/smf/logger"
+	"github.com/free5gc/smf/metrics"
+	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
 )
 
 // SendSMPolicyAssociationCreate create the session management association to the PCF
@@ -68,8 +70,85 @@ func SendSMPolicyAssociationCreate(smContext *smf_context.SMContext) (*models.Sm
 	return smPolicyDecision, httpRspStatusCode, nil
 }
 
-func SendSMPolicyAssociationModify(smContext *smf_context.SMContext) {
-	//TODO
+// SendSMPolicyAssociationModify reports fired policy control request triggers to the PCF,
+// triggers PCF hasn't armed are dropped and nil decision is returned if none is left.
+// Trigger specific reports (QoS notification, usage, UE resource request) come filled by caller
+func SendSMPolicyAssociationModify(smContext *smf_context.SMContext,
+	updateData models.SmPolicyUpdateContextData) (*models.SmPolicyDecision, int, error) {
+	triggers := make([]models.PolicyControlRequestTrigger, 0, len(updateData.RepPolicyCtrlReqTriggers))
+	for _, trigger := range updateData.RepPolicyCtrlReqTriggers {
+		if smContext.SmPolicyData.IsPolicyCtrlReqTriggerArmed(trigger) {
+			triggers = append(triggers, trigger)
+		}
+	}
+	if len(triggers) == 0 {
+		return nil, http.StatusOK, nil
+	}
+	updateData.RepPolicyCtrlReqTriggers = triggers
+
+	//Current values of changed session parameters
+	for _, trigger := range triggers {
+		switch trigger {
+		case models.PolicyControlRequestTrigger_UE_IP_CH:
+			if smContext.PDUAddress != nil {
+				updateData.Ipv4Address = smContext.PDUAddress.To4().String()
+			}
+		case models.PolicyControlRequestTrigger_SAREA_CH:
+			updateData.UserLocationInfo = smContext.UeLocation
+		case models.PolicyControlRequestTrigger_UE_TZ_CH:
+			updateData.UeTimeZone = smContext.UeTimeZone
+		case models.PolicyControlRequestTrigger_PLMN_CH:
+			if smContext.ServingNetwork != nil {
+				updateData.ServingNetwork = &models.NetworkId{
+					Mcc: smContext.ServingNetwork.Mcc,
+					Mnc: smContext.ServingNetwork.Mnc,
+				}
+			}
+		case models.PolicyControlRequestTrigger_RAT_TY_CH:
+			updateData.RatType = smContext.RatType
+		case models.PolicyControlRequestTrigger_AC_TY_CH:
+			updateData.AccessType = smContext.AnType
+		}
+	}
+
+	metrics.IncrementSvcPcfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmPolicyAssociationUpdate), "Out", "", "")
+	smPolicyDecision, httpStatus, err := SendSMPolicyAssociationUpdate(smContext, updateData)
+	if err != nil {
+		metrics.IncrementSvcPcfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmPolicyAssociationUpdate), "In", http.StatusText(httpStatus), err.Error())
+		return nil, httpStatus, err
+	}
+	metrics.IncrementSvcPcfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmPolicyAssociationUpdate), "In", http.StatusText(httpStatus), "")
+
+	smContext.SubConsumerLog.Infof("SM policy update sent, triggers %v", triggers)
+	return smPolicyDecision, httpStatus, nil
+}
+
+// SendSMPolicyAssociationUpdate reports policy control request triggers to the PCF and returns updated decision
+func SendSMPolicyAssociationUpdate(smContext *smf_context.SMContext,
+	updateData models.SmPolicyUpdateContextData) (*models.SmPolicyDecision, int, error) {
+	httpRspStatusCode := http.StatusInternalServerError
+	if smContext.SMPolicyClient == nil {
+		return nil, httpRspStatusCode, errors.Errorf("smContext not selected PCF")
+	}
+
+	//Policy Id (supi-pduSessId)
+	smPolicyID := fmt.Sprintf("%s-%d", smContext.Supi, smContext.PDUSessionID)
+
+	smPolicyDecision, httpRsp, err := smContext.SMPolicyClient.
+		DefaultApi.SmPoliciesSmPolicyIdUpdatePost(context.Background(), smPolicyID, updateData)
+	if err != nil {
+		if httpRsp != nil {
+			httpRspStatusCode = httpRsp.StatusCode
+		}
+		return nil, httpRspStatusCode, fmt.Errorf("update sm policy association failed: %s", err.Error())
+	}
+	httpRspStatusCode = httpRsp.StatusCode
+
+	if err := validateSmPolicyDecision(&smPolicyDecision); err != nil {
+		return nil, httpRspStatusCode, fmt.Errorf("update sm policy association failed: %s", err.Error())
+	}
+
+	return &smPolicyDecision, httpRspStatusCode, nil
 }
 
 func SendSMPolicyAssociationDelete(smContext *smf_context.SMContext, smDelReq *models.ReleaseSmContextRequest) (int, error) {
@@ -103,8 +182,8 @@ func SendSMPolicyAssociationDelete(smContext *smf_context.SMContext, smDelReq *m
 	//MM cause
 	ranNasRelCause.Var5gMmCause = smDelReq.JsonData.Var5gMmCauseValue
 
-	//SM Cause ?
-	//ranNasRelCause.Var5gSmCause =
+	//SM Cause, network requested release
+	ranNasRelCause.Var5gSmCause = int32(smContext.ReleaseCause5gSMValue)
 
 	smPolicyDelData.RanNasRelCauses = []models.RanNasRelCause{ranNasRelCause}
 
@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package consumer_test
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/Npcf_SMPolicyControl"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/consumer"
+	"github.com/free5gc/smf/context/smctxtest"
+)
+
+func TestSMPolicyAssociationModify(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	var updates []models.SmPolicyUpdateContextData
+	router.POST("/npcf-smpolicycontrol/v1/sm-policies/:smPolicyId/update", func(c *gin.Context) {
+		require.Equal(t, "imsi-2089300007487-7", c.Param("smPolicyId"))
+		var updateData models.SmPolicyUpdateContextData
+		require.NoError(t, c.ShouldBindJSON(&updateData))
+		updates = append(updates, updateData)
+		c.JSON(http.StatusOK, models.SmPolicyDecision{
+			SessRules: map[string]*models.SessionRule{
+				"SessRuleId-7": {
+					SessRuleId:   "SessRuleId-7",
+					AuthSessAmbr: &models.Ambr{Uplink: "50 Mbps", Downlink: "50 Mbps"},
+					AuthDefQos:   &models.AuthorizedDefaultQos{Var5qi: 9},
+				},
+			},
+		})
+	})
+	server := startStubServer(t, router)
+	defer server.Close()
+
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 7)
+	//Address isn't from a UE IP pool
+	t.Cleanup(func() { smContext.PDUAddress = nil })
+	smContext.PDUAddress = net.ParseIP("10.60.0.7")
+	smContext.RatType = models.RatType_EUTRA
+	configuration := Npcf_SMPolicyControl.NewConfiguration()
+	configuration.SetBasePath(server.URL)
+	smContext.SMPolicyClient = Npcf_SMPolicyControl.NewAPIClient(configuration)
+
+	//PCF hasn't armed any trigger
+	updateData := models.SmPolicyUpdateContextData{
+		RepPolicyCtrlReqTriggers: []models.PolicyControlRequestTrigger{
+			models.PolicyControlRequestTrigger_UE_IP_CH,
+			models.PolicyControlRequestTrigger_RAT_TY_CH,
+		},
+		RelIpv4Address: "10.60.0.1",
+	}
+	smPolicyDecision, _, err := consumer.SendSMPolicyAssociationModify(smContext, updateData)
+	require.NoError(t, err)
+	require.Nil(t, smPolicyDecision)
+	require.Empty(t, updates)
+
+	smContext.SmPolicyData.PolicyCtrlReqTriggers = []models.PolicyControlRequestTrigger{
+		models.PolicyControlRequestTrigger_UE_IP_CH,
+	}
+	smPolicyDecision, httpStatus, err := consumer.SendSMPolicyAssociationModify(smContext, updateData)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, httpStatus)
+	require.Equal(t, "50 Mbps", smPolicyDecision.SessRules["SessRuleId-7"].AuthSessAmbr.Uplink)
+
+	require.Len(t, updates, 1)
+	require.Equal(t, []models.PolicyControlRequestTrigger{models.PolicyControlRequestTrigger_UE_IP_CH},
+		updates[0].RepPolicyCtrlReqTriggers)
+	require.Equal(t, "10.60.0.7", updates[0].Ipv4Address)
+	require.Equal(t, "10.60.0.1", updates[0].RelIpv4Address)
+	//Unarmed trigger isn't reported
+	require.Empty(t, updates[0].RatType)
+}
@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"time"
+
+	"github.com/free5gc/nas/nasConvert"
+	"github.com/free5gc/nas/nasMessage"
+)
+
+//AnchorRelocationHandler runs anchor UPF relocation of SSC mode 3 session through SM context FSM
+type AnchorRelocationHandler func(smContext *SMContext)
+
+var anchorRelocationHandler AnchorRelocationHandler
+
+//RegisterAnchorRelocationHandler is called by SMF FSM at init
+func RegisterAnchorRelocationHandler(handler AnchorRelocationHandler) {
+	anchorRelocationHandler = handler
+}
+
+//RequestAnchorRelocation asks UE to move session to anchor UPF serving DNAI of its location, it
+//doesn't wait for UE to be asked
+func RequestAnchorRelocation(smContext *SMContext) {
+	if anchorRelocationHandler == nil {
+		smContext.SubCtxLog.Errorf("anchor UPF relocation, no handler registered")
+		return
+	}
+	anchorRelocationHandler(smContext)
+}
+
+//DefaultPduAddressLifetime is how long UE keeps PDU session of old anchor UPF, if DNN config has none
+const DefaultPduAddressLifetime = 60 * time.Second
+
+//AnchorRelocation is change of anchor UPF of SSC mode 3 PDU session(TS 23.502 4.3.5.2). UE is asked
+//to set up new PDU session to DNN, this one is released once PDU session address lifetime expires
+type AnchorRelocation struct {
+	TargetDnai string
+	Lifetime   time.Duration
+	//UE accepted PDU Session Modification Command
+	Acknowledged bool
+
+	timer *time.Timer
+}
+
+//UeDnai is DNAI serving tracking area of UE, empty if DNN has none for it
+func (smContext *SMContext) UeDnai() string {
+	if smContext.DNNInfo == nil {
+		return ""
+	}
+	tac := ueTac(smContext.UeLocation)
+	if tac == "" {
+		return ""
+	}
+	for _, area := range smContext.DNNInfo.Dnais {
+		for _, t := range area.Tacs {
+			if t == tac {
+				return area.Dnai
+			}
+		}
+	}
+	return ""
+}
+
+//SelectUPPath selects path to anchor UPF serving DNAI of UE location, default path of DNN if no
+//UPF serves it. DNAI of selected anchor is recorded
+func (smContext *SMContext) SelectUPPath(selection *UPFSelectionParams) UPPath {
+	upi := GetUserPlaneInformation()
+	if dnai := smContext.UeDnai(); dnai != "" {
+		dnaiSelection := *selection
+		dnaiSelection.Dnai = dnai
+		if path := upi.GetDefaultUserPlanePathByDNN(&dnaiSelection); len(path) > 0 {
+			smContext.Dnai = dnai
+			return path
+		}
+	}
+	smContext.Dnai = ""
+	return upi.GetDefaultUserPlanePathByDNN(selection)
+}
+
+//AnchorRelocationTarget is DNAI anchor UPF of SSC mode 3 session should move to for UE location,
+//empty if session stays with its anchor UPF
+func (smContext *SMContext) AnchorRelocationTarget() string {
+	if smContext.SscMode != SscMode3 || !smContext.AnchorRelocatable || smContext.AnchorRelocation != nil ||
+		smContext.SMContextState != SmStateActive || smContext.Tunnel == nil {
+		return ""
+	}
+	dnai := smContext.UeDnai()
+	if dnai == "" || dnai == smContext.Dnai {
+		return ""
+	}
+
+	path := GetUserPlaneInformation().GetDefaultUserPlanePathByDNN(&UPFSelectionParams{
+		Dnn: smContext.Dnn,
+		SNssai: &SNssai{
+			Sst: smContext.Snssai.Sst,
+			Sd:  smContext.Snssai.Sd,
+		},
+		Dnai: dnai,
+	})
+	if len(path) == 0 {
+		return ""
+	}
+	//Anchor UPF serves new DNAI as well
+	if dataPath := smContext.Tunnel.DataPathPool.GetDefaultPath(); dataPath != nil &&
+		anchorDPNode(dataPath).UPF == path[len(path)-1].UPF {
+		return ""
+	}
+	return dnai
+}
+
+//StartAnchorRelocation starts relocation of anchor UPF to DNAI, onExpire is run once PDU session
+//address lifetime expires. Caller holds SM context lock
+func (smContext *SMContext) StartAnchorRelocation(dnai string, onExpire func()) *AnchorRelocation {
+	lifetime := DefaultPduAddressLifetime
+	if smContext.DNNInfo != nil && smContext.DNNInfo.PduAddressLifetime > 0 {
+		lifetime = smContext.DNNInfo.PduAddressLifetime
+	}
+	relocation := &AnchorRelocation{
+		TargetDnai: dnai,
+		Lifetime:   lifetime,
+	}
+	relocation.timer = time.AfterFunc(lifetime, onExpire)
+	smContext.AnchorRelocation = relocation
+	smContext.SubPduSessLog.Infof("anchor UPF relocation to DNAI[%s] started, PDU session address lifetime [%v]",
+		dnai, lifetime)
+	return relocation
+}
+
+//StopAnchorRelocation drops relocation in progress, session stays with its anchor UPF.
+//Caller holds SM context lock
+func (smContext *SMContext) StopAnchorRelocation() {
+	if relocation := smContext.AnchorRelocation; relocation != nil {
+		relocation.timer.Stop()
+		smContext.AnchorRelocation = nil
+	}
+}
+
+//IsAnchorRelocationPending tells if UE hasn't answered Modification Command of relocation yet
+func (smContext *SMContext) IsAnchorRelocationPending() bool {
+	return smContext.AnchorRelocation != nil && !smContext.AnchorRelocation.Acknowledged
+}
+
+//pduAddressLifetimeEPCO is ePCO contents with PDU session address lifetime(TS 24.008 10.5.6.3)
+func pduAddressLifetimeEPCO(lifetime time.Duration) []byte {
+	pco := nasConvert.NewProtocolConfigurationOptions()
+	appendContainer(pco, nasMessage.PDUSessionAddressLifetimeDL,
+		[]byte{nasConvert.GPRSTimer3ToNas(int(lifetime.Seconds()))})
+	return pco.Marshal()
+}
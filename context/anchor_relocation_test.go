@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/nas"
+	"github.com/free5gc/nas/nasConvert"
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+	"github.com/free5gc/smf/factory"
+)
+
+//Central UPF is default anchor of DNN, edge UPF serves DNAI edge-1
+var relocationUPConfig = &factory.UserPlaneInformation{
+	UPNodes: map[string]factory.UPNode{
+		"GNodeB": {
+			Type:   "AN",
+			NodeID: "192.168.179.100",
+		},
+		"CentralUPF": {
+			Type:   "UPF",
+			NodeID: "192.168.179.1",
+			SNssaiInfos: []models.SnssaiUpfInfoItem{
+				{
+					SNssai:         &models.Snssai{Sst: 1, Sd: "010203"},
+					DnnUpfInfoList: []models.DnnUpfInfoItem{{Dnn: "enterprise"}},
+				},
+			},
+		},
+		"EdgeUPF": {
+			Type:   "UPF",
+			NodeID: "192.168.179.2",
+			SNssaiInfos: []models.SnssaiUpfInfoItem{
+				{
+					SNssai:         &models.Snssai{Sst: 1, Sd: "010203"},
+					DnnUpfInfoList: []models.DnnUpfInfoItem{{Dnn: "enterprise", DnaiList: []string{"edge-1"}}},
+				},
+			},
+		},
+	},
+	Links: []factory.UPLink{
+		{A: "GNodeB", B: "CentralUPF"},
+		{A: "GNodeB", B: "EdgeUPF"},
+	},
+}
+
+func TestAnchorRelocation(t *testing.T) {
+	upi := context.SMF_Self().UserPlaneInformation
+	context.SMF_Self().UserPlaneInformation = context.NewUserPlaneInformation(relocationUPConfig)
+	t.Cleanup(func() { context.SMF_Self().UserPlaneInformation = upi })
+
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 10,
+		smctxtest.WithDnn("enterprise", &models.Snssai{Sst: 1, Sd: "010203"}),
+		smctxtest.WithDnnInfo(&context.SnssaiSmfDnnInfo{
+			Dnais:              []factory.DnaiArea{{Dnai: "edge-1", Tacs: []string{"000002"}}},
+			PduAddressLifetime: 30 * time.Second,
+		}))
+	selection := &context.UPFSelectionParams{
+		Dnn:    smContext.Dnn,
+		SNssai: &context.SNssai{Sst: 1, Sd: "010203"},
+	}
+
+	//UE outside of edge, session anchored at central UPF
+	smContext.UeLocation = smctxtest.UeLocation("000001")
+	require.Empty(t, smContext.UeDnai())
+	path := smContext.SelectUPPath(selection)
+	require.Len(t, path, 1)
+	require.Equal(t, "192.168.179.1", path[0].NodeID.ResolveNodeIdToIp().String())
+	require.Empty(t, smContext.Dnai)
+
+	dataPath := context.GenerateDataPath(path, smContext)
+	dataPath.IsDefaultPath = true
+	smContext.Tunnel = context.NewUPTunnel()
+	smContext.Tunnel.AddDataPath(dataPath)
+	smContext.SMContextState = context.SmStateActive
+
+	//UE moved to edge, only SSC mode 3 session is relocated
+	smContext.UeLocation = smctxtest.UeLocation("000002")
+	require.Equal(t, "edge-1", smContext.UeDnai())
+	require.Empty(t, smContext.AnchorRelocationTarget())
+	smContext.SscMode, smContext.AnchorRelocatable = context.SscMode3, true
+	require.Equal(t, "edge-1", smContext.AnchorRelocationTarget())
+
+	expired := make(chan struct{}, 1)
+	relocation := smContext.StartAnchorRelocation("edge-1", func() { expired <- struct{}{} })
+	require.Equal(t, 30*time.Second, relocation.Lifetime)
+	require.True(t, smContext.IsAnchorRelocationPending())
+	require.Empty(t, smContext.AnchorRelocationTarget())
+
+	//Modification Command asks UE to reactivate within address lifetime
+	buf, err := context.BuildGSMPDUSessionModificationCommand(smContext)
+	require.Nil(t, err)
+	m := nas.NewMessage()
+	require.Nil(t, m.GsmMessageDecode(&buf))
+	command := m.PDUSessionModificationCommand
+	require.Equal(t, nasMessage.Cause5GSMReactivationRequested, command.Cause5GSM.GetCauseValue())
+	epco := nasConvert.NewProtocolConfigurationOptions()
+	require.Nil(t, epco.UnMarshal(command.ExtendedProtocolConfigurationOptions.GetExtendedProtocolConfigurationOptionsContents()))
+	require.Len(t, epco.ProtocolOrContainerList, 1)
+	require.Equal(t, nasMessage.PDUSessionAddressLifetimeDL, epco.ProtocolOrContainerList[0].ProtocolOrContainerID)
+	require.Equal(t, []byte{nasConvert.GPRSTimer3ToNas(30)}, epco.ProtocolOrContainerList[0].Contents)
+
+	//New session of UE is anchored at edge UPF
+	newSmContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 11,
+		smctxtest.WithDnnInfo(smContext.DNNInfo), smctxtest.WithUeLocation("000002"))
+	path = newSmContext.SelectUPPath(selection)
+	require.Len(t, path, 1)
+	require.Equal(t, "192.168.179.2", path[0].NodeID.ResolveNodeIdToIp().String())
+	require.Equal(t, "edge-1", newSmContext.Dnai)
+
+	smContext.StopAnchorRelocation()
+	require.Nil(t, smContext.AnchorRelocation)
+	require.False(t, smContext.IsAnchorRelocationPending())
+	select {
+	case <-expired:
+		t.Fatal("lifetime timer of stopped relocation expired")
+	default:
+	}
+}
@@ -7,6 +7,7 @@ package context
 
 import (
 	"net"
+	"time"
 
 	"github.com/free5gc/smf/factory"
 	"github.com/free5gc/smf/logger"
@@ -40,6 +41,7 @@ func (c *SMFContext) insertSmfNssaiInfo(snssaiInfoConfig *factory.SnssaiInfoItem
 		dnnInfo := SnssaiSmfDnnInfo{}
 		dnnInfo.DNS.IPv4Addr = net.ParseIP(dnnInfoConfig.DNS.IPv4Addr).To4()
 		dnnInfo.DNS.IPv6Addr = net.ParseIP(dnnInfoConfig.DNS.IPv6Addr).To4()
+		dnnInfo.DNS.IPv4SecondaryAddr = net.ParseIP(dnnInfoConfig.DNS.IPv4SecondaryAddr).To4()
 		if allocator, err := NewIPAllocator(dnnInfoConfig.UESubnet); err != nil {
 			logger.InitLog.Errorf("create ip allocator[%s] failed: %s", dnnInfoConfig.UESubnet, err)
 			continue
@@ -53,6 +55,21 @@ func (c *SMFContext) insertSmfNssaiInfo(snssaiInfoConfig *factory.SnssaiInfoItem
 			//Adding default MTU value, if nothing is set in config file.
 			dnnInfo.MTU = 1400
 		}
+		if dnnInfo.NonIPMTU = dnnInfoConfig.NonIPMTU; dnnInfo.NonIPMTU == 0 {
+			dnnInfo.NonIPMTU = dnnInfo.MTU
+		}
+		dnnInfo.PCSCF = NewPCSCFInfo(dnnInfoConfig.PCSCF)
+		dnnInfo.SecondaryAuth = newSecondaryAuthClient(dnnInfoConfig.SecondaryAuth)
+		if dnnInfoConfig.SecondaryAuth != nil {
+			dnnInfo.SecondaryAuthAmbr = dnnInfoConfig.SecondaryAuth.SessionAmbr
+		}
+		dnnInfo.AlwaysOn = dnnInfoConfig.AlwaysOn
+		dnnInfo.HomeRouted = dnnInfoConfig.HomeRouted
+		dnnInfo.Dnais = dnnInfoConfig.Dnais
+		if dnnInfo.PduAddressLifetime = time.Duration(dnnInfoConfig.PduAddressLifetime) * time.Second; dnnInfo.PduAddressLifetime == 0 {
+			dnnInfo.PduAddressLifetime = DefaultPduAddressLifetime
+		}
+		dnnInfo.Ladn = NewLadnInfo(dnnInfoConfig.Ladn)
 
 		snssaiInfo.DnnInfos[dnnInfoConfig.Dnn] = &dnnInfo
 	}
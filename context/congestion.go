@@ -0,0 +1,284 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/factory"
+)
+
+const DefaultBackOffTimer = 60 * time.Second
+
+//Reject causes congestion control sends back-off timer with, by scope of the timer:
+//DNN(T3396), S-NSSAI and DNN(T3584) or S-NSSAI(T3585), TS 24.501 6.2.7, 6.2.8
+const (
+	CongestionCauseDnn        = "DnnCongestion"
+	CongestionCauseSliceDnn   = "SliceDnnCongestion"
+	CongestionCauseSlice      = "SliceCongestion"
+	InsufficientResourceCause = "IpAllocError"
+	InsufficientResourceSlice = "InsufficientResourceSliceDnn"
+)
+
+type backOffScope uint8
+
+const (
+	backOffScopeDnn backOffScope = iota
+	backOffScopeSliceDnn
+	backOffScopeSlice
+)
+
+var backOffCauseScope = map[string]backOffScope{
+	CongestionCauseDnn:        backOffScopeDnn,
+	InsufficientResourceCause: backOffScopeDnn,
+	CongestionCauseSliceDnn:   backOffScopeSliceDnn,
+	InsufficientResourceSlice: backOffScopeSliceDnn,
+	CongestionCauseSlice:      backOffScopeSlice,
+}
+
+//CongestionRule admits sessions of S-NSSAI and/or DNN up to MaxSessions, rule without
+//S-NSSAI is DNN based and rule without DNN applies to all DNNs of S-NSSAI
+type CongestionRule struct {
+	Snssai       *models.Snssai
+	Dnn          string
+	MaxSessions  int
+	BackOffTimer time.Duration
+	//Set over OAM, sessions are rejected regardless of load
+	Active bool
+	//Sessions admitted under rule
+	sessions int
+}
+
+//backOff is back-off timer running at UE
+type backOff struct {
+	cause  string
+	expiry time.Time
+}
+
+//CongestionControl admits PDU sessions against rules and tracks back-off timers sent to UEs
+type CongestionControl struct {
+	lock         sync.Mutex
+	backOffTimer time.Duration
+	rules        []*CongestionRule
+	//Rules counting admitted session, by SM context ref
+	admitted map[string][]*CongestionRule
+	//By UE and scope of timer, expired ones are purged at most every back-off timer
+	backOffs  map[string]backOff
+	lastPurge time.Time
+}
+
+func initCongestionControl(config *factory.CongestionControl) {
+	smfContext.CongestionControl = NewCongestionControl(config)
+}
+
+//NewCongestionControl creates congestion control of configuration, nil configuration has no rules
+func NewCongestionControl(config *factory.CongestionControl) *CongestionControl {
+	cc := &CongestionControl{
+		backOffTimer: DefaultBackOffTimer,
+		admitted:     make(map[string][]*CongestionRule),
+		backOffs:     make(map[string]backOff),
+	}
+	if config == nil {
+		return cc
+	}
+
+	if config.BackOffTimer > 0 {
+		cc.backOffTimer = time.Duration(config.BackOffTimer) * time.Second
+	}
+	for _, rule := range config.Rules {
+		cc.rules = append(cc.rules, &CongestionRule{
+			Snssai:       rule.SNssai,
+			Dnn:          rule.Dnn,
+			MaxSessions:  rule.MaxSessions,
+			BackOffTimer: time.Duration(rule.BackOffTimer) * time.Second,
+		})
+	}
+	return cc
+}
+
+//Sessions returns number of sessions admitted under rule
+func (rule *CongestionRule) Sessions() int {
+	return rule.sessions
+}
+
+func (rule *CongestionRule) matches(snssai *models.Snssai, dnn string) bool {
+	if rule.Snssai != nil && (snssai == nil || rule.Snssai.Sst != snssai.Sst || rule.Snssai.Sd != snssai.Sd) {
+		return false
+	}
+	return rule.Dnn == "" || rule.Dnn == dnn
+}
+
+func (rule *CongestionRule) cause() string {
+	switch {
+	case rule.Snssai == nil:
+		return CongestionCauseDnn
+	case rule.Dnn == "":
+		return CongestionCauseSlice
+	default:
+		return CongestionCauseSliceDnn
+	}
+}
+
+func (rule *CongestionRule) sameScope(snssai *models.Snssai, dnn string) bool {
+	if (rule.Snssai == nil) != (snssai == nil) || rule.Dnn != dnn {
+		return false
+	}
+	return snssai == nil || (rule.Snssai.Sst == snssai.Sst && rule.Snssai.Sd == snssai.Sd)
+}
+
+func backOffKey(scope backOffScope, supi string, snssai *models.Snssai, dnn string) string {
+	var sst int32
+	var sd string
+	if snssai != nil {
+		sst, sd = snssai.Sst, snssai.Sd
+	}
+	switch scope {
+	case backOffScopeDnn:
+		return fmt.Sprintf("%s/%s", supi, dnn)
+	case backOffScopeSlice:
+		return fmt.Sprintf("%s/%d-%s", supi, sst, sd)
+	default:
+		return fmt.Sprintf("%s/%d-%s/%s", supi, sst, sd, dnn)
+	}
+}
+
+//Admit checks PDU session against back-off timers running at UE and congestion rules,
+//reject cause is returned if session isn't admitted
+func (cc *CongestionControl) Admit(smContext *SMContext) (string, bool) {
+	if cc == nil {
+		return "", true
+	}
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	//UE ignoring back-off timer
+	now := time.Now()
+	for scope := backOffScopeDnn; scope <= backOffScopeSlice; scope++ {
+		key := backOffKey(scope, smContext.Supi, smContext.Snssai, smContext.Dnn)
+		if b, ok := cc.backOffs[key]; ok {
+			if now.Before(b.expiry) {
+				return b.cause, false
+			}
+			delete(cc.backOffs, key)
+		}
+	}
+
+	for _, rule := range cc.rules {
+		if !rule.matches(smContext.Snssai, smContext.Dnn) {
+			continue
+		}
+		if rule.Active {
+			return rule.cause(), false
+		}
+		if rule.MaxSessions > 0 && rule.sessions >= rule.MaxSessions {
+			return rule.cause(), false
+		}
+	}
+
+	//Session counts till SM context is removed
+	var admitted []*CongestionRule
+	for _, rule := range cc.rules {
+		if rule.matches(smContext.Snssai, smContext.Dnn) {
+			rule.sessions++
+			admitted = append(admitted, rule)
+		}
+	}
+	cc.admitted[smContext.Ref] = admitted
+	return "", true
+}
+
+//Release stops counting session admitted, called on SM context removal
+func (cc *CongestionControl) Release(smContext *SMContext) {
+	if cc == nil {
+		return
+	}
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	for _, rule := range cc.admitted[smContext.Ref] {
+		rule.sessions--
+	}
+	delete(cc.admitted, smContext.Ref)
+}
+
+//StartBackOff returns back-off timer UE is rejected with for cause and tracks it, 0 if
+//cause carries none. Timer already running at UE is sent with time left
+func (cc *CongestionControl) StartBackOff(smContext *SMContext, cause string) time.Duration {
+	scope, ok := backOffCauseScope[cause]
+	if cc == nil || !ok {
+		return 0
+	}
+
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	now := time.Now()
+	key := backOffKey(scope, smContext.Supi, smContext.Snssai, smContext.Dnn)
+	if b, ok := cc.backOffs[key]; ok && now.Before(b.expiry) {
+		return b.expiry.Sub(now)
+	}
+
+	timer := cc.backOffTimer
+	for _, rule := range cc.rules {
+		if rule.BackOffTimer > 0 && rule.cause() == cause && rule.matches(smContext.Snssai, smContext.Dnn) {
+			timer = rule.BackOffTimer
+			break
+		}
+	}
+	cc.purgeBackOffs(now)
+	cc.backOffs[key] = backOff{cause: cause, expiry: now.Add(timer)}
+	return timer
+}
+
+//purgeBackOffs drops back-off timers expired at UEs not coming back, caller holds lock
+func (cc *CongestionControl) purgeBackOffs(now time.Time) {
+	if now.Sub(cc.lastPurge) < cc.backOffTimer {
+		return
+	}
+	cc.lastPurge = now
+	for key, b := range cc.backOffs {
+		if !now.Before(b.expiry) {
+			delete(cc.backOffs, key)
+		}
+	}
+}
+
+//Rules returns copy of congestion rules
+func (cc *CongestionControl) Rules() []CongestionRule {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	rules := make([]CongestionRule, 0, len(cc.rules))
+	for _, rule := range cc.rules {
+		rules = append(rules, *rule)
+	}
+	return rules
+}
+
+//Activate sets congestion of S-NSSAI and/or DNN on or off, rule is added if there is none
+//for the scope. Back-off timer of rule is updated if given
+func (cc *CongestionControl) Activate(snssai *models.Snssai, dnn string, active bool, backOffTimer time.Duration) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	var rule *CongestionRule
+	for _, r := range cc.rules {
+		if r.sameScope(snssai, dnn) {
+			rule = r
+			break
+		}
+	}
+	if rule == nil {
+		rule = &CongestionRule{Snssai: snssai, Dnn: dnn}
+		cc.rules = append(cc.rules, rule)
+	}
+	rule.Active = active
+	if backOffTimer > 0 {
+		rule.BackOffTimer = backOffTimer
+	}
+}
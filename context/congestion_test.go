@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+	"github.com/free5gc/smf/factory"
+)
+
+func TestCongestionControl(t *testing.T) {
+	snssai := &models.Snssai{Sst: 1, Sd: "010203"}
+	cc := context.NewCongestionControl(&factory.CongestionControl{
+		BackOffTimer: 30,
+		Rules: []factory.CongestionRule{
+			{Dnn: "internet", MaxSessions: 1, BackOffTimer: 120},
+		},
+	})
+
+	first := smctxtest.NewSMContext(t, "imsi-2089300007487", 10, smctxtest.WithDnn("internet", snssai))
+	cause, ok := cc.Admit(first)
+	require.True(t, ok, cause)
+
+	//DNN full, T3396 of rule
+	second := smctxtest.NewSMContext(t, "imsi-2089300007488", 10, smctxtest.WithDnn("internet", snssai))
+	cause, ok = cc.Admit(second)
+	require.False(t, ok)
+	require.Equal(t, context.CongestionCauseDnn, cause)
+	require.Equal(t, 120*time.Second, cc.StartBackOff(second, cause))
+
+	//UE retrying while back-off timer runs is rejected with time left
+	context.RemoveSMContext(first.Ref)
+	cc.Release(first)
+	cause, ok = cc.Admit(second)
+	require.False(t, ok)
+	require.Equal(t, context.CongestionCauseDnn, cause)
+	require.True(t, cc.StartBackOff(second, cause) <= 120*time.Second)
+
+	//Released session frees its place in DNN
+	other := smctxtest.NewSMContext(t, "imsi-2089300007491", 10, smctxtest.WithDnn("internet", snssai))
+	cause, ok = cc.Admit(other)
+	require.True(t, ok, cause)
+	cc.Release(other)
+
+	//Cause without back-off timer
+	require.Zero(t, cc.StartBackOff(second, "UPFDataPathError"))
+
+	//Slice congested over OAM, T3585 of default timer
+	cc.Activate(snssai, "", true, 0)
+	third := smctxtest.NewSMContext(t, "imsi-2089300007489", 10, smctxtest.WithDnn("ims", snssai))
+	cause, ok = cc.Admit(third)
+	require.False(t, ok)
+	require.Equal(t, context.CongestionCauseSlice, cause)
+	require.Equal(t, 30*time.Second, cc.StartBackOff(third, cause))
+	require.Len(t, cc.Rules(), 2)
+
+	//Deactivated, other UE is admitted
+	cc.Activate(snssai, "", false, 0)
+	fourth := smctxtest.NewSMContext(t, "imsi-2089300007490", 10, smctxtest.WithDnn("ims", snssai))
+	cause, ok = cc.Admit(fourth)
+	require.True(t, ok, cause)
+}
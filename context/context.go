@@ -16,6 +16,7 @@ import (
 	"github.com/free5gc/openapi/Nnrf_NFDiscovery"
 	"github.com/free5gc/openapi/Nnrf_NFManagement"
 	"github.com/free5gc/openapi/Nudm_SubscriberDataManagement"
+	"github.com/free5gc/openapi/Nudm_UEContextManagement"
 	"github.com/free5gc/openapi/models"
 	"github.com/free5gc/pfcp/pfcpType"
 	"github.com/free5gc/pfcp/pfcpUdp"
@@ -52,6 +53,7 @@ type SMFContext struct {
 	NFManagementClient             *Nnrf_NFManagement.APIClient
 	NFDiscoveryClient              *Nnrf_NFDiscovery.APIClient
 	SubscriberDataManagementClient *Nudm_SubscriberDataManagement.APIClient
+	UEContextManagementClient      *Nudm_UEContextManagement.APIClient
 
 	UserPlaneInformation *UserPlaneInformation
 
@@ -65,6 +67,13 @@ type SMFContext struct {
 	LocalSEIDCount      uint64
 
 	EnterpriseList *map[string]string // map to contain slice-name:enterprise-name
+
+	Shutdown ShutdownConfig
+	Sweeper  SweeperConfig
+	T3591    GsmTimerConfig
+	T3592    GsmTimerConfig
+
+	CongestionControl *CongestionControl
 }
 
 // RetrieveDnnInformation gets the corresponding dnn info from S-NSSAI and DNN
@@ -176,6 +185,11 @@ func InitSmfContext(config *factory.Config) {
 
 	smfContext.ULCLSupport = configuration.ULCL
 
+	initShutdownConfig(configuration.Shutdown)
+	initSweeperConfig(configuration.Sweeper)
+	initGsmTimerConfig(configuration.T3591, configuration.T3592)
+	initCongestionControl(configuration.CongestionControl)
+
 	smfContext.SupportedPDUSessionType = "IPv4"
 
 	smfContext.UserPlaneInformation = NewUserPlaneInformation(&configuration.UserPlaneInformation)
@@ -247,6 +247,15 @@ func (node *DataPathNode) DeactivateUpLinkTunnel(smContext *SMContext) {
 					}
 				}
 			}
+			//URR is shared by UL and DL PDRs
+			if urr := pdr.URR; urr != nil {
+				if _, ok := smContext.UsageMonUrrs[urr.URRID]; ok {
+					delete(smContext.UsageMonUrrs, urr.URRID)
+					if err = node.UPF.RemoveURR(urr); err != nil {
+						logger.CtxLog.Warnln("Deactivaed Tunnel", err)
+					}
+				}
+			}
 		}
 	}
 
@@ -293,6 +302,15 @@ func (node *DataPathNode) DeactivateDownLinkTunnel(smContext *SMContext) {
 					}
 				}
 			}
+			//URR is shared by UL and DL PDRs
+			if urr := pdr.URR; urr != nil {
+				if _, ok := smContext.UsageMonUrrs[urr.URRID]; ok {
+					delete(smContext.UsageMonUrrs, urr.URRID)
+					if err = node.UPF.RemoveURR(urr); err != nil {
+						logger.CtxLog.Warnln("Deactivaed Tunnel", err)
+					}
+				}
+			}
 		}
 	}
 
@@ -478,6 +496,44 @@ func (dpNode *DataPathNode) CreateSessRuleQer(smContext *SMContext) (*QER, error
 	return flowQER, nil
 }
 
+//CreateUsageMonUrr creates URR reporting when thresholds of session level usage monitoring
+//are reached, nil if PCF asked for none
+func (dpNode *DataPathNode) CreateUsageMonUrr(smContext *SMContext) (*URR, error) {
+	umData := smContext.SelectedUsageMonData()
+	if umData == nil {
+		return nil, nil
+	}
+
+	newURR, err := dpNode.UPF.AddURR()
+	if err != nil {
+		logger.PduSessLog.Errorln("new URR failed")
+		return nil, err
+	}
+
+	if umData.VolumeThreshold > 0 || umData.VolumeThresholdUplink > 0 || umData.VolumeThresholdDownlink > 0 {
+		newURR.MeasurementMethod.Volum = true
+		newURR.ReportingTriggers.Volth = true
+		newURR.VolumeThreshold = &pfcpType.VolumeThreshold{
+			Tovol:          umData.VolumeThreshold > 0,
+			Ulvol:          umData.VolumeThresholdUplink > 0,
+			Dlvol:          umData.VolumeThresholdDownlink > 0,
+			TotalVolume:    uint64(umData.VolumeThreshold),
+			UplinkVolume:   uint64(umData.VolumeThresholdUplink),
+			DownlinkVolume: uint64(umData.VolumeThresholdDownlink),
+		}
+	}
+	if umData.TimeThreshold > 0 {
+		newURR.MeasurementMethod.Durat = true
+		newURR.ReportingTriggers.Timth = true
+		newURR.TimeThreshold = &pfcpType.TimeThreshold{
+			TimeThreshold: uint32(umData.TimeThreshold),
+		}
+	}
+
+	smContext.UsageMonUrrs[newURR.URRID] = umData.UmId
+	return newURR, nil
+}
+
 //ActivateUpLinkPdr
 func (dpNode *DataPathNode) ActivateUpLinkPdr(smContext *SMContext, defQER *QER, defPrecedence uint32) error {
 	curULTunnel := dpNode.UpLinkTunnel
@@ -671,6 +727,11 @@ func (dataPath *DataPath) ActivateTunnelAndPDR(smContext *SMContext, precedence
 		return err
 	}
 
+	return dataPath.ActivatePDR(smContext, precedence)
+}
+
+//ActivatePDR sets up PDRs/FARs/QERs of tunnels allocated by ActivateUlDlTunnel
+func (dataPath *DataPath) ActivatePDR(smContext *SMContext, precedence uint32) error {
 	// Activate PDR
 	for curDataPathNode := dataPath.FirstDPNode; curDataPathNode != nil; curDataPathNode = curDataPathNode.Next() {
 
@@ -682,6 +743,14 @@ func (dataPath *DataPath) ActivateTunnelAndPDR(smContext *SMContext, precedence
 
 		logger.CtxLog.Traceln("Calculate ", curDataPathNode.UPF.PFCPAddr().String())
 
+		//Session level usage is measured on PSA
+		var usageMonURR *URR
+		if dataPath.IsDefaultPath && curDataPathNode.IsAnchorUPF() {
+			if usageMonURR, err = curDataPathNode.CreateUsageMonUrr(smContext); err != nil {
+				return err
+			}
+		}
+
 		// Setup UpLink PDR
 		if curDataPathNode.UpLinkTunnel != nil {
 			if err := curDataPathNode.ActivateUpLinkPdr(smContext, defQER, precedence); err != nil {
@@ -696,6 +765,17 @@ func (dataPath *DataPath) ActivateTunnelAndPDR(smContext *SMContext, precedence
 			}
 		}
 
+		if usageMonURR != nil {
+			for _, tunnel := range []*GTPTunnel{curDataPathNode.UpLinkTunnel, curDataPathNode.DownLinkTunnel} {
+				if tunnel == nil {
+					continue
+				}
+				for _, pdr := range tunnel.PDR {
+					pdr.URR = usageMonURR
+				}
+			}
+		}
+
 		if curDataPathNode.DownLinkTunnel != nil {
 			if curDataPathNode.DownLinkTunnel.SrcEndPoint == nil {
 				for _, DNDLPDR := range curDataPathNode.DownLinkTunnel.PDR {
@@ -0,0 +1,337 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/free5gc/ngap/ngapConvert"
+	"github.com/free5gc/openapi/models"
+)
+
+//GTPv2-C IE types making up UE EPS PDN connection(TS 29.274 8.1)
+const (
+	gtpv2IeTypeApn           uint8 = 71
+	gtpv2IeTypeAmbr          uint8 = 72
+	gtpv2IeTypeEbi           uint8 = 73
+	gtpv2IeTypeIpAddress     uint8 = 74
+	gtpv2IeTypeBearerQos     uint8 = 80
+	gtpv2IeTypeFteid         uint8 = 87
+	gtpv2IeTypeBearerContext uint8 = 93
+	gtpv2IeTypePdnConnection uint8 = 109
+)
+
+//F-TEID interface types(TS 29.274 8.22)
+const (
+	fteidInterfaceS5S8PgwGtpU uint8 = 5
+	fteidInterfaceS5S8PgwGtpC uint8 = 7
+)
+
+//Instance of PGW S5/S8 user plane F-TEID in bearer context(TS 29.274 Table 7.3.6-3)
+const pgwUserPlaneFteidInstance uint8 = 1
+
+//EpsBearerContext is bearer context of UE EPS PDN connection(TS 29.274 Table 7.3.6-3)
+type EpsBearerContext struct {
+	Ebi              uint8
+	Qci              uint8
+	ArpPriorityLevel uint8
+	PreemptCap       models.PreemptionCapability
+	PreemptVuln      models.PreemptionVulnerability
+	//PGW-U+UPF S5/S8 user plane endpoint
+	PgwUserIp   net.IP
+	PgwUserTeid uint32
+}
+
+//EpsPdnConnection is UE EPS PDN connection(TS 29.274 Table 7.3.6-2) PDU session maps to,
+//exchanged with MME by AMF in ueEpsPdnConnection of TS 29.502
+type EpsPdnConnection struct {
+	Apn        string
+	UeIpv4Addr net.IP
+	DefaultEbi uint8
+	//PGW-C+SMF S5/S8 control plane endpoint
+	PgwCtrlIp   net.IP
+	PgwCtrlTeid uint32
+	Bearers     []EpsBearerContext
+	//APN-AMBR in kbps
+	ApnAmbrUplink   uint32
+	ApnAmbrDownlink uint32
+}
+
+//BuildEpsPdnConnection maps PDU session to EPS PDN connection, default QoS flow maps to
+//default bearer. UL tunnel at UPF serving AN is PGW-U endpoint
+func (smContext *SMContext) BuildEpsPdnConnection() *EpsPdnConnection {
+	conn := &EpsPdnConnection{
+		Apn:        smContext.Dnn,
+		DefaultEbi: uint8(DefaultEpsBearerId),
+		PgwCtrlIp:  SMF_Self().CPNodeID.ResolveNodeIdToIp(),
+	}
+	if smContext.PDUAddress != nil {
+		conn.UeIpv4Addr = smContext.PDUAddress.To4()
+	}
+
+	ambr := smContext.DnnConfiguration.SessionAmbr
+	if rule := smContext.SelectedSessionRule(); rule != nil && rule.AuthSessAmbr != nil {
+		ambr = rule.AuthSessAmbr
+	}
+	if ambr != nil {
+		conn.ApnAmbrUplink = uint32(ngapConvert.UEAmbrToInt64(ambr.Uplink) / 1000)
+		conn.ApnAmbrDownlink = uint32(ngapConvert.UEAmbrToInt64(ambr.Downlink) / 1000)
+	}
+
+	bearer := EpsBearerContext{Ebi: conn.DefaultEbi}
+	if qos := smContext.DnnConfiguration.Var5gQosProfile; qos != nil {
+		//Standardized 5QIs 1-9 are QCIs of EPS
+		bearer.Qci = uint8(qos.Var5qi)
+		if qos.Arp != nil {
+			bearer.ArpPriorityLevel = uint8(qos.Arp.PriorityLevel)
+			bearer.PreemptCap = qos.Arp.PreemptCap
+			bearer.PreemptVuln = qos.Arp.PreemptVuln
+		}
+	}
+	if smContext.Tunnel != nil {
+		if dataPath := smContext.Tunnel.DataPathPool.GetDefaultPath(); dataPath != nil {
+			anUpf := dataPath.FirstDPNode
+			if ip, err := anUpf.UPF.N3Interfaces[0].IP(smContext.SelectedPDUSessionType); err == nil {
+				bearer.PgwUserIp = ip
+				bearer.PgwUserTeid = anUpf.UpLinkTunnel.TEID
+			}
+			//S5/S8 control plane TEID identifies session at PGW-C+SMF
+			if pfcpContext, ok := smContext.PFCPContext[anUpf.UPF.NodeID.ResolveNodeIdToIp().String()]; ok {
+				conn.PgwCtrlTeid = uint32(pfcpContext.LocalSEID)
+			}
+		}
+	}
+	conn.Bearers = []EpsBearerContext{bearer}
+	return conn
+}
+
+//Encode packs EPS PDN connection as base64 encoded PDN Connection IE(TS 29.274 8.39)
+func (conn *EpsPdnConnection) Encode() string {
+	var buf []byte
+	buf = appendGtpv2Ie(buf, gtpv2IeTypeApn, 0, encodeApn(conn.Apn))
+	if ip := conn.UeIpv4Addr.To4(); ip != nil {
+		buf = appendGtpv2Ie(buf, gtpv2IeTypeIpAddress, 0, ip)
+	}
+	buf = appendGtpv2Ie(buf, gtpv2IeTypeEbi, 0, []byte{conn.DefaultEbi & 0x0f})
+	buf = appendGtpv2Ie(buf, gtpv2IeTypeFteid, 0, encodeFteid(fteidInterfaceS5S8PgwGtpC, conn.PgwCtrlTeid, conn.PgwCtrlIp))
+	for _, bearer := range conn.Bearers {
+		buf = appendGtpv2Ie(buf, gtpv2IeTypeBearerContext, 0, bearer.encode())
+	}
+	ambr := make([]byte, 8)
+	binary.BigEndian.PutUint32(ambr[0:4], conn.ApnAmbrUplink)
+	binary.BigEndian.PutUint32(ambr[4:8], conn.ApnAmbrDownlink)
+	buf = appendGtpv2Ie(buf, gtpv2IeTypeAmbr, 0, ambr)
+
+	return base64.StdEncoding.EncodeToString(appendGtpv2Ie(nil, gtpv2IeTypePdnConnection, 0, buf))
+}
+
+func (bearer *EpsBearerContext) encode() []byte {
+	var buf []byte
+	buf = appendGtpv2Ie(buf, gtpv2IeTypeEbi, 0, []byte{bearer.Ebi & 0x0f})
+	if bearer.PgwUserIp != nil {
+		buf = appendGtpv2Ie(buf, gtpv2IeTypeFteid, pgwUserPlaneFteidInstance,
+			encodeFteid(fteidInterfaceS5S8PgwGtpU, bearer.PgwUserTeid, bearer.PgwUserIp))
+	}
+
+	//Non-GBR bearer, MBR and GBR are zero. PCI and PVI are set if pre-emption is disabled
+	qos := make([]byte, 22)
+	qos[0] = (bearer.ArpPriorityLevel & 0x0f) << 2
+	if bearer.PreemptCap != models.PreemptionCapability_MAY_PREEMPT {
+		qos[0] |= 0x40
+	}
+	if bearer.PreemptVuln != models.PreemptionVulnerability_PREEMPTABLE {
+		qos[0] |= 0x01
+	}
+	qos[1] = bearer.Qci
+	return appendGtpv2Ie(buf, gtpv2IeTypeBearerQos, 0, qos)
+}
+
+//DecodeEpsPdnConnection unpacks UE EPS PDN connection received in Create SM Context
+func DecodeEpsPdnConnection(ueEpsPdnConnection string) (*EpsPdnConnection, error) {
+	buf, err := base64.StdEncoding.DecodeString(ueEpsPdnConnection)
+	if err != nil {
+		return nil, fmt.Errorf("ueEpsPdnConnection decode failed, %v", err)
+	}
+	ies, err := parseGtpv2Ies(buf)
+	if err != nil {
+		return nil, fmt.Errorf("ueEpsPdnConnection parse failed, %v", err)
+	}
+	if len(ies) != 1 || ies[0].ieType != gtpv2IeTypePdnConnection {
+		return nil, fmt.Errorf("ueEpsPdnConnection is not PDN Connection IE")
+	}
+	if ies, err = parseGtpv2Ies(ies[0].value); err != nil {
+		return nil, fmt.Errorf("ueEpsPdnConnection parse failed, %v", err)
+	}
+
+	conn := &EpsPdnConnection{}
+	for _, ie := range ies {
+		switch ie.ieType {
+		case gtpv2IeTypeApn:
+			conn.Apn = decodeApn(ie.value)
+		case gtpv2IeTypeIpAddress:
+			if len(ie.value) == net.IPv4len {
+				conn.UeIpv4Addr = net.IP(ie.value)
+			}
+		case gtpv2IeTypeEbi:
+			if len(ie.value) > 0 {
+				conn.DefaultEbi = ie.value[0] & 0x0f
+			}
+		case gtpv2IeTypeFteid:
+			conn.PgwCtrlTeid, conn.PgwCtrlIp = decodeFteid(ie.value)
+		case gtpv2IeTypeBearerContext:
+			bearer, err := decodeEpsBearerContext(ie.value)
+			if err != nil {
+				return nil, fmt.Errorf("ueEpsPdnConnection bearer context parse failed, %v", err)
+			}
+			conn.Bearers = append(conn.Bearers, *bearer)
+		case gtpv2IeTypeAmbr:
+			if len(ie.value) >= 8 {
+				conn.ApnAmbrUplink = binary.BigEndian.Uint32(ie.value[0:4])
+				conn.ApnAmbrDownlink = binary.BigEndian.Uint32(ie.value[4:8])
+			}
+		}
+	}
+	if conn.Apn == "" || conn.DefaultEbi == 0 {
+		return nil, fmt.Errorf("ueEpsPdnConnection lacks APN or linked EBI")
+	}
+	return conn, nil
+}
+
+func decodeEpsBearerContext(value []byte) (*EpsBearerContext, error) {
+	ies, err := parseGtpv2Ies(value)
+	if err != nil {
+		return nil, err
+	}
+	bearer := &EpsBearerContext{}
+	for _, ie := range ies {
+		switch {
+		case ie.ieType == gtpv2IeTypeEbi && len(ie.value) > 0:
+			bearer.Ebi = ie.value[0] & 0x0f
+		case ie.ieType == gtpv2IeTypeFteid && ie.instance == pgwUserPlaneFteidInstance:
+			bearer.PgwUserTeid, bearer.PgwUserIp = decodeFteid(ie.value)
+		case ie.ieType == gtpv2IeTypeBearerQos && len(ie.value) >= 2:
+			bearer.ArpPriorityLevel = (ie.value[0] >> 2) & 0x0f
+			bearer.PreemptCap = models.PreemptionCapability_MAY_PREEMPT
+			if ie.value[0]&0x40 != 0 {
+				bearer.PreemptCap = models.PreemptionCapability_NOT_PREEMPT
+			}
+			bearer.PreemptVuln = models.PreemptionVulnerability_PREEMPTABLE
+			if ie.value[0]&0x01 != 0 {
+				bearer.PreemptVuln = models.PreemptionVulnerability_NOT_PREEMPTABLE
+			}
+			bearer.Qci = ie.value[1]
+		}
+	}
+	return bearer, nil
+}
+
+//SMContextTransfer maps EPS PDN connection to SM context transfer PDU session is created from,
+//default bearer maps to default QoS flow
+func (conn *EpsPdnConnection) SMContextTransfer() *SMContextTransfer {
+	transfer := &SMContextTransfer{
+		Type: SmContextTypeEpsPdnConnection,
+		Dnn:  conn.Apn,
+		SessionAmbr: &models.Ambr{
+			Uplink:   fmt.Sprintf("%d Kbps", conn.ApnAmbrUplink),
+			Downlink: fmt.Sprintf("%d Kbps", conn.ApnAmbrDownlink),
+		},
+	}
+	if conn.UeIpv4Addr != nil {
+		transfer.UeIpv4Addr = conn.UeIpv4Addr.String()
+		transfer.PduSessionType = models.PduSessionType_IPV4
+	}
+	for _, bearer := range conn.Bearers {
+		if bearer.Ebi != conn.DefaultEbi {
+			continue
+		}
+		transfer.DefaultQos = &models.SubscribedDefaultQos{
+			Var5qi: int32(bearer.Qci),
+			Arp: &models.Arp{
+				PriorityLevel: int32(bearer.ArpPriorityLevel),
+				PreemptCap:    bearer.PreemptCap,
+				PreemptVuln:   bearer.PreemptVuln,
+			},
+		}
+	}
+	return transfer
+}
+
+type gtpv2Ie struct {
+	ieType   uint8
+	instance uint8
+	value    []byte
+}
+
+func appendGtpv2Ie(buf []byte, ieType, instance uint8, value []byte) []byte {
+	header := make([]byte, 4)
+	header[0] = ieType
+	binary.BigEndian.PutUint16(header[1:3], uint16(len(value)))
+	header[3] = instance & 0x0f
+	return append(append(buf, header...), value...)
+}
+
+func parseGtpv2Ies(buf []byte) ([]gtpv2Ie, error) {
+	var ies []gtpv2Ie
+	for len(buf) > 0 {
+		if len(buf) < 4 {
+			return nil, fmt.Errorf("truncated IE header")
+		}
+		length := int(binary.BigEndian.Uint16(buf[1:3]))
+		if len(buf) < 4+length {
+			return nil, fmt.Errorf("IE type [%v] truncated", buf[0])
+		}
+		ies = append(ies, gtpv2Ie{ieType: buf[0], instance: buf[3] & 0x0f, value: buf[4 : 4+length]})
+		buf = buf[4+length:]
+	}
+	return ies, nil
+}
+
+//APN is encoded as DNS labels(TS 23.003 9.1)
+func encodeApn(apn string) []byte {
+	var buf []byte
+	for _, label := range strings.Split(apn, ".") {
+		buf = append(append(buf, byte(len(label))), label...)
+	}
+	return buf
+}
+
+func decodeApn(buf []byte) string {
+	var labels []string
+	for len(buf) > 0 {
+		length := int(buf[0])
+		if len(buf) < 1+length {
+			break
+		}
+		labels = append(labels, string(buf[1:1+length]))
+		buf = buf[1+length:]
+	}
+	return strings.Join(labels, ".")
+}
+
+func encodeFteid(interfaceType uint8, teid uint32, ip net.IP) []byte {
+	buf := make([]byte, 5)
+	buf[0] = interfaceType & 0x3f
+	binary.BigEndian.PutUint32(buf[1:5], teid)
+	if ip4 := ip.To4(); ip4 != nil {
+		buf[0] |= 0x80
+		buf = append(buf, ip4...)
+	}
+	return buf
+}
+
+func decodeFteid(buf []byte) (uint32, net.IP) {
+	if len(buf) < 5 {
+		return 0, nil
+	}
+	teid := binary.BigEndian.Uint32(buf[1:5])
+	if buf[0]&0x80 != 0 && len(buf) >= 9 {
+		return teid, net.IP(buf[5:9])
+	}
+	return teid, nil
+}
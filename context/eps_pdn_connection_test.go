@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+)
+
+func TestEpsPdnConnection(t *testing.T) {
+	allocator, err := context.NewIPAllocator("60.60.0.0/16")
+	require.NoError(t, err)
+
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 15, smctxtest.WithDnn("internet.mnc093.mcc208", nil),
+		smctxtest.WithDnnInfo(&context.SnssaiSmfDnnInfo{UeIPAllocator: allocator}))
+	smContext.PDUAddress, err = allocator.Allocate()
+	require.NoError(t, err)
+	smContext.DnnConfiguration.SessionAmbr = &models.Ambr{Uplink: "100 Mbps", Downlink: "200 Mbps"}
+	smContext.DnnConfiguration.Var5gQosProfile = &models.SubscribedDefaultQos{
+		Var5qi: 9,
+		Arp: &models.Arp{
+			PriorityLevel: 8,
+			PreemptCap:    models.PreemptionCapability_NOT_PREEMPT,
+			PreemptVuln:   models.PreemptionVulnerability_PREEMPTABLE,
+		},
+	}
+
+	conn := smContext.BuildEpsPdnConnection()
+	require.Equal(t, uint8(context.DefaultEpsBearerId), conn.DefaultEbi)
+	require.Equal(t, uint32(100000), conn.ApnAmbrUplink)
+	require.Equal(t, uint32(200000), conn.ApnAmbrDownlink)
+	require.Len(t, conn.Bearers, 1)
+
+	//PDN Connection IE carrying APN in DNS labels first
+	encoded := conn.Encode()
+	buf, err := base64.StdEncoding.DecodeString(encoded)
+	require.NoError(t, err)
+	require.Equal(t, byte(109), buf[0])
+	require.Equal(t, []byte{71, 0, 23, 0, 8, 'i', 'n', 't', 'e', 'r', 'n', 'e', 't'}, buf[4:17])
+
+	decoded, err := context.DecodeEpsPdnConnection(encoded)
+	require.NoError(t, err)
+	require.Equal(t, conn.Apn, decoded.Apn)
+	require.True(t, conn.UeIpv4Addr.Equal(decoded.UeIpv4Addr))
+	require.Equal(t, conn.DefaultEbi, decoded.DefaultEbi)
+	require.Equal(t, conn.PgwCtrlTeid, decoded.PgwCtrlTeid)
+	require.Equal(t, conn.Bearers, decoded.Bearers)
+	require.Equal(t, conn.ApnAmbrUplink, decoded.ApnAmbrUplink)
+
+	//Default bearer maps to default QoS flow
+	transfer := decoded.SMContextTransfer()
+	require.Equal(t, context.SmContextTypeEpsPdnConnection, transfer.Type)
+	require.Equal(t, "internet.mnc093.mcc208", transfer.Dnn)
+	require.Equal(t, smContext.PDUAddress.String(), transfer.UeIpv4Addr)
+	require.Equal(t, &models.Ambr{Uplink: "100000 Kbps", Downlink: "200000 Kbps"}, transfer.SessionAmbr)
+	require.Equal(t, smContext.DnnConfiguration.Var5gQosProfile, transfer.DefaultQos)
+
+	_, err = context.DecodeEpsPdnConnection("not base64")
+	require.Error(t, err)
+	//Bearer context IE alone
+	_, err = context.DecodeEpsPdnConnection(base64.StdEncoding.EncodeToString([]byte{93, 0, 0, 0}))
+	require.Error(t, err)
+	//Truncated
+	_, err = context.DecodeEpsPdnConnection(base64.StdEncoding.EncodeToString(buf[:len(buf)-1]))
+	require.Error(t, err)
+}
@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/free5gc/openapi/models"
+)
+
+//SMF events(TS 29.508) not listed in openapi models
+const (
+	SmfEventPduSesEst models.SmfEvent = "PDU_SES_EST"
+	SmfEventQosMon    models.SmfEvent = "QOS_MON"
+)
+
+var supportedSmfEvents = map[models.SmfEvent]bool{
+	models.SmfEvent_AC_TY_CH:    true,
+	models.SmfEvent_UP_PATH_CH:  true,
+	models.SmfEvent_PDU_SES_REL: true,
+	models.SmfEvent_PLMN_CH:     true,
+	models.SmfEvent_UE_IP_CH:    true,
+	SmfEventPduSesEst:           true,
+	SmfEventQosMon:              true,
+}
+
+//SmfEventHandler notifies subscribers of SMF event of SM context
+type SmfEventHandler func(smContext *SMContext, event models.SmfEvent, eventNotif models.EventNotification)
+
+var smfEventHandler SmfEventHandler
+
+//RegisterSmfEventHandler is called by SMF FSM at init
+func RegisterSmfEventHandler(handler SmfEventHandler) {
+	smfEventHandler = handler
+}
+
+//notifySmfEvent reports SMF event of SM context through registered handler
+func (smContext *SMContext) notifySmfEvent(event models.SmfEvent, eventNotif models.EventNotification) {
+	if smfEventHandler == nil {
+		return
+	}
+	smfEventHandler(smContext, event, eventNotif)
+}
+
+//EESubscription is an Nsmf_EventExposure subscription
+type EESubscription struct {
+	lock         sync.Mutex
+	Subscription models.NsmfEventExposure
+	//Number of reports sent so far, subscription expires at MaxReportNbr
+	ReportCount int32
+}
+
+//Subscriptions keyed by SubId
+var eeSubscriptions sync.Map
+
+//ValidateEventExposure checks Nsmf_EventExposure subscription is acceptable
+func ValidateEventExposure(sub *models.NsmfEventExposure) error {
+	if sub.NotifUri == "" {
+		return fmt.Errorf("notifUri missing")
+	}
+	if sub.NotifId == "" {
+		return fmt.Errorf("notifId missing")
+	}
+	if sub.Supi == "" && sub.Gpsi == "" && !sub.AnyUeInd {
+		if sub.GroupId != "" {
+			//Group membership is known to UDM only
+			return fmt.Errorf("groupId not supported")
+		}
+		return fmt.Errorf("supi, gpsi or anyUeInd required")
+	}
+	if len(sub.EventSubs) == 0 {
+		return fmt.Errorf("eventSubs missing")
+	}
+	for _, eventSub := range sub.EventSubs {
+		if !supportedSmfEvents[eventSub.Event] {
+			return fmt.Errorf("event [%v] not supported", eventSub.Event)
+		}
+	}
+	if sub.Expiry != nil && sub.Expiry.Before(time.Now()) {
+		return fmt.Errorf("expiry [%v] already passed", sub.Expiry)
+	}
+	return nil
+}
+
+//NewEESubscription stores subscription, assigns and returns SubId
+func NewEESubscription(sub models.NsmfEventExposure) string {
+	sub.SubId = uuid.New().String()
+	eeSubscriptions.Store(sub.SubId, &EESubscription{Subscription: sub})
+	return sub.SubId
+}
+
+//GetEESubscription returns copy of subscription
+func GetEESubscription(subId string) (models.NsmfEventExposure, bool) {
+	value, ok := eeSubscriptions.Load(subId)
+	if !ok {
+		return models.NsmfEventExposure{}, false
+	}
+	eeSub := value.(*EESubscription)
+	eeSub.lock.Lock()
+	defer eeSub.lock.Unlock()
+	return eeSub.Subscription, true
+}
+
+//UpdateEESubscription replaces existing subscription
+func UpdateEESubscription(subId string, sub models.NsmfEventExposure) bool {
+	value, ok := eeSubscriptions.Load(subId)
+	if !ok {
+		return false
+	}
+	eeSub := value.(*EESubscription)
+	eeSub.lock.Lock()
+	defer eeSub.lock.Unlock()
+	sub.SubId = subId
+	eeSub.Subscription = sub
+	eeSub.ReportCount = 0
+	return true
+}
+
+//RemoveEESubscription deletes subscription, returns false if not found
+func RemoveEESubscription(subId string) bool {
+	if _, ok := eeSubscriptions.Load(subId); !ok {
+		return false
+	}
+	eeSubscriptions.Delete(subId)
+	return true
+}
+
+func (eeSub *EESubscription) matches(smContext *SMContext, event models.SmfEvent) bool {
+	sub := &eeSub.Subscription
+
+	subscribed := false
+	for _, eventSub := range sub.EventSubs {
+		if eventSub.Event == event {
+			subscribed = true
+			break
+		}
+	}
+	if !subscribed {
+		return false
+	}
+
+	if sub.PduSeId != 0 && sub.PduSeId != smContext.PDUSessionID {
+		return false
+	}
+	switch {
+	case sub.AnyUeInd:
+		return true
+	case sub.Supi != "":
+		return sub.Supi == smContext.Supi
+	case sub.Gpsi != "":
+		return sub.Gpsi == smContext.Gpsi
+	}
+	return false
+}
+
+//EESubscriptionsForEvent returns subscriptions to be notified of SM context event.
+//Report count is consumed, expired subscriptions are removed.
+func (smContext *SMContext) EESubscriptionsForEvent(event models.SmfEvent) []models.NsmfEventExposure {
+	subs := make([]models.NsmfEventExposure, 0)
+	now := time.Now()
+
+	eeSubscriptions.Range(func(key, value interface{}) bool {
+		eeSub := value.(*EESubscription)
+		eeSub.lock.Lock()
+		defer eeSub.lock.Unlock()
+
+		if eeSub.Subscription.Expiry != nil && eeSub.Subscription.Expiry.Before(now) {
+			smContext.SubCtxLog.Infof("event exposure subscription [%v] expired", key)
+			eeSubscriptions.Delete(key)
+			return true
+		}
+		if !eeSub.matches(smContext, event) {
+			return true
+		}
+
+		subs = append(subs, eeSub.Subscription)
+		eeSub.ReportCount++
+		if max := eeSub.Subscription.MaxReportNbr; max > 0 && eeSub.ReportCount >= max {
+			smContext.SubCtxLog.Infof("event exposure subscription [%v] reached max reports [%v]", key, max)
+			eeSubscriptions.Delete(key)
+		}
+		return true
+	})
+	return subs
+}
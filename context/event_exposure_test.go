@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+	"github.com/free5gc/smf/qos"
+)
+
+func TestEventExposureSubscription(t *testing.T) {
+	sub := models.NsmfEventExposure{
+		Supi:     "imsi-2089300007487",
+		NotifId:  "notif-1",
+		NotifUri: "http://127.0.0.1:8000/notify",
+		EventSubs: []models.EventSubscription{
+			{Event: models.SmfEvent_PDU_SES_REL},
+			{Event: context.SmfEventPduSesEst},
+		},
+		MaxReportNbr: 2,
+	}
+	require.NoError(t, context.ValidateEventExposure(&sub))
+
+	invalid := sub
+	invalid.EventSubs = []models.EventSubscription{{Event: "UNKNOWN"}}
+	require.Error(t, context.ValidateEventExposure(&invalid))
+	invalid = sub
+	invalid.NotifUri = ""
+	require.Error(t, context.ValidateEventExposure(&invalid))
+	invalid = sub
+	invalid.Supi, invalid.GroupId = "", "group-1"
+	require.Error(t, context.ValidateEventExposure(&invalid))
+
+	subId := context.NewEESubscription(sub)
+	stored, ok := context.GetEESubscription(subId)
+	require.True(t, ok)
+	require.Equal(t, subId, stored.SubId)
+
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 14)
+	other := smctxtest.NewSMContext(t, "imsi-2089300007488", 14)
+
+	require.Empty(t, smContext.EESubscriptionsForEvent(models.SmfEvent_UE_IP_CH))
+	require.Empty(t, other.EESubscriptionsForEvent(context.SmfEventPduSesEst))
+	require.Len(t, smContext.EESubscriptionsForEvent(context.SmfEventPduSesEst), 1)
+
+	//Subscription removed once max reports are sent
+	require.Len(t, smContext.EESubscriptionsForEvent(models.SmfEvent_PDU_SES_REL), 1)
+	_, ok = context.GetEESubscription(subId)
+	require.False(t, ok)
+	require.False(t, context.RemoveEESubscription(subId))
+}
+
+func TestQosMonOnSmPolicyCommit(t *testing.T) {
+	var events []models.SmfEvent
+	context.RegisterSmfEventHandler(func(smContext *context.SMContext, event models.SmfEvent,
+		eventNotif models.EventNotification) {
+		events = append(events, event)
+	})
+	defer context.RegisterSmfEventHandler(nil)
+
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 15)
+
+	sessRule := &models.SessionRule{
+		SessRuleId:   "SessRuleId-1",
+		AuthSessAmbr: &models.Ambr{Uplink: "100 Mbps", Downlink: "100 Mbps"},
+		AuthDefQos:   &models.AuthorizedDefaultQos{Var5qi: 9},
+	}
+	decision := &models.SmPolicyDecision{SessRules: map[string]*models.SessionRule{"SessRuleId-1": sessRule}}
+
+	//Rejected update isn't reported
+	smContext.SmPolicyUpdates = append(smContext.SmPolicyUpdates, qos.BuildSmPolicyUpdate(&smContext.SmPolicyData, decision))
+	require.NoError(t, smContext.CommitSmPolicyDecision(false))
+	require.Empty(t, events)
+
+	smContext.SmPolicyUpdates = append(smContext.SmPolicyUpdates, qos.BuildSmPolicyUpdate(&smContext.SmPolicyData, decision))
+	require.NoError(t, smContext.CommitSmPolicyDecision(true))
+	require.Equal(t, []models.SmfEvent{context.SmfEventQosMon}, events)
+
+	//Same decision again changes no QoS
+	smContext.SmPolicyUpdates = append(smContext.SmPolicyUpdates, qos.BuildSmPolicyUpdate(&smContext.SmPolicyData, decision))
+	require.NoError(t, smContext.CommitSmPolicyDecision(true))
+	require.Len(t, events, 1)
+}
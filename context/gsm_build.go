@@ -7,6 +7,7 @@ package context
 
 import (
 	"encoding/hex"
+	"time"
 
 	"github.com/free5gc/nas"
 	"github.com/free5gc/nas/nasConvert"
@@ -36,7 +37,7 @@ func BuildGSMPDUSessionEstablishmentAccept(smContext *SMContext) ([]byte, error)
 	}
 	pDUSessionEstablishmentAccept.SetPDUSessionType(smContext.SelectedPDUSessionType)
 
-	pDUSessionEstablishmentAccept.SetSSCMode(1)
+	pDUSessionEstablishmentAccept.SetSSCMode(smContext.SscMode)
 	pDUSessionEstablishmentAccept.SessionAMBR = nasConvert.ModelsToSessionAMBR(sessRule.AuthSessAmbr)
 	pDUSessionEstablishmentAccept.SessionAMBR.SetLen(uint8(len(pDUSessionEstablishmentAccept.SessionAMBR.Octet)))
 
@@ -89,50 +90,39 @@ func BuildGSMPDUSessionEstablishmentAccept(smContext *SMContext) ([]byte, error)
 	pDUSessionEstablishmentAccept.DNN.SetLen(uint8(len(dnn)))
 	pDUSessionEstablishmentAccept.DNN.SetDNN(dnn)
 
-	if smContext.ProtocolConfigurationOptions.DNSIPv4Request || smContext.ProtocolConfigurationOptions.DNSIPv6Request || smContext.ProtocolConfigurationOptions.IPv4LinkMTURequest {
+	if pcoContents := smContext.BuildPCOResponse(); pcoContents != nil {
 		pDUSessionEstablishmentAccept.ExtendedProtocolConfigurationOptions =
 			nasType.NewExtendedProtocolConfigurationOptions(
 				nasMessage.PDUSessionEstablishmentAcceptExtendedProtocolConfigurationOptionsType,
 			)
-		protocolConfigurationOptions := nasConvert.NewProtocolConfigurationOptions()
-
-		// IPv4 DNS
-		if smContext.ProtocolConfigurationOptions.DNSIPv4Request {
-			err := protocolConfigurationOptions.AddDNSServerIPv4Address(smContext.DNNInfo.DNS.IPv4Addr)
-			if err != nil {
-				smContext.SubGsmLog.Warnln("Error while adding DNS IPv4 Addr: ", err)
-			}
-		}
-
-		// IPv6 DNS
-		if smContext.ProtocolConfigurationOptions.DNSIPv6Request {
-			err := protocolConfigurationOptions.AddDNSServerIPv6Address(smContext.DNNInfo.DNS.IPv6Addr)
-			if err != nil {
-				smContext.SubGsmLog.Warnln("Error while adding DNS IPv6 Addr: ", err)
-			}
-		}
-
-		// MTU
-		if smContext.ProtocolConfigurationOptions.IPv4LinkMTURequest {
-			err := protocolConfigurationOptions.AddIPv4LinkMTU(smContext.DNNInfo.MTU)
-			if err != nil {
-				smContext.SubGsmLog.Warnln("Error while adding MTU: ", err)
-			}
-		}
-
-		pcoContents := protocolConfigurationOptions.Marshal()
-		pcoContentsLength := len(pcoContents)
 		pDUSessionEstablishmentAccept.
 			ExtendedProtocolConfigurationOptions.
-			SetLen(uint16(pcoContentsLength))
+			SetLen(uint16(len(pcoContents)))
 		pDUSessionEstablishmentAccept.
 			ExtendedProtocolConfigurationOptions.
 			SetExtendedProtocolConfigurationOptionsContents(pcoContents)
 	}
+
+	if smContext.AlwaysOnRequested {
+		pDUSessionEstablishmentAccept.AlwaysonPDUSessionIndication =
+			nasType.NewAlwaysonPDUSessionIndication(nasMessage.PDUSessionEstablishmentAcceptAlwaysonPDUSessionIndicationType)
+		pDUSessionEstablishmentAccept.AlwaysonPDUSessionIndication.SetAPSI(smContext.AlwaysOnIndication())
+	}
+
+	//EAP-Success of DN-AAA
+	if auth := smContext.SecondaryAuth; auth != nil && auth.Authorized && auth.EapResult != nil {
+		pDUSessionEstablishmentAccept.EAPMessage =
+			nasType.NewEAPMessage(nasMessage.PDUSessionEstablishmentAcceptEAPMessageType)
+		pDUSessionEstablishmentAccept.EAPMessage.SetLen(uint16(len(auth.EapResult)))
+		pDUSessionEstablishmentAccept.EAPMessage.SetEAPMessage(auth.EapResult)
+	}
 	return m.PlainNasEncode()
 }
 
-func BuildGSMPDUSessionEstablishmentReject(smContext *SMContext, cause uint8) ([]byte, error) {
+//BuildGSMPDUSessionEstablishmentReject builds reject with cause, back-off timer value is included
+//if backOffTimer is set(TS 24.501 8.3.3)
+func BuildGSMPDUSessionEstablishmentReject(smContext *SMContext, cause uint8,
+	backOffTimer time.Duration) ([]byte, error) {
 	m := nas.NewMessage()
 	m.GsmMessage = nas.NewGsmMessage()
 	m.GsmHeader.SetMessageType(nas.MsgTypePDUSessionEstablishmentReject)
@@ -144,11 +134,42 @@ func BuildGSMPDUSessionEstablishmentReject(smContext *SMContext, cause uint8) ([
 	pDUSessionEstablishmentReject.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
 	pDUSessionEstablishmentReject.SetPDUSessionID(uint8(smContext.PDUSessionID))
 	pDUSessionEstablishmentReject.SetCauseValue(cause)
+	if backOffTimer > 0 {
+		pDUSessionEstablishmentReject.BackoffTimerValue = nasType.NewBackoffTimerValue(
+			nasMessage.PDUSessionEstablishmentRejectBackoffTimerValueType)
+		pDUSessionEstablishmentReject.BackoffTimerValue.SetLen(1)
+		pDUSessionEstablishmentReject.BackoffTimerValue.Octet = nasConvert.GPRSTimer3ToNas(int(backOffTimer.Seconds()))
+	}
+	//EAP-Failure of DN-AAA
+	if auth := smContext.SecondaryAuth; auth != nil && !auth.Authorized && auth.EapResult != nil {
+		pDUSessionEstablishmentReject.EAPMessage =
+			nasType.NewEAPMessage(nasMessage.PDUSessionEstablishmentRejectEAPMessageType)
+		pDUSessionEstablishmentReject.EAPMessage.SetLen(uint16(len(auth.EapResult)))
+		pDUSessionEstablishmentReject.EAPMessage.SetEAPMessage(auth.EapResult)
+	}
+
+	return m.PlainNasEncode()
+}
+
+//BuildGSMPDUSessionAuthenticationCommand relays EAP request of DN-AAA to UE(TS 24.501 8.3.4)
+func BuildGSMPDUSessionAuthenticationCommand(smContext *SMContext, eap []byte) ([]byte, error) {
+	m := nas.NewMessage()
+	m.GsmMessage = nas.NewGsmMessage()
+	m.GsmHeader.SetMessageType(nas.MsgTypePDUSessionAuthenticationCommand)
+	m.GsmHeader.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	m.PDUSessionAuthenticationCommand = nasMessage.NewPDUSessionAuthenticationCommand(0x0)
+	pDUSessionAuthenticationCommand := m.PDUSessionAuthenticationCommand
+
+	pDUSessionAuthenticationCommand.SetMessageType(nas.MsgTypePDUSessionAuthenticationCommand)
+	pDUSessionAuthenticationCommand.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	pDUSessionAuthenticationCommand.SetPDUSessionID(uint8(smContext.PDUSessionID))
+	pDUSessionAuthenticationCommand.EAPMessage.SetLen(uint16(len(eap)))
+	pDUSessionAuthenticationCommand.SetEAPMessage(eap)
 
 	return m.PlainNasEncode()
 }
 
-/*func BuildGSMPDUSessionModificationReject(smContext *SMContext, cause uint8) ([]byte, error) {
+func BuildGSMPDUSessionModificationReject(smContext *SMContext, cause uint8) ([]byte, error) {
 	m := nas.NewMessage()
 	m.GsmMessage = nas.NewGsmMessage()
 	m.GsmHeader.SetMessageType(nas.MsgTypePDUSessionModificationReject)
@@ -159,12 +180,13 @@ func BuildGSMPDUSessionEstablishmentReject(smContext *SMContext, cause uint8) ([
 	pDUSessionModificationReject.SetMessageType(nas.MsgTypePDUSessionModificationReject)
 	pDUSessionModificationReject.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
 	pDUSessionModificationReject.SetPDUSessionID(uint8(smContext.PDUSessionID))
+	pDUSessionModificationReject.SetPTI(smContext.Pti)
 	pDUSessionModificationReject.SetCauseValue(cause)
 
 	return m.PlainNasEncode()
-}*/
+}
 
-func BuildGSMPDUSessionReleaseCommand(smContext *SMContext) ([]byte, error) {
+func BuildGSMPDUSessionReleaseCommand(smContext *SMContext, cause uint8) ([]byte, error) {
 	m := nas.NewMessage()
 	m.GsmMessage = nas.NewGsmMessage()
 	m.GsmHeader.SetMessageType(nas.MsgTypePDUSessionReleaseCommand)
@@ -176,7 +198,7 @@ func BuildGSMPDUSessionReleaseCommand(smContext *SMContext) ([]byte, error) {
 	pDUSessionReleaseCommand.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
 	pDUSessionReleaseCommand.SetPDUSessionID(uint8(smContext.PDUSessionID))
 	pDUSessionReleaseCommand.SetPTI(smContext.Pti)
-	pDUSessionReleaseCommand.SetCauseValue(0x0)
+	pDUSessionReleaseCommand.SetCauseValue(cause)
 
 	return m.PlainNasEncode()
 }
@@ -193,6 +215,22 @@ func BuildGSMPDUSessionModificationCommand(smContext *SMContext) ([]byte, error)
 	pDUSessionModificationCommand.SetPDUSessionID(uint8(smContext.PDUSessionID))
 	pDUSessionModificationCommand.SetPTI(smContext.Pti)
 	pDUSessionModificationCommand.SetMessageType(nas.MsgTypePDUSessionModificationCommand)
+
+	//SSC mode 3 anchor UPF relocation, UE is to set up new PDU session within address lifetime
+	if relocation := smContext.AnchorRelocation; relocation != nil {
+		pDUSessionModificationCommand.Cause5GSM = nasType.NewCause5GSM(nasMessage.PDUSessionModificationCommandCause5GSMType)
+		pDUSessionModificationCommand.Cause5GSM.SetCauseValue(nasMessage.Cause5GSMReactivationRequested)
+
+		epco := pduAddressLifetimeEPCO(relocation.Lifetime)
+		pDUSessionModificationCommand.ExtendedProtocolConfigurationOptions =
+			nasType.NewExtendedProtocolConfigurationOptions(
+				nasMessage.PDUSessionModificationCommandExtendedProtocolConfigurationOptionsType,
+			)
+		pDUSessionModificationCommand.ExtendedProtocolConfigurationOptions.SetLen(uint16(len(epco)))
+		pDUSessionModificationCommand.
+			ExtendedProtocolConfigurationOptions.
+			SetExtendedProtocolConfigurationOptionsContents(epco)
+	}
 	// pDUSessionModificationCommand.SetQosRule()
 	// pDUSessionModificationCommand.AuthorizedQosRules.SetLen()
 	// pDUSessionModificationCommand.SessionAMBR.SetSessionAMBRForDownlink([2]uint8{0x11, 0x11})
@@ -223,3 +261,21 @@ func BuildGSMPDUSessionReleaseReject(smContext *SMContext) ([]byte, error) {
 
 	return m.PlainNasEncode()
 }
+
+//BuildGSMStatus5GSM builds 5GSM STATUS reporting error in message with PTI received from UE(TS 24.501 8.3.16)
+func BuildGSMStatus5GSM(smContext *SMContext, pti uint8, cause uint8) ([]byte, error) {
+	m := nas.NewMessage()
+	m.GsmMessage = nas.NewGsmMessage()
+	m.GsmHeader.SetMessageType(nas.MsgTypeStatus5GSM)
+	m.GsmHeader.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	m.Status5GSM = nasMessage.NewStatus5GSM(0x0)
+	status5GSM := m.Status5GSM
+
+	status5GSM.SetMessageType(nas.MsgTypeStatus5GSM)
+	status5GSM.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	status5GSM.SetPDUSessionID(uint8(smContext.PDUSessionID))
+	status5GSM.SetPTI(pti)
+	status5GSM.SetCauseValue(cause)
+
+	return m.PlainNasEncode()
+}
@@ -6,7 +6,6 @@
 package context
 
 import (
-	"github.com/free5gc/nas/nasConvert"
 	"github.com/free5gc/nas/nasMessage"
 )
 
@@ -26,113 +25,14 @@ func (smContext *SMContext) HandlePDUSessionEstablishmentRequest(req *nasMessage
 		}
 	} else {
 		// Set to default supported PDU Session Type
-		switch SMF_Self().SupportedPDUSessionType {
-		case "IPv4":
-			smContext.SelectedPDUSessionType = nasMessage.PDUSessionTypeIPv4
-		case "IPv6":
-			smContext.SelectedPDUSessionType = nasMessage.PDUSessionTypeIPv6
-		case "IPv4v6":
-			smContext.SelectedPDUSessionType = nasMessage.PDUSessionTypeIPv4IPv6
-		case "Ethernet":
-			smContext.SelectedPDUSessionType = nasMessage.PDUSessionTypeEthernet
-		default:
-			smContext.SelectedPDUSessionType = nasMessage.PDUSessionTypeIPv4
-		}
+		smContext.SelectedPDUSessionType = defaultPDUSessionType()
 	}
 
 	if req.ExtendedProtocolConfigurationOptions != nil {
-		EPCOContents := req.ExtendedProtocolConfigurationOptions.GetExtendedProtocolConfigurationOptionsContents()
-		protocolConfigurationOptions := nasConvert.NewProtocolConfigurationOptions()
-		unmarshalErr := protocolConfigurationOptions.UnMarshal(EPCOContents)
-		if unmarshalErr != nil {
-			smContext.SubGsmLog.Errorf("Parsing PCO failed: %s", unmarshalErr)
-		}
-		smContext.SubGsmLog.Infoln("Protocol Configuration Options")
-		smContext.SubGsmLog.Infoln(protocolConfigurationOptions)
-
-		//Send MTU to UE always even if UE does not request it.
-		//Preconfiguring MTU request flag.
-		smContext.ProtocolConfigurationOptions.IPv4LinkMTURequest = true
-
-		for _, container := range protocolConfigurationOptions.ProtocolOrContainerList {
-			smContext.SubGsmLog.Traceln("Container ID: ", container.ProtocolOrContainerID)
-			smContext.SubGsmLog.Traceln("Container Length: ", container.LengthOfContents)
-			switch container.ProtocolOrContainerID {
-			case nasMessage.PCSCFIPv6AddressRequestUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type PCSCFIPv6AddressRequestUL")
-			case nasMessage.IMCNSubsystemSignalingFlagUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type IMCNSubsystemSignalingFlagUL")
-			case nasMessage.DNSServerIPv6AddressRequestUL:
-				smContext.ProtocolConfigurationOptions.DNSIPv6Request = true
-			case nasMessage.NotSupportedUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type NotSupportedUL")
-			case nasMessage.MSSupportOfNetworkRequestedBearerControlIndicatorUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type MSSupportOfNetworkRequestedBearerControlIndicatorUL")
-			case nasMessage.DSMIPv6HomeAgentAddressRequestUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type DSMIPv6HomeAgentAddressRequestUL")
-			case nasMessage.DSMIPv6HomeNetworkPrefixRequestUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type DSMIPv6HomeNetworkPrefixRequestUL")
-			case nasMessage.DSMIPv6IPv4HomeAgentAddressRequestUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type DSMIPv6IPv4HomeAgentAddressRequestUL")
-			case nasMessage.IPAddressAllocationViaNASSignallingUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type IPAddressAllocationViaNASSignallingUL")
-			case nasMessage.IPv4AddressAllocationViaDHCPv4UL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type IPv4AddressAllocationViaDHCPv4UL")
-			case nasMessage.PCSCFIPv4AddressRequestUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type PCSCFIPv4AddressRequestUL")
-			case nasMessage.DNSServerIPv4AddressRequestUL:
-				smContext.ProtocolConfigurationOptions.DNSIPv4Request = true
-			case nasMessage.MSISDNRequestUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type MSISDNRequestUL")
-			case nasMessage.IFOMSupportRequestUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type IFOMSupportRequestUL")
-			case nasMessage.MSSupportOfLocalAddressInTFTIndicatorUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type MSSupportOfLocalAddressInTFTIndicatorUL")
-			case nasMessage.PCSCFReSelectionSupportUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type PCSCFReSelectionSupportUL")
-			case nasMessage.NBIFOMRequestIndicatorUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type NBIFOMRequestIndicatorUL")
-			case nasMessage.NBIFOMModeUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type NBIFOMModeUL")
-			case nasMessage.NonIPLinkMTURequestUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type NonIPLinkMTURequestUL")
-			case nasMessage.APNRateControlSupportIndicatorUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type APNRateControlSupportIndicatorUL")
-			case nasMessage.UEStatus3GPPPSDataOffUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type UEStatus3GPPPSDataOffUL")
-			case nasMessage.ReliableDataServiceRequestIndicatorUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type ReliableDataServiceRequestIndicatorUL")
-			case nasMessage.AdditionalAPNRateControlForExceptionDataSupportIndicatorUL:
-				smContext.SubGsmLog.Infoln(
-					"Didn't Implement container type AdditionalAPNRateControlForExceptionDataSupportIndicatorUL",
-				)
-			case nasMessage.PDUSessionIDUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type PDUSessionIDUL")
-			case nasMessage.EthernetFramePayloadMTURequestUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type EthernetFramePayloadMTURequestUL")
-			case nasMessage.UnstructuredLinkMTURequestUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type UnstructuredLinkMTURequestUL")
-			case nasMessage.I5GSMCauseValueUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type 5GSMCauseValueUL")
-			case nasMessage.QoSRulesWithTheLengthOfTwoOctetsSupportIndicatorUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type QoSRulesWithTheLengthOfTwoOctetsSupportIndicatorUL")
-			case nasMessage.QoSFlowDescriptionsWithTheLengthOfTwoOctetsSupportIndicatorUL:
-				smContext.SubGsmLog.Infoln(
-					"Didn't Implement container type QoSFlowDescriptionsWithTheLengthOfTwoOctetsSupportIndicatorUL",
-				)
-			case nasMessage.LinkControlProtocolUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type LinkControlProtocolUL")
-			case nasMessage.PushAccessControlProtocolUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type PushAccessControlProtocolUL")
-			case nasMessage.ChallengeHandshakeAuthenticationProtocolUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type ChallengeHandshakeAuthenticationProtocolUL")
-			case nasMessage.InternetProtocolControlProtocolUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type InternetProtocolControlProtocolUL")
-			default:
-				smContext.SubGsmLog.Infof("Unknown Container ID [%d]", container.ProtocolOrContainerID)
-			}
-		}
+		smContext.HandlePCO(req.ExtendedProtocolConfigurationOptions.GetExtendedProtocolConfigurationOptionsContents())
 	}
+
+	smContext.handleAlwaysOnRequest(req)
 }
 
 func (smContext *SMContext) HandlePDUSessionReleaseRequest(req *nasMessage.PDUSessionReleaseRequest) {
@@ -146,3 +46,27 @@ func (smContext *SMContext) HandlePDUSessionReleaseRequest(req *nasMessage.PDUSe
 		smContext.DNNInfo.UeIPAllocator.Release(ip)
 	}
 }
+
+//defaultPDUSessionType is PDU session type supported by SMF, for UE requesting none
+func defaultPDUSessionType() uint8 {
+	switch SMF_Self().SupportedPDUSessionType {
+	case "IPv6":
+		return nasMessage.PDUSessionTypeIPv6
+	case "IPv4v6":
+		return nasMessage.PDUSessionTypeIPv4IPv6
+	case "Ethernet":
+		return nasMessage.PDUSessionTypeEthernet
+	default:
+		return nasMessage.PDUSessionTypeIPv4
+	}
+}
+
+//SetRequestedPDUSessionType takes PDU session type UE requested for home-routed session,
+//H-SMF checks it against subscription and answers the type selected
+func (smContext *SMContext) SetRequestedPDUSessionType(req *nasMessage.PDUSessionEstablishmentRequest) {
+	if req.PDUSessionType != nil {
+		smContext.SelectedPDUSessionType = req.PDUSessionType.GetPDUSessionTypeValue()
+		return
+	}
+	smContext.SelectedPDUSessionType = defaultPDUSessionType()
+}
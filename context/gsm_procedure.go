@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+//GsmProcedureState of 5GSM procedure on network side(TS 24.501 6.1.3.3)
+type GsmProcedureState uint8
+
+const (
+	//Network message sent, UE's answer awaited
+	GsmProcedurePending GsmProcedureState = iota
+	//Procedure ended, kept to answer duplicate UE request
+	GsmProcedureCompleted
+)
+
+func (s GsmProcedureState) String() string {
+	switch s {
+	case GsmProcedurePending:
+		return "Pending"
+	case GsmProcedureCompleted:
+		return "Completed"
+	default:
+		return "Unknown"
+	}
+}
+
+//GsmProcedure is 5GSM procedure of PDU session, identified by PTI. Network initiated
+//procedures run with PTI 0
+type GsmProcedure struct {
+	Pti uint8
+	//UE request starting procedure, 0 if network initiated
+	ReqMsgType uint8
+	//Network message UE was sent, command or answer to UE request
+	RspMsgType uint8
+	State      GsmProcedureState
+	//T3591/T3592 running while UE's answer to command is awaited
+	Timer *GsmTimer
+	//Times command was retransmitted
+	RetransmitTimes int
+	//Encoded network message, resent to duplicate UE request
+	RspN1SmMsg []byte
+}
+
+//GsmProcedure is procedure with PTI, nil if none. Caller holds SM context lock
+func (smContext *SMContext) GsmProcedure(pti uint8) *GsmProcedure {
+	return smContext.GsmProcedures[pti]
+}
+
+//NewGsmProcedure opens pending procedure with PTI, procedure PTI was used for before is ended.
+//Caller holds SM context lock
+func (smContext *SMContext) NewGsmProcedure(pti, reqMsgType, rspMsgType uint8, rspN1SmMsg []byte) *GsmProcedure {
+	if smContext.GsmProcedures == nil {
+		smContext.GsmProcedures = make(map[uint8]*GsmProcedure)
+	}
+	if procedure := smContext.GsmProcedures[pti]; procedure != nil {
+		procedure.stopTimer()
+	}
+	//UE moved on to new PTI, earlier request of the type won't be retransmitted
+	for id, procedure := range smContext.GsmProcedures {
+		if reqMsgType != 0 && procedure.ReqMsgType == reqMsgType && procedure.State == GsmProcedureCompleted {
+			delete(smContext.GsmProcedures, id)
+		}
+	}
+
+	procedure := &GsmProcedure{
+		Pti:        pti,
+		ReqMsgType: reqMsgType,
+		RspMsgType: rspMsgType,
+		State:      GsmProcedurePending,
+		RspN1SmMsg: rspN1SmMsg,
+	}
+	smContext.GsmProcedures[pti] = procedure
+	smContext.SubGsmLog.Debugf("5GSM procedure PTI [%v] started, request [%v], network message [%v]",
+		pti, reqMsgType, rspMsgType)
+	return procedure
+}
+
+//CompleteGsmProcedure ends procedure, UE requested one is kept to answer duplicate request.
+//Caller holds SM context lock
+func (smContext *SMContext) CompleteGsmProcedure(procedure *GsmProcedure) {
+	procedure.stopTimer()
+	procedure.State = GsmProcedureCompleted
+	if procedure.ReqMsgType == 0 && smContext.GsmProcedures[procedure.Pti] == procedure {
+		delete(smContext.GsmProcedures, procedure.Pti)
+	}
+	smContext.SubGsmLog.Debugf("5GSM procedure PTI [%v] completed, retransmissions [%v]",
+		procedure.Pti, procedure.RetransmitTimes)
+}
+
+//PendingGsmProcedure is procedure awaiting UE's answer to network message type, nil if none.
+//Caller holds SM context lock
+func (smContext *SMContext) PendingGsmProcedure(rspMsgType uint8) *GsmProcedure {
+	for _, procedure := range smContext.GsmProcedures {
+		if procedure.State == GsmProcedurePending && procedure.RspMsgType == rspMsgType {
+			return procedure
+		}
+	}
+	return nil
+}
+
+//StopGsmProcedures stops timers of all procedures and clears table, SM context is going away.
+//Caller holds SM context lock
+func (smContext *SMContext) StopGsmProcedures() {
+	for _, procedure := range smContext.GsmProcedures {
+		procedure.stopTimer()
+	}
+	smContext.GsmProcedures = nil
+}
+
+func (procedure *GsmProcedure) stopTimer() {
+	if procedure.Timer != nil {
+		procedure.Timer.Stop()
+		procedure.Timer = nil
+	}
+}
@@ -0,0 +1,42 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/nas"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+)
+
+func TestGsmProcedures(t *testing.T) {
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 20)
+
+	//Network initiated modification, gone once completed
+	procedure := smContext.NewGsmProcedure(0, 0, nas.MsgTypePDUSessionModificationCommand, nil)
+	require.True(t, smContext.IsNwModificationPending())
+	smContext.CompleteGsmProcedure(procedure)
+	require.False(t, smContext.IsNwModificationPending())
+	require.Nil(t, smContext.GsmProcedure(0))
+
+	//UE requested release, kept for duplicate request
+	procedure = smContext.NewGsmProcedure(3, nas.MsgTypePDUSessionReleaseRequest,
+		nas.MsgTypePDUSessionReleaseCommand, []byte{0x2e})
+	smContext.CompleteGsmProcedure(procedure)
+	require.Equal(t, procedure, smContext.GsmProcedure(3))
+	require.Equal(t, context.GsmProcedureCompleted, procedure.State)
+	require.Nil(t, smContext.PendingGsmProcedure(nas.MsgTypePDUSessionReleaseCommand))
+
+	//Request of the type with new PTI drops it
+	smContext.NewGsmProcedure(4, nas.MsgTypePDUSessionReleaseRequest, nas.MsgTypePDUSessionReleaseCommand, nil)
+	require.Nil(t, smContext.GsmProcedure(3))
+	require.NotNil(t, smContext.PendingGsmProcedure(nas.MsgTypePDUSessionReleaseCommand))
+
+	smContext.StopGsmProcedures()
+	require.Nil(t, smContext.GsmProcedure(4))
+}
@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"sync"
+	"time"
+
+	"github.com/free5gc/smf/factory"
+)
+
+//5GSM network timers, TS 24.501 10.3
+const (
+	DefaultT3591ExpireTime = 16 * time.Second
+	DefaultT3592ExpireTime = 16 * time.Second
+	//Message is sent 5 times in total
+	DefaultGsmTimerMaxRetryTimes = 4
+)
+
+//GsmTimerConfig holds expiry and retransmissions of 5GSM network timer
+type GsmTimerConfig struct {
+	ExpireTime    time.Duration
+	MaxRetryTimes int
+}
+
+func initGsmTimerConfig(t3591, t3592 *factory.Timer) {
+	smfContext.T3591 = newGsmTimerConfig(t3591, DefaultT3591ExpireTime)
+	smfContext.T3592 = newGsmTimerConfig(t3592, DefaultT3592ExpireTime)
+}
+
+func newGsmTimerConfig(timer *factory.Timer, expireTime time.Duration) GsmTimerConfig {
+	config := GsmTimerConfig{
+		ExpireTime:    expireTime,
+		MaxRetryTimes: DefaultGsmTimerMaxRetryTimes,
+	}
+	if timer == nil {
+		return config
+	}
+	if timer.ExpireTime > 0 {
+		config.ExpireTime = time.Duration(timer.ExpireTime) * time.Second
+	}
+	if timer.MaxRetryTimes > 0 {
+		config.MaxRetryTimes = timer.MaxRetryTimes
+	}
+	return config
+}
+
+//GsmTimer drives retransmission of 5GSM message till UE answers, onExpire retransmits
+//and onFail is called once retransmissions run out
+type GsmTimer struct {
+	lock        sync.Mutex
+	config      GsmTimerConfig
+	timer       *time.Timer
+	expireTimes int
+	stopped     bool
+	onExpire    func(expireTimes int)
+	onFail      func()
+}
+
+//NewGsmTimer returns timer, it runs once started
+func NewGsmTimer(config GsmTimerConfig, onExpire func(expireTimes int), onFail func()) *GsmTimer {
+	return &GsmTimer{
+		config:   config,
+		onExpire: onExpire,
+		onFail:   onFail,
+	}
+}
+
+func (t *GsmTimer) Start() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.stopped {
+		return
+	}
+	t.timer = time.AfterFunc(t.config.ExpireTime, t.expire)
+}
+
+//Stop stops timer, callbacks already running aren't waited for
+func (t *GsmTimer) Stop() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.stopped = true
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+func (t *GsmTimer) ExpireTimes() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.expireTimes
+}
+
+func (t *GsmTimer) expire() {
+	t.lock.Lock()
+	if t.stopped {
+		t.lock.Unlock()
+		return
+	}
+	t.expireTimes++
+	if t.expireTimes > t.config.MaxRetryTimes {
+		t.stopped = true
+		t.lock.Unlock()
+		t.onFail()
+		return
+	}
+	t.timer = time.AfterFunc(t.config.ExpireTime, t.expire)
+	expireTimes := t.expireTimes
+	t.lock.Unlock()
+
+	t.onExpire(expireTimes)
+}
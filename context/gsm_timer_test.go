@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/smf/context"
+)
+
+func TestGsmTimer(t *testing.T) {
+	config := context.GsmTimerConfig{ExpireTime: 10 * time.Millisecond, MaxRetryTimes: 2}
+
+	expired := make(chan int, 4)
+	failed := make(chan struct{}, 1)
+	timer := context.NewGsmTimer(config,
+		func(expireTimes int) { expired <- expireTimes },
+		func() { failed <- struct{}{} })
+	timer.Start()
+
+	require.Equal(t, 1, <-expired)
+	require.Equal(t, 2, <-expired)
+	select {
+	case <-failed:
+	case <-time.After(time.Second):
+		t.Fatal("retransmissions not exhausted")
+	}
+	require.Empty(t, expired)
+
+	//UE answered before expiry
+	timer = context.NewGsmTimer(config,
+		func(expireTimes int) { expired <- expireTimes },
+		func() { failed <- struct{}{} })
+	timer.Start()
+	timer.Stop()
+	time.Sleep(5 * config.ExpireTime)
+	require.Empty(t, expired)
+	require.Empty(t, failed)
+	require.Zero(t, timer.ExpireTimes())
+}
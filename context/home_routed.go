@@ -0,0 +1,488 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/nas/nasConvert"
+	"github.com/free5gc/openapi/Nsmf_PDUSession"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/pfcp/pfcpType"
+	"github.com/free5gc/smf/qos"
+	errors "github.com/free5gc/smf/smferrors"
+)
+
+//N1 SM info content Ids in Nsmf_PDUSession Create/Update between V-SMF and H-SMF
+const (
+	N1SmInfoFromUe = "n1SmInfoFromUe"
+	N1SmInfoToUe   = "n1SmInfoToUe"
+)
+
+//SSC mode of session whose subscription has no SSC modes
+const DefaultSscMode = "SSC_MODE_1"
+
+//VsmfInfo is V-SMF side of home-routed PDU session, set when SMF acts as H-SMF
+type VsmfInfo struct {
+	VsmfId            string
+	VsmfPduSessionUri string
+	VcnTunnelInfo     *models.TunnelInfo
+}
+
+//HsmfInfo is H-SMF side of home-routed PDU session, set when SMF acts as V-SMF
+type HsmfInfo struct {
+	HsmfId        string
+	ApiRoot       string
+	PduSessionUri string //PDU session resource at H-SMF
+	VcnTunnelInfo *models.TunnelInfo
+	HcnTunnelInfo *models.TunnelInfo
+	N1SmInfoToUe  []byte //PDU Session Establishment Accept from H-SMF
+	Released      bool   //Session already released by H-SMF
+	Client        *Nsmf_PDUSession.APIClient
+}
+
+//VsmfUpdateRequest is H-SMF initiated Update towards V-SMF,
+//openapi has no client for it
+type VsmfUpdateRequest struct {
+	JsonData               *models.VsmfUpdateData `json:"jsonData,omitempty" multipart:"contentType:application/json"`
+	BinaryDataN1SmInfoToUe []byte                 `json:"binaryDataN1SmInfoToUe,omitempty" multipart:"contentType:application/vnd.3gpp.5gnas,ref:JsonData.N1SmInfoToUe.ContentId"`
+}
+
+//PduSessionCreateRequest is V-SMF Create of home-routed PDU session, openapi model
+//keeps N1 as *[]byte which its multipart codec can't handle
+type PduSessionCreateRequest struct {
+	JsonData                 *models.PduSessionCreateData `json:"jsonData,omitempty" multipart:"contentType:application/json"`
+	BinaryDataN1SmInfoFromUe []byte                       `json:"binaryDataN1SmInfoFromUe,omitempty" multipart:"contentType:application/vnd.3gpp.5gnas,ref:JsonData.N1SmInfoFromUe.ContentId"`
+}
+
+//IsHsmf tells if SM context is home-routed session served as H-SMF
+func (smContext *SMContext) IsHsmf() bool {
+	return smContext.Vsmf != nil
+}
+
+//IsVsmf tells if SM context is home-routed session served as V-SMF
+func (smContext *SMContext) IsVsmf() bool {
+	return smContext.Hsmf != nil
+}
+
+//IsHomeRoutedSession tells if SM context create is for home-routed session, either AMF
+//selected H-SMF or roaming subscriber asks for DNN of its HPLMN which is home-routed by
+//configuration of DNN, or not served by SMF at all
+func IsHomeRoutedSession(createData *models.SmContextCreateData) bool {
+	if createData.HSmfUri != "" {
+		return true
+	}
+	if createData.HplmnSnssai == nil || IsHomeSupi(createData.Supi) {
+		return false
+	}
+	if createData.SNssai == nil {
+		return true
+	}
+	dnnInfo := RetrieveDnnInformation(*createData.SNssai, createData.Dnn)
+	return dnnInfo == nil || dnnInfo.HomeRouted
+}
+
+//IsHomeSupi tells if IMSI belongs to one of PLMNs served by SMF
+func IsHomeSupi(supi string) bool {
+	if !strings.HasPrefix(supi, "imsi-") || len(SmfPlmnInfo) == 0 {
+		return true
+	}
+	imsi := strings.TrimPrefix(supi, "imsi-")
+	for _, plmn := range SmfPlmnInfo {
+		if strings.HasPrefix(imsi, plmn.Mcc+plmn.Mnc) {
+			return true
+		}
+	}
+	return false
+}
+
+//SetHsmf sets H-SMF to be used by V-SMF, hSmfUri is apiRoot of Nsmf_PDUSession at H-SMF
+func (smContext *SMContext) SetHsmf(hsmfId, hSmfUri string) {
+	if smContext.Hsmf == nil {
+		smContext.Hsmf = new(HsmfInfo)
+	}
+	smContext.Hsmf.HsmfId = hsmfId
+	smContext.Hsmf.ApiRoot = strings.TrimSuffix(hSmfUri, "/nsmf-pdusession/v1")
+
+	configuration := Nsmf_PDUSession.NewConfiguration()
+	configuration.SetBasePath(smContext.Hsmf.ApiRoot)
+	smContext.Hsmf.Client = Nsmf_PDUSession.NewAPIClient(configuration)
+}
+
+//HsmfPduSessionRef is pduSessionRef of home-routed session at H-SMF
+func (smContext *SMContext) HsmfPduSessionRef() string {
+	return path.Base(smContext.Hsmf.PduSessionUri)
+}
+
+func (smContext *SMContext) SetPduSessionCreateData(createData *models.PduSessionCreateData) {
+	smContext.Gpsi = createData.Gpsi
+	smContext.Supi = createData.Supi
+	smContext.Pei = createData.Pei
+	smContext.Dnn = createData.Dnn
+	smContext.Snssai = createData.SNssai
+	smContext.ServingNetwork = createData.ServingNetwork
+	smContext.AnType = createData.AnType
+	smContext.RatType = createData.RatType
+	smContext.UeLocation = createData.UeLocation
+	smContext.UeTimeZone = createData.UeTimeZone
+	smContext.AddUeLocation = createData.AddUeLocation
+	smContext.ServingNfId = createData.VsmfId
+	smContext.Vsmf = &VsmfInfo{
+		VsmfId:            createData.VsmfId,
+		VsmfPduSessionUri: createData.VsmfPduSessionUri,
+		VcnTunnelInfo:     createData.VcnTunnelInfo,
+	}
+}
+
+//ParseTunnelInfo returns IPv4 address and TEID of N9 tunnel
+func ParseTunnelInfo(tunnelInfo *models.TunnelInfo) (net.IP, uint32, error) {
+	if tunnelInfo == nil {
+		return nil, 0, fmt.Errorf("tunnel info missing")
+	}
+	ip := net.ParseIP(tunnelInfo.Ipv4Addr).To4()
+	if ip == nil {
+		return nil, 0, fmt.Errorf("invalid tunnel IPv4 address [%v]", tunnelInfo.Ipv4Addr)
+	}
+	teid, err := strconv.ParseUint(tunnelInfo.GtpTeid, 16, 32)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid tunnel TEID [%v]", tunnelInfo.GtpTeid)
+	}
+	return ip, uint32(teid), nil
+}
+
+//SetVcnTunnel points DL FARs of anchor UPF to V-CN tunnel, returns PDRs updated
+func (smContext *SMContext) SetVcnTunnel(tunnelInfo *models.TunnelInfo) ([]*PDR, error) {
+	ip, teid, err := ParseTunnelInfo(tunnelInfo)
+	if err != nil {
+		return nil, err
+	}
+	if smContext.Tunnel == nil {
+		return nil, fmt.Errorf("no user plane tunnel")
+	}
+
+	smContext.Vsmf.VcnTunnelInfo = tunnelInfo
+	smContext.Tunnel.ANInformation.IPAddress = ip
+	smContext.Tunnel.ANInformation.TEID = teid
+
+	var pdrList []*PDR
+	for _, dataPath := range smContext.Tunnel.DataPathPool {
+		if !dataPath.Activated {
+			continue
+		}
+		for _, DLPDR := range dataPath.FirstDPNode.DownLinkTunnel.PDR {
+			DLPDR.FAR.ApplyAction = pfcpType.ApplyAction{Buff: false, Drop: false, Dupl: false, Forw: true, Nocp: false}
+			DLPDR.FAR.ForwardingParameters = &ForwardingParameters{
+				DestinationInterface: pfcpType.DestinationInterface{
+					InterfaceValue: pfcpType.DestinationInterfaceAccess,
+				},
+				NetworkInstance: []byte(smContext.Dnn),
+				OuterHeaderCreation: &pfcpType.OuterHeaderCreation{
+					OuterHeaderCreationDescription: pfcpType.OuterHeaderCreationGtpUUdpIpv4,
+					Ipv4Address:                    ip,
+					Teid:                           teid,
+				},
+			}
+			pdrList = append(pdrList, DLPDR)
+		}
+	}
+	smContext.UpCnxState = models.UpCnxState_ACTIVATED
+	return pdrList, nil
+}
+
+//HcnTunnelInfo is H-CN tunnel of anchor UPF towards V-UPF
+func (smContext *SMContext) HcnTunnelInfo() (*models.TunnelInfo, error) {
+	if smContext.Tunnel == nil {
+		return nil, fmt.Errorf("no user plane tunnel")
+	}
+	ANUPF := smContext.Tunnel.DataPathPool.GetDefaultPath().FirstDPNode
+	return smContext.n9TunnelInfo(ANUPF.UPF, ANUPF.UpLinkTunnel.TEID)
+}
+
+//n9TunnelInfo is N9 endpoint of UPF, N3 interface is used if UPF has no N9
+func (smContext *SMContext) n9TunnelInfo(upf *UPF, teid uint32) (*models.TunnelInfo, error) {
+	iface := upf.GetInterface(models.UpInterfaceType_N9, smContext.Dnn)
+	if iface == nil {
+		if len(upf.N3Interfaces) == 0 {
+			return nil, fmt.Errorf("no N9/N3 interface at UPF")
+		}
+		iface = &upf.N3Interfaces[0]
+	}
+	ip, err := iface.IP(smContext.SelectedPDUSessionType)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TunnelInfo{
+		Ipv4Addr: ip.String(),
+		GtpTeid:  fmt.Sprintf("%08x", teid),
+	}, nil
+}
+
+//BuildPduSessionCreatedData builds H-SMF response to V-SMF, N1 is sent alongside
+func (smContext *SMContext) BuildPduSessionCreatedData() (*models.PduSessionCreatedData, error) {
+	if len(smContext.SmPolicyUpdates) == 0 {
+		return nil, fmt.Errorf("no SM policy decision")
+	}
+	policyUpdate := smContext.SmPolicyUpdates[0]
+	sessRule := smContext.SelectedSessionRule()
+	if sessRule == nil || sessRule.AuthDefQos == nil {
+		return nil, fmt.Errorf("no session rule")
+	}
+
+	hcnTunnelInfo, err := smContext.HcnTunnelInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	qosRulesBytes, err := qos.BuildQosRules(policyUpdate).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	authQfd := qos.BuildAuthorizedQosFlowDescriptions(policyUpdate)
+
+	createdData := &models.PduSessionCreatedData{
+		PduSessionType: nasConvert.PDUSessionTypeToModels(smContext.SelectedPDUSessionType),
+		SscMode:        string(SscModeToModels(smContext.SscMode)),
+		HcnTunnelInfo:  hcnTunnelInfo,
+		SessionAmbr:    sessRule.AuthSessAmbr,
+		QosFlowsSetupList: []models.QosFlowSetupItem{
+			{
+				Qfi:                sessRule.AuthDefQos.Var5qi,
+				QosRules:           base64.StdEncoding.EncodeToString(qosRulesBytes),
+				QosFlowDescription: base64.StdEncoding.EncodeToString(authQfd.Content),
+				QosFlowProfile: &models.QosFlowProfile{
+					Var5qi: sessRule.AuthDefQos.Var5qi,
+					Arp:    sessRule.AuthDefQos.Arp,
+				},
+			},
+		},
+		HSmfInstanceId: SMF_Self().NfInstanceID,
+		PduSessionId:   smContext.PDUSessionID,
+		SNssai:         smContext.Snssai,
+		N1SmInfoToUe:   &models.RefToBinaryData{ContentId: N1SmInfoToUe},
+	}
+	if smContext.PDUAddress != nil {
+		createdData.UeIpv4Address = smContext.PDUAddress.String()
+	}
+	return createdData, nil
+}
+
+//GeneratePduSessionCreateReject builds H-SMF reject of Create, with N1 reject to UE
+func (smContext *SMContext) GeneratePduSessionCreateReject(cause string) *http_wrapper.Response {
+	createError := &models.PduSessionCreateError{
+		Error: errors.ErrorType[cause],
+	}
+	rsp := models.PostPduSessionsErrorResponse{JsonData: createError}
+
+	n1smCause := errors.ErrorCause[cause]
+	createError.N1smCause = strconv.Itoa(int(n1smCause))
+	if buf, err := BuildGSMPDUSessionEstablishmentReject(smContext, n1smCause,
+		SMF_Self().CongestionControl.StartBackOff(smContext, cause)); err != nil {
+		smContext.SubGsmLog.Errorf("build GSM PDUSessionEstablishmentReject failed: %v", err)
+	} else {
+		createError.N1SmInfoToUe = &models.RefToBinaryData{ContentId: N1SmInfoToUe}
+		rsp.BinaryDataN1SmInfoToUe = buf
+	}
+
+	status := http.StatusInternalServerError
+	if createError.Error != nil {
+		status = int(createError.Error.Status)
+	}
+	return &http_wrapper.Response{
+		Status: status,
+		Body:   rsp,
+	}
+}
+
+//anchorDPNode is last UPF of data path
+func anchorDPNode(dataPath *DataPath) *DataPathNode {
+	node := dataPath.FirstDPNode
+	for node.Next() != nil {
+		node = node.Next()
+	}
+	return node
+}
+
+//SetupVcnTunnel selects V-UPF and allocates its N9 tunnel towards H-UPF,
+//PDRs are activated once H-SMF provides UE IP and QoS
+func (smContext *SMContext) SetupVcnTunnel() (*models.TunnelInfo, error) {
+	upfSelectionParams := &UPFSelectionParams{
+		Dnn: smContext.Dnn,
+		SNssai: &SNssai{
+			Sst: smContext.Snssai.Sst,
+			Sd:  smContext.Snssai.Sd,
+		},
+	}
+	defaultUPPath := GetUserPlaneInformation().GetDefaultUserPlanePathByDNN(upfSelectionParams)
+	dataPath := GenerateDataPath(defaultUPPath, smContext)
+	if dataPath == nil {
+		return nil, fmt.Errorf("data path not found for selection param %v", upfSelectionParams.String())
+	}
+	if err := dataPath.validateDataPathUpfStatus(); err != nil {
+		return nil, err
+	}
+
+	//No PCC rules till H-SMF answers, default PDRs
+	smContext.SmPolicyUpdates = append(smContext.SmPolicyUpdates,
+		qos.BuildSmPolicyUpdate(&smContext.SmPolicyData, &models.SmPolicyDecision{}))
+
+	smContext.Tunnel = NewUPTunnel()
+	dataPath.IsDefaultPath = true
+	smContext.Tunnel.AddDataPath(dataPath)
+	smContext.AllocateLocalSEIDForDataPath(dataPath)
+	if err := dataPath.ActivateUlDlTunnel(smContext); err != nil {
+		return nil, err
+	}
+
+	anchor := anchorDPNode(dataPath)
+	vcnTunnelInfo, err := smContext.n9TunnelInfo(anchor.UPF, anchor.DownLinkTunnel.TEID)
+	if err != nil {
+		return nil, err
+	}
+	smContext.Hsmf.VcnTunnelInfo = vcnTunnelInfo
+	return vcnTunnelInfo, nil
+}
+
+//ReleaseVcnTunnel frees V-UPF data path of home-routed session H-SMF didn't set up,
+//no PFCP session is established at V-UPF till then
+func (smContext *SMContext) ReleaseVcnTunnel() {
+	if smContext.Tunnel == nil {
+		return
+	}
+	for _, dataPath := range smContext.Tunnel.DataPathPool {
+		dataPath.DeactivateTunnelAndPDR(smContext)
+	}
+	smContext.Tunnel = nil
+	smContext.Hsmf.VcnTunnelInfo = nil
+}
+
+//BuildPduSessionCreateData builds V-SMF request to H-SMF, N1 from UE is sent alongside
+func (smContext *SMContext) BuildPduSessionCreateData(createData *models.SmContextCreateData) *models.PduSessionCreateData {
+	self := SMF_Self()
+	snssai := smContext.Snssai
+	if smContext.HplmnSnssai != nil {
+		snssai = smContext.HplmnSnssai
+	}
+	return &models.PduSessionCreateData{
+		Supi:         smContext.Supi,
+		Pei:          createData.Pei,
+		Gpsi:         smContext.Gpsi,
+		PduSessionId: smContext.PDUSessionID,
+		Dnn:          smContext.Dnn,
+		SNssai:       snssai,
+		VsmfId:       self.NfInstanceID,
+		VsmfPduSessionUri: fmt.Sprintf("%s://%s:%d/nsmf-pdusession/v1/pdu-sessions/%s",
+			self.URIScheme, self.RegisterIPv4, self.SBIPort, smContext.Ref),
+		ServingNetwork: smContext.ServingNetwork,
+		RequestType:    createData.RequestType,
+		VcnTunnelInfo:  smContext.Hsmf.VcnTunnelInfo,
+		AnType:         smContext.AnType,
+		RatType:        smContext.RatType,
+		UeLocation:     smContext.UeLocation,
+		UeTimeZone:     smContext.UeTimeZone,
+		AddUeLocation:  smContext.AddUeLocation,
+		N1SmInfoFromUe: &models.RefToBinaryData{ContentId: N1SmInfoFromUe},
+		SelMode:        createData.SelMode,
+	}
+}
+
+//homeRoutedPolicyDecision turns QoS authorized by H-SMF into local policy decision
+func homeRoutedPolicyDecision(createdData *models.PduSessionCreatedData) *models.SmPolicyDecision {
+	sessRule := &models.SessionRule{
+		SessRuleId:   "HomeRouted",
+		AuthSessAmbr: createdData.SessionAmbr,
+	}
+	decision := &models.SmPolicyDecision{
+		SessRules: map[string]*models.SessionRule{sessRule.SessRuleId: sessRule},
+		QosDecs:   make(map[string]*models.QosData),
+	}
+
+	for _, flow := range createdData.QosFlowsSetupList {
+		var5qi := flow.Qfi
+		arp := &models.Arp{
+			PriorityLevel: 8,
+			PreemptCap:    models.PreemptionCapability_NOT_PREEMPT,
+			PreemptVuln:   models.PreemptionVulnerability_PREEMPTABLE,
+		}
+		if profile := flow.QosFlowProfile; profile != nil {
+			var5qi = profile.Var5qi
+			if profile.Arp != nil {
+				arp = profile.Arp
+			}
+		}
+
+		qosId := strconv.Itoa(int(flow.Qfi))
+		decision.QosDecs[qosId] = &models.QosData{QosId: qosId, Var5qi: var5qi, Arp: arp}
+
+		//First flow is the default one
+		if sessRule.AuthDefQos == nil {
+			sessRule.AuthDefQos = &models.AuthorizedDefaultQos{Var5qi: var5qi, Arp: arp}
+		}
+	}
+	return decision
+}
+
+//ApplyPduSessionCreatedData takes UE IP and QoS from H-SMF and points V-UPF towards H-CN tunnel
+func (smContext *SMContext) ApplyPduSessionCreatedData(createdData *models.PduSessionCreatedData) error {
+	if createdData.SessionAmbr == nil || len(createdData.QosFlowsSetupList) == 0 {
+		return fmt.Errorf("session AMBR or QoS flows missing")
+	}
+	ueIP := net.ParseIP(createdData.UeIpv4Address).To4()
+	if ueIP == nil {
+		return fmt.Errorf("invalid UE IPv4 address [%v]", createdData.UeIpv4Address)
+	}
+	hcnIP, hcnTeid, err := ParseTunnelInfo(createdData.HcnTunnelInfo)
+	if err != nil {
+		return err
+	}
+	vcnIP, vcnTeid, err := ParseTunnelInfo(smContext.Hsmf.VcnTunnelInfo)
+	if err != nil {
+		return err
+	}
+
+	smContext.Hsmf.HsmfId = createdData.HSmfInstanceId
+	smContext.Hsmf.HcnTunnelInfo = createdData.HcnTunnelInfo
+	smContext.PDUAddress = ueIP
+	if createdData.PduSessionType != "" {
+		smContext.SelectedPDUSessionType = nasConvert.ModelsToPDUSessionType(createdData.PduSessionType)
+	}
+	smContext.SmPolicyUpdates = []*qos.PolicyUpdate{
+		qos.BuildSmPolicyUpdate(&smContext.SmPolicyData, homeRoutedPolicyDecision(createdData)),
+	}
+
+	dataPath := smContext.Tunnel.DataPathPool.GetDefaultPath()
+	if err := dataPath.ActivatePDR(smContext, 255); err != nil {
+		return err
+	}
+
+	//UL goes to H-UPF, DL arrives on N9 tunnel instead of N6
+	anchor := anchorDPNode(dataPath)
+	for _, ULPDR := range anchor.UpLinkTunnel.PDR {
+		ULPDR.FAR.ForwardingParameters.DestinationInterface.InterfaceValue = pfcpType.DestinationInterfaceCore
+		ULPDR.FAR.ForwardingParameters.OuterHeaderCreation = &pfcpType.OuterHeaderCreation{
+			OuterHeaderCreationDescription: pfcpType.OuterHeaderCreationGtpUUdpIpv4,
+			Ipv4Address:                    hcnIP,
+			Teid:                           hcnTeid,
+		}
+	}
+	for _, DLPDR := range anchor.DownLinkTunnel.PDR {
+		DLPDR.PDI.SourceInterface = pfcpType.SourceInterface{InterfaceValue: pfcpType.SourceInterfaceCore}
+		DLPDR.PDI.LocalFTeid = &pfcpType.FTEID{
+			V4:          true,
+			Ipv4Address: vcnIP,
+			Teid:        vcnTeid,
+		}
+		DLPDR.OuterHeaderRemoval = &pfcpType.OuterHeaderRemoval{
+			OuterHeaderRemovalDescription: pfcpType.OuterHeaderRemovalGtpUUdpIpv4,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+)
+
+func TestParseTunnelInfo(t *testing.T) {
+	ip, teid, err := context.ParseTunnelInfo(&models.TunnelInfo{Ipv4Addr: "10.200.200.102", GtpTeid: "0000abcd"})
+	require.NoError(t, err)
+	require.True(t, ip.Equal(net.ParseIP("10.200.200.102")))
+	require.Equal(t, uint32(0xabcd), teid)
+
+	_, _, err = context.ParseTunnelInfo(nil)
+	require.Error(t, err)
+	_, _, err = context.ParseTunnelInfo(&models.TunnelInfo{Ipv4Addr: "2001:db8::1", GtpTeid: "1"})
+	require.Error(t, err)
+	_, _, err = context.ParseTunnelInfo(&models.TunnelInfo{Ipv4Addr: "10.200.200.102", GtpTeid: "xyz"})
+	require.Error(t, err)
+}
+
+func TestSetPduSessionCreateData(t *testing.T) {
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 17)
+	require.False(t, smContext.IsHsmf())
+
+	smContext.SetPduSessionCreateData(&models.PduSessionCreateData{
+		Supi:              "imsi-2089300007487",
+		Dnn:               "internet",
+		VsmfId:            "vsmf-instance",
+		VsmfPduSessionUri: "http://vsmf/nsmf-pdusession/v1/pdu-sessions/1",
+		VcnTunnelInfo:     &models.TunnelInfo{Ipv4Addr: "10.200.200.102", GtpTeid: "00000001"},
+	})
+	require.True(t, smContext.IsHsmf())
+	require.Equal(t, "internet", smContext.Dnn)
+	require.Equal(t, "vsmf-instance", smContext.Vsmf.VsmfId)
+	require.Equal(t, "vsmf-instance", smContext.ServingNfId)
+
+	//No user plane yet
+	_, err := smContext.SetVcnTunnel(smContext.Vsmf.VcnTunnelInfo)
+	require.Error(t, err)
+}
+
+func TestIsHomeRoutedSession(t *testing.T) {
+	defer func(info context.SmfSnssaiPlmnIdInfo) { context.SmfPlmnInfo = info }(context.SmfPlmnInfo)
+	context.SmfPlmnInfo = context.SmfSnssaiPlmnIdInfo{"1010203": models.PlmnId{Mcc: "208", Mnc: "93"}}
+
+	require.True(t, context.IsHomeSupi("imsi-2089300007487"))
+	require.False(t, context.IsHomeSupi("imsi-3102600007487"))
+	require.True(t, context.IsHomeSupi("nai-user@example.com"))
+
+	hplmnSnssai := &models.Snssai{Sst: 1, Sd: "010203"}
+	require.False(t, context.IsHomeRoutedSession(&models.SmContextCreateData{Supi: "imsi-3102600007487"}))
+	require.False(t, context.IsHomeRoutedSession(&models.SmContextCreateData{
+		Supi: "imsi-2089300007487", HplmnSnssai: hplmnSnssai}))
+	require.True(t, context.IsHomeRoutedSession(&models.SmContextCreateData{
+		Supi: "imsi-3102600007487", HplmnSnssai: hplmnSnssai}))
+	require.True(t, context.IsHomeRoutedSession(&models.SmContextCreateData{
+		Supi: "imsi-2089300007487", HSmfUri: "http://hsmf/nsmf-pdusession/v1"}))
+
+	//DNN served locally is home-routed only if configured so
+	snssai := &models.Snssai{Sst: 1, Sd: "010203"}
+	dnnInfo := &context.SnssaiSmfDnnInfo{}
+	context.SMF_Self().SnssaiInfos = append(context.SMF_Self().SnssaiInfos, context.SnssaiSmfInfo{
+		Snssai:   context.SNssai{Sst: snssai.Sst, Sd: snssai.Sd},
+		DnnInfos: map[string]*context.SnssaiSmfDnnInfo{"internet": dnnInfo},
+	})
+	defer func() {
+		infos := context.SMF_Self().SnssaiInfos
+		context.SMF_Self().SnssaiInfos = infos[:len(infos)-1]
+	}()
+	createData := &models.SmContextCreateData{Supi: "imsi-3102600007487", HplmnSnssai: hplmnSnssai,
+		SNssai: snssai, Dnn: "internet"}
+	require.False(t, context.IsHomeRoutedSession(createData))
+	dnnInfo.HomeRouted = true
+	require.True(t, context.IsHomeRoutedSession(createData))
+	createData.Dnn = "ims"
+	require.True(t, context.IsHomeRoutedSession(createData))
+}
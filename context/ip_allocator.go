@@ -80,6 +80,25 @@ func (a *IPAllocator) Allocate() (net.IP, error) {
 	}
 }
 
+// Reserve marks given IP address as allocated, used when session is transferred with its address
+func (a *IPAllocator) Reserve(ip net.IP) error {
+	if ip4 := ip.To4(); ip4 != nil && len(a.ipNetwork.IP) == net.IPv4len {
+		ip = ip4
+	}
+	if !a.ipNetwork.Contains(ip) {
+		return errors.New("ip reservation failed, address not in pool")
+	}
+	offset := int64(IPAddrOffset(ip, a.ipNetwork.IP))
+	if offset < a.g.minValue || offset > a.g.maxValue {
+		return errors.New("ip reservation failed, address not allocatable")
+	}
+	if a.g.isUsed[offset] {
+		return errors.New("ip reservation failed, address in use")
+	}
+	a.g.isUsed[offset] = true
+	return nil
+}
+
 func (a *IPAllocator) Release(ip net.IP) {
 	offset := IPAddrOffset(ip, a.ipNetwork.IP)
 	a.g.release(int64(offset))
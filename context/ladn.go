@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"time"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/factory"
+)
+
+//LadnPresenceHandler runs change of UE presence in LADN service area through SM context FSM
+type LadnPresenceHandler func(smContext *SMContext)
+
+var ladnPresenceHandler LadnPresenceHandler
+
+//RegisterLadnPresenceHandler is called by SMF FSM at init
+func RegisterLadnPresenceHandler(handler LadnPresenceHandler) {
+	ladnPresenceHandler = handler
+}
+
+//RequestLadnPresenceChange acts on UE leaving or returning to LADN service area, it doesn't
+//wait for user plane to be updated
+func RequestLadnPresenceChange(smContext *SMContext) {
+	if ladnPresenceHandler == nil {
+		smContext.SubCtxLog.Errorf("LADN presence change, no handler registered")
+		return
+	}
+	ladnPresenceHandler(smContext)
+}
+
+//DefaultLadnReleaseTimer is how long PDU session is kept after UE left LADN service area, if DNN config has none
+const DefaultLadnReleaseTimer = 60 * time.Second
+
+//LadnInfo is service area of LADN DNN(TS 23.501 5.6.5)
+type LadnInfo struct {
+	Tais []models.Tai
+	//PDU session is released if UE doesn't return to service area in time
+	ReleaseTimer time.Duration
+}
+
+func NewLadnInfo(config *factory.Ladn) *LadnInfo {
+	if config == nil {
+		return nil
+	}
+	info := &LadnInfo{
+		Tais:         config.Tais,
+		ReleaseTimer: time.Duration(config.ReleaseTimer) * time.Second,
+	}
+	if info.ReleaseTimer == 0 {
+		info.ReleaseTimer = DefaultLadnReleaseTimer
+	}
+	return info
+}
+
+//serves tells if tracking area is in service area, PLMN is matched only if configured
+func (info *LadnInfo) serves(tai *models.Tai) bool {
+	if tai == nil {
+		return false
+	}
+	for _, t := range info.Tais {
+		if t.Tac != tai.Tac {
+			continue
+		}
+		if t.PlmnId == nil || tai.PlmnId == nil || *t.PlmnId == *tai.PlmnId {
+			return true
+		}
+	}
+	return false
+}
+
+//IsLadn tells if PDU session is to LADN DNN
+func (smContext *SMContext) IsLadn() bool {
+	return smContext.DNNInfo != nil && smContext.DNNInfo.Ladn != nil
+}
+
+//LadnPresence is presence of UE in LADN service area reported by AMF, found from UE location
+//if AMF didn't report it
+func (smContext *SMContext) LadnPresence() models.PresenceState {
+	switch smContext.PresenceInLadn {
+	case models.PresenceState_IN_AREA, models.PresenceState_OUT_OF_AREA:
+		return smContext.PresenceInLadn
+	}
+	if !smContext.IsLadn() {
+		return models.PresenceState_UNKNOWN
+	}
+	tai := ueTai(smContext.UeLocation)
+	switch {
+	case tai == nil:
+		return models.PresenceState_UNKNOWN
+	case smContext.DNNInfo.Ladn.serves(tai):
+		return models.PresenceState_IN_AREA
+	default:
+		return models.PresenceState_OUT_OF_AREA
+	}
+}
+
+//IsOutOfLadnServiceArea tells if UE is known to be outside service area of LADN DNN
+func (smContext *SMContext) IsOutOfLadnServiceArea() bool {
+	return smContext.IsLadn() && smContext.LadnPresence() == models.PresenceState_OUT_OF_AREA
+}
+
+//StartLadnRelease starts release timer of session UE left LADN service area with, onExpire is
+//run unless UE returns in time. Caller holds SM context lock
+func (smContext *SMContext) StartLadnRelease(onExpire func()) *time.Timer {
+	smContext.StopLadnRelease()
+	releaseTimer := DefaultLadnReleaseTimer
+	if smContext.IsLadn() && smContext.DNNInfo.Ladn.ReleaseTimer > 0 {
+		releaseTimer = smContext.DNNInfo.Ladn.ReleaseTimer
+	}
+	smContext.ladnRelease = time.AfterFunc(releaseTimer, onExpire)
+	smContext.SubPduSessLog.Infof("UE out of LADN service area, PDU session released in [%v]", releaseTimer)
+	return smContext.ladnRelease
+}
+
+//StopLadnRelease stops release timer, UE returned to LADN service area. Caller holds SM context lock
+func (smContext *SMContext) StopLadnRelease() {
+	if smContext.ladnRelease != nil {
+		smContext.ladnRelease.Stop()
+		smContext.ladnRelease = nil
+	}
+}
+
+//IsLadnReleasePending tells if session is kept with user plane deactivated until UE returns to
+//LADN service area
+func (smContext *SMContext) IsLadnReleasePending() bool {
+	return smContext.ladnRelease != nil
+}
+
+//IsLadnRelease tells if release timer is the one running, it isn't once stopped or restarted
+func (smContext *SMContext) IsLadnRelease(timer *time.Timer) bool {
+	return timer != nil && smContext.ladnRelease == timer
+}
@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+	"github.com/free5gc/smf/factory"
+)
+
+func TestLadnPresence(t *testing.T) {
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 10,
+		smctxtest.WithDnnInfo(&context.SnssaiSmfDnnInfo{}), smctxtest.WithUeLocation("000003"))
+
+	//Not LADN DNN
+	require.False(t, smContext.IsLadn())
+	require.False(t, smContext.IsOutOfLadnServiceArea())
+
+	smContext.DNNInfo.Ladn = context.NewLadnInfo(&factory.Ladn{
+		Tais: []models.Tai{
+			{Tac: "000001"},
+			{PlmnId: &models.PlmnId{Mcc: "208", Mnc: "93"}, Tac: "000002"},
+		},
+	})
+	require.True(t, smContext.IsLadn())
+	require.Equal(t, context.DefaultLadnReleaseTimer, smContext.DNNInfo.Ladn.ReleaseTimer)
+
+	//Presence found from UE location if AMF didn't report it
+	require.Equal(t, models.PresenceState_OUT_OF_AREA, smContext.LadnPresence())
+	require.True(t, smContext.IsOutOfLadnServiceArea())
+	smContext.UeLocation = smctxtest.UeLocation("000001")
+	require.Equal(t, models.PresenceState_IN_AREA, smContext.LadnPresence())
+	smContext.UeLocation = &models.UserLocation{NrLocation: &models.NrLocation{
+		Tai: &models.Tai{PlmnId: &models.PlmnId{Mcc: "208", Mnc: "95"}, Tac: "000002"},
+	}}
+	require.Equal(t, models.PresenceState_OUT_OF_AREA, smContext.LadnPresence())
+	smContext.UeLocation = nil
+	require.Equal(t, models.PresenceState_UNKNOWN, smContext.LadnPresence())
+	require.False(t, smContext.IsOutOfLadnServiceArea())
+
+	//Presence reported by AMF
+	smContext.PresenceInLadn = models.PresenceState_OUT_OF_AREA
+	require.True(t, smContext.IsOutOfLadnServiceArea())
+	smContext.UeLocation = smctxtest.UeLocation("000001")
+	smContext.PresenceInLadn = models.PresenceState_INACTIVE
+	require.Equal(t, models.PresenceState_IN_AREA, smContext.LadnPresence())
+}
+
+func TestLadnRelease(t *testing.T) {
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 10,
+		smctxtest.WithDnnInfo(&context.SnssaiSmfDnnInfo{
+			Ladn: &context.LadnInfo{ReleaseTimer: 10 * time.Millisecond},
+		}))
+
+	expired := make(chan struct{}, 1)
+	timer := smContext.StartLadnRelease(func() { expired <- struct{}{} })
+	require.True(t, smContext.IsLadnReleasePending())
+	require.True(t, smContext.IsLadnRelease(timer))
+	select {
+	case <-expired:
+	case <-time.After(time.Second):
+		t.Fatal("release timer didn't expire")
+	}
+
+	//UE returned to service area
+	timer = smContext.StartLadnRelease(func() { expired <- struct{}{} })
+	smContext.StopLadnRelease()
+	require.False(t, smContext.IsLadnReleasePending())
+	require.False(t, smContext.IsLadnRelease(timer))
+	select {
+	case <-expired:
+		t.Fatal("stopped release timer expired")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -188,3 +188,39 @@ func HandleHandoverRequestAcknowledgeTransfer(b []byte, ctx *SMContext) (err err
 
 	return nil
 }
+
+//HandlePDUSessionResourceNotifyTransfer returns QoS flows RAN notified of, true if
+//their QoS is fulfilled again
+func HandlePDUSessionResourceNotifyTransfer(b []byte, ctx *SMContext) (map[uint8]bool, error) {
+	notifyTransfer := ngapType.PDUSessionResourceNotifyTransfer{}
+
+	if err := aper.UnmarshalWithParams(b, &notifyTransfer, "valueExt"); err != nil {
+		return nil, err
+	}
+
+	notifiedFlows := make(map[uint8]bool)
+	if notifyTransfer.QosFlowNotifyList != nil {
+		for _, item := range notifyTransfer.QosFlowNotifyList.List {
+			notifiedFlows[uint8(item.QosFlowIdentifier.Value)] =
+				item.NotificationCause.Value == ngapType.NotificationCausePresentFulfilled
+		}
+	}
+	return notifiedFlows, nil
+}
+
+//HandlePDUSessionResourceModifyResponseTransfer returns QoS flows RAN failed to add or modify
+func HandlePDUSessionResourceModifyResponseTransfer(b []byte, ctx *SMContext) ([]uint8, error) {
+	modifyResponseTransfer := ngapType.PDUSessionResourceModifyResponseTransfer{}
+
+	if err := aper.UnmarshalWithParams(b, &modifyResponseTransfer, "valueExt"); err != nil {
+		return nil, err
+	}
+
+	failedFlows := make([]uint8, 0)
+	if modifyResponseTransfer.QosFlowFailedToAddOrModifyList != nil {
+		for _, item := range modifyResponseTransfer.QosFlowFailedToAddOrModifyList.List {
+			failedFlows = append(failedFlows, uint8(item.QosFlowIdentifier.Value))
+		}
+	}
+	return failedFlows, nil
+}
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import "github.com/free5gc/pfcp/pfcpType"
+
+//NwReleaseHandler runs network requested PDU session release through SM context FSM
+type NwReleaseHandler func(smContext *SMContext, cause uint8)
+
+var nwReleaseHandler NwReleaseHandler
+
+//RegisterNwReleaseHandler is called by SMF FSM at init
+func RegisterNwReleaseHandler(handler NwReleaseHandler) {
+	nwReleaseHandler = handler
+}
+
+//RequestNwRelease starts network requested release of PDU session with 5GSM cause,
+//it doesn't wait for the release to complete
+func RequestNwRelease(smContext *SMContext, cause uint8) {
+	if nwReleaseHandler == nil {
+		smContext.SubCtxLog.Errorf("network requested release, no handler registered")
+		return
+	}
+	nwReleaseHandler(smContext, cause)
+}
+
+//RequestNwReleaseOfUpfSessions starts network requested release of PDU sessions with PFCP
+//session at UPF which failed or lost its sessions, returns number of sessions. Caller doesn't
+//hold UPF lock
+func RequestNwReleaseOfUpfSessions(nodeID pfcpType.NodeID, cause uint8) int {
+	nodeIP := nodeID.ResolveNodeIdToIp().String()
+	released := 0
+	RangeSMContexts(func(smContext *SMContext) bool {
+		smContext.SMLock.Lock()
+		_, exist := smContext.PFCPContext[nodeIP]
+		smContext.SMLock.Unlock()
+		if exist {
+			RequestNwRelease(smContext, cause)
+			released++
+		}
+		return true
+	})
+	return released
+}
+
+//IsNwReleaseInProgress tells if PDU session is being released on network's request
+func (smContext *SMContext) IsNwReleaseInProgress() bool {
+	return smContext.ReleaseCause5gSMValue != 0 && smContext.SMContextState == SmStateInActivePending
+}
@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/pfcp/pfcpType"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+)
+
+func TestRequestNwReleaseOfUpfSessions(t *testing.T) {
+	released := make(map[string]uint8)
+	context.RegisterNwReleaseHandler(func(smContext *context.SMContext, cause uint8) {
+		released[smContext.Ref] = cause
+	})
+	defer context.RegisterNwReleaseHandler(nil)
+
+	nodeID := pfcpType.NodeID{NodeIdType: pfcpType.NodeIdTypeIpv4Address, NodeIdValue: net.ParseIP("10.200.200.101").To4()}
+	other := pfcpType.NodeID{NodeIdType: pfcpType.NodeIdTypeIpv4Address, NodeIdValue: net.ParseIP("10.200.200.102").To4()}
+
+	atUpf := smctxtest.NewSMContext(t, "imsi-2089300007487", 15)
+	atUpf.PFCPContext[nodeID.ResolveNodeIdToIp().String()] = &context.PFCPSessionContext{}
+
+	atOther := smctxtest.NewSMContext(t, "imsi-2089300007487", 16)
+	atOther.PFCPContext[other.ResolveNodeIdToIp().String()] = &context.PFCPSessionContext{}
+
+	require.Equal(t, 1, context.RequestNwReleaseOfUpfSessions(nodeID, nasMessage.Cause5GSMReactivationRequested))
+	require.Equal(t, map[string]uint8{atUpf.Ref: nasMessage.Cause5GSMReactivationRequested}, released)
+}
@@ -0,0 +1,180 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+
+	"github.com/free5gc/smf/qos"
+)
+
+type pccRulePdr struct {
+	tunnel *GTPTunnel
+	name   string
+	pdr    *PDR
+}
+
+//PccRulePdrs are PDRs of data path node changed for PCC rules added or removed by policy update,
+//tunnels are updated once UPF accepted them
+type PccRulePdrs struct {
+	Node    *DataPathNode
+	added   []pccRulePdr
+	removed []pccRulePdr
+}
+
+//Rules returns PDRs, FARs and QERs of node to be sent in PFCP Session Modification
+func (p *PccRulePdrs) Rules() (pdrList []*PDR, farList []*FAR, qerList []*QER) {
+	for _, rulePdr := range append(p.added, p.removed...) {
+		pdrList = append(pdrList, rulePdr.pdr)
+		farList = append(farList, rulePdr.pdr.FAR)
+		qerList = append(qerList, rulePdr.pdr.QER...)
+	}
+	return pdrList, farList, qerList
+}
+
+//BuildPccRulePdrs builds PDRs of PCC rules added or removed by policy update at head of
+//SmPolicyUpdates, on every node of activated data paths. PDR of added rule forwards like
+//default PDR of its tunnel, with QER of rule. Returns nil if no PCC rule changed
+func (smContext *SMContext) BuildPccRulePdrs() ([]*PccRulePdrs, error) {
+	if len(smContext.SmPolicyUpdates) == 0 || smContext.SmPolicyUpdates[0].PccRuleUpdate == nil ||
+		smContext.Tunnel == nil {
+		return nil, nil
+	}
+	pccRuleUpdate := smContext.SmPolicyUpdates[0].PccRuleUpdate
+
+	var updates []*PccRulePdrs
+	for _, dataPath := range smContext.Tunnel.DataPathPool {
+		if !dataPath.Activated {
+			continue
+		}
+		for node := dataPath.FirstDPNode; node != nil; node = node.Next() {
+			update := &PccRulePdrs{Node: node}
+			for _, tunnel := range []*GTPTunnel{node.UpLinkTunnel, node.DownLinkTunnel} {
+				if tunnel == nil || tunnel.PDR["default"] == nil {
+					continue
+				}
+				if err := update.add(smContext, tunnel, pccRuleUpdate); err != nil {
+					smContext.CommitPccRulePdrs(append(updates, update), false)
+					return nil, err
+				}
+				update.remove(tunnel, pccRuleUpdate)
+			}
+			if len(update.added)+len(update.removed) > 0 {
+				updates = append(updates, update)
+			}
+		}
+	}
+	return updates, nil
+}
+
+func (p *PccRulePdrs) add(smContext *SMContext, tunnel *GTPTunnel, pccRuleUpdate *qos.PccRulesUpdate) error {
+	defPdr := tunnel.PDR["default"]
+	for name, rule := range pccRuleUpdate.GetAddPccRuleUpdate() {
+		if tunnel.PDR[name] != nil {
+			continue
+		}
+		if len(rule.FlowInfos) == 0 || len(rule.RefQosData) == 0 {
+			return fmt.Errorf("PCC rule [%v] has no flow information or QoS data", name)
+		}
+		if qos.GetQoSDataFromPolicyDecision(smContext.SmPolicyUpdates[0].SmPolicyDecision, rule.RefQosData[0]) == nil {
+			return fmt.Errorf("PCC rule [%v] refers to unknown QoS data [%v]", name, rule.RefQosData[0])
+		}
+
+		pdr, err := p.Node.UPF.BuildCreatePdrFromPccRule(rule)
+		if err != nil {
+			return fmt.Errorf("build PDR of PCC rule [%v] failed, %v", name, err)
+		}
+		p.added = append(p.added, pccRulePdr{tunnel: tunnel, name: name, pdr: pdr})
+
+		refTcData := ""
+		if len(rule.RefTcData) > 0 {
+			refTcData = rule.RefTcData[0]
+		}
+		flowQer, err := p.Node.CreatePccRuleQer(smContext, rule.RefQosData[0], refTcData)
+		if err != nil {
+			return fmt.Errorf("build QER of PCC rule [%v] failed, %v", name, err)
+		}
+		//Session AMBR QER of tunnel is shared
+		pdr.QER = append([]*QER{flowQer}, defPdr.QER...)
+
+		sdfFilter := pdr.PDI.SDFFilter
+		pdr.PDI = defPdr.PDI
+		pdr.PDI.SDFFilter = sdfFilter
+		pdr.OuterHeaderRemoval = defPdr.OuterHeaderRemoval
+		pdr.FAR.ApplyAction = defPdr.FAR.ApplyAction
+		if defPdr.FAR.ForwardingParameters != nil {
+			forwardingParameters := *defPdr.FAR.ForwardingParameters
+			pdr.FAR.ForwardingParameters = &forwardingParameters
+		}
+	}
+	return nil
+}
+
+func (p *PccRulePdrs) remove(tunnel *GTPTunnel, pccRuleUpdate *qos.PccRulesUpdate) {
+	for name := range pccRuleUpdate.GetDelPccRuleUpdate() {
+		pdr := tunnel.PDR[name]
+		if pdr == nil {
+			continue
+		}
+		pdr.State = RULE_REMOVE
+		pdr.FAR.State = RULE_REMOVE
+		p.removed = append(p.removed, pccRulePdr{tunnel: tunnel, name: name, pdr: pdr})
+	}
+}
+
+//CommitPccRulePdrs installs PDRs of added PCC rules in tunnels and frees PDRs of removed
+//ones if UPFs accepted them, PDRs of added rules are freed otherwise
+func (smContext *SMContext) CommitPccRulePdrs(updates []*PccRulePdrs, accepted bool) {
+	for _, update := range updates {
+		upf := update.Node.UPF
+		freed, kept := update.removed, update.added
+		if !accepted {
+			freed, kept = update.added, update.removed
+		}
+
+		for _, rulePdr := range kept {
+			rulePdr.pdr.State = RULE_CREATE
+			rulePdr.pdr.FAR.State = RULE_CREATE
+			if !accepted {
+				continue
+			}
+			rulePdr.tunnel.PDR[rulePdr.name] = rulePdr.pdr
+			if err := smContext.PutPDRtoPFCPSession(upf.NodeID,
+				map[string]*PDR{rulePdr.name: rulePdr.pdr}); err != nil {
+				smContext.SubPfcpLog.Warnf("PCC rule [%v] PDR not put in PFCP session, %v", rulePdr.name, err)
+			}
+		}
+
+		for _, rulePdr := range freed {
+			if accepted {
+				delete(rulePdr.tunnel.PDR, rulePdr.name)
+				smContext.RemovePDRfromPFCPSession(upf.NodeID, rulePdr.pdr)
+			}
+			if err := upf.RemovePDR(rulePdr.pdr); err != nil {
+				smContext.SubPfcpLog.Warnf("PCC rule [%v] PDR not freed, %v", rulePdr.name, err)
+			}
+			if err := upf.RemoveFAR(rulePdr.pdr.FAR); err != nil {
+				smContext.SubPfcpLog.Warnf("PCC rule [%v] FAR not freed, %v", rulePdr.name, err)
+			}
+			//Session AMBR QER is kept
+			if len(rulePdr.pdr.QER) > 0 && !isDefaultPdrQer(rulePdr.tunnel, rulePdr.pdr.QER[0]) {
+				if err := upf.RemoveQER(rulePdr.pdr.QER[0]); err != nil {
+					smContext.SubPfcpLog.Warnf("PCC rule [%v] QER not freed, %v", rulePdr.name, err)
+				}
+			}
+		}
+	}
+}
+
+func isDefaultPdrQer(tunnel *GTPTunnel, qer *QER) bool {
+	if defPdr := tunnel.PDR["default"]; defPdr != nil {
+		for _, defQer := range defPdr.QER {
+			if defQer == qer {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -1,3 +1,4 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
 // Copyright 2019 free5GC.org
 //
 // SPDX-License-Identifier: Apache-2.0
@@ -5,8 +6,291 @@
 // ProtocolConfigurationOptions
 package context
 
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/free5gc/nas/nasConvert"
+	"github.com/free5gc/nas/nasMessage"
+)
+
+//IPCP(RFC 1332, RFC 1877) codes and options SMF answers
+const (
+	ipcpConfigureRequest uint8 = 1
+	ipcpConfigureAck     uint8 = 2
+	ipcpConfigureNak     uint8 = 3
+	ipcpConfigureReject  uint8 = 4
+	ipcpPrimaryDNS       uint8 = 129
+	ipcpSecondaryDNS     uint8 = 131
+	ipcpHeaderLen              = 4
+)
+
+//ProtocolConfigurationOptions is PCO/ePCO UE sent in Establishment Request, containers are
+//kept by ID in order received to be answered in Establishment Accept(TS 24.008 10.5.6.3)
 type ProtocolConfigurationOptions struct {
-	DNSIPv4Request     bool
-	DNSIPv6Request     bool
-	IPv4LinkMTURequest bool
+	//Contents of containers by ID
+	Requests map[uint16][]byte
+	order    []uint16
+	//UE supports QoS rules/flow descriptions with length of two octets(TS 24.501 9.11.4.13)
+	QosRulesLen2Supported     bool
+	QosFlowDescsLen2Supported bool
+	//P-CSCFs selected for UE, selection is done once for both address families
+	pcscf []PCSCFServer
+}
+
+//pcoContainer handles container of UE's PCO, containers without respond are recorded only
+type pcoContainer struct {
+	name    string
+	request func(pco *ProtocolConfigurationOptions, contents []byte)
+	respond func(smContext *SMContext, rsp *nasConvert.ProtocolConfigurationOptions, contents []byte) error
+}
+
+var pcoContainers = map[uint16]pcoContainer{
+	nasMessage.PCSCFIPv6AddressRequestUL:             {name: "PCSCFIPv6AddressRequest", respond: addPCSCFIPv6Address},
+	nasMessage.IMCNSubsystemSignalingFlagUL:          {name: "IMCNSubsystemSignalingFlag"},
+	nasMessage.DNSServerIPv6AddressRequestUL:         {name: "DNSServerIPv6AddressRequest", respond: addDNSServerIPv6Address},
+	nasMessage.NotSupportedUL:                        {name: "NotSupported"},
+	nasMessage.IPAddressAllocationViaNASSignallingUL: {name: "IPAddressAllocationViaNASSignalling"},
+	nasMessage.IPv4AddressAllocationViaDHCPv4UL:      {name: "IPv4AddressAllocationViaDHCPv4"},
+	nasMessage.PCSCFIPv4AddressRequestUL:             {name: "PCSCFIPv4AddressRequest", respond: addPCSCFIPv4Address},
+	nasMessage.DNSServerIPv4AddressRequestUL:         {name: "DNSServerIPv4AddressRequest", respond: addDNSServerIPv4Address},
+	nasMessage.MSISDNRequestUL:                       {name: "MSISDNRequest", respond: addMSISDN},
+	nasMessage.IPv4LinkMTURequestUL:                  {name: "IPv4LinkMTURequest", respond: addIPv4LinkMTU},
+	nasMessage.PCSCFReSelectionSupportUL:             {name: "PCSCFReSelectionSupport"},
+	nasMessage.NonIPLinkMTURequestUL:                 {name: "NonIPLinkMTURequest", respond: addNonIPLinkMTU},
+	nasMessage.UEStatus3GPPPSDataOffUL:               {name: "UEStatus3GPPPSDataOff"},
+	nasMessage.PDUSessionIDUL:                        {name: "PDUSessionID"},
+	nasMessage.I5GSMCauseValueUL:                     {name: "5GSMCauseValue"},
+	nasMessage.QoSRulesWithTheLengthOfTwoOctetsSupportIndicatorUL: {
+		name: "QoSRulesWithTheLengthOfTwoOctetsSupportIndicator",
+		request: func(pco *ProtocolConfigurationOptions, contents []byte) {
+			pco.QosRulesLen2Supported = true
+		},
+		respond: addLen2SupportIndicator(nasMessage.QoSRulesWithTheLengthOfTwoOctetsSupportIndicatorUL),
+	},
+	nasMessage.QoSFlowDescriptionsWithTheLengthOfTwoOctetsSupportIndicatorUL: {
+		name: "QoSFlowDescriptionsWithTheLengthOfTwoOctetsSupportIndicator",
+		request: func(pco *ProtocolConfigurationOptions, contents []byte) {
+			pco.QosFlowDescsLen2Supported = true
+		},
+		respond: addLen2SupportIndicator(nasMessage.QoSFlowDescriptionsWithTheLengthOfTwoOctetsSupportIndicatorUL),
+	},
+	nasMessage.InternetProtocolControlProtocolUL: {name: "InternetProtocolControlProtocol", respond: addIPCP},
+}
+
+//Requested tells if UE's PCO has container
+func (pco *ProtocolConfigurationOptions) Requested(id uint16) bool {
+	_, ok := pco.Requests[id]
+	return ok
+}
+
+func (pco *ProtocolConfigurationOptions) addRequest(id uint16, contents []byte) {
+	if pco.Requests == nil {
+		pco.Requests = make(map[uint16][]byte)
+	}
+	if _, ok := pco.Requests[id]; !ok {
+		pco.order = append(pco.order, id)
+	}
+	pco.Requests[id] = contents
+}
+
+//HandlePCO records containers of UE's PCO/ePCO
+func (smContext *SMContext) HandlePCO(contents []byte) {
+	requestPco := nasConvert.NewProtocolConfigurationOptions()
+	if err := requestPco.UnMarshal(contents); err != nil {
+		smContext.SubGsmLog.Errorf("Parsing PCO failed: %s", err)
+	}
+
+	pco := smContext.ProtocolConfigurationOptions
+	//Send MTU to UE always even if UE does not request it.
+	pco.addRequest(nasMessage.IPv4LinkMTURequestUL, nil)
+
+	for _, container := range requestPco.ProtocolOrContainerList {
+		handler, ok := pcoContainers[container.ProtocolOrContainerID]
+		if !ok {
+			smContext.SubGsmLog.Infof("Unknown Container ID [%d]", container.ProtocolOrContainerID)
+			continue
+		}
+		smContext.SubGsmLog.Tracef("PCO container [%v], length [%v]", handler.name, container.LengthOfContents)
+		if handler.respond == nil && handler.request == nil {
+			smContext.SubGsmLog.Infof("Didn't Implement container type %v", handler.name)
+		}
+		pco.addRequest(container.ProtocolOrContainerID, container.Contents)
+		if handler.request != nil {
+			handler.request(pco, container.Contents)
+		}
+	}
+}
+
+//BuildPCOResponse is contents of PCO/ePCO answering UE's containers, nil if nothing to answer
+func (smContext *SMContext) BuildPCOResponse() []byte {
+	pco := smContext.ProtocolConfigurationOptions
+	if pco == nil || smContext.DNNInfo == nil {
+		return nil
+	}
+
+	rsp := nasConvert.NewProtocolConfigurationOptions()
+	for _, id := range pco.order {
+		handler := pcoContainers[id]
+		if handler.respond == nil {
+			continue
+		}
+		if err := handler.respond(smContext, rsp, pco.Requests[id]); err != nil {
+			smContext.SubGsmLog.Warnf("Error while answering PCO container %v: %v", handler.name, err)
+		}
+	}
+	if len(rsp.ProtocolOrContainerList) == 0 {
+		return nil
+	}
+	return rsp.Marshal()
+}
+
+func appendContainer(rsp *nasConvert.ProtocolConfigurationOptions, id uint16, contents []byte) {
+	rsp.ProtocolOrContainerList = append(rsp.ProtocolOrContainerList, &nasConvert.ProtocolOrContainerUnit{
+		ProtocolOrContainerID: id,
+		LengthOfContents:      uint8(len(contents)),
+		Contents:              contents,
+	})
+}
+
+//addLen2SupportIndicator answers UE's support indicator of QoS rules/flow descriptions with
+//length of two octets with network's one, empty container of same ID(TS 24.008 10.5.6.3)
+func addLen2SupportIndicator(id uint16) func(*SMContext, *nasConvert.ProtocolConfigurationOptions, []byte) error {
+	return func(_ *SMContext, rsp *nasConvert.ProtocolConfigurationOptions, _ []byte) error {
+		appendContainer(rsp, id, nil)
+		return nil
+	}
+}
+
+func addDNSServerIPv4Address(smContext *SMContext, rsp *nasConvert.ProtocolConfigurationOptions, _ []byte) error {
+	return rsp.AddDNSServerIPv4Address(smContext.DNNInfo.DNS.IPv4Addr)
+}
+
+func addDNSServerIPv6Address(smContext *SMContext, rsp *nasConvert.ProtocolConfigurationOptions, _ []byte) error {
+	return rsp.AddDNSServerIPv6Address(smContext.DNNInfo.DNS.IPv6Addr)
+}
+
+func addIPv4LinkMTU(smContext *SMContext, rsp *nasConvert.ProtocolConfigurationOptions, _ []byte) error {
+	return rsp.AddIPv4LinkMTU(smContext.DNNInfo.MTU)
+}
+
+func addNonIPLinkMTU(smContext *SMContext, rsp *nasConvert.ProtocolConfigurationOptions, _ []byte) error {
+	mtu := make([]byte, 2)
+	binary.BigEndian.PutUint16(mtu, smContext.DNNInfo.NonIPMTU)
+	appendContainer(rsp, nasMessage.NonIPLinkMTUDL, mtu)
+	return nil
+}
+
+//selectedPCSCF is P-CSCFs for UE, selected one first
+func (smContext *SMContext) selectedPCSCF() ([]PCSCFServer, error) {
+	pco := smContext.ProtocolConfigurationOptions
+	if pco.pcscf == nil {
+		pco.pcscf = smContext.SelectPCSCF()
+		if len(pco.pcscf) == 0 {
+			return nil, fmt.Errorf("no P-CSCF configured for DNN [%v]", smContext.Dnn)
+		}
+		smContext.SubGsmLog.Infof("P-CSCF [%v/%v] selected", pco.pcscf[0].IPv4Addr, pco.pcscf[0].IPv6Addr)
+	}
+	return pco.pcscf, nil
+}
+
+func addPCSCFIPv4Address(smContext *SMContext, rsp *nasConvert.ProtocolConfigurationOptions, _ []byte) error {
+	servers, err := smContext.selectedPCSCF()
+	if err != nil {
+		return err
+	}
+	for _, server := range servers {
+		if server.IPv4Addr != nil {
+			if err := rsp.AddPCSCFIPv4Address(server.IPv4Addr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func addPCSCFIPv6Address(smContext *SMContext, rsp *nasConvert.ProtocolConfigurationOptions, _ []byte) error {
+	servers, err := smContext.selectedPCSCF()
+	if err != nil {
+		return err
+	}
+	for _, server := range servers {
+		if server.IPv6Addr != nil {
+			appendContainer(rsp, nasMessage.PCSCFIPv6AddressDL, server.IPv6Addr.To16())
+		}
+	}
+	return nil
+}
+
+//addMSISDN answers with MSISDN of GPSI, coded as Calling party BCD number from octet 3(TS 24.008 10.5.4.9)
+func addMSISDN(smContext *SMContext, rsp *nasConvert.ProtocolConfigurationOptions, _ []byte) error {
+	if !strings.HasPrefix(smContext.Gpsi, "msisdn-") {
+		return fmt.Errorf("no MSISDN in GPSI [%v]", smContext.Gpsi)
+	}
+	msisdn := strings.TrimPrefix(smContext.Gpsi, "msisdn-")
+
+	//International number, ISDN numbering plan
+	contents := []byte{0x91}
+	for i := 0; i < len(msisdn); i += 2 {
+		digit := msisdn[i] - '0'
+		next := uint8(0x0f)
+		if i+1 < len(msisdn) {
+			next = msisdn[i+1] - '0'
+		}
+		if digit > 9 || (next > 9 && next != 0x0f) {
+			return fmt.Errorf("invalid MSISDN [%v]", msisdn)
+		}
+		contents = append(contents, next<<4|digit)
+	}
+	appendContainer(rsp, nasMessage.MSISDNDL, contents)
+	return nil
+}
+
+//addIPCP answers IPCP Configure-Request of legacy UE asking for DNS servers. Unsupported options
+//are Configure-Rejected, DNS addresses other than configured ones are Configure-Naked with them,
+//request is Configure-Acked otherwise(RFC 1332, RFC 1661 5, RFC 1877)
+func addIPCP(smContext *SMContext, rsp *nasConvert.ProtocolConfigurationOptions, contents []byte) error {
+	if len(contents) < ipcpHeaderLen || contents[0] != ipcpConfigureRequest {
+		return fmt.Errorf("not IPCP Configure-Request")
+	}
+	dns := map[uint8]net.IP{
+		ipcpPrimaryDNS:   smContext.DNNInfo.DNS.IPv4Addr.To4(),
+		ipcpSecondaryDNS: smContext.DNNInfo.DNS.IPv4SecondaryAddr.To4(),
+	}
+	if dns[ipcpPrimaryDNS] == nil {
+		return fmt.Errorf("no DNS IPv4 address configured for DNN [%v]", smContext.Dnn)
+	}
+	if dns[ipcpSecondaryDNS] == nil {
+		dns[ipcpSecondaryDNS] = dns[ipcpPrimaryDNS]
+	}
+
+	acked, naked, rejected := new(bytes.Buffer), new(bytes.Buffer), new(bytes.Buffer)
+	for opts := contents[ipcpHeaderLen:]; len(opts) >= 2 && int(opts[1]) >= 2 && int(opts[1]) <= len(opts); opts = opts[opts[1]:] {
+		option := opts[:opts[1]]
+		switch addr := dns[option[0]]; {
+		case addr == nil:
+			rejected.Write(option)
+		case bytes.Equal(option[2:], addr):
+			acked.Write(option)
+		default:
+			naked.Write([]byte{option[0], 2 + net.IPv4len})
+			naked.Write(addr)
+		}
+	}
+
+	//Reject takes precedence over Nak, Nak over Ack
+	code, options := ipcpConfigureAck, acked
+	if rejected.Len() > 0 {
+		code, options = ipcpConfigureReject, rejected
+	} else if naked.Len() > 0 {
+		code, options = ipcpConfigureNak, naked
+	}
+
+	ipcp := []byte{code, contents[1], 0, 0}
+	binary.BigEndian.PutUint16(ipcp[2:], uint16(ipcpHeaderLen+options.Len()))
+	appendContainer(rsp, nasMessage.InternetProtocolControlProtocolUL, append(ipcp, options.Bytes()...))
+	return nil
 }
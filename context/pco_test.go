@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/nas/nasConvert"
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+	"github.com/free5gc/smf/factory"
+)
+
+func TestPCOResponse(t *testing.T) {
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 10)
+	smContext.Gpsi = "msisdn-4412345678"
+	smContext.DNNInfo = &context.SnssaiSmfDnnInfo{
+		DNS:      context.DNS{IPv4Addr: net.ParseIP("8.8.8.8").To4()},
+		MTU:      1400,
+		NonIPMTU: 1200,
+		PCSCF: context.NewPCSCFInfo(&factory.PCSCF{Servers: []factory.PCSCFServer{
+			{IPv4Addr: "10.100.0.10", IPv6Addr: "2001:db8::10"},
+		}}),
+	}
+
+	request := nasConvert.NewProtocolConfigurationOptions()
+	for id, contents := range map[uint16][]byte{
+		nasMessage.DNSServerIPv4AddressRequestUL:                      nil,
+		nasMessage.PCSCFIPv4AddressRequestUL:                          nil,
+		nasMessage.PCSCFIPv6AddressRequestUL:                          nil,
+		nasMessage.MSISDNRequestUL:                                    nil,
+		nasMessage.NonIPLinkMTURequestUL:                              nil,
+		nasMessage.QoSRulesWithTheLengthOfTwoOctetsSupportIndicatorUL: nil,
+		nasMessage.IMCNSubsystemSignalingFlagUL:                       nil,
+		//IPCP Configure-Request for primary DNS
+		nasMessage.InternetProtocolControlProtocolUL: {0x01, 0x07, 0x00, 0x0a, 0x81, 0x06, 0x00, 0x00, 0x00, 0x00},
+	} {
+		request.ProtocolOrContainerList = append(request.ProtocolOrContainerList, &nasConvert.ProtocolOrContainerUnit{
+			ProtocolOrContainerID: id,
+			LengthOfContents:      uint8(len(contents)),
+			Contents:              contents,
+		})
+	}
+	smContext.HandlePCO(request.Marshal())
+	require.True(t, smContext.ProtocolConfigurationOptions.QosRulesLen2Supported)
+	require.False(t, smContext.ProtocolConfigurationOptions.QosFlowDescsLen2Supported)
+	require.True(t, smContext.ProtocolConfigurationOptions.Requested(nasMessage.IMCNSubsystemSignalingFlagUL))
+
+	response := nasConvert.NewProtocolConfigurationOptions()
+	require.NoError(t, response.UnMarshal(smContext.BuildPCOResponse()))
+	containers := make(map[uint16][]byte)
+	for _, container := range response.ProtocolOrContainerList {
+		containers[container.ProtocolOrContainerID] = container.Contents
+	}
+	require.Len(t, containers, 8)
+	require.Contains(t, containers, nasMessage.QoSRulesWithTheLengthOfTwoOctetsSupportIndicatorUL)
+	require.NotContains(t, containers, nasMessage.QoSFlowDescriptionsWithTheLengthOfTwoOctetsSupportIndicatorUL)
+	require.Equal(t, []byte{8, 8, 8, 8}, containers[nasMessage.DNSServerIPv4AddressDL])
+	require.Equal(t, []byte{10, 100, 0, 10}, containers[nasMessage.PCSCFIPv4AddressDL])
+	require.Equal(t, []byte(net.ParseIP("2001:db8::10")), containers[nasMessage.PCSCFIPv6AddressDL])
+	require.Equal(t, []byte{0x91, 0x44, 0x21, 0x43, 0x65, 0x87}, containers[nasMessage.MSISDNDL])
+	require.Equal(t, []byte{0x05, 0x78}, containers[nasMessage.IPv4LinkMTUDL])
+	require.Equal(t, []byte{0x04, 0xb0}, containers[nasMessage.NonIPLinkMTUDL])
+	require.Equal(t, []byte{0x03, 0x07, 0x00, 0x0a, 0x81, 0x06, 8, 8, 8, 8},
+		containers[nasMessage.InternetProtocolControlProtocolUL])
+}
+
+func TestPCOResponseIPCP(t *testing.T) {
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 11)
+	smContext.DNNInfo = &context.SnssaiSmfDnnInfo{
+		DNS: context.DNS{IPv4Addr: net.ParseIP("8.8.8.8").To4(), IPv4SecondaryAddr: net.ParseIP("8.8.4.4").To4()},
+	}
+
+	ipcpResponse := func(request []byte) []byte {
+		smContext.ProtocolConfigurationOptions = &context.ProtocolConfigurationOptions{}
+		pco := nasConvert.NewProtocolConfigurationOptions()
+		pco.ProtocolOrContainerList = append(pco.ProtocolOrContainerList, &nasConvert.ProtocolOrContainerUnit{
+			ProtocolOrContainerID: nasMessage.InternetProtocolControlProtocolUL,
+			LengthOfContents:      uint8(len(request)),
+			Contents:              request,
+		})
+		smContext.HandlePCO(pco.Marshal())
+
+		response := nasConvert.NewProtocolConfigurationOptions()
+		require.NoError(t, response.UnMarshal(smContext.BuildPCOResponse()))
+		for _, container := range response.ProtocolOrContainerList {
+			if container.ProtocolOrContainerID == nasMessage.InternetProtocolControlProtocolUL {
+				return container.Contents
+			}
+		}
+		return nil
+	}
+
+	//Primary and secondary DNS are Naked with configured ones
+	require.Equal(t, []byte{0x03, 0x01, 0x00, 0x10, 0x81, 0x06, 8, 8, 8, 8, 0x83, 0x06, 8, 8, 4, 4},
+		ipcpResponse([]byte{0x01, 0x01, 0x00, 0x10, 0x81, 0x06, 0, 0, 0, 0, 0x83, 0x06, 0, 0, 0, 0}))
+
+	//NBNS isn't supported, Rejected regardless of DNS
+	require.Equal(t, []byte{0x04, 0x02, 0x00, 0x0a, 0x82, 0x06, 0, 0, 0, 0},
+		ipcpResponse([]byte{0x01, 0x02, 0x00, 0x10, 0x81, 0x06, 0, 0, 0, 0, 0x82, 0x06, 0, 0, 0, 0}))
+
+	//Configured DNS is Acked
+	require.Equal(t, []byte{0x02, 0x03, 0x00, 0x0a, 0x81, 0x06, 8, 8, 8, 8},
+		ipcpResponse([]byte{0x01, 0x03, 0x00, 0x0a, 0x81, 0x06, 8, 8, 8, 8}))
+}
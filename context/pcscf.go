@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"net"
+	"sync/atomic"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/factory"
+	"github.com/free5gc/smf/logger"
+)
+
+const (
+	PCSCFSelectionRoundRobin = "roundRobin"
+	PCSCFSelectionLocation   = "location"
+)
+
+//PCSCFInfo is P-CSCFs of DNN, UE is given all of them starting at selected one
+type PCSCFInfo struct {
+	Selection string
+	Servers   []PCSCFServer
+	//Next server of round robin selection
+	next uint32
+}
+
+type PCSCFServer struct {
+	IPv4Addr net.IP
+	IPv6Addr net.IP
+	Tacs     []string
+}
+
+func NewPCSCFInfo(config *factory.PCSCF) *PCSCFInfo {
+	if config == nil || len(config.Servers) == 0 {
+		return nil
+	}
+
+	info := &PCSCFInfo{Selection: config.Selection}
+	if info.Selection == "" {
+		info.Selection = PCSCFSelectionRoundRobin
+	}
+	for _, server := range config.Servers {
+		pcscf := PCSCFServer{Tacs: server.Tacs}
+		if server.IPv4Addr != "" {
+			if pcscf.IPv4Addr = net.ParseIP(server.IPv4Addr).To4(); pcscf.IPv4Addr == nil {
+				logger.InitLog.Errorf("invalid P-CSCF IPv4 address [%v]", server.IPv4Addr)
+			}
+		}
+		if server.IPv6Addr != "" {
+			if pcscf.IPv6Addr = net.ParseIP(server.IPv6Addr).To16(); pcscf.IPv6Addr == nil {
+				logger.InitLog.Errorf("invalid P-CSCF IPv6 address [%v]", server.IPv6Addr)
+			}
+		}
+		info.Servers = append(info.Servers, pcscf)
+	}
+	return info
+}
+
+//Select orders P-CSCFs for UE in tracking area tac, serving P-CSCFs first for location
+//based selection, rotated for round robin
+func (info *PCSCFInfo) Select(tac string) []PCSCFServer {
+	if info == nil || len(info.Servers) == 0 {
+		return nil
+	}
+
+	servers := make([]PCSCFServer, 0, len(info.Servers))
+	if info.Selection == PCSCFSelectionLocation && tac != "" {
+		var others []PCSCFServer
+		for _, server := range info.Servers {
+			if server.serves(tac) {
+				servers = append(servers, server)
+			} else {
+				others = append(others, server)
+			}
+		}
+		if len(servers) > 0 {
+			return append(servers, others...)
+		}
+	}
+
+	start := int((atomic.AddUint32(&info.next, 1) - 1) % uint32(len(info.Servers)))
+	servers = append(servers, info.Servers[start:]...)
+	return append(servers, info.Servers[:start]...)
+}
+
+func (server *PCSCFServer) serves(tac string) bool {
+	for _, t := range server.Tacs {
+		if t == tac {
+			return true
+		}
+	}
+	return false
+}
+
+//ueTai is tracking area of UE location, nil if unknown
+func ueTai(ueLocation *models.UserLocation) *models.Tai {
+	switch {
+	case ueLocation == nil:
+		return nil
+	case ueLocation.NrLocation != nil && ueLocation.NrLocation.Tai != nil:
+		return ueLocation.NrLocation.Tai
+	case ueLocation.EutraLocation != nil && ueLocation.EutraLocation.Tai != nil:
+		return ueLocation.EutraLocation.Tai
+	default:
+		return nil
+	}
+}
+
+//ueTac is TAC of UE location, empty if unknown
+func ueTac(ueLocation *models.UserLocation) string {
+	if tai := ueTai(ueLocation); tai != nil {
+		return tai.Tac
+	}
+	return ""
+}
+
+//SelectPCSCF is P-CSCFs sent to UE requesting them in PCO
+func (smContext *SMContext) SelectPCSCF() []PCSCFServer {
+	if smContext.DNNInfo == nil {
+		return nil
+	}
+	return smContext.DNNInfo.PCSCF.Select(ueTac(smContext.UeLocation))
+}
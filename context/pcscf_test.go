@@ -0,0 +1,42 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/factory"
+)
+
+func TestPCSCFSelection(t *testing.T) {
+	servers := []factory.PCSCFServer{
+		{IPv4Addr: "10.100.0.10", IPv6Addr: "2001:db8::10", Tacs: []string{"000001"}},
+		{IPv4Addr: "10.100.0.11", Tacs: []string{"000002"}},
+		{IPv4Addr: "10.100.0.12"},
+	}
+	require.Nil(t, context.NewPCSCFInfo(&factory.PCSCF{}))
+
+	//Round robin, all P-CSCFs starting at next one
+	info := context.NewPCSCFInfo(&factory.PCSCF{Servers: servers})
+	require.Equal(t, context.PCSCFSelectionRoundRobin, info.Selection)
+	for _, first := range []string{"10.100.0.10", "10.100.0.11", "10.100.0.12", "10.100.0.10"} {
+		selected := info.Select("000002")
+		require.Len(t, selected, 3)
+		require.True(t, net.ParseIP(first).Equal(selected[0].IPv4Addr))
+	}
+	require.True(t, net.ParseIP("2001:db8::10").Equal(info.Servers[0].IPv6Addr))
+
+	//By location, serving P-CSCF first, round robin if UE's TA has none
+	info = context.NewPCSCFInfo(&factory.PCSCF{Selection: context.PCSCFSelectionLocation, Servers: servers})
+	selected := info.Select("000002")
+	require.Len(t, selected, 3)
+	require.True(t, net.ParseIP("10.100.0.11").Equal(selected[0].IPv4Addr))
+	selected = info.Select("000009")
+	require.True(t, net.ParseIP("10.100.0.10").Equal(selected[0].IPv4Addr))
+}
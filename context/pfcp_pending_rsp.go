@@ -0,0 +1,278 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/pfcp"
+	"github.com/free5gc/smf/transaction"
+)
+
+//PfcpRsp is a PFCP session response(or send failure) received from UPF
+type PfcpRsp struct {
+	SeqNum    uint32
+	LocalSEID uint64
+	NodeIP    string
+	//PFCP request type this response answers
+	ReqType  pfcp.MessageType
+	Accepted bool
+	Timeout  bool
+	Cause    uint8
+}
+
+func (rsp *PfcpRsp) String() string {
+	return fmt.Sprintf("seq[%v] lseid[%v] node[%v] accepted[%v] timeout[%v] cause[%v]",
+		rsp.SeqNum, rsp.LocalSEID, rsp.NodeIP, rsp.Accepted, rsp.Timeout, rsp.Cause)
+}
+
+//PfcpRspHandler delivers PFCP session establishment response to SM context FSM
+type PfcpRspHandler func(smContext *SMContext, rsp *PfcpRsp)
+
+var pfcpRspHandler PfcpRspHandler
+
+//RegisterPfcpRspHandler is called by SMF FSM at init
+func RegisterPfcpRspHandler(handler PfcpRspHandler) {
+	pfcpRspHandler = handler
+}
+
+type pfcpPendingReq struct {
+	nodeIP    string
+	reqType   pfcp.MessageType
+	localSEID uint64
+}
+
+//pfcpPendingRsp tracks outstanding PFCP session requests of SM context
+type pfcpPendingRsp struct {
+	lock sync.Mutex
+	reqs map[uint32]*pfcpPendingReq
+	//Negative responses per request type, till all responses of the type are received
+	failed map[pfcp.MessageType][]*PfcpRsp
+	//Procedure waiting for responses
+	procedure *PfcpProcedure
+}
+
+func (p *pfcpPendingRsp) pendingCount(reqType pfcp.MessageType) int {
+	count := 0
+	for _, req := range p.reqs {
+		if req.reqType == reqType {
+			count++
+		}
+	}
+	return count
+}
+
+//AddPendingPfcpReq records PFCP session request sent to UPF, to correlate its response
+func (smContext *SMContext) AddPendingPfcpReq(seqNum uint32, nodeIP string, reqType pfcp.MessageType, localSEID uint64) {
+	p := &smContext.pfcpPendingRsp
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.reqs == nil {
+		p.reqs = make(map[uint32]*pfcpPendingReq)
+		p.failed = make(map[pfcp.MessageType][]*PfcpRsp)
+	}
+	p.reqs[seqNum] = &pfcpPendingReq{nodeIP: nodeIP, reqType: reqType, localSEID: localSEID}
+}
+
+//ResolvePfcpRsp matches response with pending request by sequence number and SEID.
+//done is set once all UPFs have answered requests of this type, failed has
+//the negative responses received in the meantime.
+func (smContext *SMContext) ResolvePfcpRsp(rsp *PfcpRsp) (matched, done bool, failed []*PfcpRsp) {
+	p := &smContext.pfcpPendingRsp
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	req, ok := p.reqs[rsp.SeqNum]
+	if !ok || req.localSEID != rsp.LocalSEID {
+		smContext.SubPfcpLog.Warnf("no pending pfcp request for response %v", rsp.String())
+		return false, false, nil
+	}
+	delete(p.reqs, rsp.SeqNum)
+	rsp.NodeIP = req.nodeIP
+	rsp.ReqType = req.reqType
+
+	if !rsp.Accepted {
+		p.failed[req.reqType] = append(p.failed[req.reqType], rsp)
+	}
+
+	if p.pendingCount(req.reqType) != 0 {
+		return true, false, nil
+	}
+	failed = p.failed[req.reqType]
+	delete(p.failed, req.reqType)
+	return true, true, failed
+}
+
+//PendingPfcpReqCount returns number of unanswered PFCP requests of a type
+func (smContext *SMContext) PendingPfcpReqCount(reqType pfcp.MessageType) int {
+	p := &smContext.pfcpPendingRsp
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.pendingCount(reqType)
+}
+
+//PostPfcpRsp hands over PFCP response to SM context.
+//Establishment responses are delivered to FSM as event, modification and
+//deletion responses are aggregated and delivered to FSM once all UPFs have
+//answered the procedure waiting for them.
+func (smContext *SMContext) PostPfcpRsp(rsp *PfcpRsp) {
+	if rsp.ReqType == pfcp.PFCP_SESSION_ESTABLISHMENT_REQUEST {
+		if pfcpRspHandler == nil {
+			smContext.SubPfcpLog.Errorf("pfcp response handler not registered, response %v dropped", rsp.String())
+			return
+		}
+		pfcpRspHandler(smContext, rsp)
+		return
+	}
+
+	matched, done, failed := smContext.ResolvePfcpRsp(rsp)
+	if !matched || !done {
+		return
+	}
+
+	//No procedure waits for responses(e.g. local release), nothing to resume
+	if !smContext.IsPfcpProcedurePending(rsp.ReqType) {
+		return
+	}
+	if pfcpProcedureRspHandler == nil {
+		smContext.SubPfcpLog.Errorf("pfcp procedure response handler not registered, response %v dropped", rsp.String())
+		return
+	}
+	pfcpProcedureRspHandler(smContext, &PfcpProcedureRsp{
+		ReqType: rsp.ReqType,
+		Status:  pfcpRspStatus(rsp.ReqType, failed),
+	})
+}
+
+//pfcpRspStatus is outcome of PFCP modification or deletion from negative responses received.
+//Deletion rejected by UPF is success, session is gone either way
+func pfcpRspStatus(reqType pfcp.MessageType, failed []*PfcpRsp) PFCPSessionResponseStatus {
+	timeout := false
+	for _, rsp := range failed {
+		timeout = timeout || rsp.Timeout
+	}
+
+	if reqType == pfcp.PFCP_SESSION_DELETION_REQUEST {
+		if timeout {
+			return SessionReleaseTimeout
+		}
+		return SessionReleaseSuccess
+	}
+
+	switch {
+	case timeout:
+		return SessionUpdateTimeout
+	case len(failed) != 0:
+		return SessionUpdateFailed
+	default:
+		return SessionUpdateSuccess
+	}
+}
+
+//PfcpProcedure is a procedure waiting for UPFs to answer its PFCP session modification or deletion
+type PfcpProcedure struct {
+	ReqType pfcp.MessageType
+	//Txn answered once procedure completes, nil if procedure isn't answering a request
+	Txn *transaction.Transaction
+	//OnRsp completes procedure once all UPFs answered, it is run with SM context
+	//lock held and returns state SM context settles in
+	OnRsp func(status PFCPSessionResponseStatus) SMContextState
+}
+
+//PfcpProcedureRsp is outcome of PFCP requests of procedure, delivered once all UPFs answered
+type PfcpProcedureRsp struct {
+	ReqType pfcp.MessageType
+	Status  PFCPSessionResponseStatus
+}
+
+//PfcpProcedureRspHandler delivers outcome of PFCP session modification or deletion to SM context FSM
+type PfcpProcedureRspHandler func(smContext *SMContext, rsp *PfcpProcedureRsp)
+
+var pfcpProcedureRspHandler PfcpProcedureRspHandler
+
+//RegisterPfcpProcedureRspHandler is called by SMF FSM at init
+func RegisterPfcpProcedureRspHandler(handler PfcpProcedureRspHandler) {
+	pfcpProcedureRspHandler = handler
+}
+
+//AwaitPfcpRsp parks procedure till UPFs answer its requests, it is registered before requests
+//are sent. Other txns of SM context are queued meanwhile
+func (smContext *SMContext) AwaitPfcpRsp(procedure *PfcpProcedure) {
+	p := &smContext.pfcpPendingRsp
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.procedure != nil {
+		smContext.SubPfcpLog.Warnf("pfcp procedure of type [%v] replaced while waiting for responses", p.procedure.ReqType)
+	}
+	p.procedure = procedure
+}
+
+//IsPfcpProcedurePending tells if procedure waits for responses to PFCP requests of a type
+func (smContext *SMContext) IsPfcpProcedurePending(reqType pfcp.MessageType) bool {
+	p := &smContext.pfcpPendingRsp
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.procedure != nil && p.procedure.ReqType == reqType
+}
+
+//IsAwaitingPfcpRsp tells if any procedure waits for PFCP responses
+func (smContext *SMContext) IsAwaitingPfcpRsp() bool {
+	p := &smContext.pfcpPendingRsp
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.procedure != nil
+}
+
+//IsTxnAwaitingPfcpRsp tells if txn is answered once PFCP responses arrive
+func (smContext *SMContext) IsTxnAwaitingPfcpRsp(txn *transaction.Transaction) bool {
+	p := &smContext.pfcpPendingRsp
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.procedure != nil && p.procedure.Txn == txn
+}
+
+//TakePfcpProcedure removes procedure waiting for PFCP responses of a type, to be completed
+func (smContext *SMContext) TakePfcpProcedure(reqType pfcp.MessageType) *PfcpProcedure {
+	p := &smContext.pfcpPendingRsp
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	procedure := p.procedure
+	if procedure == nil || procedure.ReqType != reqType {
+		return nil
+	}
+	p.procedure = nil
+	return procedure
+}
+
+//abortPfcpProcedure answers txn of procedure still waiting for PFCP responses, SM context is released
+func (smContext *SMContext) abortPfcpProcedure() {
+	p := &smContext.pfcpPendingRsp
+	p.lock.Lock()
+	procedure := p.procedure
+	p.procedure = nil
+	p.lock.Unlock()
+
+	if procedure == nil || procedure.Txn == nil {
+		return
+	}
+	smContext.SubPfcpLog.Warnf("SM context released while waiting for pfcp responses of type [%v]", procedure.ReqType)
+	txn := procedure.Txn
+	txn.Rsp = &http_wrapper.Response{
+		Status: http.StatusInternalServerError,
+		Body: &models.ProblemDetails{
+			Title:  "SM context released",
+			Status: http.StatusInternalServerError,
+			Cause:  "CONTEXT_NOT_FOUND",
+		},
+	}
+	go func() {
+		txn.Status <- false
+	}()
+}
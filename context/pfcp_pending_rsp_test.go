@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/pfcp"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+)
+
+func TestResolvePfcpRsp(t *testing.T) {
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007488", 10)
+
+	smContext.AddPendingPfcpReq(1, "192.168.179.1", pfcp.PFCP_SESSION_ESTABLISHMENT_REQUEST, 100)
+	smContext.AddPendingPfcpReq(2, "192.168.179.2", pfcp.PFCP_SESSION_ESTABLISHMENT_REQUEST, 100)
+	require.Equal(t, 2, smContext.PendingPfcpReqCount(pfcp.PFCP_SESSION_ESTABLISHMENT_REQUEST))
+
+	//Unknown sequence number or SEID
+	matched, _, _ := smContext.ResolvePfcpRsp(&context.PfcpRsp{SeqNum: 3, LocalSEID: 100, Accepted: true})
+	require.False(t, matched)
+	matched, _, _ = smContext.ResolvePfcpRsp(&context.PfcpRsp{SeqNum: 1, LocalSEID: 101, Accepted: true})
+	require.False(t, matched)
+
+	matched, done, _ := smContext.ResolvePfcpRsp(&context.PfcpRsp{SeqNum: 2, LocalSEID: 100, Accepted: false})
+	require.True(t, matched)
+	require.False(t, done)
+
+	matched, done, failed := smContext.ResolvePfcpRsp(&context.PfcpRsp{SeqNum: 1, LocalSEID: 100, Accepted: true})
+	require.True(t, matched)
+	require.True(t, done)
+	require.Len(t, failed, 1)
+	require.Equal(t, "192.168.179.2", failed[0].NodeIP)
+	require.Equal(t, 0, smContext.PendingPfcpReqCount(pfcp.PFCP_SESSION_ESTABLISHMENT_REQUEST))
+}
+
+func TestPostPfcpProcedureRsp(t *testing.T) {
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007488", 11)
+
+	rsps := make(chan *context.PfcpProcedureRsp, 1)
+	context.RegisterPfcpProcedureRspHandler(func(smContext *context.SMContext, rsp *context.PfcpProcedureRsp) {
+		rsps <- rsp
+	})
+	defer context.RegisterPfcpProcedureRspHandler(nil)
+
+	//No procedure waits, response dropped
+	smContext.AddPendingPfcpReq(1, "192.168.179.1", pfcp.PFCP_SESSION_MODIFICATION_REQUEST, 100)
+	smContext.PostPfcpRsp(&context.PfcpRsp{SeqNum: 1, LocalSEID: 100, Accepted: true})
+	require.Len(t, rsps, 0)
+
+	smContext.AwaitPfcpRsp(&context.PfcpProcedure{ReqType: pfcp.PFCP_SESSION_MODIFICATION_REQUEST})
+	require.True(t, smContext.IsAwaitingPfcpRsp())
+	require.False(t, smContext.IsPfcpProcedurePending(pfcp.PFCP_SESSION_DELETION_REQUEST))
+	smContext.AddPendingPfcpReq(2, "192.168.179.1", pfcp.PFCP_SESSION_MODIFICATION_REQUEST, 100)
+	smContext.AddPendingPfcpReq(3, "192.168.179.2", pfcp.PFCP_SESSION_MODIFICATION_REQUEST, 100)
+	smContext.PostPfcpRsp(&context.PfcpRsp{SeqNum: 2, LocalSEID: 100, Timeout: true})
+	require.Len(t, rsps, 0)
+	smContext.PostPfcpRsp(&context.PfcpRsp{SeqNum: 3, LocalSEID: 100, Accepted: true})
+	require.Len(t, rsps, 1)
+	rsp := <-rsps
+	require.Equal(t, pfcp.PFCP_SESSION_MODIFICATION_REQUEST, rsp.ReqType)
+	require.Equal(t, context.SessionUpdateTimeout, rsp.Status)
+
+	procedure := smContext.TakePfcpProcedure(pfcp.PFCP_SESSION_MODIFICATION_REQUEST)
+	require.NotNil(t, procedure)
+	require.False(t, smContext.IsAwaitingPfcpRsp())
+
+	//Deletion rejected by UPF completes release
+	smContext.AwaitPfcpRsp(&context.PfcpProcedure{ReqType: pfcp.PFCP_SESSION_DELETION_REQUEST})
+	smContext.AddPendingPfcpReq(4, "192.168.179.1", pfcp.PFCP_SESSION_DELETION_REQUEST, 100)
+	smContext.PostPfcpRsp(&context.PfcpRsp{SeqNum: 4, LocalSEID: 100, Accepted: false})
+	rsp = <-rsps
+	require.Equal(t, context.SessionReleaseSuccess, rsp.Status)
+}
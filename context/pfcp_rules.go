@@ -91,6 +91,14 @@ type QER struct {
 
 // Usage Report Rule
 type URR struct {
+	URRID uint32
+
+	MeasurementMethod pfcpType.MeasurementMethod
+	ReportingTriggers pfcpType.ReportingTriggers
+	VolumeThreshold   *pfcpType.VolumeThreshold
+	TimeThreshold     *pfcpType.TimeThreshold
+
+	State RuleState
 }
 
 func (pdr PDR) String() string {
@@ -0,0 +1,237 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/factory"
+	"github.com/free5gc/smf/radius"
+	errors "github.com/free5gc/smf/smferrors"
+)
+
+//EAP codes, SMF relays EAP in pass-through mode(RFC 3748 4)
+const (
+	EapCodeRequest  uint8 = 1
+	EapCodeResponse uint8 = 2
+	EapCodeSuccess  uint8 = 3
+	EapCodeFailure  uint8 = 4
+
+	eapTypeIdentity uint8 = 1
+)
+
+//Service-Type Framed
+const radiusServiceTypeFramed uint32 = 2
+
+type SecondaryAuthResult uint8
+
+const (
+	//EAP request of DN-AAA to be sent to UE
+	SecondaryAuthChallenge SecondaryAuthResult = iota
+	SecondaryAuthSuccess
+	SecondaryAuthFailure
+)
+
+//SecondaryAuth is PDU session authentication and authorization by DN-AAA(TS 23.502 4.3.2.3),
+//rest of PDU session establishment waits for its outcome
+type SecondaryAuth struct {
+	client *radius.Client
+	//Identifier of last EAP request relayed to UE
+	eapId uint8
+	//EAP identity of UE at DN
+	Identity string
+	//RADIUS State and Class of DN-AAA
+	state []byte
+	class []byte
+
+	Authorized bool
+	//EAP-Success/Failure sent to UE in PDU Session Establishment Accept/Reject
+	EapResult []byte
+	//UE IP address and session AMBR authorized by DN-AAA, if provided
+	FramedIPAddr net.IP
+	SessionAmbr  *models.Ambr
+
+	//PDU session establishment parked until UE is authenticated
+	EstablishmentRequest *nasMessage.PDUSessionEstablishmentRequest
+	Transfer             *SMContextTransfer
+
+	acctStartTime time.Time
+}
+
+func newSecondaryAuthClient(config *factory.SecondaryAuth) *radius.Client {
+	if config == nil {
+		return nil
+	}
+	return radius.NewClient(config.Server, config.AccountingServer, config.Secret,
+		time.Duration(config.Timeout)*time.Second, config.Retries)
+}
+
+func buildEap(code, id uint8, data []byte) []byte {
+	eap := make([]byte, 4+len(data))
+	eap[0] = code
+	eap[1] = id
+	binary.BigEndian.PutUint16(eap[2:], uint16(len(eap)))
+	copy(eap[4:], data)
+	return eap
+}
+
+//StartSecondaryAuth parks PDU session establishment till UE is authenticated by DN-AAA
+func (smContext *SMContext) StartSecondaryAuth(request *nasMessage.PDUSessionEstablishmentRequest,
+	transfer *SMContextTransfer) {
+	smContext.SecondaryAuth = &SecondaryAuth{
+		client:               smContext.DNNInfo.SecondaryAuth,
+		eapId:                1,
+		EstablishmentRequest: request,
+		Transfer:             transfer,
+	}
+}
+
+//IdentityRequest returns EAP-Request/Identity starting authentication of UE
+func (auth *SecondaryAuth) IdentityRequest() []byte {
+	return buildEap(EapCodeRequest, auth.eapId, []byte{eapTypeIdentity})
+}
+
+//ApplySecondaryAuthIP uses UE IP address assigned by DN-AAA if it is free in pool of DNN
+func (smContext *SMContext) ApplySecondaryAuthIP() bool {
+	auth := smContext.SecondaryAuth
+	if auth == nil || auth.FramedIPAddr == nil {
+		return false
+	}
+	if err := smContext.DNNInfo.UeIPAllocator.Reserve(auth.FramedIPAddr); err != nil {
+		smContext.SubPduSessLog.Warnf("UE IP[%s] assigned by DN-AAA not used, %v", auth.FramedIPAddr, err)
+		return false
+	}
+	smContext.PDUAddress = auth.FramedIPAddr
+	return true
+}
+
+//BuildSecondaryAuthReject builds PDU Session Establishment Reject of session which fails after
+//UE was authenticated, or wasn't authenticated, by DN-AAA
+func (smContext *SMContext) BuildSecondaryAuthReject(cause string) ([]byte, error) {
+	return BuildGSMPDUSessionEstablishmentReject(smContext, errors.ErrorCause[cause],
+		SMF_Self().CongestionControl.StartBackOff(smContext, cause))
+}
+
+//radiusCallingStationId is MSISDN of UE if known
+func (smContext *SMContext) radiusCallingStationId() string {
+	if strings.HasPrefix(smContext.Gpsi, "msisdn-") {
+		return strings.TrimPrefix(smContext.Gpsi, "msisdn-")
+	}
+	return ""
+}
+
+func (smContext *SMContext) newRadiusRequest(code radius.Code) *radius.Packet {
+	auth := smContext.SecondaryAuth
+	req := radius.NewPacket(code)
+	if auth.Identity != "" {
+		req.AddString(radius.AttrUserName, auth.Identity)
+	}
+	req.AddIPv4(radius.AttrNASIPAddress, net.ParseIP(SMF_Self().RegisterIPv4))
+	if SMF_Self().Name != "" {
+		req.AddString(radius.AttrNASIdentifier, SMF_Self().Name)
+	}
+	req.AddString(radius.AttrCalledStationId, smContext.Dnn)
+	if msisdn := smContext.radiusCallingStationId(); msisdn != "" {
+		req.AddString(radius.AttrCallingStationId, msisdn)
+	}
+	return req
+}
+
+//RelaySecondaryAuthEap relays EAP message of UE to DN-AAA and returns EAP message to be sent
+//back to UE, EAP-Failure is returned along with error if DN-AAA can't be reached
+func (smContext *SMContext) RelaySecondaryAuthEap(eap []byte) (SecondaryAuthResult, []byte, error) {
+	auth := smContext.SecondaryAuth
+	if auth == nil {
+		return SecondaryAuthFailure, nil, fmt.Errorf("secondary authentication not started")
+	}
+	if len(eap) < 4 || eap[0] != EapCodeResponse {
+		return SecondaryAuthFailure, nil, fmt.Errorf("invalid EAP response")
+	}
+	if len(eap) > 5 && eap[4] == eapTypeIdentity && auth.Identity == "" {
+		auth.Identity = string(eap[5:])
+	}
+
+	req := smContext.newRadiusRequest(radius.CodeAccessRequest)
+	req.AddUint32(radius.AttrServiceType, radiusServiceTypeFramed)
+	if auth.state != nil {
+		req.Add(radius.AttrState, auth.state)
+	}
+	req.AddEAPMessage(eap)
+
+	rsp, err := auth.client.Exchange(req)
+	if err != nil {
+		auth.EapResult = buildEap(EapCodeFailure, auth.eapId, nil)
+		return SecondaryAuthFailure, auth.EapResult, err
+	}
+	auth.state = rsp.Get(radius.AttrState)
+	eapRsp := rsp.EAPMessage()
+
+	switch rsp.Code {
+	case radius.CodeAccessChallenge:
+		if len(eapRsp) < 4 || eapRsp[0] != EapCodeRequest {
+			auth.EapResult = buildEap(EapCodeFailure, auth.eapId, nil)
+			return SecondaryAuthFailure, auth.EapResult, fmt.Errorf("Access-Challenge without EAP request")
+		}
+		auth.eapId = eapRsp[1]
+		return SecondaryAuthChallenge, eapRsp, nil
+
+	case radius.CodeAccessAccept:
+		auth.Authorized = true
+		auth.class = rsp.Get(radius.AttrClass)
+		auth.FramedIPAddr = rsp.GetIPv4(radius.AttrFramedIPAddress)
+		if vsa := smContext.DNNInfo.SecondaryAuthAmbr; vsa != nil {
+			ul := rsp.GetVendor(vsa.VendorId, vsa.UplinkType)
+			dl := rsp.GetVendor(vsa.VendorId, vsa.DownlinkType)
+			if ul != nil && dl != nil {
+				auth.SessionAmbr = &models.Ambr{Uplink: string(ul), Downlink: string(dl)}
+			}
+		}
+		if auth.EapResult = eapRsp; eapRsp == nil {
+			auth.EapResult = buildEap(EapCodeSuccess, auth.eapId, nil)
+		}
+		return SecondaryAuthSuccess, auth.EapResult, nil
+	}
+
+	if auth.EapResult = eapRsp; eapRsp == nil {
+		auth.EapResult = buildEap(EapCodeFailure, auth.eapId, nil)
+	}
+	return SecondaryAuthFailure, auth.EapResult, nil
+}
+
+//SecondaryAuthAccounting sends accounting start or stop of session authorized by DN-AAA,
+//request is sent in background. Stop is sent only for session accounting was started for
+func (smContext *SMContext) SecondaryAuthAccounting(status uint32) {
+	auth := smContext.SecondaryAuth
+	if auth == nil || !auth.Authorized || (status == radius.AcctStatusStop && auth.acctStartTime.IsZero()) {
+		return
+	}
+
+	req := smContext.newRadiusRequest(radius.CodeAccountingRequest)
+	req.AddUint32(radius.AttrAcctStatusType, status)
+	req.AddString(radius.AttrAcctSessionId, smContext.Ref)
+	req.AddIPv4(radius.AttrFramedIPAddress, smContext.PDUAddress)
+	if auth.class != nil {
+		req.Add(radius.AttrClass, auth.class)
+	}
+	if status == radius.AcctStatusStart {
+		auth.acctStartTime = time.Now()
+	} else {
+		req.AddUint32(radius.AttrAcctSessionTime, uint32(time.Since(auth.acctStartTime).Seconds()))
+		auth.acctStartTime = time.Time{}
+	}
+
+	client, log := auth.client, smContext.SubPduSessLog
+	go func() {
+		if err := client.Account(req); err != nil {
+			log.Warnf("DN-AAA accounting[%d] failed, %v", status, err)
+		}
+	}()
+}
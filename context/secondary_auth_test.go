@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+	"github.com/free5gc/smf/factory"
+	"github.com/free5gc/smf/radius"
+)
+
+const testAaaSecret = "testing123"
+
+var testAmbrVsa = &factory.RadiusSessionAmbr{VendorId: radius.Vendor3GPP, UplinkType: 201, DownlinkType: 202}
+
+//startTestAaa runs local DN-AAA, identity "alice" is challenged once and accepted, others rejected
+func startTestAaa(t *testing.T) (string, chan *radius.Packet) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+	accounting := make(chan *radius.Packet, 10)
+
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, peer, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			req, err := radius.Decode(buf[:n])
+			if err != nil || radius.VerifyRequest(buf[:n], []byte(testAaaSecret)) != nil {
+				continue
+			}
+
+			var rsp *radius.Packet
+			switch {
+			case req.Code == radius.CodeAccountingRequest:
+				accounting <- req
+				rsp = radius.NewPacket(radius.CodeAccountingResponse)
+			case string(req.Get(radius.AttrUserName)) != "alice":
+				rsp = radius.NewPacket(radius.CodeAccessReject)
+			case req.Get(radius.AttrState) == nil:
+				rsp = radius.NewPacket(radius.CodeAccessChallenge)
+				rsp.Add(radius.AttrState, []byte("md5-challenge"))
+				rsp.AddEAPMessage([]byte{context.EapCodeRequest, 2, 0, 6, 4, 0})
+			default:
+				rsp = radius.NewPacket(radius.CodeAccessAccept)
+				rsp.AddIPv4(radius.AttrFramedIPAddress, net.ParseIP("10.60.0.20"))
+				rsp.AddVendor(testAmbrVsa.VendorId, testAmbrVsa.UplinkType, []byte("10 Mbps"))
+				rsp.AddVendor(testAmbrVsa.VendorId, testAmbrVsa.DownlinkType, []byte("50 Mbps"))
+			}
+			if rspBuf, err := rsp.EncodeResponse([]byte(testAaaSecret), req); err == nil {
+				conn.WriteToUDP(rspBuf, peer)
+			}
+		}
+	}()
+	return conn.LocalAddr().String(), accounting
+}
+
+func newSecondaryAuthTestContext(t *testing.T, supi, server string) *context.SMContext {
+	allocator, err := context.NewIPAllocator("10.60.0.0/24")
+	require.Nil(t, err)
+	smContext := smctxtest.NewSMContext(t, supi, 10)
+	smContext.Dnn = "enterprise"
+	smContext.DNNInfo = &context.SnssaiSmfDnnInfo{
+		UeIPAllocator:     allocator,
+		SecondaryAuth:     radius.NewClient(server, server, testAaaSecret, time.Second, 1),
+		SecondaryAuthAmbr: testAmbrVsa,
+	}
+	smContext.StartSecondaryAuth(nil, nil)
+	return smContext
+}
+
+func TestSecondaryAuth(t *testing.T) {
+	server, accounting := startTestAaa(t)
+	smContext := newSecondaryAuthTestContext(t, "imsi-2089300007501", server)
+	auth := smContext.SecondaryAuth
+	require.Equal(t, []byte{context.EapCodeRequest, 1, 0, 5, 1}, auth.IdentityRequest())
+
+	//Identity response is challenged
+	result, eap, err := smContext.RelaySecondaryAuthEap([]byte{context.EapCodeResponse, 1, 0, 10, 1, 'a', 'l', 'i', 'c', 'e'})
+	require.Nil(t, err)
+	require.Equal(t, context.SecondaryAuthChallenge, result)
+	require.Equal(t, []byte{context.EapCodeRequest, 2, 0, 6, 4, 0}, eap)
+	require.Equal(t, "alice", auth.Identity)
+
+	//Challenge answered, UE authorized with IP address and session AMBR of DN-AAA
+	result, eap, err = smContext.RelaySecondaryAuthEap([]byte{context.EapCodeResponse, 2, 0, 6, 4, 0})
+	require.Nil(t, err)
+	require.Equal(t, context.SecondaryAuthSuccess, result)
+	require.Equal(t, []byte{context.EapCodeSuccess, 2, 0, 4}, eap)
+	require.True(t, auth.Authorized)
+	require.Equal(t, "10 Mbps", auth.SessionAmbr.Uplink)
+	require.Equal(t, "50 Mbps", auth.SessionAmbr.Downlink)
+	require.True(t, smContext.ApplySecondaryAuthIP())
+	require.Equal(t, "10.60.0.20", smContext.PDUAddress.String())
+
+	//Accounting stop without start is not sent
+	smContext.SecondaryAuthAccounting(radius.AcctStatusStop)
+	smContext.SecondaryAuthAccounting(radius.AcctStatusStart)
+	req := <-accounting
+	require.Equal(t, []byte{0, 0, 0, 1}, req.Get(radius.AttrAcctStatusType))
+	require.Equal(t, smContext.Ref, string(req.Get(radius.AttrAcctSessionId)))
+	smContext.SecondaryAuthAccounting(radius.AcctStatusStop)
+	req = <-accounting
+	require.Equal(t, []byte{0, 0, 0, 2}, req.Get(radius.AttrAcctStatusType))
+}
+
+func TestSecondaryAuthReject(t *testing.T) {
+	server, _ := startTestAaa(t)
+	smContext := newSecondaryAuthTestContext(t, "imsi-2089300007502", server)
+
+	result, eap, err := smContext.RelaySecondaryAuthEap([]byte{context.EapCodeResponse, 1, 0, 12, 1, 'm', 'a', 'l', 'l', 'o', 'r', 'y'})
+	require.Nil(t, err)
+	require.Equal(t, context.SecondaryAuthFailure, result)
+	require.Equal(t, []byte{context.EapCodeFailure, 1, 0, 4}, eap)
+	require.False(t, smContext.SecondaryAuth.Authorized)
+	require.False(t, smContext.ApplySecondaryAuthIP())
+
+	//DN-AAA not reachable
+	smContext = newSecondaryAuthTestContext(t, "imsi-2089300007503", "127.0.0.1:1")
+	smContext.DNNInfo.SecondaryAuth.Timeout = 100 * time.Millisecond
+	result, eap, err = smContext.RelaySecondaryAuthEap([]byte{context.EapCodeResponse, 1, 0, 10, 1, 'a', 'l', 'i', 'c', 'e'})
+	require.NotNil(t, err)
+	require.Equal(t, context.SecondaryAuthFailure, result)
+	require.Equal(t, []byte{context.EapCodeFailure, 1, 0, 4}, eap)
+}
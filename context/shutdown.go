@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/free5gc/smf/factory"
+)
+
+const (
+	DefaultShutdownDrainTimeout = 30 * time.Second
+	DefaultShutdownRetryAfter   = 60
+	DefaultShutdownPersistPath  = "/tmp/smf-sessions.json"
+)
+
+//ShutdownConfig holds graceful shutdown parameters
+type ShutdownConfig struct {
+	Graceful      bool
+	DrainTimeout  time.Duration
+	RetryAfter    int
+	SessionAction string
+	PersistPath   string
+}
+
+var shuttingDown int32
+
+func initShutdownConfig(shutdown *factory.Shutdown) {
+	smfContext.Shutdown = ShutdownConfig{
+		DrainTimeout:  DefaultShutdownDrainTimeout,
+		RetryAfter:    DefaultShutdownRetryAfter,
+		SessionAction: factory.SHUTDOWN_SESSION_RELEASE,
+		PersistPath:   DefaultShutdownPersistPath,
+	}
+	if shutdown == nil {
+		return
+	}
+
+	smfContext.Shutdown.Graceful = shutdown.Graceful
+	if shutdown.DrainTimeout > 0 {
+		smfContext.Shutdown.DrainTimeout = time.Duration(shutdown.DrainTimeout) * time.Second
+	}
+	if shutdown.RetryAfter > 0 {
+		smfContext.Shutdown.RetryAfter = shutdown.RetryAfter
+	}
+	if shutdown.SessionAction == factory.SHUTDOWN_SESSION_PERSIST {
+		smfContext.Shutdown.SessionAction = factory.SHUTDOWN_SESSION_PERSIST
+	}
+	if shutdown.PersistPath != "" {
+		smfContext.Shutdown.PersistPath = shutdown.PersistPath
+	}
+}
+
+//SetShuttingDown marks SMF as shutting down, new SM contexts are rejected
+func SetShuttingDown() {
+	atomic.StoreInt32(&shuttingDown, 1)
+}
+
+func IsShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) == 1
+}
+
+//RangeSMContexts calls f for every SM context till f returns false
+func RangeSMContexts(f func(smContext *SMContext) bool) {
+	smContextPool.Range(func(key, value interface{}) bool {
+		return f(value.(*SMContext))
+	})
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/free5gc/smf/metrics"
 	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
 	"github.com/free5gc/smf/qos"
+	"github.com/free5gc/smf/radius"
 	errors "github.com/free5gc/smf/smferrors"
 	"github.com/free5gc/smf/transaction"
 	"github.com/sirupsen/logrus"
@@ -23,9 +24,11 @@ import (
 	"net/http"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/free5gc/nas"
 	"github.com/free5gc/nas/nasConvert"
 	"github.com/free5gc/nas/nasMessage"
 	"github.com/free5gc/openapi"
@@ -65,6 +68,7 @@ const (
 	SmStatePfcpRelease
 	SmStateRelease
 	SmStateN1N2TransferPending
+	SmStateSecondaryAuthPending
 	SmStateMax
 )
 
@@ -126,14 +130,26 @@ type SMContext struct {
 	SelectedPCFProfile models.NfProfile
 	SmStatusNotifyUri  string
 
+	//Serving SMF registered at UDM UECM for this session
+	UdmRegistered bool
+	//UDM SDM subscription to SM data changes of this session
+	SdmSubscriptionId string
+
+	//Home-routed roaming, set when SMF acts as H-SMF
+	Vsmf *VsmfInfo
+
+	//Home-routed roaming, set when SMF acts as V-SMF
+	Hsmf *HsmfInfo
+
 	SMContextState SMContextState
+	//Time of last state change
+	StateChangeTime time.Time
 
 	Tunnel    *UPTunnel
 	BPManager *BPManager
 	// NodeID(string form) to PFCP Session Context
 	PFCPContext                         map[string]*PFCPSessionContext
-	SBIPFCPCommunicationChan            chan PFCPSessionResponseStatus
-	PendingUPF                          PendingUPF
+	pfcpPendingRsp                      pfcpPendingRsp
 	PDUSessionRelease_DUE_TO_DUP_PDU_ID bool
 	LocalPurged                         bool
 
@@ -144,14 +160,38 @@ type SMContext struct {
 	SmPolicyUpdates []*qos.PolicyUpdate
 	//Holds Session/PCC Rules and Qos/Cond/Charging Data
 	SmPolicyData qos.SmCtxtPolicyData
+	//Usage monitoring id of URRs installed on PSA of default path, by URR id
+	UsageMonUrrs map[uint32]string
 
 	// NAS
 	Pti                     uint8
 	EstAcceptCause5gSMValue uint8
+	//Network requested release
+	ReleaseCause5gSMValue uint8
+	//5GSM procedures by PTI
+	GsmProcedures map[uint8]*GsmProcedure
 
 	// PCO Related
 	ProtocolConfigurationOptions *ProtocolConfigurationOptions
 
+	//Authentication/authorization by DN-AAA, nil if DNN has none
+	SecondaryAuth *SecondaryAuth
+
+	//Selected SSC mode, anchor UPF of SSC mode 2/3 session can be relocated
+	SscMode           uint8
+	AnchorRelocatable bool
+	//DNAI anchor UPF was selected for, empty if default path of DNN
+	Dnai string
+	//SSC mode 3 anchor UPF relocation in progress
+	AnchorRelocation *AnchorRelocation
+	//Always-on PDU session requested by UE and granted by DNN policy
+	AlwaysOnRequested bool
+	AlwaysOn          bool
+	//Release of LADN DNN session UE left service area of, nil if none pending
+	ladnRelease *time.Timer
+	//AN resources were released by SMF as UE left LADN service area, set up again once it returns
+	LadnUpDeactivated bool
+
 	// lock
 	SMLock sync.Mutex
 
@@ -167,6 +207,11 @@ type SMContext struct {
 	TxnBus       transaction.TxnBus
 	SMTxnBusLock sync.Mutex
 	ActiveTxn    *transaction.Transaction
+
+	//Recent transactions and state changes
+	txnHistory *smTxnHistory
+	//Event being handled and state it was handled in
+	stateEvent *smStateEvent
 }
 
 func canonicalName(identifier string, pduSessID int32) (canonical string) {
@@ -193,19 +238,18 @@ func NewSMContext(identifier string, pduSessID int32) (smContext *SMContext) {
 	canonicalRef.Store(canonicalName(identifier, pduSessID), smContext.Ref)
 
 	smContext.SMContextState = SmStateInit
+	smContext.StateChangeTime = time.Now()
 	smContext.Identifier = identifier
 	smContext.PDUSessionID = pduSessID
 	smContext.PFCPContext = make(map[string]*PFCPSessionContext)
 
 	// initialize SM Policy Data
-	smContext.SBIPFCPCommunicationChan = make(chan PFCPSessionResponseStatus, 1)
 	smContext.SmPolicyUpdates = make([]*qos.PolicyUpdate, 0)
 	smContext.SmPolicyData.Initialize()
+	smContext.UsageMonUrrs = make(map[uint32]string)
 
-	smContext.ProtocolConfigurationOptions = &ProtocolConfigurationOptions{
-		DNSIPv4Request: false,
-		DNSIPv6Request: false,
-	}
+	smContext.ProtocolConfigurationOptions = &ProtocolConfigurationOptions{}
+	smContext.SscMode = SscMode1
 
 	//Sess Stats
 	smContextActive := incSMContextActive()
@@ -214,6 +258,8 @@ func NewSMContext(identifier string, pduSessID int32) (smContext *SMContext) {
 	//initialise log tags
 	smContext.initLogTags()
 
+	smContext.txnHistory = new(smTxnHistory)
+
 	return smContext
 }
 
@@ -230,45 +276,78 @@ func (smContext *SMContext) initLogTags() {
 	smContext.SubQosLog = logger.QosLog.WithFields(subField)
 }
 
-func (smContext *SMContext) ChangeState(nextState SMContextState) {
+func (smContext *SMContext) ChangeState(nextState SMContextState) error {
 
-	//Update Subscriber profile Metrics
-	if nextState == SmStateActive || smContext.SMContextState == SmStateActive {
-		var upf string
-		if smContext.Tunnel != nil {
-			//Set UPF FQDN name if provided else IP-address
-			if smContext.Tunnel.DataPathPool[1].FirstDPNode.UPF.NodeID.NodeIdType == pfcpType.NodeIdTypeFqdn {
-				upf = string(smContext.Tunnel.DataPathPool[1].FirstDPNode.UPF.NodeID.NodeIdValue)
-				upf = strings.Split(upf, ".")[0]
-			} else {
-				upf = smContext.Tunnel.DataPathPool[1].FirstDPNode.UPF.GetUPFIP()
-			}
+	currState := smContext.SMContextState
+	//State changes only while SMF FSM handles an event
+	if smContext.stateEvent == nil {
+		smContext.SubCtxLog.Errorf("context state change rejected, no event in progress, current state[%v] next state[%v]",
+			currState.String(), nextState.String())
+		return fmt.Errorf("illegal state transition [%v] -> [%v], no event in progress",
+			currState.String(), nextState.String())
+	}
+	if from, event := smContext.stateEvent.state, smContext.stateEvent.event; !IsValidStateTransition(from, event, nextState) {
+		smContext.SubCtxLog.Errorf("context state change rejected, event[%v] of state[%v], current state[%v] next state[%v]",
+			event, from.String(), currState.String(), nextState.String())
+		return fmt.Errorf("illegal state transition [%v] -> [%v] on event[%v] of state[%v]",
+			currState.String(), nextState.String(), event, from.String())
+	}
+
+	smContext.SubCtxLog.Infof("context state change, current state[%v] next state[%v]",
+		currState.String(), nextState.String())
+	smContext.setState(nextState)
+	return nil
+}
+
+//setState moves SM context to next state, exit and entry actions are run unless state stays
+func (smContext *SMContext) setState(nextState SMContextState) {
+	currState := smContext.SMContextState
+
+	//Self transitions don't run exit/entry actions
+	if currState != nextState {
+		if onExit := smStateExitActions[currState]; onExit != nil {
+			onExit(smContext)
 		}
+	}
 
-		//enterprise name
-		ent := "na"
-		if smfContext.EnterpriseList != nil {
+	smContext.SMContextState = nextState
+	smContext.txnHistoryTransition(currState, nextState)
 
-			entMap := *smfContext.EnterpriseList
-			smContext.SubCtxLog.Infof("context state change, Enterprises configured = [%v], subscriber slice sst [%v], sd [%v]",
-				entMap, smContext.Snssai.Sst, smContext.Snssai.Sd)
-			ent = entMap[strconv.Itoa(int(smContext.Snssai.Sst))+smContext.Snssai.Sd]
-		} else {
-			smContext.SubCtxLog.Warn("context state change, enterprise info not available")
+	if currState != nextState {
+		smContext.StateChangeTime = time.Now()
+		if onEntry := smStateEntryActions[nextState]; onEntry != nil {
+			onEntry(smContext)
 		}
+	}
+}
 
-		if nextState == SmStateActive {
-			metrics.SetSessProfileStats(smContext.Identifier, smContext.PDUAddress.String(), nextState.String(),
-				upf, ent, 1)
+// UpdateSessProfileStats updates Subscriber profile Metrics for given state
+func (smContext *SMContext) UpdateSessProfileStats(state SMContextState, count uint64) {
+	var upf string
+	if smContext.Tunnel != nil {
+		//Set UPF FQDN name if provided else IP-address
+		if smContext.Tunnel.DataPathPool[1].FirstDPNode.UPF.NodeID.NodeIdType == pfcpType.NodeIdTypeFqdn {
+			upf = string(smContext.Tunnel.DataPathPool[1].FirstDPNode.UPF.NodeID.NodeIdValue)
+			upf = strings.Split(upf, ".")[0]
 		} else {
-			metrics.SetSessProfileStats(smContext.Identifier, smContext.PDUAddress.String(), smContext.SMContextState.String(),
-				upf, ent, 0)
+			upf = smContext.Tunnel.DataPathPool[1].FirstDPNode.UPF.GetUPFIP()
 		}
 	}
 
-	smContext.SubCtxLog.Infof("context state change, current state[%v] next state[%v]",
-		smContext.SMContextState.String(), nextState.String())
-	smContext.SMContextState = nextState
+	//enterprise name
+	ent := "na"
+	if smfContext.EnterpriseList != nil {
+
+		entMap := *smfContext.EnterpriseList
+		smContext.SubCtxLog.Infof("context state change, Enterprises configured = [%v], subscriber slice sst [%v], sd [%v]",
+			entMap, smContext.Snssai.Sst, smContext.Snssai.Sd)
+		ent = entMap[strconv.Itoa(int(smContext.Snssai.Sst))+smContext.Snssai.Sd]
+	} else {
+		smContext.SubCtxLog.Warn("context state change, enterprise info not available")
+	}
+
+	metrics.SetSessProfileStats(smContext.Identifier, smContext.PDUAddress.String(), state.String(),
+		upf, ent, count)
 }
 
 //*** add unit test ***//
@@ -286,17 +365,27 @@ func RemoveSMContext(ref string) {
 	var smContext *SMContext
 	if value, ok := smContextPool.Load(ref); ok {
 		smContext = value.(*SMContext)
+	} else {
+		//Released already
+		return
 	}
 
 	smContext.SubCtxLog.Infof("RemoveSMContext, SM context released ")
-	smContext.ChangeState(SmStateInit)
+	//Teardown, context leaves whichever state it is in
+	smContext.setState(SmStateInit)
+	smContext.abortPfcpProcedure()
+
+	smContext.SecondaryAuthAccounting(radius.AcctStatusStop)
+	smContext.StopAnchorRelocation()
+	smContext.StopLadnRelease()
+	SMF_Self().CongestionControl.Release(smContext)
 
 	for _, pfcpSessionContext := range smContext.PFCPContext {
 		seidSMContextMap.Delete(pfcpSessionContext.LocalSEID)
 	}
 
-	//Release UE IP-Address
-	if ip := smContext.PDUAddress; ip != nil {
+	//Release UE IP-Address, allocated by H-SMF for home-routed session
+	if ip := smContext.PDUAddress; ip != nil && !smContext.IsVsmf() {
 		smContext.SubPduSessLog.Infof("Release IP[%s]", smContext.PDUAddress.String())
 		smContext.DNNInfo.UeIPAllocator.Release(ip)
 	}
@@ -556,6 +645,21 @@ func (smContext *SMContext) SelectedSessionRule() *models.SessionRule {
 	}
 }
 
+//SelectedUsageMonData is usage monitoring data referred by selected session rule, nil if none
+func (smContext *SMContext) SelectedUsageMonData() *models.UsageMonitoringData {
+	sessionRule := smContext.SelectedSessionRule()
+	if sessionRule == nil || sessionRule.RefUmData == "" {
+		return nil
+	}
+	//Policy update in progress
+	if len(smContext.SmPolicyUpdates) > 0 && smContext.SmPolicyUpdates[0].SmPolicyDecision != nil {
+		if umData, ok := smContext.SmPolicyUpdates[0].SmPolicyDecision.UmDecs[sessionRule.RefUmData]; ok {
+			return umData
+		}
+	}
+	return smContext.SmPolicyData.SmCtxtUsageMonData.UsageMonData[sessionRule.RefUmData]
+}
+
 func (smContextState SMContextState) String() string {
 	switch smContextState {
 	case SmStateInit:
@@ -574,8 +678,12 @@ func (smContextState SMContextState) String() string {
 		return "SmStatePfcpModify"
 	case SmStatePfcpRelease:
 		return "SmStatePfcpRelease"
+	case SmStateRelease:
+		return "SmStateRelease"
 	case SmStateN1N2TransferPending:
 		return "SmStateN1N2TransferPending"
+	case SmStateSecondaryAuthPending:
+		return "SmStateSecondaryAuthPending"
 
 	default:
 		return "Unknown State"
@@ -587,7 +695,8 @@ func (smContext *SMContext) GeneratePDUSessionEstablishmentReject(cause string)
 
 	if buf, err := BuildGSMPDUSessionEstablishmentReject(
 		smContext,
-		errors.ErrorCause[cause]); err != nil {
+		errors.ErrorCause[cause],
+		SMF_Self().CongestionControl.StartBackOff(smContext, cause)); err != nil {
 		httpResponse = &http_wrapper.Response{
 			Header: nil,
 			Status: int(errors.ErrorType[cause].Status),
@@ -621,8 +730,22 @@ func (smContext *SMContext) CommitSmPolicyDecision(status bool) error {
 	smContext.SMLock.Lock()
 	defer smContext.SMLock.Unlock()
 
+	return smContext.CommitSmPolicyDecisionLocked(status)
+}
+
+//IsNwModificationPending tells if PDU Session Modification Command awaits UE answer
+func (smContext *SMContext) IsNwModificationPending() bool {
+	return smContext.PendingGsmProcedure(nas.MsgTypePDUSessionModificationCommand) != nil
+}
+
+//CommitSmPolicyDecisionLocked is CommitSmPolicyDecision for callers holding SM context lock
+func (smContext *SMContext) CommitSmPolicyDecisionLocked(status bool) error {
 	if status {
 		qos.CommitSmPolicyDecision(&smContext.SmPolicyData, smContext.SmPolicyUpdates[0])
+		//QoS of PDU session changed as PCF decided
+		if smContext.SmPolicyUpdates[0].IsQosChanged() {
+			smContext.notifySmfEvent(SmfEventQosMon, models.EventNotification{})
+		}
 	}
 
 	//Release 0th index update
@@ -0,0 +1,164 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/free5gc/smf/transaction"
+)
+
+//Max transactions retained per SM context
+const MaxTxnHistory = 32
+
+const (
+	TxnResultRunning = "running"
+	TxnResultSuccess = "success"
+	TxnResultFailure = "failure"
+	//State change done outside any transaction
+	TxnResultNone = "none"
+)
+
+//SMStateTrace is a SM context state change
+type SMStateTrace struct {
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	Time time.Time `json:"time"`
+}
+
+//SMTxnRecord is a transaction processed on SM context
+type SMTxnRecord struct {
+	TxnId       uint32         `json:"txnId"`
+	MsgType     string         `json:"msgType"`
+	Events      []string       `json:"events,omitempty"`
+	StartTime   time.Time      `json:"startTime"`
+	EndTime     time.Time      `json:"endTime,omitempty"`
+	Result      string         `json:"result"`
+	Error       string         `json:"error,omitempty"`
+	Transitions []SMStateTrace `json:"transitions,omitempty"`
+}
+
+//smTxnHistory is a bounded ring buffer of transactions
+type smTxnHistory struct {
+	lock    sync.Mutex
+	records [MaxTxnHistory]*SMTxnRecord
+	next    int
+	count   int
+	current *SMTxnRecord
+}
+
+func (h *smTxnHistory) push(rec *SMTxnRecord) {
+	h.records[h.next] = rec
+	h.next = (h.next + 1) % MaxTxnHistory
+	if h.count < MaxTxnHistory {
+		h.count++
+	}
+}
+
+//TxnHistoryStart opens history record for txn run on SM context
+func (smContext *SMContext) TxnHistoryStart(txn *transaction.Transaction) {
+	h := smContext.txnHistory
+	if h == nil {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	rec := &SMTxnRecord{
+		TxnId:     txn.TxnId,
+		MsgType:   string(txn.MsgType),
+		StartTime: txn.StartTime(),
+		Result:    TxnResultRunning,
+	}
+	h.push(rec)
+	h.current = rec
+}
+
+//TxnHistoryEnd closes history record of txn with result
+func (smContext *SMContext) TxnHistoryEnd(txn *transaction.Transaction, result string) {
+	h := smContext.txnHistory
+	if h == nil {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.current == nil || h.current.TxnId != txn.TxnId {
+		return
+	}
+	h.current.EndTime = time.Now()
+	h.current.Result = result
+	if txn.Err != nil {
+		h.current.Error = txn.Err.Error()
+	}
+	h.current = nil
+}
+
+//TxnHistoryEvent adds FSM event to running txn record
+func (smContext *SMContext) TxnHistoryEvent(event string) {
+	h := smContext.txnHistory
+	if h == nil {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.current != nil {
+		h.current.Events = append(h.current.Events, event)
+	}
+}
+
+func (smContext *SMContext) txnHistoryTransition(from, to SMContextState) {
+	h := smContext.txnHistory
+	if h == nil {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	now := time.Now()
+	trace := SMStateTrace{From: from.String(), To: to.String(), Time: now}
+	if h.current != nil {
+		h.current.Transitions = append(h.current.Transitions, trace)
+		return
+	}
+	h.push(&SMTxnRecord{
+		StartTime:   now,
+		EndTime:     now,
+		Result:      TxnResultNone,
+		Transitions: []SMStateTrace{trace},
+	})
+}
+
+//TxnHistory returns copy of transaction history, oldest first
+func (smContext *SMContext) TxnHistory() []SMTxnRecord {
+	history := make([]SMTxnRecord, 0)
+	h := smContext.txnHistory
+	if h == nil {
+		return history
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	start := (h.next - h.count + MaxTxnHistory) % MaxTxnHistory
+	for i := 0; i < h.count; i++ {
+		rec := *h.records[(start+i)%MaxTxnHistory]
+		rec.Events = append([]string(nil), rec.Events...)
+		rec.Transitions = append([]SMStateTrace(nil), rec.Transitions...)
+		history = append(history, rec)
+	}
+	return history
+}
+
+//DumpTxnHistory logs transaction history of SM context, used in crash dumps
+func (smContext *SMContext) DumpTxnHistory() {
+	if dump, err := json.Marshal(smContext.TxnHistory()); err != nil {
+		smContext.SubCtxLog.Errorf("txn history dump failed, %v", err)
+	} else {
+		smContext.SubCtxLog.Errorf("state[%v] txn history: %s", smContext.SMContextState.String(), dump)
+	}
+}
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
+	"github.com/free5gc/smf/transaction"
+)
+
+//Event of FSM SM context is allowed to stay in SmStateInit on
+const historyTestEvent context.SMContextEvent = 1
+
+func TestSMContextTxnHistory(t *testing.T) {
+	context.RegisterStateTransition(context.SmStateInit, historyTestEvent, context.SmStateInit)
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 10)
+
+	txn := transaction.NewTransaction(nil, nil, svcmsgtypes.CreateSmContext)
+	smContext.TxnHistoryStart(txn)
+	smContext.TxnHistoryEvent("SmEventPduSessCreate")
+	smContext.StartStateEvent(historyTestEvent)
+	require.NoError(t, smContext.ChangeState(context.SmStateInit))
+	smContext.EndStateEvent()
+	smContext.TxnHistoryEnd(txn, context.TxnResultSuccess)
+
+	history := smContext.TxnHistory()
+	require.Len(t, history, 1)
+	require.Equal(t, txn.TxnId, history[0].TxnId)
+	require.Equal(t, string(svcmsgtypes.CreateSmContext), history[0].MsgType)
+	require.Equal(t, context.TxnResultSuccess, history[0].Result)
+	require.Equal(t, []string{"SmEventPduSessCreate"}, history[0].Events)
+	require.Len(t, history[0].Transitions, 1)
+
+	//Oldest records are overwritten once buffer is full
+	var last *transaction.Transaction
+	for i := 0; i < context.MaxTxnHistory+5; i++ {
+		last = transaction.NewTransaction(nil, nil, svcmsgtypes.UpdateSmContext)
+		smContext.TxnHistoryStart(last)
+		smContext.TxnHistoryEnd(last, context.TxnResultFailure)
+	}
+	history = smContext.TxnHistory()
+	require.Len(t, history, context.MaxTxnHistory)
+	require.Equal(t, last.TxnId, history[len(history)-1].TxnId)
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import "sync"
+
+//SMContextEvent is event of SMF FSM SM context is handling, events are defined by fsm package
+type SMContextEvent uint
+
+//SMContextStateAction is invoked on entry to or exit from a SM context state
+type SMContextStateAction func(smContext *SMContext)
+
+//smStateEvent is state SM context was in once it started handling event
+type smStateEvent struct {
+	state SMContextState
+	event SMContextEvent
+}
+
+var (
+	smStateTransitionLock sync.RWMutex
+	//States SM context may move to while handling event, populated by SMF FSM at init
+	smStateTransitions = make(map[smStateEvent]*[SmStateMax]bool)
+
+	smStateEntryActions [SmStateMax]SMContextStateAction
+	smStateExitActions  [SmStateMax]SMContextStateAction
+)
+
+//RegisterStateTransition marks to as a legal state of SM context handling event in state from
+func RegisterStateTransition(from SMContextState, event SMContextEvent, to SMContextState) {
+	if from >= SmStateMax || to >= SmStateMax {
+		return
+	}
+	smStateTransitionLock.Lock()
+	defer smStateTransitionLock.Unlock()
+	key := smStateEvent{state: from, event: event}
+	if smStateTransitions[key] == nil {
+		smStateTransitions[key] = new([SmStateMax]bool)
+	}
+	smStateTransitions[key][to] = true
+}
+
+//RegisterStateActions sets entry and exit actions of a SM context state
+func RegisterStateActions(state SMContextState, onEntry, onExit SMContextStateAction) {
+	if state >= SmStateMax {
+		return
+	}
+	smStateEntryActions[state] = onEntry
+	smStateExitActions[state] = onExit
+}
+
+//IsValidStateTransition checks if SM context handling event in state from is allowed to move to state to.
+//Self transitions are allowed only if registered
+func IsValidStateTransition(from SMContextState, event SMContextEvent, to SMContextState) bool {
+	if from >= SmStateMax || to >= SmStateMax {
+		return false
+	}
+	smStateTransitionLock.RLock()
+	defer smStateTransitionLock.RUnlock()
+	transitions := smStateTransitions[smStateEvent{state: from, event: event}]
+	return transitions != nil && transitions[to]
+}
+
+//StartStateEvent records event SM context starts handling in its current state, state changes
+//till EndStateEvent are checked against transitions registered for them
+func (smContext *SMContext) StartStateEvent(event SMContextEvent) {
+	smContext.stateEvent = &smStateEvent{state: smContext.SMContextState, event: event}
+}
+
+//EndStateEvent completes event handling, state isn't changed till next event
+func (smContext *SMContext) EndStateEvent() {
+	smContext.stateEvent = nil
+}
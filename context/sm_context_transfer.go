@@ -0,0 +1,175 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/free5gc/nas/nasConvert"
+	"github.com/free5gc/openapi/models"
+)
+
+//SM context type requested by Retrieve SM Context(TS 29.502)
+const (
+	SmContextTypeSmContext        = "SM_CONTEXT"
+	SmContextTypeEpsPdnConnection = "EPS_PDN_CONNECTION"
+)
+
+//EBI given to default bearer of PDN connection mapped from PDU session
+const DefaultEpsBearerId int32 = 5
+
+//SmContextRetrieveData is Retrieve SM Context request,
+//smContextType is not part of openapi model yet
+type SmContextRetrieveData struct {
+	models.SmContextRetrieveData
+	SmContextType string `json:"smContextType,omitempty"`
+}
+
+//RequestedType returns SM context type asked for, EPS if target is MME
+func (data *SmContextRetrieveData) RequestedType() string {
+	if data.SmContextType != "" {
+		return data.SmContextType
+	}
+	if data.TargetMmeCap != nil {
+		return SmContextTypeEpsPdnConnection
+	}
+	return SmContextTypeSmContext
+}
+
+//SmContextRetrievedData is Retrieve SM Context response, SM context for AMF or EPS PDN connection
+//for MME(TS 29.274 Table 7.3.6-2) depending on type asked for
+type SmContextRetrievedData struct {
+	UeEpsPdnConnection string             `json:"ueEpsPdnConnection,omitempty"`
+	SmContext          *SMContextTransfer `json:"smContext,omitempty"`
+}
+
+//PostSmContextsRequest is Create SM Context request with SM context transfer extension
+type PostSmContextsRequest struct {
+	JsonData              *SmContextCreateData `json:"jsonData,omitempty" multipart:"contentType:application/json"`
+	BinaryDataN1SmMessage []byte               `json:"binaryDataN1SmMessage,omitempty" multipart:"contentType:application/vnd.3gpp.5gnas,ref:JsonData.N1SmMsg.ContentId"`
+}
+
+//SmContextCreateData is Create SM Context data, SmContextTransfer is extension carrying SM
+//context retrieved from SMF it is handed over by, TS 29.502 has no attribute for it
+type SmContextCreateData struct {
+	models.SmContextCreateData
+	SmContextTransfer string `json:"smfSmContextTransfer,omitempty"`
+}
+
+//SMContextTransfer is the serialised form of SM context handed over to another SMF
+type SMContextTransfer struct {
+	Type               string                       `json:"type"`
+	Supi               string                       `json:"supi,omitempty"`
+	Gpsi               string                       `json:"gpsi,omitempty"`
+	Pei                string                       `json:"pei,omitempty"`
+	PduSessionId       int32                        `json:"pduSessionId"`
+	Dnn                string                       `json:"dnn"`
+	SNssai             *models.Snssai               `json:"sNssai,omitempty"`
+	HplmnSnssai        *models.Snssai               `json:"hplmnSnssai,omitempty"`
+	ServingNetwork     *models.PlmnId               `json:"servingNetwork,omitempty"`
+	AnType             models.AccessType            `json:"anType,omitempty"`
+	RatType            models.RatType               `json:"ratType,omitempty"`
+	UeLocation         *models.UserLocation         `json:"ueLocation,omitempty"`
+	PduSessionType     models.PduSessionType        `json:"pduSessionType,omitempty"`
+	UeIpv4Addr         string                       `json:"ueIpv4Addr,omitempty"`
+	SessionAmbr        *models.Ambr                 `json:"sessionAmbr,omitempty"`
+	DefaultQos         *models.SubscribedDefaultQos `json:"defaultQos,omitempty"`
+	UpCnxState         models.UpCnxState            `json:"upCnxState,omitempty"`
+	PcfId              string                       `json:"pcfId,omitempty"`
+	SmContextStatusUri string                       `json:"smContextStatusUri,omitempty"`
+}
+
+//BuildSMContextTransfer serialises SM context in requested type, EPS PDN connection is built
+//by BuildEpsPdnConnection
+func (smContext *SMContext) BuildSMContextTransfer(smContextType string) (*SMContextTransfer, error) {
+	transfer := &SMContextTransfer{
+		Type:           smContextType,
+		Supi:           smContext.Supi,
+		Gpsi:           smContext.Gpsi,
+		PduSessionId:   smContext.PDUSessionID,
+		Dnn:            smContext.Dnn,
+		SNssai:         smContext.Snssai,
+		ServingNetwork: smContext.ServingNetwork,
+		PduSessionType: nasConvert.PDUSessionTypeToModels(smContext.SelectedPDUSessionType),
+		SessionAmbr:    smContext.DnnConfiguration.SessionAmbr,
+		DefaultQos:     smContext.DnnConfiguration.Var5gQosProfile,
+	}
+	if smContext.PDUAddress != nil {
+		transfer.UeIpv4Addr = smContext.PDUAddress.String()
+	}
+	if rule := smContext.SelectedSessionRule(); rule != nil && rule.AuthSessAmbr != nil {
+		transfer.SessionAmbr = rule.AuthSessAmbr
+	}
+
+	switch smContextType {
+	case SmContextTypeSmContext:
+		transfer.Pei = smContext.Pei
+		transfer.HplmnSnssai = smContext.HplmnSnssai
+		transfer.AnType = smContext.AnType
+		transfer.RatType = smContext.RatType
+		transfer.UeLocation = smContext.UeLocation
+		transfer.UpCnxState = smContext.UpCnxState
+		transfer.PcfId = smContext.SelectedPCFProfile.NfInstanceId
+		transfer.SmContextStatusUri = smContext.SmStatusNotifyUri
+	default:
+		return nil, fmt.Errorf("sm context type [%v] not supported", smContextType)
+	}
+	return transfer, nil
+}
+
+//Encode packs transfer into SM context transfer extension
+func (transfer *SMContextTransfer) Encode() (string, error) {
+	buf, err := json.Marshal(transfer)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf), nil
+}
+
+//DecodeSMContextTransfer unpacks SM context transfer extension received in Create SM Context
+func DecodeSMContextTransfer(smContextTransfer string) (*SMContextTransfer, error) {
+	buf, err := base64.StdEncoding.DecodeString(smContextTransfer)
+	if err != nil {
+		return nil, fmt.Errorf("smfSmContextTransfer decode failed, %v", err)
+	}
+	transfer := &SMContextTransfer{}
+	if err := json.Unmarshal(buf, transfer); err != nil {
+		return nil, fmt.Errorf("smfSmContextTransfer unmarshal failed, %v", err)
+	}
+	return transfer, nil
+}
+
+//ApplySMContextTransfer fills SM context being created from transferred one.
+//UE IP address is retained if it's still free in DNN pool, returns whether it was.
+func (smContext *SMContext) ApplySMContextTransfer(transfer *SMContextTransfer) bool {
+	smContext.SubCtxLog.Infof("SM context created from transferred [%v] context", transfer.Type)
+
+	if smContext.Pei == "" {
+		smContext.Pei = transfer.Pei
+	}
+	if smContext.Gpsi == "" {
+		smContext.Gpsi = transfer.Gpsi
+	}
+	if transfer.PduSessionType != "" {
+		smContext.SelectedPDUSessionType = nasConvert.ModelsToPDUSessionType(transfer.PduSessionType)
+	}
+	if transfer.SmContextStatusUri != "" && smContext.SmStatusNotifyUri == "" {
+		smContext.SmStatusNotifyUri = transfer.SmContextStatusUri
+	}
+
+	ip := net.ParseIP(transfer.UeIpv4Addr)
+	if ip == nil || smContext.DNNInfo == nil {
+		return false
+	}
+	if err := smContext.DNNInfo.UeIPAllocator.Reserve(ip); err != nil {
+		smContext.SubCtxLog.Warnf("transferred UE IP [%v] not retained, %v", transfer.UeIpv4Addr, err)
+		return false
+	}
+	smContext.PDUAddress = ip.To4()
+	return true
+}
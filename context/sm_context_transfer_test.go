@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context_test
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+)
+
+func TestSMContextTransfer(t *testing.T) {
+	allocator, err := context.NewIPAllocator("60.60.0.0/16")
+	require.NoError(t, err)
+
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 15, smctxtest.WithDnn("internet", nil))
+	smContext.PDUAddress, err = allocator.Allocate()
+	require.NoError(t, err)
+	smContext.DnnConfiguration.Var5gQosProfile = &models.SubscribedDefaultQos{Var5qi: 9}
+
+	retrieve := context.SmContextRetrieveData{}
+	require.Equal(t, context.SmContextTypeSmContext, retrieve.RequestedType())
+	retrieve.TargetMmeCap = &models.MmeCapabilities{}
+	require.Equal(t, context.SmContextTypeEpsPdnConnection, retrieve.RequestedType())
+
+	_, err = smContext.BuildSMContextTransfer("AF_COORDINATION_INFO")
+	require.Error(t, err)
+
+	//EPS PDN connection isn't SM context transfer
+	_, err = smContext.BuildSMContextTransfer(context.SmContextTypeEpsPdnConnection)
+	require.Error(t, err)
+
+	transfer, err := smContext.BuildSMContextTransfer(context.SmContextTypeSmContext)
+	require.NoError(t, err)
+	require.Equal(t, smContext.PDUAddress.String(), transfer.UeIpv4Addr)
+
+	encoded, err := transfer.Encode()
+	require.NoError(t, err)
+	decoded, err := context.DecodeSMContextTransfer(encoded)
+	require.NoError(t, err)
+	require.Equal(t, transfer, decoded)
+
+	//Extension travels next to standard attributes of Create SM Context data
+	createData := context.SmContextCreateData{}
+	require.NoError(t, json.Unmarshal([]byte(`{"supi":"imsi-2089300007487","ueEpsPdnConnection":"AAE=",
+		"smfSmContextTransfer":"`+encoded+`"}`), &createData))
+	require.Equal(t, "imsi-2089300007487", createData.Supi)
+	require.Equal(t, "AAE=", createData.UeEpsPdnConnection)
+	require.Equal(t, encoded, createData.SmContextTransfer)
+
+	//Address still in use by old context, so it can't be retained
+	newContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 16)
+	smContext.DNNInfo = &context.SnssaiSmfDnnInfo{UeIPAllocator: allocator}
+	newContext.DNNInfo = &context.SnssaiSmfDnnInfo{UeIPAllocator: allocator}
+	require.False(t, newContext.ApplySMContextTransfer(decoded))
+
+	allocator.Release(smContext.PDUAddress)
+	smContext.PDUAddress = nil
+	require.True(t, newContext.ApplySMContextTransfer(decoded))
+	require.True(t, newContext.PDUAddress.Equal(net.ParseIP(transfer.UeIpv4Addr)))
+}
@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//Package smctxtest provides SM contexts of UE for tests of SMF packages
+package smctxtest
+
+import (
+	"testing"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/context"
+)
+
+//Option sets up SM context before test uses it
+type Option func(smContext *context.SMContext)
+
+//NewSMContext returns SM context of PDU session of UE, it is removed once test completes
+func NewSMContext(t testing.TB, supi string, pduSessionID int32, opts ...Option) *context.SMContext {
+	smContext := context.NewSMContext(supi, pduSessionID)
+	t.Cleanup(func() { context.RemoveSMContext(smContext.Ref) })
+	smContext.Supi = supi
+	for _, opt := range opts {
+		opt(smContext)
+	}
+	return smContext
+}
+
+//WithDnn sets DNN and S-NSSAI of session, S-NSSAI is left unset if snssai is nil
+func WithDnn(dnn string, snssai *models.Snssai) Option {
+	return func(smContext *context.SMContext) {
+		smContext.Dnn = dnn
+		if snssai != nil {
+			smContext.Snssai = snssai
+		}
+	}
+}
+
+//WithDnnInfo sets DNN configuration of session
+func WithDnnInfo(dnnInfo *context.SnssaiSmfDnnInfo) Option {
+	return func(smContext *context.SMContext) {
+		smContext.DNNInfo = dnnInfo
+	}
+}
+
+//WithState sets state of SM context without checking transition
+func WithState(state context.SMContextState) Option {
+	return func(smContext *context.SMContext) {
+		smContext.SMContextState = state
+	}
+}
+
+//WithUeLocation sets NR location of UE to tracking area tac
+func WithUeLocation(tac string) Option {
+	return func(smContext *context.SMContext) {
+		smContext.UeLocation = UeLocation(tac)
+	}
+}
+
+//UeLocation is NR location of UE in tracking area tac
+func UeLocation(tac string) *models.UserLocation {
+	return &models.UserLocation{NrLocation: &models.NrLocation{Tai: &models.Tai{Tac: tac}}}
+}
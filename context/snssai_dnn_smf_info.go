@@ -7,8 +7,11 @@ package context
 
 import (
 	"net"
+	"time"
 
 	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/factory"
+	"github.com/free5gc/smf/radius"
 )
 
 // SnssaiSmfInfo records the SMF S-NSSAI related information
@@ -23,9 +26,25 @@ type SnssaiSmfDnnInfo struct {
 	DNS           DNS
 	UeIPAllocator *IPAllocator
 	MTU           uint16
+	NonIPMTU      uint16
+	PCSCF         *PCSCFInfo
+	//DN-AAA, nil if DNN has no secondary authentication
+	SecondaryAuth *radius.Client
+	//Vendor-specific attributes of session AMBR authorized by DN-AAA, nil if not read
+	SecondaryAuthAmbr *factory.RadiusSessionAmbr
+	//PDU sessions of DNN may be always-on
+	AlwaysOn bool
+	//DNAIs by tracking area and lifetime of SSC mode 3 session being relocated
+	Dnais              []factory.DnaiArea
+	PduAddressLifetime time.Duration
+	//Service area of LADN DNN, nil if DNN isn't LADN
+	Ladn *LadnInfo
+	//PDU sessions of roaming UEs are home-routed
+	HomeRouted bool
 }
 
 type DNS struct {
-	IPv4Addr net.IP
-	IPv6Addr net.IP
+	IPv4Addr          net.IP
+	IPv6Addr          net.IP
+	IPv4SecondaryAddr net.IP
 }
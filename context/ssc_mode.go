@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/openapi/models"
+)
+
+//SSC mode values(TS 24.501 9.11.4.16)
+const (
+	SscMode1 uint8 = 1
+	SscMode2 uint8 = 2
+	SscMode3 uint8 = 3
+)
+
+//Always-on PDU session indication values(TS 24.501 9.11.4.3)
+const (
+	AlwaysOnNotAllowed uint8 = 0
+	AlwaysOnRequired   uint8 = 1
+)
+
+func sscModeToNas(mode models.SscMode) uint8 {
+	switch mode {
+	case models.SscMode__2:
+		return SscMode2
+	case models.SscMode__3:
+		return SscMode3
+	}
+	return SscMode1
+}
+
+func SscModeToModels(mode uint8) models.SscMode {
+	switch mode {
+	case SscMode2:
+		return models.SscMode__2
+	case SscMode3:
+		return models.SscMode__3
+	}
+	return models.SscMode__1
+}
+
+//allowedSscModes returns default and allowed SSC modes of subscription, DefaultSscMode if UDM has none
+func (smContext *SMContext) allowedSscModes() (uint8, []uint8) {
+	sscModes := smContext.DnnConfiguration.SscModes
+	if sscModes == nil || sscModes.DefaultSscMode == "" {
+		return sscModeToNas(DefaultSscMode), []uint8{sscModeToNas(DefaultSscMode)}
+	}
+
+	defaultMode := sscModeToNas(sscModes.DefaultSscMode)
+	allowed := []uint8{defaultMode}
+	for _, mode := range sscModes.AllowedSscModes {
+		allowed = append(allowed, sscModeToNas(mode))
+	}
+	return defaultMode, allowed
+}
+
+//SelectSscMode selects SSC mode requested by UE if subscription allows it, default SSC mode of
+//subscription if UE didn't request any(TS 23.501 5.6.9.3). Anchor UPF of SSC mode 2 and 3
+//sessions may be relocated later
+func (smContext *SMContext) SelectSscMode(req *nasMessage.PDUSessionEstablishmentRequest) error {
+	defaultMode, allowed := smContext.allowedSscModes()
+
+	selected := defaultMode
+	if req != nil && req.SSCMode != nil {
+		requested := req.SSCMode.GetSSCMode()
+		//Unused values are interpreted as SSC mode 1, 2 and 3
+		if requested > SscMode3 {
+			requested -= SscMode3
+		}
+		selected = 0
+		for _, mode := range allowed {
+			if mode == requested {
+				selected = requested
+			}
+		}
+		if selected == 0 {
+			return fmt.Errorf("SSC mode[%d] not allowed in DNN[%s] subscription", requested, smContext.Dnn)
+		}
+	}
+
+	smContext.SscMode = selected
+	smContext.AnchorRelocatable = selected != SscMode1
+	smContext.SubPduSessLog.Infof("SSC mode[%d] selected", selected)
+	return nil
+}
+
+//handleAlwaysOnRequest decides on always-on PDU session requested by UE by policy of DNN,
+//indication is sent in Establishment Accept only if UE requested it(TS 24.501 6.4.1.3)
+func (smContext *SMContext) handleAlwaysOnRequest(req *nasMessage.PDUSessionEstablishmentRequest) {
+	smContext.AlwaysOnRequested = req.AlwaysonPDUSessionRequested != nil &&
+		req.AlwaysonPDUSessionRequested.GetAPSR() == 1
+	smContext.AlwaysOn = smContext.AlwaysOnRequested && smContext.DNNInfo != nil && smContext.DNNInfo.AlwaysOn
+}
+
+//AlwaysOnIndication returns Always-on PDU session indication of Establishment Accept
+func (smContext *SMContext) AlwaysOnIndication() uint8 {
+	if smContext.AlwaysOn {
+		return AlwaysOnRequired
+	}
+	return AlwaysOnNotAllowed
+}
@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/nas/nasType"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+)
+
+func newSscModeRequest(sscMode uint8, alwaysOn bool) *nasMessage.PDUSessionEstablishmentRequest {
+	req := nasMessage.NewPDUSessionEstablishmentRequest(0)
+	if sscMode != 0 {
+		req.SSCMode = nasType.NewSSCMode(nasMessage.PDUSessionEstablishmentRequestSSCModeType)
+		req.SSCMode.SetSSCMode(sscMode)
+	}
+	if alwaysOn {
+		req.AlwaysonPDUSessionRequested = nasType.NewAlwaysonPDUSessionRequested(
+			nasMessage.PDUSessionEstablishmentRequestAlwaysonPDUSessionRequestedType)
+		req.AlwaysonPDUSessionRequested.SetAPSR(1)
+	}
+	return req
+}
+
+func TestSelectSscMode(t *testing.T) {
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 10, smctxtest.WithDnn("internet", nil))
+
+	//Subscription without SSC modes, SSC mode 1 only
+	require.Nil(t, smContext.SelectSscMode(newSscModeRequest(0, false)))
+	require.Equal(t, context.SscMode1, smContext.SscMode)
+	require.NotNil(t, smContext.SelectSscMode(newSscModeRequest(context.SscMode2, false)))
+
+	smContext.DnnConfiguration.SscModes = &models.SscModes{
+		DefaultSscMode:  models.SscMode__1,
+		AllowedSscModes: []models.SscMode{models.SscMode__3},
+	}
+	require.Nil(t, smContext.SelectSscMode(newSscModeRequest(0, false)))
+	require.Equal(t, context.SscMode1, smContext.SscMode)
+	require.False(t, smContext.AnchorRelocatable)
+
+	require.Nil(t, smContext.SelectSscMode(newSscModeRequest(context.SscMode3, false)))
+	require.Equal(t, context.SscMode3, smContext.SscMode)
+	require.True(t, smContext.AnchorRelocatable)
+	require.Equal(t, models.SscMode__3, context.SscModeToModels(smContext.SscMode))
+
+	//Unused value interpreted as SSC mode 3
+	require.Nil(t, smContext.SelectSscMode(newSscModeRequest(6, false)))
+	require.Equal(t, context.SscMode3, smContext.SscMode)
+
+	require.NotNil(t, smContext.SelectSscMode(newSscModeRequest(context.SscMode2, false)))
+}
+
+func TestAlwaysOnRequest(t *testing.T) {
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 10,
+		smctxtest.WithDnnInfo(&context.SnssaiSmfDnnInfo{}))
+
+	smContext.HandlePDUSessionEstablishmentRequest(newSscModeRequest(0, false))
+	require.False(t, smContext.AlwaysOnRequested)
+
+	//DNN policy doesn't allow always-on sessions
+	smContext.HandlePDUSessionEstablishmentRequest(newSscModeRequest(0, true))
+	require.True(t, smContext.AlwaysOnRequested)
+	require.Equal(t, context.AlwaysOnNotAllowed, smContext.AlwaysOnIndication())
+
+	smContext.DNNInfo.AlwaysOn = true
+	smContext.HandlePDUSessionEstablishmentRequest(newSscModeRequest(0, true))
+	require.Equal(t, context.AlwaysOnRequired, smContext.AlwaysOnIndication())
+}
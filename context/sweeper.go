@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"time"
+
+	"github.com/free5gc/smf/factory"
+)
+
+const (
+	DefaultSweeperInterval           = 60 * time.Second
+	DefaultPfcpCreatePendingMaxAge   = 60 * time.Second
+	DefaultN1N2TransferPendingMaxAge = 120 * time.Second
+	DefaultInActivePendingMaxAge     = 300 * time.Second
+	//UE and DN-AAA exchanging EAP
+	DefaultSecondaryAuthPendingMaxAge = 120 * time.Second
+)
+
+//SweeperConfig holds max time SM context may stay in a pending state
+type SweeperConfig struct {
+	Enable   bool
+	Interval time.Duration
+	MaxAge   map[SMContextState]time.Duration
+}
+
+func initSweeperConfig(sweeper *factory.Sweeper) {
+	smfContext.Sweeper = SweeperConfig{
+		Interval: DefaultSweeperInterval,
+		MaxAge: map[SMContextState]time.Duration{
+			SmStatePfcpCreatePending:    DefaultPfcpCreatePendingMaxAge,
+			SmStateN1N2TransferPending:  DefaultN1N2TransferPendingMaxAge,
+			SmStateInActivePending:      DefaultInActivePendingMaxAge,
+			SmStateSecondaryAuthPending: DefaultSecondaryAuthPendingMaxAge,
+		},
+	}
+	if sweeper == nil {
+		return
+	}
+
+	smfContext.Sweeper.Enable = sweeper.Enable
+	if sweeper.Interval > 0 {
+		smfContext.Sweeper.Interval = time.Duration(sweeper.Interval) * time.Second
+	}
+	setMaxAge := func(state SMContextState, seconds int) {
+		if seconds > 0 {
+			smfContext.Sweeper.MaxAge[state] = time.Duration(seconds) * time.Second
+		}
+	}
+	setMaxAge(SmStatePfcpCreatePending, sweeper.PfcpCreatePending)
+	setMaxAge(SmStateN1N2TransferPending, sweeper.N1N2TransferPending)
+	setMaxAge(SmStateInActivePending, sweeper.InActivePending)
+	setMaxAge(SmStateSecondaryAuthPending, sweeper.SecondaryAuthPending)
+}
+
+//StaleReleaseHandler runs release of SM context stuck in pending state through SM context FSM,
+//since is time SM context entered the state
+type StaleReleaseHandler func(smContext *SMContext, since time.Time)
+
+var staleReleaseHandler StaleReleaseHandler
+
+//RegisterStaleReleaseHandler is called by SMF FSM at init
+func RegisterStaleReleaseHandler(handler StaleReleaseHandler) {
+	staleReleaseHandler = handler
+}
+
+//RequestStaleRelease starts local release of SM context which entered its pending state at since,
+//it's skipped if SM context moved on meanwhile. It doesn't wait for the release to complete
+func RequestStaleRelease(smContext *SMContext, since time.Time) {
+	if staleReleaseHandler == nil {
+		smContext.SubCtxLog.Errorf("stale SM context release, no handler registered")
+		return
+	}
+	staleReleaseHandler(smContext, since)
+}
+
+//IsStale tells if SM context is still in pending state it entered at since
+func (smContext *SMContext) IsStale(since time.Time) bool {
+	return GetSMContext(smContext.Ref) == smContext && smContext.StateChangeTime.Equal(since)
+}
+
+//StaleSMContexts returns SM contexts which stayed in a pending state longer than allowed, with
+//time they entered the state. Txns running on them are left to complete by release request
+func StaleSMContexts(now time.Time, maxAge map[SMContextState]time.Duration) map[*SMContext]time.Time {
+	stale := make(map[*SMContext]time.Time)
+	RangeSMContexts(func(smContext *SMContext) bool {
+		smContext.SMLock.Lock()
+		state, since := smContext.SMContextState, smContext.StateChangeTime
+		smContext.SMLock.Unlock()
+		if limit, ok := maxAge[state]; ok && limit > 0 && now.Sub(since) > limit {
+			stale[smContext] = since
+		}
+		return true
+	})
+	return stale
+}
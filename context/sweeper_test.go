@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+)
+
+func TestStaleSMContexts(t *testing.T) {
+	now := time.Now()
+	maxAge := map[context.SMContextState]time.Duration{
+		context.SmStatePfcpCreatePending: time.Minute,
+	}
+
+	stuck := smctxtest.NewSMContext(t, "imsi-2089300007487", 11,
+		smctxtest.WithState(context.SmStatePfcpCreatePending))
+	stuck.StateChangeTime = now.Add(-2 * time.Minute)
+
+	recent := smctxtest.NewSMContext(t, "imsi-2089300007487", 12,
+		smctxtest.WithState(context.SmStatePfcpCreatePending))
+	recent.StateChangeTime = now.Add(-30 * time.Second)
+
+	active := smctxtest.NewSMContext(t, "imsi-2089300007487", 13, smctxtest.WithState(context.SmStateActive))
+	active.StateChangeTime = now.Add(-time.Hour)
+
+	stale := context.StaleSMContexts(now, maxAge)
+	require.Equal(t, map[*context.SMContext]time.Time{stuck: stuck.StateChangeTime}, stale)
+	require.True(t, stuck.IsStale(stale[stuck]))
+
+	//Moved on before release ran
+	require.False(t, recent.IsStale(stuck.StateChangeTime))
+
+	//Context released twice
+	context.RemoveSMContext(stuck.Ref)
+	require.NotPanics(t, func() { context.RemoveSMContext(stuck.Ref) })
+	require.False(t, stuck.IsStale(stale[stuck]))
+}
@@ -66,11 +66,11 @@ type UPF struct {
 	N3Interfaces []UPFInterfaceInfo
 	N9Interfaces []UPFInterfaceInfo
 
-	pdrPool sync.Map
-	farPool sync.Map
-	barPool sync.Map
-	qerPool sync.Map
-	// urrPool        sync.Map
+	pdrPool        sync.Map
+	farPool        sync.Map
+	barPool        sync.Map
+	qerPool        sync.Map
+	urrPool        sync.Map
 	pdrIDGenerator *idgenerator.IDGenerator
 	farIDGenerator *idgenerator.IDGenerator
 	barIDGenerator *idgenerator.IDGenerator
@@ -537,6 +537,39 @@ func (upf *UPF) AddBAR() (*BAR, error) {
 	return bar, nil
 }
 
+func (upf *UPF) urrID() (uint32, error) {
+	if upf.UPFStatus != AssociatedSetUpSuccess {
+		err := fmt.Errorf("this upf not associate with smf")
+		return 0, err
+	}
+
+	var urrID uint32
+	if tmpID, err := upf.urrIDGenerator.Allocate(); err != nil {
+		return 0, err
+	} else {
+		urrID = uint32(tmpID)
+	}
+
+	return urrID, nil
+}
+
+func (upf *UPF) AddURR() (*URR, error) {
+	if upf.UPFStatus != AssociatedSetUpSuccess {
+		err := fmt.Errorf("this upf do not associate with smf")
+		return nil, err
+	}
+
+	urr := new(URR)
+	if URRID, err := upf.urrID(); err != nil {
+		return nil, err
+	} else {
+		urr.URRID = URRID
+		upf.urrPool.Store(urr.URRID, urr)
+	}
+
+	return urr, nil
+}
+
 func (upf *UPF) AddQER() (*QER, error) {
 	if upf.UPFStatus != AssociatedSetUpSuccess {
 		err := fmt.Errorf("this upf do not associate with smf")
@@ -601,6 +634,17 @@ func (upf *UPF) RemoveQER(qer *QER) (err error) {
 	return nil
 }
 
+func (upf *UPF) RemoveURR(urr *URR) (err error) {
+	if upf.UPFStatus != AssociatedSetUpSuccess {
+		err = fmt.Errorf("this upf not associate with smf")
+		return err
+	}
+
+	upf.urrIDGenerator.FreeID(int64(urr.URRID))
+	upf.urrPool.Delete(urr.URRID)
+	return nil
+}
+
 func (upf *UPF) isSupportSnssai(snssai *SNssai) bool {
 	for _, snssaiInfo := range upf.SNssaiInfos {
 		if snssaiInfo.SNssai.Equal(snssai) {
@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/pfcp/pfcpType"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+	"github.com/free5gc/smf/qos"
+)
+
+func TestCreateUsageMonUrr(t *testing.T) {
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 17)
+
+	nodeID := pfcpType.NodeID{NodeIdType: pfcpType.NodeIdTypeIpv4Address, NodeIdValue: net.ParseIP("10.200.200.103").To4()}
+	upf := context.NewUPF(&nodeID, nil)
+	upf.UPFStatus = context.AssociatedSetUpSuccess
+	node := &context.DataPathNode{UPF: upf}
+
+	//No usage monitoring asked for
+	sessRule := &models.SessionRule{
+		SessRuleId:   "SessRuleId-1",
+		AuthSessAmbr: &models.Ambr{Uplink: "100 Mbps", Downlink: "100 Mbps"},
+		AuthDefQos:   &models.AuthorizedDefaultQos{Var5qi: 9},
+	}
+	smContext.SmPolicyUpdates = []*qos.PolicyUpdate{qos.BuildSmPolicyUpdate(&smContext.SmPolicyData,
+		&models.SmPolicyDecision{SessRules: map[string]*models.SessionRule{"SessRuleId-1": sessRule}})}
+	urr, err := node.CreateUsageMonUrr(smContext)
+	require.NoError(t, err)
+	require.Nil(t, urr)
+
+	//Session level usage monitoring of session rule
+	umRule := *sessRule
+	umRule.RefUmData = "um-1"
+	smContext.SmPolicyUpdates = []*qos.PolicyUpdate{qos.BuildSmPolicyUpdate(&smContext.SmPolicyData,
+		&models.SmPolicyDecision{
+			SessRules: map[string]*models.SessionRule{"SessRuleId-1": &umRule},
+			UmDecs: map[string]*models.UsageMonitoringData{
+				"um-1": {UmId: "um-1", VolumeThresholdUplink: 1000, TimeThreshold: 60},
+			},
+		})}
+	urr, err = node.CreateUsageMonUrr(smContext)
+	require.NoError(t, err)
+	require.NotNil(t, urr)
+	require.True(t, urr.MeasurementMethod.Volum && urr.MeasurementMethod.Durat)
+	require.True(t, urr.ReportingTriggers.Volth && urr.ReportingTriggers.Timth)
+	require.Equal(t, &pfcpType.VolumeThreshold{Ulvol: true, UplinkVolume: 1000}, urr.VolumeThreshold)
+	require.Equal(t, uint32(60), urr.TimeThreshold.TimeThreshold)
+	require.Equal(t, map[uint32]string{urr.URRID: "um-1"}, smContext.UsageMonUrrs)
+
+	//Committed decision keeps usage monitoring data
+	require.NoError(t, smContext.CommitSmPolicyDecisionLocked(true))
+	require.Equal(t, "um-1", smContext.SelectedUsageMonData().UmId)
+}
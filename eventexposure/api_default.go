@@ -17,24 +17,94 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/openapi"
+	"github.com/free5gc/openapi/models"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/logger"
+	stats "github.com/free5gc/smf/metrics"
+	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
+	"github.com/free5gc/smf/producer"
 )
 
-// SubscriptionsPost -
+func decodeEventExposure(c *gin.Context, msgType svcmsgtypes.SmfMsgType) (models.NsmfEventExposure, bool) {
+	var request models.NsmfEventExposure
+
+	reqBody, err := c.GetRawData()
+	if err == nil {
+		err = openapi.Deserialize(&request, reqBody, "application/json")
+	}
+	if err != nil {
+		problemDetail := "[Request Body] " + err.Error()
+		rsp := models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: problemDetail,
+		}
+		logger.CtxLog.Errorln(problemDetail)
+		stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(msgType), "Out", http.StatusText(http.StatusBadRequest), "Malformed")
+		c.JSON(http.StatusBadRequest, rsp)
+		return request, false
+	}
+	return request, true
+}
+
+func sendEventExposureRsp(c *gin.Context, msgType svcmsgtypes.SmfMsgType, HTTPResponse *http_wrapper.Response) {
+	for key, val := range HTTPResponse.Header {
+		c.Header(key, val[0])
+	}
+	stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(msgType), "Out", http.StatusText(HTTPResponse.Status), "")
+
+	if HTTPResponse.Body == nil {
+		c.Status(HTTPResponse.Status)
+		return
+	}
+	c.JSON(HTTPResponse.Status, HTTPResponse.Body)
+}
+
+// SubscriptionsPost - Create an individual subscription for event notifications from the SMF
 func SubscriptionsPost(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{})
+	logger.CtxLog.Info("Recieve Event Exposure Subscription Create Request")
+	stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmfEventExposureSubscribe), "In", "", "")
+
+	request, ok := decodeEventExposure(c, svcmsgtypes.SmfEventExposureSubscribe)
+	if !ok {
+		return
+	}
+
+	HTTPResponse := producer.HandleSMFEventExposureSubscriptionsPost(request)
+	sendEventExposureRsp(c, svcmsgtypes.SmfEventExposureSubscribe, HTTPResponse)
 }
 
-// SubscriptionsSubIdDelete -
+// SubscriptionsSubIdDelete - Delete an individual subscription for event notifications from the SMF
 func SubscriptionsSubIdDelete(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{})
+	logger.CtxLog.Info("Recieve Event Exposure Subscription Delete Request")
+	stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmfEventExposureUnsubscribe), "In", "", "")
+
+	HTTPResponse := producer.HandleSMFEventExposureSubscriptionDelete(c.Params.ByName("subId"))
+	sendEventExposureRsp(c, svcmsgtypes.SmfEventExposureUnsubscribe, HTTPResponse)
 }
 
-// SubscriptionsSubIdGet -
+// SubscriptionsSubIdGet - Read an individual subscription for event notifications from the SMF
 func SubscriptionsSubIdGet(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{})
+	HTTPResponse := producer.HandleSMFEventExposureSubscriptionGet(c.Params.ByName("subId"))
+	for key, val := range HTTPResponse.Header {
+		c.Header(key, val[0])
+	}
+	c.JSON(HTTPResponse.Status, HTTPResponse.Body)
 }
 
-// SubscriptionsSubIdPut -
+// SubscriptionsSubIdPut - Replace an individual subscription for event notifications from the SMF
 func SubscriptionsSubIdPut(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{})
+	logger.CtxLog.Info("Recieve Event Exposure Subscription Modify Request")
+	stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmfEventExposureModify), "In", "", "")
+
+	request, ok := decodeEventExposure(c, svcmsgtypes.SmfEventExposureModify)
+	if !ok {
+		return
+	}
+
+	HTTPResponse := producer.HandleSMFEventExposureSubscriptionPut(c.Params.ByName("subId"), request)
+	sendEventExposureRsp(c, svcmsgtypes.SmfEventExposureModify, HTTPResponse)
 }
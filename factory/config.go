@@ -65,6 +65,64 @@ type Configuration struct {
 	SNssaiInfo           []SnssaiInfoItem     `yaml:"snssaiInfos,omitempty"`
 	ULCL                 bool                 `yaml:"ulcl,omitempty"`
 	EnterpriseList       map[string]string    `yaml:"enterpriseList,omitempty"`
+	Shutdown             *Shutdown            `yaml:"shutdown,omitempty"`
+	Sweeper              *Sweeper             `yaml:"sweeper,omitempty"`
+	T3591                *Timer               `yaml:"t3591,omitempty"`
+	T3592                *Timer               `yaml:"t3592,omitempty"`
+	CongestionControl    *CongestionControl   `yaml:"congestionControl,omitempty"`
+}
+
+const (
+	SHUTDOWN_SESSION_RELEASE = "release"
+	SHUTDOWN_SESSION_PERSIST = "persist"
+)
+
+//Shutdown configures graceful shutdown of SMF
+type Shutdown struct {
+	Graceful bool `yaml:"graceful,omitempty"`
+	//Time(seconds) to drain in-flight transactions before exit
+	DrainTimeout int `yaml:"drainTimeout,omitempty"`
+	//Retry-After(seconds) sent with 503 to new SM context requests
+	RetryAfter int `yaml:"retryAfter,omitempty"`
+	//Remaining sessions are "release"d or "persist"ed
+	SessionAction string `yaml:"sessionAction,omitempty"`
+	PersistPath   string `yaml:"persistPath,omitempty"`
+}
+
+//Sweeper configures cleanup of SM contexts stuck in pending states,
+//age limits are in seconds, 0 keeps the default
+type Sweeper struct {
+	Enable               bool `yaml:"enable,omitempty"`
+	Interval             int  `yaml:"interval,omitempty"`
+	PfcpCreatePending    int  `yaml:"pfcpCreatePending,omitempty"`
+	N1N2TransferPending  int  `yaml:"n1n2TransferPending,omitempty"`
+	InActivePending      int  `yaml:"inActivePending,omitempty"`
+	SecondaryAuthPending int  `yaml:"secondaryAuthPending,omitempty"`
+}
+
+//Timer configures 5GSM network timer(TS 24.501 10.3), 0 keeps the default
+type Timer struct {
+	//Time(seconds) to wait for UE answer before retransmission
+	ExpireTime int `yaml:"expireTime,omitempty"`
+	//Retransmissions before procedure is aborted
+	MaxRetryTimes int `yaml:"maxRetryTimes,omitempty"`
+}
+
+//CongestionControl configures DNN and S-NSSAI based congestion control(TS 24.501 6.2.7, 6.2.8)
+type CongestionControl struct {
+	//Back-off timer sent with reject for congestion or insufficient resources, seconds
+	BackOffTimer int              `yaml:"backOffTimer,omitempty"`
+	Rules        []CongestionRule `yaml:"rules,omitempty"`
+}
+
+//CongestionRule admits sessions of S-NSSAI and/or DNN up to MaxSessions,
+//rule without S-NSSAI is DNN based
+type CongestionRule struct {
+	SNssai      *models.Snssai `yaml:"sNssai,omitempty"`
+	Dnn         string         `yaml:"dnn,omitempty"`
+	MaxSessions int            `yaml:"maxSessions,omitempty"`
+	//Back-off timer of rule, seconds. 0 uses default
+	BackOffTimer int `yaml:"backOffTimer,omitempty"`
 }
 
 type SnssaiInfoItem struct {
@@ -78,6 +136,73 @@ type SnssaiDnnInfoItem struct {
 	DNS      DNS    `yaml:"dns"`
 	UESubnet string `yaml:"ueSubnet"`
 	MTU      uint16 `yaml:"mtu"`
+	//MTU of non-IP/unstructured PDU sessions, MTU if not set
+	NonIPMTU uint16 `yaml:"nonIpMtu,omitempty"`
+	PCSCF    *PCSCF `yaml:"pcscf,omitempty"`
+	//DN-AAA authenticating/authorizing UE during PDU session establishment
+	SecondaryAuth *SecondaryAuth `yaml:"secondaryAuth,omitempty"`
+	//Always-on PDU sessions requested by UE are granted
+	AlwaysOn bool `yaml:"alwaysOn,omitempty"`
+	//DNAIs by tracking area, anchor UPF serving DNAI of UE location is selected
+	Dnais []DnaiArea `yaml:"dnais,omitempty"`
+	//Seconds UE keeps SSC mode 3 PDU session after anchor UPF relocation is triggered, 60 if not set
+	PduAddressLifetime int `yaml:"pduAddressLifetime,omitempty"`
+	//DNN is LADN, available to UEs in its service area only
+	Ladn *Ladn `yaml:"ladn,omitempty"`
+	//PDU sessions of roaming UEs to DNN are home-routed via H-SMF, local breakout if not set.
+	//Sessions to DNN not configured are always home-routed
+	HomeRouted bool `yaml:"homeRouted,omitempty"`
+}
+
+//DnaiArea is DNAI serving UEs in tracking areas
+type DnaiArea struct {
+	Dnai string   `yaml:"dnai"`
+	Tacs []string `yaml:"tacs"`
+}
+
+//Ladn is service area of LADN DNN(TS 23.501 5.6.5)
+type Ladn struct {
+	Tais []models.Tai `yaml:"tais"`
+	//Seconds PDU session is kept with user plane deactivated after UE left service area, 60 if not set
+	ReleaseTimer int `yaml:"releaseTimer,omitempty"`
+}
+
+//SecondaryAuth is RADIUS DN-AAA of DNN(TS 29.561 11)
+type SecondaryAuth struct {
+	//host:port of RADIUS authentication server
+	Server string `yaml:"server"`
+	Secret string `yaml:"secret"`
+	//host:port of RADIUS accounting server, server host with port 1813 if not set
+	AccountingServer string `yaml:"accountingServer,omitempty"`
+	//Seconds to wait for response, 3 if not set
+	Timeout int `yaml:"timeout,omitempty"`
+	//Retransmissions of request, 2 if not set
+	Retries int `yaml:"retries,omitempty"`
+	//Session AMBR authorized by DN-AAA, TS 29.561 defines no attribute for it so it is read
+	//only if configured
+	SessionAmbr *RadiusSessionAmbr `yaml:"sessionAmbr,omitempty"`
+}
+
+//RadiusSessionAmbr is vendor-specific sub-attributes agreed with DN-AAA carrying session AMBR,
+//value is bitrate string such as "100 Mbps"
+type RadiusSessionAmbr struct {
+	VendorId     uint32 `yaml:"vendorId"`
+	UplinkType   uint8  `yaml:"uplinkType"`
+	DownlinkType uint8  `yaml:"downlinkType"`
+}
+
+//PCSCF lists P-CSCFs of IMS DNN UE discovers in PCO(TS 24.229 9.2.1)
+type PCSCF struct {
+	//"roundRobin"(default) or "location"
+	Selection string        `yaml:"selection,omitempty"`
+	Servers   []PCSCFServer `yaml:"servers"`
+}
+
+type PCSCFServer struct {
+	IPv4Addr string `yaml:"ipv4,omitempty"`
+	IPv6Addr string `yaml:"ipv6,omitempty"`
+	//Tracking areas P-CSCF serves for location based selection
+	Tacs []string `yaml:"tacs,omitempty"`
 }
 
 type Sbi struct {
@@ -102,6 +227,8 @@ type PFCP struct {
 type DNS struct {
 	IPv4Addr string `yaml:"ipv4,omitempty"`
 	IPv6Addr string `yaml:"ipv6,omitempty"`
+	//Secondary DNS of legacy UEs asking over IPCP, primary one if not set
+	IPv4SecondaryAddr string `yaml:"ipv4Secondary,omitempty"`
 }
 
 type Path struct {
@@ -416,7 +543,7 @@ func compareAndProcessConfigs(smfCfg, newCfg *Configuration) {
 }
 
 func compareNsDnn(c1, c2 interface{}) bool {
-	return c1.(SnssaiDnnInfoItem) == c2.(SnssaiDnnInfoItem)
+	return reflect.DeepEqual(c1.(SnssaiDnnInfoItem), c2.(SnssaiDnnInfoItem))
 }
 
 func compareUPLinks(c1, c2 interface{}) bool {
@@ -0,0 +1,40 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fsm
+
+import (
+	"fmt"
+	"strings"
+)
+
+//ExportDot renders SM context transition table as Graphviz DOT
+func ExportDot() string {
+	var b strings.Builder
+
+	b.WriteString("digraph SmContextFsm {\n")
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box];\n")
+	for _, tr := range SmTransitionTable {
+		for _, to := range tr.To {
+			fmt.Fprintf(&b, "\t\"%s\" -> \"%s\" [label=\"%s\"];\n", tr.From.String(), to.String(), tr.Event.String())
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+//ExportMermaid renders SM context transition table as Mermaid state diagram
+func ExportMermaid() string {
+	var b strings.Builder
+
+	b.WriteString("stateDiagram-v2\n")
+	fmt.Fprintf(&b, "\t[*] --> %s\n", SmTransitionTable[0].From.String())
+	for _, tr := range SmTransitionTable {
+		for _, to := range tr.To {
+			fmt.Fprintf(&b, "\t%s --> %s : %s\n", tr.From.String(), to.String(), tr.Event.String())
+		}
+	}
+	return b.String()
+}
@@ -6,8 +6,12 @@ package fsm
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/free5gc/pfcp"
 	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/logger"
+	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
 	"github.com/free5gc/smf/producer"
 	"github.com/free5gc/smf/transaction"
 )
@@ -26,6 +30,20 @@ const (
 	SmEventPduSessN1N2Transfer
 	SmEventPduSessN1N2TransferFailureIndication
 	SmEventPolicyUpdateNotify
+	SmEventPfcpSessCreateRsp
+	SmEventPduSessRetrieve
+	SmEventHsmfPduSessCreate
+	SmEventHsmfPduSessUpdate
+	SmEventHsmfPduSessRelease
+	SmEventVsmfPduSessUpdate
+	SmEventSdmDataChangeNotify
+	SmEventPolicyTerminateNotify
+	SmEventNwInitiatedPduSessRelease
+	SmEventPfcpSessModifyRsp
+	SmEventPfcpSessReleaseRsp
+	SmEventLadnPresenceChange
+	SmEventStaleSMContextRelease
+	SmEventAnchorRelocation
 	SmEventMax
 )
 
@@ -33,48 +51,93 @@ type SmEventData struct {
 	Txn interface{}
 }
 
-//Define FSM Func Point Struct here
-type fsmHandler [smf_context.SmStateMax][SmEventMax]func(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error)
+//Define FSM transition lookup, indexed by current state and event
+type fsmHandler [smf_context.SmStateMax][SmEventMax]*SmTransition
 
 var SmfFsmHandler fsmHandler
 
 func init() {
-	//Initilise with default invalid handler
-	for state := smf_context.SmStateInit; state < smf_context.SmStateMax; state++ {
-		for event := SmEventInvalid; event < SmEventMax; event++ {
-			SmfFsmHandler[state][event] = EmptyEventHandler
-		}
+	if err := InitFsm(SmTransitionTable); err != nil {
+		logger.FsmLog.Fatalf("invalid sm context transition table, %v", err)
 	}
-
-	InitFsm()
 	transaction.InitTxnFsm(SmfTxnFsmHandle)
+	transaction.CrashDumpHook = TxnCrashDump
+	smf_context.RegisterPfcpRspHandler(PostPfcpSessCreateRsp)
+	smf_context.RegisterPfcpProcedureRspHandler(PostPfcpProcedureRsp)
+	smf_context.RegisterNwReleaseHandler(PostNwInitiatedPduSessRelease)
+	smf_context.RegisterLadnPresenceHandler(PostLadnPresenceChange)
+	smf_context.RegisterStaleReleaseHandler(PostStaleSMContextRelease)
+	smf_context.RegisterAnchorRelocationHandler(PostAnchorRelocation)
+	smf_context.RegisterSmfEventHandler(producer.NotifySmfEvent)
 }
 
-//Override with specific handler
-func InitFsm() {
+//InitFsm validates transition table and registers it with SM context
+func InitFsm(table []SmTransition) error {
+	if err := ValidateTransitionTable(table); err != nil {
+		return err
+	}
+
+	for _, state := range UnreachableStates(table) {
+		logger.FsmLog.Warnf("sm context state[%v] is not reachable", state.String())
+	}
+
+	var handler fsmHandler
+	for i := range table {
+		tr := &table[i]
+		handler[tr.From][tr.Event] = tr
+		for _, to := range tr.To {
+			smf_context.RegisterStateTransition(tr.From, smf_context.SMContextEvent(tr.Event), to)
+		}
+	}
+	for state, action := range SmStateActions {
+		smf_context.RegisterStateActions(state, action.OnEntry, action.OnExit)
+	}
 
-	SmfFsmHandler[smf_context.SmStateInit][SmEventPduSessCreate] = HandleStateInitEventPduSessCreate
-	SmfFsmHandler[smf_context.SmStatePfcpCreatePending][SmEventPfcpSessCreate] = HandleStatePfcpCreatePendingEventPfcpSessCreate
-	SmfFsmHandler[smf_context.SmStateN1N2TransferPending][SmEventPduSessN1N2Transfer] = HandleStateN1N2TransferPendingEventN1N2Transfer
-	SmfFsmHandler[smf_context.SmStateActive][SmEventPduSessModify] = HandleStateActiveEventPduSessModify
-	SmfFsmHandler[smf_context.SmStateActive][SmEventPduSessRelease] = HandleStateActiveEventPduSessRelease
-	SmfFsmHandler[smf_context.SmStateActive][SmEventPduSessN1N2TransferFailureIndication] = HandleStateActiveEventPduSessN1N2TransFailInd
-	SmfFsmHandler[smf_context.SmStateActive][SmEventPolicyUpdateNotify] = HandleStateActiveEventPolicyUpdateNotify
+	SmfFsmHandler = handler
+	return nil
 }
 
 func HandleEvent(smContext *smf_context.SMContext, event SmEvent, eventData SmEventData) error {
 
 	ctxtState := smContext.SMContextState
 	smContext.SubFsmLog.Debugf("handle fsm event[%v], state[%v] ", event.String(), ctxtState.String())
-	if nextState, err := SmfFsmHandler[smContext.SMContextState][event](event, &eventData); err != nil {
+	smContext.TxnHistoryEvent(event.String())
+
+	if ctxtState >= smf_context.SmStateMax || event >= SmEventMax {
+		return fmt.Errorf("fsm error, invalid state[%v] event[%v]", ctxtState.String(), event.String())
+	}
+
+	tr := SmfFsmHandler[ctxtState][event]
+	if tr == nil {
+		_, err := EmptyEventHandler(event, &eventData)
+		return err
+	}
+	//State changes made by handler are checked against row of table
+	smContext.StartStateEvent(smf_context.SMContextEvent(event))
+	defer smContext.EndStateEvent()
+
+	if tr.Guard != nil {
+		if err := tr.Guard(smContext, &eventData); err != nil {
+			smContext.SubFsmLog.Errorf("fsm state[%v] event[%v] guard failed, %v",
+				ctxtState.String(), event.String(), err.Error())
+			return fmt.Errorf("fsm guard failure, %v", err.Error())
+		}
+	}
+
+	nextState, err := tr.Handler(event, &eventData)
+	if err != nil {
 		smContext.SubFsmLog.Errorf("fsm state[%v] event[%v], next-state[%v] error, %v",
-			smContext.SMContextState.String(), event.String(), nextState.String(), err.Error())
+			ctxtState.String(), event.String(), nextState.String(), err.Error())
 		return err
-	} else {
-		smContext.ChangeState(nextState)
 	}
 
-	return nil
+	if !tr.allows(nextState) {
+		smContext.SubFsmLog.Errorf("fsm state[%v] event[%v], unexpected next-state[%v]",
+			ctxtState.String(), event.String(), nextState.String())
+		return fmt.Errorf("fsm error, unexpected next-state[%v]", nextState.String())
+	}
+
+	return smContext.ChangeState(nextState)
 }
 
 type SmfTxnFsm struct{}
@@ -97,6 +160,10 @@ func HandleStateInitEventPduSessCreate(event SmEvent, eventData *SmEventData) (s
 		return smf_context.SmStateInit, fmt.Errorf("pdu session create error, %v ", err.Error())
 	}
 
+	//UE to be authenticated by DN-AAA first
+	if txnSmContext(eventData).SecondaryAuth != nil {
+		return smf_context.SmStateSecondaryAuthPending, nil
+	}
 	return smf_context.SmStatePfcpCreatePending, nil
 }
 
@@ -106,17 +173,135 @@ func HandleStatePfcpCreatePendingEventPfcpSessCreate(event SmEvent, eventData *S
 	smCtxt := txn.Ctxt.(*smf_context.SMContext)
 
 	producer.SendPFCPRules(smCtxt)
+
+	//Responses are delivered as SmEventPfcpSessCreateRsp
 	smCtxt.SubFsmLog.Debug("waiting for pfcp session establish response")
-	switch <-smCtxt.SBIPFCPCommunicationChan {
-	case smf_context.SessionEstablishSuccess:
-		smCtxt.SubFsmLog.Debug("pfcp session establish response success")
-		return smf_context.SmStateN1N2TransferPending, nil
-	case smf_context.SessionEstablishFailed:
-		fallthrough
-	default:
-		smCtxt.SubFsmLog.Error("pfcp session establish response failure")
-		return smf_context.SmStatePfcpCreatePending, fmt.Errorf("pfcp establishment failure")
+	return smf_context.SmStatePfcpCreatePending, nil
+}
+
+func HandleStatePfcpCreatePendingEventPfcpSessCreateRsp(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+
+	txn := eventData.Txn.(*transaction.Transaction)
+	smCtxt := txn.Ctxt.(*smf_context.SMContext)
+	rsp := txn.Req.(*smf_context.PfcpRsp)
+
+	matched, done, failed := smCtxt.ResolvePfcpRsp(rsp)
+	if !matched {
+		//Stale or duplicate response
+		return smf_context.SmStatePfcpCreatePending, nil
+	}
+
+	if !done {
+		smCtxt.SubFsmLog.Debugf("pfcp session establish response from [%v], waiting for other UPFs", rsp.NodeIP)
+		return smf_context.SmStatePfcpCreatePending, nil
+	}
+
+	if len(failed) != 0 {
+		smCtxt.SubFsmLog.Errorf("pfcp session establish response failure from [%v] UPF(s)", len(failed))
+		producer.HandlePfcpSessEstFailure(smCtxt, failed)
+		return smf_context.SmStateInit, fmt.Errorf("pfcp establishment failure")
 	}
+
+	smCtxt.SubFsmLog.Debug("pfcp session establish response success")
+	return smf_context.SmStateN1N2TransferPending, nil
+}
+
+//PostPfcpSessCreateRsp runs PFCP Session Establishment response through txn FSM
+func PostPfcpSessCreateRsp(smContext *smf_context.SMContext, rsp *smf_context.PfcpRsp) {
+	txn := transaction.NewTransaction(rsp, nil, svcmsgtypes.SmfMsgType(svcmsgtypes.PfcpSessCreateRsp))
+	txn.Ctxt = smContext
+	txn.CtxtKey = smContext.Ref
+
+	go func(txn *transaction.Transaction) {
+		go txn.StartTxnLifeCycle(SmfTxnFsmHandle)
+		<-txn.Status
+	}(txn)
+}
+
+//PostPfcpProcedureRsp runs outcome of PFCP Session Modification or Deletion through txn FSM,
+//procedure waiting for it is resumed
+func PostPfcpProcedureRsp(smContext *smf_context.SMContext, rsp *smf_context.PfcpProcedureRsp) {
+	msgType := svcmsgtypes.PfcpSessModifyRsp
+	if rsp.ReqType == pfcp.PFCP_SESSION_DELETION_REQUEST {
+		msgType = svcmsgtypes.PfcpSessReleaseRsp
+	}
+	txn := transaction.NewTransaction(rsp, nil, svcmsgtypes.SmfMsgType(msgType))
+	txn.Ctxt = smContext
+	txn.CtxtKey = smContext.Ref
+
+	go func(txn *transaction.Transaction) {
+		go txn.StartTxnLifeCycle(SmfTxnFsmHandle)
+		<-txn.Status
+	}(txn)
+}
+
+//resumePfcpProcedure completes procedure which waited for PFCP responses, its txn is answered then
+func resumePfcpProcedure(eventData *SmEventData) (smf_context.SMContextState, error) {
+	smCtxt := txnSmContext(eventData)
+	rsp := eventData.Txn.(*transaction.Transaction).Req.(*smf_context.PfcpProcedureRsp)
+
+	state, procTxn := producer.HandlePfcpProcedureRsp(smCtxt, rsp)
+	if procTxn != nil && !smCtxt.IsTxnAwaitingPfcpRsp(procTxn) {
+		procTxn.Status <- procTxn.Err == nil
+	}
+	return state, nil
+}
+
+func HandleStatePfcpModifyEventPfcpSessModifyRsp(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	return resumePfcpProcedure(eventData)
+}
+
+func HandleStatePfcpReleaseEventPfcpSessReleaseRsp(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	return resumePfcpProcedure(eventData)
+}
+
+//PostNwInitiatedPduSessRelease runs network requested PDU session release through txn FSM
+func PostNwInitiatedPduSessRelease(smContext *smf_context.SMContext, cause uint8) {
+	txn := transaction.NewTransaction(cause, nil, svcmsgtypes.SmfMsgType(svcmsgtypes.NwInitiatedPduSessRelease))
+	txn.Ctxt = smContext
+	txn.CtxtKey = smContext.Ref
+
+	go func(txn *transaction.Transaction) {
+		go txn.StartTxnLifeCycle(SmfTxnFsmHandle)
+		<-txn.Status
+	}(txn)
+}
+
+//PostLadnPresenceChange runs change of UE presence in LADN service area through txn FSM
+func PostLadnPresenceChange(smContext *smf_context.SMContext) {
+	txn := transaction.NewTransaction(nil, nil, svcmsgtypes.SmfMsgType(svcmsgtypes.LadnPresenceChange))
+	txn.Ctxt = smContext
+	txn.CtxtKey = smContext.Ref
+
+	go func(txn *transaction.Transaction) {
+		go txn.StartTxnLifeCycle(SmfTxnFsmHandle)
+		<-txn.Status
+	}(txn)
+}
+
+//PostAnchorRelocation runs anchor UPF relocation of SSC mode 3 session through txn FSM
+func PostAnchorRelocation(smContext *smf_context.SMContext) {
+	txn := transaction.NewTransaction(nil, nil, svcmsgtypes.SmfMsgType(svcmsgtypes.AnchorRelocation))
+	txn.Ctxt = smContext
+	txn.CtxtKey = smContext.Ref
+
+	go func(txn *transaction.Transaction) {
+		go txn.StartTxnLifeCycle(SmfTxnFsmHandle)
+		<-txn.Status
+	}(txn)
+}
+
+//PostStaleSMContextRelease runs release of SM context stuck in pending state through txn FSM,
+//it's serialized with txns running on SM context
+func PostStaleSMContextRelease(smContext *smf_context.SMContext, since time.Time) {
+	txn := transaction.NewTransaction(since, nil, svcmsgtypes.SmfMsgType(svcmsgtypes.StaleSmContextRelease))
+	txn.Ctxt = smContext
+	txn.CtxtKey = smContext.Ref
+
+	go func(txn *transaction.Transaction) {
+		go txn.StartTxnLifeCycle(SmfTxnFsmHandle)
+		<-txn.Status
+	}(txn)
 }
 
 func HandleStateN1N2TransferPendingEventN1N2Transfer(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
@@ -124,8 +309,14 @@ func HandleStateN1N2TransferPendingEventN1N2Transfer(event SmEvent, eventData *S
 	txn := eventData.Txn.(*transaction.Transaction)
 	smCtxt := txn.Ctxt.(*smf_context.SMContext)
 
+	//Home-routed session, V-SMF delivers N1/N2
+	if smCtxt.IsHsmf() {
+		producer.CompleteHsmfPduSessEstablishment(smCtxt)
+		return smf_context.SmStateActive, nil
+	}
+
 	if err := producer.SendPduSessN1N2Transfer(smCtxt, true); err != nil {
-		smCtxt.SubFsmLog.Error("N1N2 transfer failure error, %v ", err.Error())
+		smCtxt.SubFsmLog.Errorf("N1N2 transfer failure error, %v ", err.Error())
 		return smf_context.SmStateN1N2TransferPending, fmt.Errorf("N1N2 Transfer failure error, %v ", err.Error())
 	}
 	return smf_context.SmStateActive, nil
@@ -144,9 +335,10 @@ func HandleStateActiveEventPduSessModify(event SmEvent, eventData *SmEventData)
 
 	if err := producer.HandlePDUSessionSMContextUpdate(eventData.Txn); err != nil {
 		smCtxt.SubFsmLog.Errorf("sm context update error, %v ", err.Error())
-		return smf_context.SmStateActive, err
+		return smCtxt.SMContextState, err
 	}
-	return smf_context.SmStateActive, nil
+	//Update may deactivate UP connection or release the context
+	return smCtxt.SMContextState, nil
 }
 
 func HandleStateActiveEventPduSessRelease(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
@@ -158,7 +350,8 @@ func HandleStateActiveEventPduSessRelease(event SmEvent, eventData *SmEventData)
 		smCtxt.SubFsmLog.Errorf("sm context release error, %v ", err.Error())
 		return smf_context.SmStateInit, err
 	}
-	return smf_context.SmStateInit, nil
+	//Released once UPFs answered
+	return smCtxt.SMContextState, nil
 }
 
 func HandleStateActiveEventPduSessN1N2TransFailInd(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
@@ -166,11 +359,20 @@ func HandleStateActiveEventPduSessN1N2TransFailInd(event SmEvent, eventData *SmE
 	txn := eventData.Txn.(*transaction.Transaction)
 	smCtxt := txn.Ctxt.(*smf_context.SMContext)
 
+	//UE not reached with network requested PDU Session Modification Command
+	if smCtxt.IsNwModificationPending() {
+		if err := producer.HandleNwModificationN1N2TransFailInd(eventData.Txn); err != nil {
+			smCtxt.SubFsmLog.Errorf("Error while processing HandleNwModificationN1N2TransFailInd, %v ", err.Error())
+		}
+		return smf_context.SmStateActive, nil
+	}
+
 	if err := producer.HandlePduSessN1N2TransFailInd(eventData.Txn); err != nil {
 		smCtxt.SubFsmLog.Errorf("Error while processing HandlePduSessN1N2TransferFailureIndication, %v ", err.Error())
 		return smf_context.SmStateInit, err
 	}
-	return smf_context.SmStateInit, nil
+	//Answered once UPF answered
+	return smCtxt.SMContextState, nil
 }
 func HandleStateActiveEventPolicyUpdateNotify(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
 	txn := eventData.Txn.(*transaction.Transaction)
@@ -185,3 +387,202 @@ func HandleStateActiveEventPolicyUpdateNotify(event SmEvent, eventData *SmEventD
 	return smf_context.SmStateActive, nil
 
 }
+
+func HandleStateActiveEventSdmDataChangeNotify(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	txn := eventData.Txn.(*transaction.Transaction)
+	smCtxt := txn.Ctxt.(*smf_context.SMContext)
+
+	if err := producer.HandleSdmDataChangeNotify(eventData.Txn); err != nil {
+		txn.Err = err
+		smCtxt.SubFsmLog.Errorf("sdm data change notification error, %v ", err.Error())
+		return smf_context.SmStateActive, fmt.Errorf("sdm data change notification error, %v ", err.Error())
+	}
+
+	//Released by network requested release if DNN is no longer subscribed
+	return smf_context.SmStateActive, nil
+}
+
+func HandleStateActiveEventPolicyTerminateNotify(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	txn := eventData.Txn.(*transaction.Transaction)
+	smCtxt := txn.Ctxt.(*smf_context.SMContext)
+
+	if err := producer.HandleSMPolicyTerminateNotify(eventData.Txn); err != nil {
+		txn.Err = err
+		smCtxt.SubFsmLog.Errorf("sm policy termination error, %v ", err.Error())
+		return smCtxt.SMContextState, err
+	}
+
+	//Released by network requested release, or release was in progress already
+	return smCtxt.SMContextState, nil
+}
+
+func HandleStateActiveEventNwInitiatedPduSessRelease(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	txn := eventData.Txn.(*transaction.Transaction)
+	smCtxt := txn.Ctxt.(*smf_context.SMContext)
+
+	if err := producer.HandleNwInitiatedPduSessionRelease(eventData.Txn); err != nil {
+		txn.Err = err
+		smCtxt.SubFsmLog.Errorf("network initiated pdu session release error, %v ", err.Error())
+		return smCtxt.SMContextState, err
+	}
+
+	//Released on PDU Session Release Complete, or release was in progress already
+	return smCtxt.SMContextState, nil
+}
+
+func HandleStateActiveEventLadnPresenceChange(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	txn := eventData.Txn.(*transaction.Transaction)
+	smCtxt := txn.Ctxt.(*smf_context.SMContext)
+
+	if err := producer.HandleLadnPresenceChange(eventData.Txn); err != nil {
+		txn.Err = err
+		smCtxt.SubFsmLog.Errorf("LADN presence change error, %v ", err.Error())
+		return smCtxt.SMContextState, err
+	}
+
+	//User plane updated once UPF answered, or session is being released
+	return smCtxt.SMContextState, nil
+}
+
+func HandleStateActiveEventAnchorRelocation(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	txn := eventData.Txn.(*transaction.Transaction)
+	smCtxt := txn.Ctxt.(*smf_context.SMContext)
+
+	if err := producer.HandleAnchorRelocation(eventData.Txn); err != nil {
+		txn.Err = err
+		smCtxt.SubFsmLog.Errorf("anchor relocation error, %v ", err.Error())
+		return smCtxt.SMContextState, err
+	}
+
+	//UE sets up new PDU session, this one is released once address lifetime expires
+	return smCtxt.SMContextState, nil
+}
+
+func HandleStatePendingEventStaleSMContextRelease(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	txn := eventData.Txn.(*transaction.Transaction)
+	smCtxt := txn.Ctxt.(*smf_context.SMContext)
+
+	if err := producer.HandleStaleSMContextRelease(eventData.Txn); err != nil {
+		txn.Err = err
+		smCtxt.SubFsmLog.Errorf("stale sm context release error, %v ", err.Error())
+		return smCtxt.SMContextState, err
+	}
+
+	//Released locally, or SM context moved on
+	return smCtxt.SMContextState, nil
+}
+
+func HandleStateInActivePendingEventPduSessN1N2TransFailInd(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	txn := eventData.Txn.(*transaction.Transaction)
+	smCtxt := txn.Ctxt.(*smf_context.SMContext)
+
+	if err := producer.HandleNwReleaseN1N2TransFailInd(eventData.Txn); err != nil {
+		smCtxt.SubFsmLog.Errorf("Error while processing HandleNwReleaseN1N2TransFailInd, %v ", err.Error())
+		return smf_context.SmStateInActivePending, err
+	}
+	return smf_context.SmStateInActivePending, nil
+}
+
+func HandleStateSecondaryAuthPendingEventPfcpSessCreate(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	smCtxt := txnSmContext(eventData)
+
+	//UP is set up once DN-AAA has authorized UE
+	if err := producer.SendSecondaryAuthCommand(smCtxt); err != nil {
+		smCtxt.SubFsmLog.Errorf("PDU Session Authentication Command failure, %v ", err.Error())
+		producer.ReleaseSMContextLocally(smCtxt, true)
+		return smf_context.SmStateInit, nil
+	}
+	return smf_context.SmStateSecondaryAuthPending, nil
+}
+
+func HandleStateSecondaryAuthPendingEventPduSessModify(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	smCtxt := txnSmContext(eventData)
+
+	result, err := producer.HandleSecondaryAuthUpdate(eventData.Txn)
+	if err != nil {
+		smCtxt.SubFsmLog.Errorf("secondary authentication update error, %v ", err.Error())
+		return smCtxt.SMContextState, err
+	}
+	switch result {
+	case smf_context.SecondaryAuthSuccess:
+		//PFCP session establishment is queued once update is answered
+		return smf_context.SmStatePfcpCreatePending, nil
+	case smf_context.SecondaryAuthFailure:
+		return smf_context.SmStateInit, nil
+	}
+	return smf_context.SmStateSecondaryAuthPending, nil
+}
+
+func HandleStateSecondaryAuthPendingEventPduSessRelease(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	producer.HandleSecondaryAuthRelease(eventData.Txn)
+	return smf_context.SmStateInit, nil
+}
+
+func HandleStateSecondaryAuthPendingEventPduSessN1N2TransFailInd(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	producer.HandleSecondaryAuthN1N2TransFailInd(eventData.Txn)
+	return smf_context.SmStateInit, nil
+}
+
+func HandleStateActiveEventPduSessRetrieve(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	txn := eventData.Txn.(*transaction.Transaction)
+	smCtxt := txn.Ctxt.(*smf_context.SMContext)
+
+	if err := producer.HandlePDUSessionSMContextRetrieve(eventData.Txn); err != nil {
+		txn.Err = err
+		smCtxt.SubFsmLog.Errorf("sm context retrieve error, %v ", err.Error())
+		return smCtxt.SMContextState, err
+	}
+
+	//Retrieval doesn't change the context
+	return smCtxt.SMContextState, nil
+}
+
+func HandleStateInitEventHsmfPduSessCreate(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+
+	if err := producer.HandlePDUSessionCreate(eventData.Txn); err != nil {
+		txn := eventData.Txn.(*transaction.Transaction)
+		txn.Err = err
+		return smf_context.SmStateInit, fmt.Errorf("home-routed pdu session create error, %v ", err.Error())
+	}
+
+	return smf_context.SmStatePfcpCreatePending, nil
+}
+
+func HandleStateActiveEventHsmfPduSessUpdate(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	txn := eventData.Txn.(*transaction.Transaction)
+	smCtxt := txn.Ctxt.(*smf_context.SMContext)
+
+	if err := producer.HandlePDUSessionUpdate(eventData.Txn); err != nil {
+		txn.Err = err
+		smCtxt.SubFsmLog.Errorf("home-routed pdu session update error, %v ", err.Error())
+		return smCtxt.SMContextState, err
+	}
+	//UE requested release deactivates the session
+	return smCtxt.SMContextState, nil
+}
+
+func HandleStateActiveEventHsmfPduSessRelease(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	txn := eventData.Txn.(*transaction.Transaction)
+	smCtxt := txn.Ctxt.(*smf_context.SMContext)
+
+	if err := producer.HandlePDUSessionRelease(eventData.Txn); err != nil {
+		txn.Err = err
+		smCtxt.SubFsmLog.Errorf("home-routed pdu session release error, %v ", err.Error())
+		return smf_context.SmStateInit, err
+	}
+	//Released once UPFs answered
+	return smCtxt.SMContextState, nil
+}
+
+func HandleStateActiveEventVsmfPduSessUpdate(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	txn := eventData.Txn.(*transaction.Transaction)
+	smCtxt := txn.Ctxt.(*smf_context.SMContext)
+
+	if err := producer.HandleVsmfPduSessionUpdate(eventData.Txn); err != nil {
+		txn.Err = err
+		smCtxt.SubFsmLog.Errorf("home-routed pdu session update from H-SMF error, %v ", err.Error())
+		return smCtxt.SMContextState, err
+	}
+	//Network requested release deactivates the session
+	return smCtxt.SMContextState, nil
+}
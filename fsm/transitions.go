@@ -0,0 +1,429 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fsm
+
+import (
+	"fmt"
+
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/transaction"
+)
+
+//SmEventHandler processes an event and returns the state SM context settles in
+type SmEventHandler func(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error)
+
+//SmGuard is evaluated before the handler, transition is not taken if it returns error
+type SmGuard func(smCtxt *smf_context.SMContext, eventData *SmEventData) error
+
+//SmTransition is a row of the SM context transition table
+type SmTransition struct {
+	From    smf_context.SMContextState
+	Event   SmEvent
+	To      []smf_context.SMContextState //States SM context may move to while handler runs
+	Guard   SmGuard
+	Handler SmEventHandler
+}
+
+//SmStateAction holds entry/exit actions of a state
+type SmStateAction struct {
+	OnEntry smf_context.SMContextStateAction
+	OnExit  smf_context.SMContextStateAction
+}
+
+//SM context lifecycle
+var SmTransitionTable = []SmTransition{
+	{
+		From:  smf_context.SmStateInit,
+		Event: SmEventPduSessCreate,
+		To: []smf_context.SMContextState{smf_context.SmStatePfcpCreatePending,
+			smf_context.SmStateSecondaryAuthPending, smf_context.SmStateInit},
+		Handler: HandleStateInitEventPduSessCreate,
+	},
+	{
+		//Secondary authentication by DN-AAA, EAP-Request/Identity sent to UE
+		From:    smf_context.SmStateSecondaryAuthPending,
+		Event:   SmEventPfcpSessCreate,
+		To:      []smf_context.SMContextState{smf_context.SmStateSecondaryAuthPending, smf_context.SmStateInit},
+		Guard:   guardAmfSelected,
+		Handler: HandleStateSecondaryAuthPendingEventPfcpSessCreate,
+	},
+	{
+		//EAP relayed between UE and DN-AAA till UE is authorized or rejected
+		From:  smf_context.SmStateSecondaryAuthPending,
+		Event: SmEventPduSessModify,
+		To: []smf_context.SMContextState{smf_context.SmStateSecondaryAuthPending,
+			smf_context.SmStatePfcpCreatePending, smf_context.SmStateInit},
+		Handler: HandleStateSecondaryAuthPendingEventPduSessModify,
+	},
+	{
+		From:    smf_context.SmStateSecondaryAuthPending,
+		Event:   SmEventPduSessRelease,
+		To:      []smf_context.SMContextState{smf_context.SmStateInit},
+		Handler: HandleStateSecondaryAuthPendingEventPduSessRelease,
+	},
+	{
+		//UE not reached with PDU Session Authentication Command
+		From:    smf_context.SmStateSecondaryAuthPending,
+		Event:   SmEventPduSessN1N2TransferFailureIndication,
+		To:      []smf_context.SMContextState{smf_context.SmStateInit},
+		Handler: HandleStateSecondaryAuthPendingEventPduSessN1N2TransFailInd,
+	},
+	{
+		From:    smf_context.SmStatePfcpCreatePending,
+		Event:   SmEventPfcpSessCreate,
+		To:      []smf_context.SMContextState{smf_context.SmStatePfcpCreatePending},
+		Guard:   guardTunnelPresent,
+		Handler: HandleStatePfcpCreatePendingEventPfcpSessCreate,
+	},
+	{
+		//All UPFs answered, or failure aggregated and context released
+		From:  smf_context.SmStatePfcpCreatePending,
+		Event: SmEventPfcpSessCreateRsp,
+		To: []smf_context.SMContextState{smf_context.SmStatePfcpCreatePending,
+			smf_context.SmStateN1N2TransferPending, smf_context.SmStateInit},
+		Handler: HandleStatePfcpCreatePendingEventPfcpSessCreateRsp,
+	},
+	{
+		From:    smf_context.SmStateN1N2TransferPending,
+		Event:   SmEventPduSessN1N2Transfer,
+		To:      []smf_context.SMContextState{smf_context.SmStateActive},
+		Guard:   guardAmfSelected,
+		Handler: HandleStateN1N2TransferPendingEventN1N2Transfer,
+	},
+	{
+		//N1/N2/UP Cnx/HO handling goes through SmStateModify, UP changes wait in
+		//SmStatePfcpModify/SmStatePfcpRelease for UPF to answer
+		From:  smf_context.SmStateActive,
+		Event: SmEventPduSessModify,
+		To: []smf_context.SMContextState{smf_context.SmStateActive, smf_context.SmStateModify,
+			smf_context.SmStatePfcpModify, smf_context.SmStatePfcpRelease, smf_context.SmStateInActivePending,
+			smf_context.SmStateInit},
+		Handler: HandleStateActiveEventPduSessModify,
+	},
+	{
+		From:  smf_context.SmStateInActivePending,
+		Event: SmEventPduSessModify,
+		To: []smf_context.SMContextState{smf_context.SmStateActive, smf_context.SmStateModify,
+			smf_context.SmStatePfcpModify, smf_context.SmStatePfcpRelease, smf_context.SmStateInActivePending,
+			smf_context.SmStateInit},
+		Handler: HandleStateActiveEventPduSessModify,
+	},
+	{
+		//Released once UPFs answered
+		From:    smf_context.SmStateActive,
+		Event:   SmEventPduSessRelease,
+		To:      []smf_context.SMContextState{smf_context.SmStatePfcpRelease, smf_context.SmStateInit},
+		Handler: HandleStateActiveEventPduSessRelease,
+	},
+	{
+		From:    smf_context.SmStateInActivePending,
+		Event:   SmEventPduSessRelease,
+		To:      []smf_context.SMContextState{smf_context.SmStatePfcpRelease, smf_context.SmStateInit},
+		Handler: HandleStateActiveEventPduSessRelease,
+	},
+	{
+		//Release SM context after N1 PDU Session Release Complete
+		From:    smf_context.SmStateInit,
+		Event:   SmEventPduSessRelease,
+		To:      []smf_context.SMContextState{smf_context.SmStatePfcpRelease, smf_context.SmStateInit},
+		Handler: HandleStateActiveEventPduSessRelease,
+	},
+	{
+		//DL data dropped, UP released if UPF doesn't answer
+		From:  smf_context.SmStateActive,
+		Event: SmEventPduSessN1N2TransferFailureIndication,
+		To: []smf_context.SMContextState{smf_context.SmStateActive, smf_context.SmStatePfcpModify,
+			smf_context.SmStatePfcpRelease, smf_context.SmStateInActivePending, smf_context.SmStateInit},
+		Handler: HandleStateActiveEventPduSessN1N2TransFailInd,
+	},
+	{
+		//UPFs answered PFCP Session Modification
+		From:  smf_context.SmStatePfcpModify,
+		Event: SmEventPfcpSessModifyRsp,
+		To: []smf_context.SMContextState{smf_context.SmStatePfcpModify, smf_context.SmStateActive,
+			smf_context.SmStatePfcpRelease, smf_context.SmStateInActivePending, smf_context.SmStateInit},
+		Handler: HandleStatePfcpModifyEventPfcpSessModifyRsp,
+	},
+	{
+		//UPFs answered PFCP Session Deletion
+		From:  smf_context.SmStatePfcpRelease,
+		Event: SmEventPfcpSessReleaseRsp,
+		To: []smf_context.SMContextState{smf_context.SmStatePfcpRelease,
+			smf_context.SmStateInActivePending, smf_context.SmStateInit},
+		Handler: HandleStatePfcpReleaseEventPfcpSessReleaseRsp,
+	},
+	{
+		From:    smf_context.SmStateActive,
+		Event:   SmEventPolicyUpdateNotify,
+		To:      []smf_context.SMContextState{smf_context.SmStateActive},
+		Guard:   guardAmfSelected,
+		Handler: HandleStateActiveEventPolicyUpdateNotify,
+	},
+	{
+		From:    smf_context.SmStateActive,
+		Event:   SmEventSdmDataChangeNotify,
+		To:      []smf_context.SMContextState{smf_context.SmStateActive},
+		Handler: HandleStateActiveEventSdmDataChangeNotify,
+	},
+	{
+		//PCF initiated release, by network requested release
+		From:    smf_context.SmStateActive,
+		Event:   SmEventPolicyTerminateNotify,
+		To:      []smf_context.SMContextState{smf_context.SmStateActive},
+		Handler: HandleStateActiveEventPolicyTerminateNotify,
+	},
+	{
+		//Release in progress, nothing more to do
+		From:    smf_context.SmStateInActivePending,
+		Event:   SmEventPolicyTerminateNotify,
+		To:      []smf_context.SMContextState{smf_context.SmStateInActivePending},
+		Handler: HandleStateActiveEventPolicyTerminateNotify,
+	},
+	{
+		From:    smf_context.SmStateInit,
+		Event:   SmEventPolicyTerminateNotify,
+		To:      []smf_context.SMContextState{smf_context.SmStateInit},
+		Handler: HandleStateActiveEventPolicyTerminateNotify,
+	},
+	{
+		//Network requested release, released on PDU Session Release Complete
+		From:    smf_context.SmStateActive,
+		Event:   SmEventNwInitiatedPduSessRelease,
+		To:      []smf_context.SMContextState{smf_context.SmStatePfcpRelease, smf_context.SmStateInActivePending},
+		Handler: HandleStateActiveEventNwInitiatedPduSessRelease,
+	},
+	{
+		//UE left or returned to LADN service area, downlink FARs updated
+		From:    smf_context.SmStateActive,
+		Event:   SmEventLadnPresenceChange,
+		To:      []smf_context.SMContextState{smf_context.SmStateActive, smf_context.SmStatePfcpModify},
+		Handler: HandleStateActiveEventLadnPresenceChange,
+	},
+	{
+		//SSC mode 3, UE moved to area of DNAI served by other anchor UPF
+		From:    smf_context.SmStateActive,
+		Event:   SmEventAnchorRelocation,
+		To:      []smf_context.SMContextState{smf_context.SmStateActive},
+		Handler: HandleStateActiveEventAnchorRelocation,
+	},
+	{
+		//Release in progress, session stays with its anchor UPF
+		From:    smf_context.SmStateInActivePending,
+		Event:   SmEventAnchorRelocation,
+		To:      []smf_context.SMContextState{smf_context.SmStateInActivePending},
+		Handler: HandleStateActiveEventAnchorRelocation,
+	},
+	{
+		//Release in progress, only LADN release timer is started or stopped
+		From:    smf_context.SmStateInActivePending,
+		Event:   SmEventLadnPresenceChange,
+		To:      []smf_context.SMContextState{smf_context.SmStateInActivePending},
+		Handler: HandleStateActiveEventLadnPresenceChange,
+	},
+	{
+		//Release in progress, nothing more to do
+		From:    smf_context.SmStateInActivePending,
+		Event:   SmEventNwInitiatedPduSessRelease,
+		To:      []smf_context.SMContextState{smf_context.SmStateInActivePending},
+		Handler: HandleStateActiveEventNwInitiatedPduSessRelease,
+	},
+	{
+		//UE not reached with network requested PDU Session Release Command
+		From:    smf_context.SmStateInActivePending,
+		Event:   SmEventPduSessN1N2TransferFailureIndication,
+		To:      []smf_context.SMContextState{smf_context.SmStateInActivePending},
+		Handler: HandleStateInActivePendingEventPduSessN1N2TransFailInd,
+	},
+	{
+		//Stuck in pending state, released locally by sweeper
+		From:    smf_context.SmStatePfcpCreatePending,
+		Event:   SmEventStaleSMContextRelease,
+		To:      []smf_context.SMContextState{smf_context.SmStatePfcpCreatePending},
+		Handler: HandleStatePendingEventStaleSMContextRelease,
+	},
+	{
+		From:    smf_context.SmStateN1N2TransferPending,
+		Event:   SmEventStaleSMContextRelease,
+		To:      []smf_context.SMContextState{smf_context.SmStateN1N2TransferPending},
+		Handler: HandleStatePendingEventStaleSMContextRelease,
+	},
+	{
+		From:    smf_context.SmStateSecondaryAuthPending,
+		Event:   SmEventStaleSMContextRelease,
+		To:      []smf_context.SMContextState{smf_context.SmStateSecondaryAuthPending},
+		Handler: HandleStatePendingEventStaleSMContextRelease,
+	},
+	{
+		From:    smf_context.SmStateInActivePending,
+		Event:   SmEventStaleSMContextRelease,
+		To:      []smf_context.SMContextState{smf_context.SmStateInActivePending},
+		Handler: HandleStatePendingEventStaleSMContextRelease,
+	},
+	{
+		//AMF relocation, EPS interworking
+		From:    smf_context.SmStateActive,
+		Event:   SmEventPduSessRetrieve,
+		To:      []smf_context.SMContextState{smf_context.SmStateActive},
+		Handler: HandleStateActiveEventPduSessRetrieve,
+	},
+	{
+		From:    smf_context.SmStateInActivePending,
+		Event:   SmEventPduSessRetrieve,
+		To:      []smf_context.SMContextState{smf_context.SmStateInActivePending},
+		Handler: HandleStateActiveEventPduSessRetrieve,
+	},
+	{
+		//Home-routed roaming, SMF acts as H-SMF
+		From:    smf_context.SmStateInit,
+		Event:   SmEventHsmfPduSessCreate,
+		To:      []smf_context.SMContextState{smf_context.SmStatePfcpCreatePending, smf_context.SmStateInit},
+		Handler: HandleStateInitEventHsmfPduSessCreate,
+	},
+	{
+		From:  smf_context.SmStateActive,
+		Event: SmEventHsmfPduSessUpdate,
+		To: []smf_context.SMContextState{smf_context.SmStateActive, smf_context.SmStatePfcpModify,
+			smf_context.SmStatePfcpRelease, smf_context.SmStateInActivePending},
+		Guard:   guardHsmf,
+		Handler: HandleStateActiveEventHsmfPduSessUpdate,
+	},
+	{
+		From:    smf_context.SmStateActive,
+		Event:   SmEventHsmfPduSessRelease,
+		To:      []smf_context.SMContextState{smf_context.SmStatePfcpRelease, smf_context.SmStateInit},
+		Guard:   guardHsmf,
+		Handler: HandleStateActiveEventHsmfPduSessRelease,
+	},
+	{
+		From:    smf_context.SmStateInActivePending,
+		Event:   SmEventHsmfPduSessRelease,
+		To:      []smf_context.SMContextState{smf_context.SmStatePfcpRelease, smf_context.SmStateInit},
+		Guard:   guardHsmf,
+		Handler: HandleStateActiveEventHsmfPduSessRelease,
+	},
+	{
+		//Home-routed roaming, SMF acts as V-SMF
+		From:  smf_context.SmStateActive,
+		Event: SmEventVsmfPduSessUpdate,
+		To: []smf_context.SMContextState{smf_context.SmStateActive,
+			smf_context.SmStatePfcpRelease, smf_context.SmStateInActivePending},
+		Guard:   guardVsmf,
+		Handler: HandleStateActiveEventVsmfPduSessUpdate,
+	},
+}
+
+//Entry/Exit actions
+var SmStateActions = map[smf_context.SMContextState]SmStateAction{
+	smf_context.SmStateActive: {
+		OnEntry: func(smCtxt *smf_context.SMContext) {
+			smCtxt.UpdateSessProfileStats(smf_context.SmStateActive, 1)
+		},
+		OnExit: func(smCtxt *smf_context.SMContext) {
+			smCtxt.UpdateSessProfileStats(smf_context.SmStateActive, 0)
+		},
+	},
+}
+
+//ValidateTransitionTable checks table for incomplete or conflicting rows
+func ValidateTransitionTable(table []SmTransition) error {
+	var seen [smf_context.SmStateMax][SmEventMax]bool
+
+	for i, tr := range table {
+		if tr.From >= smf_context.SmStateMax {
+			return fmt.Errorf("row[%d]: invalid from-state [%d]", i, tr.From)
+		}
+		if tr.Event == SmEventInvalid || tr.Event >= SmEventMax {
+			return fmt.Errorf("row[%d]: invalid event [%d]", i, tr.Event)
+		}
+		if tr.Handler == nil {
+			return fmt.Errorf("row[%d]: state[%v] event[%v] has no handler", i, tr.From, tr.Event)
+		}
+		if len(tr.To) == 0 {
+			return fmt.Errorf("row[%d]: state[%v] event[%v] has no next-state", i, tr.From, tr.Event)
+		}
+		for _, to := range tr.To {
+			if to >= smf_context.SmStateMax {
+				return fmt.Errorf("row[%d]: invalid next-state [%d]", i, to)
+			}
+		}
+		if seen[tr.From][tr.Event] {
+			return fmt.Errorf("row[%d]: duplicate state[%v] event[%v]", i, tr.From, tr.Event)
+		}
+		seen[tr.From][tr.Event] = true
+	}
+
+	return nil
+}
+
+//UnreachableStates returns states which can't be reached from SmStateInit
+func UnreachableStates(table []SmTransition) []smf_context.SMContextState {
+	var reachable [smf_context.SmStateMax]bool
+	reachable[smf_context.SmStateInit] = true
+
+	for changed := true; changed; {
+		changed = false
+		mark := func(from, to smf_context.SMContextState) {
+			if reachable[from] && !reachable[to] {
+				reachable[to] = true
+				changed = true
+			}
+		}
+		for _, tr := range table {
+			for _, to := range tr.To {
+				mark(tr.From, to)
+			}
+		}
+	}
+
+	unreachable := make([]smf_context.SMContextState, 0)
+	for state := smf_context.SmStateInit; state < smf_context.SmStateMax; state++ {
+		if !reachable[state] {
+			unreachable = append(unreachable, state)
+		}
+	}
+	return unreachable
+}
+
+func (tr *SmTransition) allows(state smf_context.SMContextState) bool {
+	for _, to := range tr.To {
+		if to == state {
+			return true
+		}
+	}
+	return false
+}
+
+//Guards
+func guardTunnelPresent(smCtxt *smf_context.SMContext, eventData *SmEventData) error {
+	if smCtxt.Tunnel == nil {
+		return fmt.Errorf("no user plane tunnel")
+	}
+	return nil
+}
+
+func guardAmfSelected(smCtxt *smf_context.SMContext, eventData *SmEventData) error {
+	if smCtxt.CommunicationClient == nil && !smCtxt.IsHsmf() {
+		return fmt.Errorf("no AMF communication client")
+	}
+	return nil
+}
+
+func guardHsmf(smCtxt *smf_context.SMContext, eventData *SmEventData) error {
+	if !smCtxt.IsHsmf() {
+		return fmt.Errorf("not a home-routed session")
+	}
+	return nil
+}
+
+func guardVsmf(smCtxt *smf_context.SMContext, eventData *SmEventData) error {
+	if !smCtxt.IsVsmf() {
+		return fmt.Errorf("not a home-routed session")
+	}
+	return nil
+}
+
+func txnSmContext(eventData *SmEventData) *smf_context.SMContext {
+	return eventData.Txn.(*transaction.Transaction).Ctxt.(*smf_context.SMContext)
+}
@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fsm_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+	"github.com/free5gc/smf/fsm"
+)
+
+func TestValidateTransitionTable(t *testing.T) {
+	require.NoError(t, fsm.ValidateTransitionTable(fsm.SmTransitionTable))
+
+	testCases := []struct {
+		name  string
+		table []fsm.SmTransition
+	}{
+		{
+			"no handler",
+			[]fsm.SmTransition{
+				{
+					From:  smf_context.SmStateInit,
+					Event: fsm.SmEventPduSessCreate,
+					To:    []smf_context.SMContextState{smf_context.SmStatePfcpCreatePending},
+				},
+			},
+		},
+		{
+			"no next-state",
+			[]fsm.SmTransition{
+				{
+					From:    smf_context.SmStateInit,
+					Event:   fsm.SmEventPduSessCreate,
+					Handler: fsm.HandleStateInitEventPduSessCreate,
+				},
+			},
+		},
+		{
+			"duplicate row",
+			[]fsm.SmTransition{
+				{
+					From:    smf_context.SmStateInit,
+					Event:   fsm.SmEventPduSessCreate,
+					To:      []smf_context.SMContextState{smf_context.SmStatePfcpCreatePending},
+					Handler: fsm.HandleStateInitEventPduSessCreate,
+				},
+				{
+					From:    smf_context.SmStateInit,
+					Event:   fsm.SmEventPduSessCreate,
+					To:      []smf_context.SMContextState{smf_context.SmStateActive},
+					Handler: fsm.HandleStateInitEventPduSessCreate,
+				},
+			},
+		},
+		{
+			"invalid event",
+			[]fsm.SmTransition{
+				{
+					From:    smf_context.SmStateInit,
+					Event:   fsm.SmEventMax,
+					To:      []smf_context.SMContextState{smf_context.SmStatePfcpCreatePending},
+					Handler: fsm.HandleStateInitEventPduSessCreate,
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Error(t, fsm.ValidateTransitionTable(tc.table))
+		})
+	}
+}
+
+func TestStateTransitionRegistered(t *testing.T) {
+	valid := func(from smf_context.SMContextState, event fsm.SmEvent, to smf_context.SMContextState) bool {
+		return smf_context.IsValidStateTransition(from, smf_context.SMContextEvent(event), to)
+	}
+	require.True(t, valid(smf_context.SmStateActive, fsm.SmEventPduSessModify, smf_context.SmStatePfcpModify))
+	require.True(t, valid(smf_context.SmStatePfcpModify, fsm.SmEventPfcpSessModifyRsp, smf_context.SmStateInit))
+	require.False(t, valid(smf_context.SmStateInit, fsm.SmEventPduSessCreate, smf_context.SmStateActive))
+	//Transition is allowed on event of its row only
+	require.True(t, valid(smf_context.SmStateActive, fsm.SmEventPduSessModify, smf_context.SmStateModify))
+	require.False(t, valid(smf_context.SmStateActive, fsm.SmEventPolicyUpdateNotify, smf_context.SmStatePfcpModify))
+	require.False(t, valid(smf_context.SmStatePfcpRelease, fsm.SmEventPduSessRelease, smf_context.SmStateActive))
+	//Self transitions are allowed only if listed
+	require.True(t, valid(smf_context.SmStateActive, fsm.SmEventPolicyUpdateNotify, smf_context.SmStateActive))
+	require.False(t, valid(smf_context.SmStateActive, fsm.SmEventPduSessRelease, smf_context.SmStateActive))
+}
+
+func TestIllegalStateChangeFailsProcedure(t *testing.T) {
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 18, smctxtest.WithState(smf_context.SmStateActive))
+
+	//No event in progress, state stays
+	require.Error(t, smContext.ChangeState(smf_context.SmStateInit))
+	require.Equal(t, smf_context.SmStateActive, smContext.SMContextState)
+
+	//Policy update isn't allowed to touch UPFs
+	smContext.StartStateEvent(smf_context.SMContextEvent(fsm.SmEventPolicyUpdateNotify))
+	require.Error(t, smContext.ChangeState(smf_context.SmStatePfcpModify))
+	require.Equal(t, smf_context.SmStateActive, smContext.SMContextState)
+	require.NoError(t, smContext.ChangeState(smf_context.SmStateActive))
+	smContext.EndStateEvent()
+
+	//Steps of Update SM Context are checked against state it started in
+	smContext.StartStateEvent(smf_context.SMContextEvent(fsm.SmEventPduSessModify))
+	require.NoError(t, smContext.ChangeState(smf_context.SmStateModify))
+	require.NoError(t, smContext.ChangeState(smf_context.SmStatePfcpModify))
+	require.Error(t, smContext.ChangeState(smf_context.SmStatePfcpCreatePending))
+	require.Equal(t, smf_context.SmStatePfcpModify, smContext.SMContextState)
+	smContext.EndStateEvent()
+
+	//Teardown resets state whichever it is in
+	smf_context.RemoveSMContext(smContext.Ref)
+	require.Equal(t, smf_context.SmStateInit, smContext.SMContextState)
+}
+
+func TestExportGraph(t *testing.T) {
+	require.Contains(t, fsm.ExportDot(), "\"SmStateInit\" -> \"SmStatePfcpCreatePending\"")
+	require.Contains(t, fsm.ExportMermaid(), "SmStateInit --> SmStatePfcpCreatePending : SmEventPduSessCreate")
+}
@@ -31,7 +31,7 @@ func (SmfTxnFsm) TxnLoadCtxt(txn *transaction.Transaction) (transaction.TxnEvent
 
 	switch txn.MsgType {
 	case svcmsgtypes.CreateSmContext:
-		req := txn.Req.(models.PostSmContextsRequest)
+		req := txn.Req.(smf_context.PostSmContextsRequest)
 		createData := req.JsonData
 		if smCtxtRef, err := smf_context.ResolveRef(createData.Supi, createData.PduSessionId); err == nil {
 			//Previous context exist
@@ -40,15 +40,40 @@ func (SmfTxnFsm) TxnLoadCtxt(txn *transaction.Transaction) (transaction.TxnEvent
 		//Create fresh context
 		txn.Ctxt = smf_context.NewSMContext(createData.Supi, createData.PduSessionId)
 
+	case svcmsgtypes.NsmfPDUSessionCreate:
+		createData := txn.Req.(smf_context.PduSessionCreateRequest).JsonData
+		if smCtxtRef, err := smf_context.ResolveRef(createData.Supi, createData.PduSessionId); err == nil {
+			//Previous context exist
+			producer.HandlePduSessionContextReplacement(smCtxtRef)
+		}
+		txn.Ctxt = smf_context.NewSMContext(createData.Supi, createData.PduSessionId)
+
+	case svcmsgtypes.NsmfPDUSessionUpdate:
+		fallthrough
+	case svcmsgtypes.NsmfPDUSessionRelease:
+		fallthrough
 	case svcmsgtypes.UpdateSmContext:
 		fallthrough
 	case svcmsgtypes.ReleaseSmContext:
 		fallthrough
+	case svcmsgtypes.RetrieveSmContext:
+		fallthrough
 	case svcmsgtypes.SmPolicyUpdateNotification:
+		fallthrough
+	case svcmsgtypes.SmPolicyTerminationNotification:
+		fallthrough
+	case svcmsgtypes.SdmDataChangeNotification:
 		txn.Ctxt = smf_context.GetSMContext(txn.CtxtKey)
 
 	case svcmsgtypes.PfcpSessCreate:
 		fallthrough
+	case svcmsgtypes.PfcpSessCreateRsp:
+		fallthrough
+	case svcmsgtypes.PfcpSessModifyRsp, svcmsgtypes.PfcpSessReleaseRsp:
+		fallthrough
+	case svcmsgtypes.NwInitiatedPduSessRelease, svcmsgtypes.LadnPresenceChange, svcmsgtypes.StaleSmContextRelease,
+		svcmsgtypes.AnchorRelocation:
+		fallthrough
 	case svcmsgtypes.N1N2MessageTransfer:
 		//Pre-loaded- No action
 	case svcmsgtypes.N1N2MessageTransferFailureNotification:
@@ -71,11 +96,12 @@ func (SmfTxnFsm) TxnCtxtPost(txn *transaction.Transaction) (transaction.TxnEvent
 
 	smContext := txn.Ctxt.(*smf_context.SMContext)
 
-	//If already Active Txn running then post it to SMF Txn Bus
-	if smContext.ActiveTxn != nil {
-		//Lock the bus before modifying
-		smContext.SMTxnBusLock.Lock()
-		defer smContext.SMTxnBusLock.Unlock()
+	//Lock the bus before modifying
+	smContext.SMTxnBusLock.Lock()
+	defer smContext.SMTxnBusLock.Unlock()
+
+	//If already Active Txn running, or procedure waits for PFCP responses, then post it to SMF Txn Bus
+	if smContext.ActiveTxn != nil || (smContext.IsAwaitingPfcpRsp() && !isPfcpProcedureRsp(txn)) {
 		smContext.TxnBus = smContext.TxnBus.AddTxn(txn)
 
 		//Txn has been posted and shall be scheduled later
@@ -84,7 +110,7 @@ func (SmfTxnFsm) TxnCtxtPost(txn *transaction.Transaction) (transaction.TxnEvent
 	}
 
 	//No other Txn running, lets proceed with current Txn
-
+	smContext.ActiveTxn = txn
 	return transaction.TxnEventRun, nil
 }
 
@@ -92,14 +118,15 @@ func (SmfTxnFsm) TxnCtxtRun(txn *transaction.Transaction) (transaction.TxnEvent,
 
 	smContext := txn.Ctxt.(*smf_context.SMContext)
 
-	//There shouldn't be any active Txn if current Txn has reached to Run state
+	//There shouldn't be any other active Txn if current Txn has reached to Run state
 	//Probably, abort it
-	if smContext.ActiveTxn != nil {
+	if smContext.ActiveTxn != nil && smContext.ActiveTxn != txn {
 		logger.TxnFsmLog.Errorf("active transaction [%v] not completed", smContext.ActiveTxn)
 	}
 
 	//make current txn as Active now, move it to processing
 	smContext.ActiveTxn = txn
+	smContext.TxnHistoryStart(txn)
 	return transaction.TxnEventProcess, nil
 }
 
@@ -123,12 +150,41 @@ func (SmfTxnFsm) TxnProcess(txn *transaction.Transaction) (transaction.TxnEvent,
 		event = SmEventPduSessRelease
 	case svcmsgtypes.PfcpSessCreate:
 		event = SmEventPfcpSessCreate
+	case svcmsgtypes.PfcpSessCreateRsp:
+		event = SmEventPfcpSessCreateRsp
+	case svcmsgtypes.PfcpSessModifyRsp:
+		event = SmEventPfcpSessModifyRsp
+	case svcmsgtypes.PfcpSessReleaseRsp:
+		event = SmEventPfcpSessReleaseRsp
 	case svcmsgtypes.N1N2MessageTransfer:
 		event = SmEventPduSessN1N2Transfer
 	case svcmsgtypes.N1N2MessageTransferFailureNotification:
 		event = SmEventPduSessN1N2TransferFailureIndication
 	case svcmsgtypes.SmPolicyUpdateNotification:
 		event = SmEventPolicyUpdateNotify
+	case svcmsgtypes.SmPolicyTerminationNotification:
+		event = SmEventPolicyTerminateNotify
+	case svcmsgtypes.SdmDataChangeNotification:
+		event = SmEventSdmDataChangeNotify
+	case svcmsgtypes.NwInitiatedPduSessRelease:
+		event = SmEventNwInitiatedPduSessRelease
+	case svcmsgtypes.LadnPresenceChange:
+		event = SmEventLadnPresenceChange
+	case svcmsgtypes.StaleSmContextRelease:
+		event = SmEventStaleSMContextRelease
+	case svcmsgtypes.AnchorRelocation:
+		event = SmEventAnchorRelocation
+	case svcmsgtypes.RetrieveSmContext:
+		event = SmEventPduSessRetrieve
+	case svcmsgtypes.NsmfPDUSessionCreate:
+		event = SmEventHsmfPduSessCreate
+	case svcmsgtypes.NsmfPDUSessionUpdate:
+		event = SmEventHsmfPduSessUpdate
+		if _, ok := txn.Req.(smf_context.VsmfUpdateRequest); ok {
+			event = SmEventVsmfPduSessUpdate
+		}
+	case svcmsgtypes.NsmfPDUSessionRelease:
+		event = SmEventHsmfPduSessRelease
 	default:
 		event = SmEventInvalid
 
@@ -146,7 +202,27 @@ func (SmfTxnFsm) TxnProcess(txn *transaction.Transaction) (transaction.TxnEvent,
 func (SmfTxnFsm) TxnSuccess(txn *transaction.Transaction) (transaction.TxnEvent, error) {
 
 	switch txn.MsgType {
-	case svcmsgtypes.PfcpSessCreate:
+	case svcmsgtypes.UpdateSmContext:
+		//UE authorized by DN-AAA, UP set up follows
+		if txn.Ctxt.(*smf_context.SMContext).SMContextState != smf_context.SmStatePfcpCreatePending {
+			break
+		}
+
+		nextTxn := transaction.NewTransaction(nil, nil, svcmsgtypes.SmfMsgType(svcmsgtypes.PfcpSessCreate))
+		nextTxn.Ctxt = txn.Ctxt
+		smContext := txn.Ctxt.(*smf_context.SMContext)
+		smContext.SMTxnBusLock.Lock()
+		smContext.TxnBus = smContext.TxnBus.AddTxn(nextTxn)
+		smContext.SMTxnBusLock.Unlock()
+		go func(nextTxn *transaction.Transaction) {
+			<-nextTxn.Status
+		}(nextTxn)
+
+	case svcmsgtypes.PfcpSessCreateRsp:
+		//Wait till all UPFs have answered
+		if txn.Ctxt.(*smf_context.SMContext).SMContextState != smf_context.SmStateN1N2TransferPending {
+			break
+		}
 
 		nextTxn := transaction.NewTransaction(nil, nil, svcmsgtypes.SmfMsgType(svcmsgtypes.N1N2MessageTransfer))
 		nextTxn.Ctxt = txn.Ctxt
@@ -162,6 +238,16 @@ func (SmfTxnFsm) TxnSuccess(txn *transaction.Transaction) (transaction.TxnEvent,
 		}(nextTxn)
 	}
 
+	if smContext, ok := txn.Ctxt.(*smf_context.SMContext); ok && smContext != nil {
+		smContext.TxnHistoryEnd(txn, smf_context.TxnResultSuccess)
+
+		//Answered once UPFs have answered
+		if smContext.IsTxnAwaitingPfcpRsp(txn) {
+			txn.TxnFsmLog.Debugf("txn waits for pfcp responses")
+			return transaction.TxnEventEnd, nil
+		}
+	}
+
 	//put Success Rsp
 	txn.Status <- true
 	return transaction.TxnEventEnd, nil
@@ -190,6 +276,18 @@ func (SmfTxnFsm) TxnFailure(txn *transaction.Transaction) (transaction.TxnEvent,
 				},
 			}
 			txn.Rsp = httpResponse
+		} else if txn.Rsp == nil {
+			txn.Rsp = &http_wrapper.Response{
+				Status: http.StatusInternalServerError,
+				Body: models.UpdateSmContextErrorResponse{
+					JsonData: &models.SmContextUpdateError{
+						Error: &models.ProblemDetails{
+							Title:  "SM context update failure",
+							Status: http.StatusInternalServerError,
+						},
+					},
+				},
+			}
 		}
 
 	case svcmsgtypes.ReleaseSmContext:
@@ -209,8 +307,123 @@ func (SmfTxnFsm) TxnFailure(txn *transaction.Transaction) (transaction.TxnEvent,
 				},
 			}
 			txn.Rsp = httpResponse
+		} else if txn.Rsp == nil {
+			txn.Rsp = &http_wrapper.Response{
+				Status: http.StatusInternalServerError,
+				Body: &models.ProblemDetails{
+					Title:  "SM context release failure",
+					Status: http.StatusInternalServerError,
+				},
+			}
+		}
+
+	case svcmsgtypes.RetrieveSmContext:
+		if smContext, _ := txn.Ctxt.(*smf_context.SMContext); smContext == nil {
+			logger.PduSessLog.Warnf("PDUSessionSMContextRetrieve [%s] is not found", txn.CtxtKey)
+			txn.Rsp = &http_wrapper.Response{
+				Status: http.StatusNotFound,
+				Body: &models.ProblemDetails{
+					Type:   "Resource Not Found",
+					Title:  "SMContext Ref is not found",
+					Status: http.StatusNotFound,
+					Cause:  "CONTEXT_NOT_FOUND",
+				},
+			}
+		} else if txn.Rsp == nil {
+			txn.Rsp = &http_wrapper.Response{
+				Status: http.StatusInternalServerError,
+				Body: &models.ProblemDetails{
+					Title:  "SM context retrieve failure",
+					Status: http.StatusInternalServerError,
+				},
+			}
+		}
+
+	case svcmsgtypes.SdmDataChangeNotification:
+		if smContext, _ := txn.Ctxt.(*smf_context.SMContext); smContext == nil {
+			logger.PduSessLog.Warnf("SDM data change notification, SMContext[%s] is not found", txn.CtxtKey)
+			txn.Rsp = &http_wrapper.Response{
+				Status: http.StatusNotFound,
+				Body: &models.ProblemDetails{
+					Type:   "Resource Not Found",
+					Title:  "SMContext Ref is not found",
+					Status: http.StatusNotFound,
+					Cause:  "CONTEXT_NOT_FOUND",
+				},
+			}
+		} else if txn.Rsp == nil {
+			txn.Rsp = &http_wrapper.Response{
+				Status: http.StatusInternalServerError,
+				Body: &models.ProblemDetails{
+					Title:  "SM data change not applied",
+					Status: http.StatusInternalServerError,
+				},
+			}
+		}
+
+	case svcmsgtypes.SmPolicyTerminationNotification:
+		if smContext, _ := txn.Ctxt.(*smf_context.SMContext); smContext == nil {
+			logger.PduSessLog.Warnf("SM policy termination notification, SMContext[%s] is not found", txn.CtxtKey)
+			txn.Rsp = &http_wrapper.Response{
+				Status: http.StatusNotFound,
+				Body: &models.ProblemDetails{
+					Type:   "Resource Not Found",
+					Title:  "SMContext Ref is not found",
+					Status: http.StatusNotFound,
+					Cause:  "CONTEXT_NOT_FOUND",
+				},
+			}
+		} else if txn.Rsp == nil {
+			txn.Rsp = &http_wrapper.Response{
+				Status: http.StatusInternalServerError,
+				Body: &models.ProblemDetails{
+					Title:  "SM policy termination failure",
+					Status: http.StatusInternalServerError,
+				},
+			}
+		}
+
+	case svcmsgtypes.NsmfPDUSessionCreate:
+		if txn.Rsp == nil {
+			txn.Rsp = &http_wrapper.Response{
+				Status: http.StatusInternalServerError,
+				Body: models.PostPduSessionsErrorResponse{
+					JsonData: &models.PduSessionCreateError{
+						Error: &models.ProblemDetails{
+							Title:  "PDU session create failure",
+							Status: http.StatusInternalServerError,
+						},
+					},
+				},
+			}
+		}
+
+	case svcmsgtypes.NsmfPDUSessionUpdate, svcmsgtypes.NsmfPDUSessionRelease:
+		if smContext, _ := txn.Ctxt.(*smf_context.SMContext); smContext == nil ||
+			!(smContext.IsHsmf() || smContext.IsVsmf()) {
+			logger.PduSessLog.Warnf("PDU session [%s] is not found", txn.CtxtKey)
+			txn.Rsp = &http_wrapper.Response{
+				Status: http.StatusNotFound,
+				Body: &models.ProblemDetails{
+					Type:   "Resource Not Found",
+					Title:  "PDU session Ref is not found",
+					Status: http.StatusNotFound,
+					Cause:  "CONTEXT_NOT_FOUND",
+				},
+			}
+		} else if txn.Rsp == nil {
+			txn.Rsp = &http_wrapper.Response{
+				Status: http.StatusInternalServerError,
+				Body: &models.ProblemDetails{
+					Title:  "PDU session procedure failure",
+					Status: http.StatusInternalServerError,
+				},
+			}
 		}
 	}
+	if smContext, ok := txn.Ctxt.(*smf_context.SMContext); ok && smContext != nil {
+		smContext.TxnHistoryEnd(txn, smf_context.TxnResultFailure)
+	}
 	txn.Status <- false
 	return transaction.TxnEventEnd, nil
 }
@@ -239,15 +452,29 @@ func (SmfTxnFsm) TxnEnd(txn *transaction.Transaction) (transaction.TxnEvent, err
 	if smContext == nil {
 		return transaction.TxnEventExit, nil
 	}
+
+	//PDU session rejected during secondary authentication, released once reject is answered
+	if txn.MsgType == svcmsgtypes.UpdateSmContext && smContext.SecondaryAuth != nil &&
+		smContext.SMContextState == smf_context.SmStateInit {
+		producer.ReleaseSMContextLocally(smContext, true)
+	}
+
+	//Lock txnbus to access
+	smContext.SMTxnBusLock.Lock()
+	defer smContext.SMTxnBusLock.Unlock()
 	smContext.ActiveTxn = nil
 
+	//Active Txn is over, now Pull out head Txn and Run it.
+	//While procedure waits for PFCP responses only they are run
 	var nextTxn *transaction.Transaction
-	//Active Txn is over, now Pull out head Txn and Run it
-	if len(smContext.TxnBus) > 0 {
-		//Lock txnbus to access
-		smContext.SMTxnBusLock.Lock()
-		defer smContext.SMTxnBusLock.Unlock()
+	if smContext.IsAwaitingPfcpRsp() {
+		nextTxn, smContext.TxnBus = smContext.TxnBus.PopTxnOfType(svcmsgtypes.PfcpSessModifyRsp,
+			svcmsgtypes.PfcpSessReleaseRsp)
+	} else {
 		nextTxn, smContext.TxnBus = smContext.TxnBus.PopTxn()
+	}
+	if nextTxn != nil {
+		smContext.ActiveTxn = nextTxn
 		txn.NextTxn = nextTxn
 		return transaction.TxnEventRun, nil
 	}
@@ -255,6 +482,18 @@ func (SmfTxnFsm) TxnEnd(txn *transaction.Transaction) (transaction.TxnEvent, err
 	return transaction.TxnEventExit, nil
 }
 
+//isPfcpProcedureRsp tells if txn delivers PFCP responses procedure waits for
+func isPfcpProcedureRsp(txn *transaction.Transaction) bool {
+	return txn.MsgType == svcmsgtypes.PfcpSessModifyRsp || txn.MsgType == svcmsgtypes.PfcpSessReleaseRsp
+}
+
+//Dump SM context txn history when txn crashes
+func TxnCrashDump(txn *transaction.Transaction) {
+	if smContext, ok := txn.Ctxt.(*smf_context.SMContext); ok && smContext != nil {
+		smContext.DumpTxnHistory()
+	}
+}
+
 /// Suggestions
 //1. Global pipeline for txns
 //2. Memory alloc pool for txns
@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fsm_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/nas"
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/openapi/models"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+	"github.com/free5gc/smf/fsm"
+	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
+	"github.com/free5gc/smf/qos"
+	"github.com/free5gc/smf/transaction"
+)
+
+func runTxn(req interface{}, msgType svcmsgtypes.SmfMsgType, ctxtKey string) *http_wrapper.Response {
+	txn := transaction.NewTransaction(req, nil, msgType)
+	txn.CtxtKey = ctxtKey
+	go txn.StartTxnLifeCycle(fsm.SmfTxnFsmHandle)
+	<-txn.Status
+	return txn.Rsp.(*http_wrapper.Response)
+}
+
+func TestSmPolicyTerminationNotification(t *testing.T) {
+	notification := models.TerminationNotification{
+		Cause: models.PolicyAssociationReleaseCause_UE_SUBSCRIPTION,
+	}
+
+	rsp := runTxn(notification, svcmsgtypes.SmPolicyTerminationNotification, "urn:uuid:unknown")
+	require.Equal(t, http.StatusNotFound, rsp.Status)
+
+	//UE requested release already in progress
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 8, smctxtest.WithState(smf_context.SmStateInActivePending))
+
+	rsp = runTxn(notification, svcmsgtypes.SmPolicyTerminationNotification, smContext.Ref)
+	require.Equal(t, http.StatusNoContent, rsp.Status)
+	require.Equal(t, smf_context.SmStateInActivePending, smContext.SMContextState)
+	require.Zero(t, smContext.ReleaseCause5gSMValue)
+}
+
+func TestNwInitiatedPduSessRelease(t *testing.T) {
+	//UE requested release already in progress
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 9, smctxtest.WithState(smf_context.SmStateInActivePending))
+
+	txn := transaction.NewTransaction(uint8(nasMessage.Cause5GSMRegularDeactivation), nil,
+		svcmsgtypes.SmfMsgType(svcmsgtypes.NwInitiatedPduSessRelease))
+	txn.Ctxt = smContext
+	txn.CtxtKey = smContext.Ref
+	go txn.StartTxnLifeCycle(fsm.SmfTxnFsmHandle)
+	<-txn.Status
+
+	require.Equal(t, smf_context.SmStateInActivePending, smContext.SMContextState)
+	require.Zero(t, smContext.ReleaseCause5gSMValue)
+	require.Nil(t, smContext.PendingGsmProcedure(nas.MsgTypePDUSessionReleaseCommand))
+}
+
+func TestLadnPresenceChange(t *testing.T) {
+	//UE left LADN service area while release is in progress
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 9,
+		smctxtest.WithState(smf_context.SmStateInActivePending),
+		smctxtest.WithDnnInfo(&smf_context.SnssaiSmfDnnInfo{Ladn: &smf_context.LadnInfo{ReleaseTimer: time.Hour}}))
+	smContext.PresenceInLadn = models.PresenceState_OUT_OF_AREA
+
+	txn := transaction.NewTransaction(nil, nil, svcmsgtypes.SmfMsgType(svcmsgtypes.LadnPresenceChange))
+	txn.Ctxt = smContext
+	txn.CtxtKey = smContext.Ref
+	go txn.StartTxnLifeCycle(fsm.SmfTxnFsmHandle)
+	<-txn.Status
+
+	//No user plane update, nor N2 release
+	require.Equal(t, smf_context.SmStateInActivePending, smContext.SMContextState)
+	require.True(t, smContext.IsLadnReleasePending())
+	require.False(t, smContext.IsAwaitingPfcpRsp())
+	require.False(t, smContext.LadnUpDeactivated)
+	smContext.StopLadnRelease()
+}
+
+func TestNwModificationN1N2TransferFailure(t *testing.T) {
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 10, smctxtest.WithState(smf_context.SmStateActive))
+
+	//PDU Session Modification Command waiting for paged UE
+	smContext.SmPolicyUpdates = []*qos.PolicyUpdate{{}}
+	smContext.NewGsmProcedure(0, 0, nas.MsgTypePDUSessionModificationCommand, nil)
+
+	notification := models.N1N2MsgTxfrFailureNotification{
+		Cause: models.N1N2MessageTransferCause_UE_NOT_RESPONDING,
+	}
+	txn := transaction.NewTransaction(notification, nil,
+		svcmsgtypes.SmfMsgType(svcmsgtypes.N1N2MessageTransferFailureNotification))
+	txn.CtxtKey = smContext.Ref
+	go txn.StartTxnLifeCycle(fsm.SmfTxnFsmHandle)
+	<-txn.Status
+
+	//Policy update rolled back, session goes on
+	require.Equal(t, smf_context.SmStateActive, smContext.SMContextState)
+	require.False(t, smContext.IsNwModificationPending())
+	require.Empty(t, smContext.SmPolicyUpdates)
+}
+
+func TestGsmStatusOnPtiMismatch(t *testing.T) {
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 11, smctxtest.WithState(smf_context.SmStateActive))
+
+	//Network requested modification waiting for UE
+	smContext.SmPolicyUpdates = []*qos.PolicyUpdate{{}}
+	smContext.NewGsmProcedure(0, 0, nas.MsgTypePDUSessionModificationCommand, nil)
+
+	//Modification Complete with PTI of no procedure in progress
+	request := models.UpdateSmContextRequest{
+		JsonData:              &models.SmContextUpdateData{},
+		BinaryDataN1SmMessage: []byte{nasMessage.Epd5GSSessionManagementMessage, 11, 5, nas.MsgTypePDUSessionModificationComplete},
+	}
+	rsp := runTxn(request, svcmsgtypes.SmfMsgType(svcmsgtypes.UpdateSmContext), smContext.Ref)
+	require.Equal(t, http.StatusOK, rsp.Status)
+
+	m := nas.NewMessage()
+	buf := rsp.Body.(models.UpdateSmContextResponse).BinaryDataN1SmMessage
+	require.Nil(t, m.GsmMessageDecode(&buf))
+	require.Equal(t, nas.MsgTypeStatus5GSM, m.GsmHeader.GetMessageType())
+	require.Equal(t, uint8(5), m.Status5GSM.GetPTI())
+	require.Equal(t, nasMessage.Cause5GSMPTIMismatch, m.Status5GSM.GetCauseValue())
+
+	//Modification still waiting for UE
+	require.True(t, smContext.IsNwModificationPending())
+}
+
+func TestDuplicateGsmRequest(t *testing.T) {
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 12, smctxtest.WithState(smf_context.SmStateActive))
+
+	//Release Command already sent for PTI 7
+	releaseCommand := []byte{nasMessage.Epd5GSSessionManagementMessage, 12, 7, nas.MsgTypePDUSessionReleaseCommand, 0x24}
+	smContext.CompleteGsmProcedure(smContext.NewGsmProcedure(7, nas.MsgTypePDUSessionReleaseRequest,
+		nas.MsgTypePDUSessionReleaseCommand, releaseCommand))
+
+	request := models.UpdateSmContextRequest{
+		JsonData:              &models.SmContextUpdateData{},
+		BinaryDataN1SmMessage: []byte{nasMessage.Epd5GSSessionManagementMessage, 12, 7, nas.MsgTypePDUSessionReleaseRequest},
+	}
+	rsp := runTxn(request, svcmsgtypes.SmfMsgType(svcmsgtypes.UpdateSmContext), smContext.Ref)
+	require.Equal(t, http.StatusOK, rsp.Status)
+	require.Equal(t, releaseCommand, rsp.Body.(models.UpdateSmContextResponse).BinaryDataN1SmMessage)
+
+	//Session untouched
+	require.Equal(t, smf_context.SmStateActive, smContext.SMContextState)
+}
+
+func TestGsmStatusOnMalformedMessage(t *testing.T) {
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 12, smctxtest.WithState(smf_context.SmStateActive))
+
+	for msgType, cause := range map[uint8]uint8{
+		//5GSM cause missing
+		nas.MsgTypePDUSessionModificationCommandReject: nasMessage.Cause5GSMInvalidMandatoryInformation,
+		//Not a 5GSM message type
+		0xe0: nasMessage.Cause5GSMMessageTypeNonExistentOrNotImplemented,
+	} {
+		request := models.UpdateSmContextRequest{
+			JsonData:              &models.SmContextUpdateData{},
+			BinaryDataN1SmMessage: []byte{nasMessage.Epd5GSSessionManagementMessage, 12, 5, msgType},
+		}
+		rsp := runTxn(request, svcmsgtypes.SmfMsgType(svcmsgtypes.UpdateSmContext), smContext.Ref)
+		require.Equal(t, http.StatusOK, rsp.Status)
+
+		m := nas.NewMessage()
+		buf := rsp.Body.(models.UpdateSmContextResponse).BinaryDataN1SmMessage
+		require.Nil(t, m.GsmMessageDecode(&buf))
+		require.Equal(t, nas.MsgTypeStatus5GSM, m.GsmHeader.GetMessageType())
+		require.Equal(t, cause, m.Status5GSM.GetCauseValue())
+	}
+}
+
+func TestStaleSMContextRelease(t *testing.T) {
+	release := func(smContext *smf_context.SMContext, since time.Time) {
+		txn := transaction.NewTransaction(since, nil, svcmsgtypes.SmfMsgType(svcmsgtypes.StaleSmContextRelease))
+		txn.Ctxt = smContext
+		txn.CtxtKey = smContext.Ref
+		go txn.StartTxnLifeCycle(fsm.SmfTxnFsmHandle)
+		<-txn.Status
+	}
+
+	//Stuck since sweep, released locally
+	stuck := smctxtest.NewSMContext(t, "imsi-2089300007487", 10,
+		smctxtest.WithState(smf_context.SmStatePfcpCreatePending))
+	release(stuck, stuck.StateChangeTime)
+	require.Nil(t, smf_context.GetSMContext(stuck.Ref))
+
+	//Left pending state and came back after sweep, kept
+	retried := smctxtest.NewSMContext(t, "imsi-2089300007487", 11,
+		smctxtest.WithState(smf_context.SmStateN1N2TransferPending))
+	release(retried, retried.StateChangeTime.Add(-time.Minute))
+	require.Equal(t, retried, smf_context.GetSMContext(retried.Ref))
+	require.Equal(t, smf_context.SmStateN1N2TransferPending, retried.SMContextState)
+}
@@ -22,6 +22,36 @@ func (e SmEvent) String() string {
 		return "SmEventPduSessN1N2Transfer"
 	case SmEventPduSessN1N2TransferFailureIndication:
 		return "SmEventPduSessN1N2TransferFailureIndication"
+	case SmEventPolicyUpdateNotify:
+		return "SmEventPolicyUpdateNotify"
+	case SmEventPfcpSessCreateRsp:
+		return "SmEventPfcpSessCreateRsp"
+	case SmEventPduSessRetrieve:
+		return "SmEventPduSessRetrieve"
+	case SmEventHsmfPduSessCreate:
+		return "SmEventHsmfPduSessCreate"
+	case SmEventHsmfPduSessUpdate:
+		return "SmEventHsmfPduSessUpdate"
+	case SmEventHsmfPduSessRelease:
+		return "SmEventHsmfPduSessRelease"
+	case SmEventVsmfPduSessUpdate:
+		return "SmEventVsmfPduSessUpdate"
+	case SmEventSdmDataChangeNotify:
+		return "SmEventSdmDataChangeNotify"
+	case SmEventPolicyTerminateNotify:
+		return "SmEventPolicyTerminateNotify"
+	case SmEventNwInitiatedPduSessRelease:
+		return "SmEventNwInitiatedPduSessRelease"
+	case SmEventPfcpSessModifyRsp:
+		return "SmEventPfcpSessModifyRsp"
+	case SmEventPfcpSessReleaseRsp:
+		return "SmEventPfcpSessReleaseRsp"
+	case SmEventLadnPresenceChange:
+		return "SmEventLadnPresenceChange"
+	case SmEventStaleSMContextRelease:
+		return "SmEventStaleSMContextRelease"
+	case SmEventAnchorRelocation:
+		return "SmEventAnchorRelocation"
 	default:
 		return "invalid SM event"
 	}
@@ -26,6 +26,8 @@ type SmfStats struct {
 	svcUdmMsg   *prometheus.CounterVec
 	sessions    *prometheus.GaugeVec
 	sessProfile *prometheus.GaugeVec
+	staleSess   *prometheus.CounterVec
+	gsmStatus   *prometheus.CounterVec
 }
 
 var smfStats *SmfStats
@@ -66,6 +68,16 @@ func initSmfStats() *SmfStats {
 			Name: "smf_pdu_session_profile",
 			Help: "SMF PDU session Profile",
 		}, []string{"id", "ip", "state", "upf", "enterprise"}),
+
+		staleSess: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "smf_stale_pdu_sessions_cleaned_total",
+			Help: "Number of PDU sessions cleaned up after getting stuck in a pending state",
+		}, []string{"smf_id", "state"}),
+
+		gsmStatus: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "smf_5gsm_status_messages_total",
+			Help: "5GSM STATUS messages exchanged with UE by 5GSM cause",
+		}, []string{"smf_id", "direction", "cause"}),
 	}
 }
 
@@ -91,6 +103,12 @@ func (ps *SmfStats) register() error {
 	if err := prometheus.Register(ps.sessProfile); err != nil {
 		return err
 	}
+	if err := prometheus.Register(ps.staleSess); err != nil {
+		return err
+	}
+	if err := prometheus.Register(ps.gsmStatus); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -142,3 +160,13 @@ func SetSessStats(nodeId string, count uint64) {
 func SetSessProfileStats(id, ip, state, upf, enterprise string, count uint64) {
 	smfStats.sessProfile.WithLabelValues(id, ip, state, upf, enterprise).Set(float64(count))
 }
+
+//IncrementStaleSessStats counts sessions cleaned up by SM context sweeper
+func IncrementStaleSessStats(smfID, state string) {
+	smfStats.staleSess.WithLabelValues(smfID, state).Inc()
+}
+
+//IncrementGsmStatusStats counts 5GSM STATUS messages received from or sent to UE
+func IncrementGsmStatusStats(smfID, direction, cause string) {
+	smfStats.gsmStatus.WithLabelValues(smfID, direction, cause).Inc()
+}
@@ -20,19 +20,34 @@ const (
 	NsmfPDUSessionUpdate  SmfMsgType = "Update"  //Update a PDU session in the H-SMF or V- SMF
 	NsmfPDUSessionRelease SmfMsgType = "Release" //Release a PDU session in the H-SMF
 
+	//Nsmf_EventExposure
+	SmfEventExposureSubscribe   SmfMsgType = "EventExposureSubscribe"
+	SmfEventExposureModify      SmfMsgType = "EventExposureModify"
+	SmfEventExposureUnsubscribe SmfMsgType = "EventExposureUnsubscribe"
+	SmfEventExposureNotify      SmfMsgType = "EventExposureNotify"
+
 	//NNRF_NFManagement
 	NnrfNFRegister           SmfMsgType = "NfRegister"
+	NnrfNFUpdate             SmfMsgType = "NfUpdate"
 	NnrfNFDeRegister         SmfMsgType = "NfDeRegister"
 	NnrfNFInstanceDeRegister SmfMsgType = "NnrfNFInstanceDeRegister"
 	NnrfNFDiscoveryUdm       SmfMsgType = "NfDiscoveryUdm"
 	NnrfNFDiscoveryPcf       SmfMsgType = "NfDiscoveryPcf"
 	NnrfNFDiscoveryAmf       SmfMsgType = "NfDiscoveryAmf"
+	NnrfNFDiscoverySmf       SmfMsgType = "NfDiscoverySmf"
 
 	//NUDM_
-	SmSubscriptionDataRetrieval SmfMsgType = "SmSubscriptionDataRetrieval"
+	SmSubscriptionDataRetrieval   SmfMsgType = "SmSubscriptionDataRetrieval"
+	SmfRegistration               SmfMsgType = "SmfRegistration"
+	SmfDeregistration             SmfMsgType = "SmfDeregistration"
+	UdmDeregistrationNotification SmfMsgType = "UdmDeregistrationNotification"
+	SdmSubscribe                  SmfMsgType = "SdmSubscribe"
+	SdmUnsubscribe                SmfMsgType = "SdmUnsubscribe"
+	SdmDataChangeNotification     SmfMsgType = "SdmDataChangeNotification"
 
 	//NPCF_
 	SmPolicyAssociationCreate       SmfMsgType = "SmPolicyAssociationCreate"
+	SmPolicyAssociationUpdate       SmfMsgType = "SmPolicyAssociationUpdate"
 	SmPolicyAssociationDelete       SmfMsgType = "SmPolicyAssociationDelete"
 	SmPolicyUpdateNotification      SmfMsgType = "SmPolicyUpdateNotification"
 	SmPolicyTerminationNotification SmfMsgType = "SmPolicyTerminationNotification"
@@ -42,7 +57,16 @@ const (
 	N1N2MessageTransferFailureNotification SmfMsgType = "N1N2MessageTransferFailureNotification"
 
 	//PFCP
-	PfcpSessCreate  SmfMsgType = "PfcpSessCreate"
-	PfcpSessModify  SmfMsgType = "PfcpSessModify"
-	PfcpSessRelease SmfMsgType = "PfcpSessRelease"
+	PfcpSessCreate     SmfMsgType = "PfcpSessCreate"
+	PfcpSessCreateRsp  SmfMsgType = "PfcpSessCreateRsp"
+	PfcpSessModify     SmfMsgType = "PfcpSessModify"
+	PfcpSessModifyRsp  SmfMsgType = "PfcpSessModifyRsp"
+	PfcpSessRelease    SmfMsgType = "PfcpSessRelease"
+	PfcpSessReleaseRsp SmfMsgType = "PfcpSessReleaseRsp"
+
+	//SMF internal
+	NwInitiatedPduSessRelease SmfMsgType = "NwInitiatedPduSessRelease"
+	LadnPresenceChange        SmfMsgType = "LadnPresenceChange"
+	StaleSmContextRelease     SmfMsgType = "StaleSmContextRelease"
+	AnchorRelocation          SmfMsgType = "AnchorRelocation"
 )
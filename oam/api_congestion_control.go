@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oam
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/free5gc/openapi"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/producer"
+)
+
+func HTTPGetCongestionControl(c *gin.Context) {
+	HTTPResponse := producer.HandleOAMGetCongestionControl()
+
+	c.JSON(HTTPResponse.Status, HTTPResponse.Body)
+}
+
+func HTTPSetCongestionControl(c *gin.Context) {
+	var request producer.CongestionRuleInfo
+
+	reqBody, err := c.GetRawData()
+	if err == nil {
+		err = openapi.Deserialize(&request, reqBody, "application/json")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: "[Request Body] " + err.Error(),
+		})
+		return
+	}
+
+	HTTPResponse := producer.HandleOAMSetCongestionControl(request)
+	if HTTPResponse.Body == nil {
+		c.Status(HTTPResponse.Status)
+		return
+	}
+	c.JSON(HTTPResponse.Status, HTTPResponse.Body)
+}
@@ -0,0 +1,21 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oam
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/smf/producer"
+)
+
+func HTTPGetSMContextHistory(c *gin.Context) {
+	req := http_wrapper.NewRequest(c.Request, nil)
+	req.Params["ref"] = c.Params.ByName("ref")
+
+	HTTPResponse := producer.HandleOAMGetSMContextHistory(req.Params["ref"])
+
+	c.JSON(HTTPResponse.Status, HTTPResponse.Body)
+}
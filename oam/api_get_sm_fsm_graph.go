@@ -0,0 +1,25 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oam
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/free5gc/smf/fsm"
+)
+
+//HTTPGetSmFsmGraph exports SM context FSM as Graphviz DOT(default) or Mermaid
+func HTTPGetSmFsmGraph(c *gin.Context) {
+	switch c.Query("format") {
+	case "", "dot":
+		c.String(http.StatusOK, fsm.ExportDot())
+	case "mermaid":
+		c.String(http.StatusOK, fsm.ExportMermaid())
+	default:
+		c.String(http.StatusBadRequest, "unsupported format, use dot or mermaid")
+	}
+}
@@ -42,6 +42,10 @@ func AddService(engine *gin.Engine) *gin.RouterGroup {
 		switch route.Method {
 		case "GET":
 			group.GET(route.Pattern, route.HandlerFunc)
+		case "PUT":
+			group.PUT(route.Pattern, route.HandlerFunc)
+		case "POST":
+			group.POST(route.Pattern, route.HandlerFunc)
 		}
 	}
 	return group
@@ -65,4 +69,34 @@ var routes = Routes{
 		"/ue-pdu-session-info/:smContextRef",
 		HTTPGetUEPDUSessionInfo,
 	},
+	{
+		"Get SM Context FSM Graph",
+		"GET",
+		"/sm-fsm",
+		HTTPGetSmFsmGraph,
+	},
+	{
+		"Get SM Context Transaction History",
+		"GET",
+		"/sessions/:ref/history",
+		HTTPGetSMContextHistory,
+	},
+	{
+		"Release PDU Session",
+		"POST",
+		"/sessions/:ref/release",
+		HTTPReleasePDUSession,
+	},
+	{
+		"Get Congestion Control",
+		"GET",
+		"/congestion-control",
+		HTTPGetCongestionControl,
+	},
+	{
+		"Set Congestion Control",
+		"PUT",
+		"/congestion-control",
+		HTTPSetCongestionControl,
+	},
 }
@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oam_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/smf/context/smctxtest"
+	"github.com/free5gc/smf/oam"
+)
+
+func TestSMContextHistoryRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	group := oam.AddService(router)
+	require.Equal(t, "/nsmf-oam/v1", group.BasePath())
+
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 10)
+
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	//History is served by the OAM group, there is no separate group for it
+	require.Equal(t, http.StatusOK, get("/nsmf-oam/v1/sessions/"+smContext.Ref+"/history"))
+	require.Equal(t, http.StatusNotFound, get("/nsmf-oam/v1/sessions/unknown/history"))
+	require.Equal(t, http.StatusNotFound, get("/smf-oam/v1/sessions/"+smContext.Ref+"/history"))
+}
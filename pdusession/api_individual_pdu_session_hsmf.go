@@ -15,16 +15,106 @@ package pdusession
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/openapi"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/fsm"
+	"github.com/free5gc/smf/logger"
+	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
+	"github.com/free5gc/smf/transaction"
+
+	smf_context "github.com/free5gc/smf/context"
+	stats "github.com/free5gc/smf/metrics"
 )
 
 // ReleasePduSession - Release
 func ReleasePduSession(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{})
+	logger.PduSessLog.Info("Recieve Release PDU Session Request")
+	stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionRelease), "In", "", "")
+
+	//Request body is optional
+	var request models.ReleaseData
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problemDetail := "[Request Body] " + err.Error()
+			rsp := models.ProblemDetails{
+				Title:  "Malformed request syntax",
+				Status: http.StatusBadRequest,
+				Detail: problemDetail,
+			}
+			logger.PduSessLog.Errorln(problemDetail)
+			c.JSON(http.StatusBadRequest, rsp)
+			stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionRelease), "Out", http.StatusText(http.StatusBadRequest), "Malformed")
+			return
+		}
+	}
+
+	txn := transaction.NewTransaction(request, nil, svcmsgtypes.SmfMsgType(svcmsgtypes.NsmfPDUSessionRelease))
+	txn.CtxtKey = c.Params.ByName("pduSessionRef")
+	go txn.StartTxnLifeCycle(fsm.SmfTxnFsmHandle)
+	<-txn.Status
+
+	HTTPResponse := txn.Rsp.(*http_wrapper.Response)
+	stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionRelease), "Out", http.StatusText(HTTPResponse.Status), "")
+	if HTTPResponse.Status == http.StatusNoContent {
+		c.Status(http.StatusNoContent)
+	} else {
+		c.JSON(HTTPResponse.Status, HTTPResponse.Body)
+	}
 }
 
 // UpdatePduSession - Update (initiated by V-SMF)
 func UpdatePduSession(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{})
+	logger.PduSessLog.Info("Recieve Update PDU Session Request")
+	stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionUpdate), "In", "", "")
+
+	//Same resource serves V-SMF side of home-routed session, updated by H-SMF
+	if smContext := smf_context.GetSMContext(c.Params.ByName("pduSessionRef")); smContext != nil && smContext.IsVsmf() {
+		updateVsmfPduSession(c)
+		return
+	}
+
+	var request models.UpdatePduSessionRequest
+	request.JsonData = new(models.HsmfUpdateData)
+
+	s := strings.Split(c.GetHeader("Content-Type"), ";")
+	var err error
+	switch s[0] {
+	case "application/json":
+		err = c.ShouldBindJSON(request.JsonData)
+	case "multipart/related":
+		err = c.ShouldBindWith(&request, openapi.MultipartRelatedBinding{})
+	}
+	if err != nil {
+		problemDetail := "[Request Body] " + err.Error()
+		rsp := models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: problemDetail,
+		}
+		logger.PduSessLog.Errorln(problemDetail)
+		c.JSON(http.StatusBadRequest, rsp)
+		stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionUpdate), "Out", http.StatusText(http.StatusBadRequest), "Malformed")
+		return
+	}
+
+	txn := transaction.NewTransaction(request, nil, svcmsgtypes.SmfMsgType(svcmsgtypes.NsmfPDUSessionUpdate))
+	txn.CtxtKey = c.Params.ByName("pduSessionRef")
+	go txn.StartTxnLifeCycle(fsm.SmfTxnFsmHandle)
+	<-txn.Status
+
+	HTTPResponse := txn.Rsp.(*http_wrapper.Response)
+	stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionUpdate), "Out", http.StatusText(HTTPResponse.Status), "")
+	switch {
+	case HTTPResponse.Status == http.StatusNoContent:
+		c.Status(http.StatusNoContent)
+	case HTTPResponse.Status < 300:
+		c.Render(HTTPResponse.Status, openapi.MultipartRelatedRender{Data: HTTPResponse.Body})
+	default:
+		c.JSON(HTTPResponse.Status, HTTPResponse.Body)
+	}
 }
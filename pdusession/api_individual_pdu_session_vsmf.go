@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pdusession
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/openapi"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/fsm"
+	"github.com/free5gc/smf/logger"
+	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
+	"github.com/free5gc/smf/transaction"
+
+	smf_context "github.com/free5gc/smf/context"
+	stats "github.com/free5gc/smf/metrics"
+)
+
+//updateVsmfPduSession - Update (initiated by H-SMF)
+func updateVsmfPduSession(c *gin.Context) {
+	var request smf_context.VsmfUpdateRequest
+	request.JsonData = new(models.VsmfUpdateData)
+
+	s := strings.Split(c.GetHeader("Content-Type"), ";")
+	var err error
+	switch s[0] {
+	case "application/json":
+		err = c.ShouldBindJSON(request.JsonData)
+	case "multipart/related":
+		err = c.ShouldBindWith(&request, openapi.MultipartRelatedBinding{})
+	}
+	if err != nil {
+		problemDetail := "[Request Body] " + err.Error()
+		rsp := models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: problemDetail,
+		}
+		logger.PduSessLog.Errorln(problemDetail)
+		c.JSON(http.StatusBadRequest, rsp)
+		stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionUpdate), "Out", http.StatusText(http.StatusBadRequest), "Malformed")
+		return
+	}
+
+	txn := transaction.NewTransaction(request, nil, svcmsgtypes.SmfMsgType(svcmsgtypes.NsmfPDUSessionUpdate))
+	txn.CtxtKey = c.Params.ByName("pduSessionRef")
+	go txn.StartTxnLifeCycle(fsm.SmfTxnFsmHandle)
+	<-txn.Status
+
+	HTTPResponse := txn.Rsp.(*http_wrapper.Response)
+	stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionUpdate), "Out", http.StatusText(HTTPResponse.Status), "")
+	if HTTPResponse.Status == http.StatusNoContent {
+		c.Status(http.StatusNoContent)
+	} else {
+		c.JSON(HTTPResponse.Status, HTTPResponse.Body)
+	}
+}
@@ -80,7 +80,34 @@ func HTTPReleaseSmContext(c *gin.Context) {
 
 // RetrieveSmContext - Retrieve SM Context
 func RetrieveSmContext(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{})
+	logger.PduSessLog.Info("Recieve Retrieve SM Context Request")
+	stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.RetrieveSmContext), "In", "", "")
+
+	//Request body is optional
+	var request smf_context.SmContextRetrieveData
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problemDetail := "[Request Body] " + err.Error()
+			rsp := models.ProblemDetails{
+				Title:  "Malformed request syntax",
+				Status: http.StatusBadRequest,
+				Detail: problemDetail,
+			}
+			logger.PduSessLog.Errorln(problemDetail)
+			c.JSON(http.StatusBadRequest, rsp)
+			stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.RetrieveSmContext), "Out", http.StatusText(http.StatusBadRequest), "Malformed")
+			return
+		}
+	}
+
+	txn := transaction.NewTransaction(request, nil, svcmsgtypes.SmfMsgType(svcmsgtypes.RetrieveSmContext))
+	txn.CtxtKey = c.Params.ByName("smContextRef")
+	go txn.StartTxnLifeCycle(fsm.SmfTxnFsmHandle)
+	<-txn.Status
+
+	HTTPResponse := txn.Rsp.(*http_wrapper.Response)
+	stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.RetrieveSmContext), "Out", http.StatusText(HTTPResponse.Status), "")
+	c.JSON(HTTPResponse.Status, HTTPResponse.Body)
 }
 
 // HTTPUpdateSmContext - Update SM Context
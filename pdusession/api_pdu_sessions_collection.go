@@ -15,11 +15,93 @@ package pdusession
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/openapi"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/fsm"
+	"github.com/free5gc/smf/logger"
+	"github.com/free5gc/smf/transaction"
+
+	smf_context "github.com/free5gc/smf/context"
+	stats "github.com/free5gc/smf/metrics"
+	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
+	"github.com/free5gc/smf/smferrors"
 )
 
 // PostPduSessions - Create
 func PostPduSessions(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{})
+	logger.PduSessLog.Info("Recieve Create PDU Session Request")
+	var request smf_context.PduSessionCreateRequest
+	stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionCreate), "In", "", "")
+
+	//No new sessions while SMF is shutting down
+	if smf_context.IsShuttingDown() {
+		rsp := smferrors.SmfShuttingDown
+		c.Header("Retry-After", strconv.Itoa(smf_context.SMF_Self().Shutdown.RetryAfter))
+		stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionCreate), "Out", http.StatusText(http.StatusServiceUnavailable), "ShuttingDown")
+		logger.PduSessLog.Warnln("Create PDU Session Request rejected, SMF shutting down")
+		c.JSON(http.StatusServiceUnavailable, rsp)
+		return
+	}
+
+	request.JsonData = new(models.PduSessionCreateData)
+
+	s := strings.Split(c.GetHeader("Content-Type"), ";")
+	var err error
+	switch s[0] {
+	case "application/json":
+		err = c.ShouldBindJSON(request.JsonData)
+	case "multipart/related":
+		err = c.ShouldBindWith(&request, openapi.MultipartRelatedBinding{})
+	}
+
+	if err != nil {
+		problemDetail := "[Request Body] " + err.Error()
+		rsp := models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: problemDetail,
+		}
+		stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionCreate), "Out", http.StatusText(http.StatusBadRequest), "Malformed")
+		logger.PduSessLog.Errorln(problemDetail)
+		c.JSON(http.StatusBadRequest, rsp)
+		return
+	}
+
+	req := http_wrapper.NewRequest(c.Request, request)
+	txn := transaction.NewTransaction(req.Body.(smf_context.PduSessionCreateRequest), nil, svcmsgtypes.SmfMsgType(svcmsgtypes.NsmfPDUSessionCreate))
+
+	go txn.StartTxnLifeCycle(fsm.SmfTxnFsmHandle)
+	<-txn.Status //wait for txn to complete at SMF
+	HTTPResponse := txn.Rsp.(*http_wrapper.Response)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+	errStr := ""
+	if txn.Err != nil {
+		errStr = txn.Err.Error()
+	}
+
+	//Http Response to V-SMF
+	for key, val := range HTTPResponse.Header {
+		c.Header(key, val[0])
+	}
+	stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.NsmfPDUSessionCreate), "Out", http.StatusText(HTTPResponse.Status), errStr)
+	c.Render(HTTPResponse.Status, openapi.MultipartRelatedRender{Data: HTTPResponse.Body})
+
+	go func(smContext *smf_context.SMContext) {
+
+		var txn *transaction.Transaction
+		if HTTPResponse.Status == http.StatusCreated {
+			txn = transaction.NewTransaction(nil, nil, svcmsgtypes.SmfMsgType(svcmsgtypes.PfcpSessCreate))
+			txn.Ctxt = smContext
+			go txn.StartTxnLifeCycle(fsm.SmfTxnFsmHandle)
+			<-txn.Status
+		} else {
+			smf_context.RemoveSMContext(smContext.Ref)
+		}
+	}(smContext)
 }
@@ -15,6 +15,7 @@ package pdusession
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -29,15 +30,26 @@ import (
 	smf_context "github.com/free5gc/smf/context"
 	stats "github.com/free5gc/smf/metrics"
 	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
+	"github.com/free5gc/smf/smferrors"
 )
 
 // HTTPPostSmContexts - Create SM Context
 func HTTPPostSmContexts(c *gin.Context) {
 	logger.PduSessLog.Info("Recieve Create SM Context Request")
-	var request models.PostSmContextsRequest
+	var request smf_context.PostSmContextsRequest
 	stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.CreateSmContext), "In", "", "")
 
-	request.JsonData = new(models.SmContextCreateData)
+	//No new sessions while SMF is shutting down
+	if smf_context.IsShuttingDown() {
+		rsp := smferrors.SmfShuttingDown
+		c.Header("Retry-After", strconv.Itoa(smf_context.SMF_Self().Shutdown.RetryAfter))
+		stats.IncrementN11MsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.CreateSmContext), "Out", http.StatusText(http.StatusServiceUnavailable), "ShuttingDown")
+		logger.PduSessLog.Warnln("Create SM Context Request rejected, SMF shutting down")
+		c.JSON(http.StatusServiceUnavailable, rsp)
+		return
+	}
+
+	request.JsonData = new(smf_context.SmContextCreateData)
 
 	s := strings.Split(c.GetHeader("Content-Type"), ";")
 	var err error
@@ -62,7 +74,7 @@ func HTTPPostSmContexts(c *gin.Context) {
 	}
 
 	req := http_wrapper.NewRequest(c.Request, request)
-	txn := transaction.NewTransaction(req.Body.(models.PostSmContextsRequest), nil, svcmsgtypes.SmfMsgType(svcmsgtypes.CreateSmContext))
+	txn := transaction.NewTransaction(req.Body.(smf_context.PostSmContextsRequest), nil, svcmsgtypes.SmfMsgType(svcmsgtypes.CreateSmContext))
 
 	go txn.StartTxnLifeCycle(fsm.SmfTxnFsmHandle)
 	<-txn.Status //wait for txn to complete at SMF
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"net"
 
+	"github.com/free5gc/nas/nasMessage"
 	"github.com/free5gc/openapi/models"
 	"github.com/free5gc/pfcp"
 	"github.com/free5gc/pfcp/pfcpType"
@@ -50,20 +51,24 @@ func HandlePfcpHeartbeatResponse(msg *pfcpUdp.Message) {
 	}
 
 	upf.UpfLock.Lock()
-	defer upf.UpfLock.Unlock()
-
-	if *rsp.RecoveryTimeStamp != upf.RecoveryTimeStamp {
+	restarted := *rsp.RecoveryTimeStamp != upf.RecoveryTimeStamp
+	if restarted {
 		//change UPF state to not associated so that
 		//PFCP Association can be initiated again
 		upf.UPFStatus = smf_context.NotAssociated
 		logger.PfcpLog.Warnf("PFCP Heartbeat Response, upf [%v] recovery timestamp changed", upf.NodeID)
 
-		//TODO: Session cleanup required and updated to AMF/PCF
 		metrics.IncrementN4MsgStats(smf_context.SMF_Self().NfInstanceID, pfcpmsgtypes.PfcpMsgTypeString(msg.PfcpMessage.Header.MessageType), "In", "Failure", "RecoveryTimeStamp_mismatch")
 	}
 
 	upf.NHeartBeat = 0 //reset Heartbeat attempt to 0
+	upf.UpfLock.Unlock()
 
+	//UPF restarted and lost its sessions, UE may reactivate them
+	if restarted {
+		released := smf_context.RequestNwReleaseOfUpfSessions(*nodeID, nasMessage.Cause5GSMReactivationRequested)
+		logger.PfcpLog.Warnf("upf [%v] restarted, releasing [%v] PDU sessions", upf.NodeID, released)
+	}
 }
 
 func SetUpfInactive(nodeID pfcpType.NodeID, msgType pfcp.MessageType) {
@@ -193,6 +198,10 @@ func HandlePfcpAssociationReleaseRequest(msg *pfcpUdp.Message) {
 	upf := smf_context.RetrieveUPFNodeByNodeID(*pfcpMsg.NodeID)
 
 	if upf != nil {
+		//PFCP sessions go with association, UE may reactivate PDU sessions
+		released := smf_context.RequestNwReleaseOfUpfSessions(*pfcpMsg.NodeID,
+			nasMessage.Cause5GSMReactivationRequested)
+		logger.PfcpLog.Warnf("upf [%v] released association, releasing [%v] PDU sessions", upf.NodeID, released)
 		smf_context.RemoveUPFNodeByNodeID(*pfcpMsg.NodeID)
 		cause.CauseValue = pfcpType.CauseRequestAccepted
 	} else {
@@ -244,6 +253,10 @@ func HandlePfcpSessionEstablishmentResponse(msg *pfcpUdp.Message) {
 		}
 	}
 	smContext := smf_context.GetSMContextBySEID(SEID)
+	if smContext == nil {
+		logger.PfcpLog.Warnf("PFCP Session Establish Response found SM context nil, response discarded")
+		return
+	}
 
 	if rsp.UPFSEID != nil {
 		NodeIDtoIP := rsp.NodeID.ResolveNodeIdToIp().String()
@@ -251,24 +264,26 @@ func HandlePfcpSessionEstablishmentResponse(msg *pfcpUdp.Message) {
 		pfcpSessionCtx.RemoteSEID = rsp.UPFSEID.Seid
 	}
 
-	//Get N3 interface UPF
-	ANUPF := smContext.Tunnel.DataPathPool.GetDefaultPath().FirstDPNode
-
-	if ANUPF.UPF.NodeID.ResolveNodeIdToIp().Equal(rsp.NodeID.ResolveNodeIdToIp()) {
-		// UPF Accept
-		if rsp.Cause.CauseValue == pfcpType.CauseRequestAccepted {
-			smContext.SBIPFCPCommunicationChan <- smf_context.SessionEstablishSuccess
-			smContext.SubPfcpLog.Infof("PFCP Session Establishment accepted")
-		} else {
-			smContext.SBIPFCPCommunicationChan <- smf_context.SessionEstablishFailed
-			smContext.SubPfcpLog.Errorf("PFCP Session Establishment rejected with cause [%v]", rsp.Cause.CauseValue)
-			if rsp.Cause.CauseValue ==
-				pfcpType.CauseNoEstablishedPfcpAssociation {
-				SetUpfInactive(*rsp.NodeID, msg.PfcpMessage.Header.MessageType)
-			}
+	// UPF Accept
+	if rsp.Cause.CauseValue == pfcpType.CauseRequestAccepted {
+		smContext.SubPfcpLog.Infof("PFCP Session Establishment accepted")
+	} else {
+		smContext.SubPfcpLog.Errorf("PFCP Session Establishment rejected with cause [%v]", rsp.Cause.CauseValue)
+		if rsp.Cause.CauseValue ==
+			pfcpType.CauseNoEstablishedPfcpAssociation {
+			SetUpfInactive(*rsp.NodeID, msg.PfcpMessage.Header.MessageType)
 		}
 	}
 
+	//Deliver to SM context FSM, correlated by sequence number and SEID
+	smContext.PostPfcpRsp(&smf_context.PfcpRsp{
+		SeqNum:    msg.PfcpMessage.Header.SequenceNumber,
+		LocalSEID: SEID,
+		ReqType:   pfcp.PFCP_SESSION_ESTABLISHMENT_REQUEST,
+		Accepted:  rsp.Cause.CauseValue == pfcpType.CauseRequestAccepted,
+		Cause:     rsp.Cause.CauseValue,
+	})
+
 	if smf_context.SMF_Self().ULCLSupport && smContext.BPManager != nil {
 		if smContext.BPManager.BPStatus == smf_context.AddingPSA {
 			smContext.SubPfcpLog.Infoln("Keep Adding PSAndULCL")
@@ -295,6 +310,11 @@ func HandlePfcpSessionModificationResponse(msg *pfcpUdp.Message) {
 
 	logger.PfcpLog.Infoln("In HandlePfcpSessionModificationResponse")
 
+	if smContext == nil {
+		logger.PfcpLog.Warnf("PFCP Session Modification Response found SM context nil, response discarded")
+		return
+	}
+
 	if smf_context.SMF_Self().ULCLSupport && smContext.BPManager != nil {
 		if smContext.BPManager.BPStatus == smf_context.AddingPSA {
 			smContext.SubPfcpLog.Infoln("Keep Adding PSAAndULCL")
@@ -304,18 +324,10 @@ func HandlePfcpSessionModificationResponse(msg *pfcpUdp.Message) {
 		}
 	}
 
-	if pfcpRsp.Cause.CauseValue == pfcpType.CauseRequestAccepted {
+	accepted := pfcpRsp.Cause.CauseValue == pfcpType.CauseRequestAccepted
+	if accepted {
 		smContext.SubPduSessLog.Infoln("PFCP Modification Response Accept")
 		if smContext.SMContextState == smf_context.SmStatePfcpModify {
-			upfNodeID := smContext.GetNodeIDByLocalSEID(SEID)
-			upfIP := upfNodeID.ResolveNodeIdToIp().String()
-			delete(smContext.PendingUPF, upfIP)
-			smContext.SubPduSessLog.Tracef("Delete pending pfcp response: UPF IP [%s]\n", upfIP)
-
-			if smContext.PendingUPF.IsEmpty() {
-				smContext.SBIPFCPCommunicationChan <- smf_context.SessionUpdateSuccess
-			}
-
 			if smf_context.SMF_Self().ULCLSupport && smContext.BPManager != nil {
 				if smContext.BPManager.BPStatus == smf_context.UnInitialized {
 					smContext.SubPfcpLog.Infoln("Add PSAAndULCL")
@@ -329,11 +341,17 @@ func HandlePfcpSessionModificationResponse(msg *pfcpUdp.Message) {
 		smContext.SubPfcpLog.Infof("PFCP Session Modification Success[%d]\n", SEID)
 	} else {
 		smContext.SubPfcpLog.Infof("PFCP Session Modification Failed[%d]\n", SEID)
-		if smContext.SMContextState == smf_context.SmStatePfcpModify {
-			smContext.SBIPFCPCommunicationChan <- smf_context.SessionUpdateFailed
-		}
 	}
 
+	//Procedure completes once all UPFs have answered
+	smContext.PostPfcpRsp(&smf_context.PfcpRsp{
+		SeqNum:    msg.PfcpMessage.Header.SequenceNumber,
+		LocalSEID: SEID,
+		ReqType:   pfcp.PFCP_SESSION_MODIFICATION_REQUEST,
+		Accepted:  accepted,
+		Cause:     pfcpRsp.Cause.CauseValue,
+	})
+
 	smContext.SubCtxLog.Traceln("PFCP Session Context")
 	for _, ctx := range smContext.PFCPContext {
 		smContext.SubCtxLog.Traceln(ctx.String())
@@ -361,24 +379,21 @@ func HandlePfcpSessionDeletionResponse(msg *pfcpUdp.Message) {
 		// TODO fix: SEID should be the value sent by UPF but now the SEID value is from sm context
 	}
 
-	if pfcpRsp.Cause.CauseValue == pfcpType.CauseRequestAccepted {
-		if smContext.SMContextState == smf_context.SmStatePfcpRelease{
-			upfNodeID := smContext.GetNodeIDByLocalSEID(SEID)
-			upfIP := upfNodeID.ResolveNodeIdToIp().String()
-			delete(smContext.PendingUPF, upfIP)
-			smContext.SubPduSessLog.Tracef("Delete pending pfcp response: UPF IP [%s]\n", upfIP)
-
-			if smContext.PendingUPF.IsEmpty() && !smContext.LocalPurged {
-				smContext.SBIPFCPCommunicationChan <- smf_context.SessionReleaseSuccess
-			}
-		}
+	accepted := pfcpRsp.Cause.CauseValue == pfcpType.CauseRequestAccepted
+	if accepted {
 		smContext.SubPfcpLog.Infof("PFCP Session Deletion Success[%d]\n", SEID)
 	} else {
-		if smContext.SMContextState == smf_context.SmStatePfcpRelease&& !smContext.LocalPurged {
-			smContext.SBIPFCPCommunicationChan <- smf_context.SessionReleaseSuccess
-		}
 		smContext.SubPfcpLog.Infof("PFCP Session Deletion Failed[%d]\n", SEID)
 	}
+
+	//Procedure completes once all UPFs have answered
+	smContext.PostPfcpRsp(&smf_context.PfcpRsp{
+		SeqNum:    msg.PfcpMessage.Header.SequenceNumber,
+		LocalSEID: SEID,
+		ReqType:   pfcp.PFCP_SESSION_DELETION_REQUEST,
+		Accepted:  accepted,
+		Cause:     pfcpRsp.Cause.CauseValue,
+	})
 }
 
 func HandlePfcpSessionReportRequest(msg *pfcpUdp.Message) {
@@ -405,6 +420,16 @@ func HandlePfcpSessionReportRequest(msg *pfcpUdp.Message) {
 	smContext.SMLock.Lock()
 	defer smContext.SMLock.Unlock()
 
+	//Usage report, answered here unless downlink data report below answers it.
+	//PCF is reported to once UPF has been answered
+	if req.ReportType.Usar && req.UsageReport != nil {
+		defer producer.HandleUsageReport(smContext, req.UsageReport)
+		if !(req.ReportType.Dldr && smContext.UpCnxState == models.UpCnxState_DEACTIVATED) {
+			cause.CauseValue = pfcpType.CauseRequestAccepted
+			pfcp_message.SendPfcpSessionReportResponse(msg.RemoteAddr, cause, pfcpSRflag, seqFromUPF, SEID)
+		}
+	}
+
 	if smContext.UpCnxState == models.UpCnxState_DEACTIVATED {
 		if req.ReportType.Dldr {
 			downlinkDataReport := req.DownlinkDataReport
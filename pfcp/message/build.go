@@ -117,6 +117,12 @@ func pdrToCreatePDR(pdr *context.PDR) *pfcp.CreatePDR {
 		}
 	}
 
+	if pdr.URR != nil {
+		createPDR.URRID = append(createPDR.URRID, &pfcpType.URRID{
+			UrrIdValue: pdr.URR.URRID,
+		})
+	}
+
 	return createPDR
 }
 
@@ -182,6 +188,32 @@ func qerToCreateQER(qer *context.QER) *pfcp.CreateQER {
 	return createQER
 }
 
+func urrToCreateURR(urr *context.URR) *pfcp.CreateURR {
+	createURR := new(pfcp.CreateURR)
+
+	createURR.URRID = new(pfcpType.URRID)
+	createURR.URRID.UrrIdValue = urr.URRID
+
+	createURR.MeasurementMethod = &urr.MeasurementMethod
+	createURR.ReportingTriggers = &urr.ReportingTriggers
+	createURR.VolumeThreshold = urr.VolumeThreshold
+	createURR.TimeThreshold = urr.TimeThreshold
+
+	return createURR
+}
+
+//createURRs are Create URR IEs of new URRs of PDRs, URR shared by PDRs is created once
+func createURRs(pdrList []*context.PDR) []*pfcp.CreateURR {
+	var createURR []*pfcp.CreateURR
+	for _, pdr := range pdrList {
+		if urr := pdr.URR; urr != nil && urr.State == context.RULE_INITIAL {
+			createURR = append(createURR, urrToCreateURR(urr))
+			urr.State = context.RULE_CREATE
+		}
+	}
+	return createURR
+}
+
 func pdrToUpdatePDR(pdr *context.PDR) *pfcp.UpdatePDR {
 	updatePDR := new(pfcp.UpdatePDR)
 
@@ -292,6 +324,8 @@ func BuildPfcpSessionEstablishmentRequest(
 	msg.CreatePDR = make([]*pfcp.CreatePDR, 0)
 	msg.CreateFAR = make([]*pfcp.CreateFAR, 0)
 
+	msg.CreateURR = createURRs(pdrList)
+
 	for _, pdr := range pdrList {
 		if pdr.State == context.RULE_INITIAL {
 			msg.CreatePDR = append(msg.CreatePDR, pdrToCreatePDR(pdr))
@@ -398,6 +432,8 @@ func BuildPfcpSessionModificationRequest(
 		Ipv4Address: context.SMF_Self().CPNodeID.NodeIdValue,
 	}
 
+	msg.CreateURR = createURRs(pdrList)
+
 	for _, pdr := range pdrList {
 		switch pdr.State {
 		case context.RULE_INITIAL:
@@ -6,14 +6,11 @@
 package message
 
 import (
-	"context"
 	"net"
 	"sync"
 
 	"sync/atomic"
 
-	"github.com/free5gc/nas/nasMessage"
-	"github.com/free5gc/openapi/models"
 	"github.com/free5gc/pfcp"
 	"github.com/free5gc/pfcp/pfcpType"
 	"github.com/free5gc/pfcp/pfcpUdp"
@@ -211,6 +208,7 @@ func SendPfcpSessionEstablishmentRequest(
 	}
 
 	ip := upNodeID.ResolveNodeIdToIp()
+	seqNum := getSeqNumber()
 
 	message := pfcp.Message{
 		Header: pfcp.Header{
@@ -219,7 +217,7 @@ func SendPfcpSessionEstablishmentRequest(
 			S:               pfcp.SEID_PRESENT,
 			MessageType:     pfcp.PFCP_SESSION_ESTABLISHMENT_REQUEST,
 			SEID:            0,
-			SequenceNumber:  getSeqNumber(),
+			SequenceNumber:  seqNum,
 			MessagePriority: 0,
 		},
 		Body: pfcpMsg,
@@ -232,7 +230,10 @@ func SendPfcpSessionEstablishmentRequest(
 	ctx.SubPduSessLog.Traceln("[SMF] Send SendPfcpSessionEstablishmentRequest")
 	ctx.SubPduSessLog.Traceln("Send to addr ", upaddr.String())
 
-	eventData := pfcpUdp.PfcpEventData{LSEID: ctx.PFCPContext[ip.String()].LocalSEID, ErrHandler: HandlePfcpSendError}
+	lseid := ctx.PFCPContext[ip.String()].LocalSEID
+	ctx.AddPendingPfcpReq(seqNum, ip.String(), pfcp.PFCP_SESSION_ESTABLISHMENT_REQUEST, lseid)
+
+	eventData := pfcpUdp.PfcpEventData{LSEID: lseid, ErrHandler: HandlePfcpSendError}
 	udp.SendPfcp(message, upaddr, eventData)
 	ctx.SubPfcpLog.Infof("Sent PFCP Session Establish Request to NodeID[%s]", ip.String())
 }
@@ -291,7 +292,10 @@ func SendPfcpSessionModificationRequest(upNodeID pfcpType.NodeID,
 		Port: pfcpUdp.PFCP_PORT,
 	}
 
-	eventData := pfcpUdp.PfcpEventData{LSEID: ctx.PFCPContext[nodeIDtoIP].LocalSEID, ErrHandler: HandlePfcpSendError}
+	lseid := ctx.PFCPContext[nodeIDtoIP].LocalSEID
+	ctx.AddPendingPfcpReq(seqNum, nodeIDtoIP, pfcp.PFCP_SESSION_MODIFICATION_REQUEST, lseid)
+
+	eventData := pfcpUdp.PfcpEventData{LSEID: lseid, ErrHandler: HandlePfcpSendError}
 
 	udp.SendPfcp(message, upaddr, eventData)
 	ctx.SubPfcpLog.Infof("Sent PFCP Session Modify Request to NodeID[%s]", upNodeID.ResolveNodeIdToIp().String())
@@ -349,7 +353,10 @@ func SendPfcpSessionDeletionRequest(upNodeID pfcpType.NodeID, ctx *smf_context.S
 		Port: pfcpUdp.PFCP_PORT,
 	}
 
-	eventData := pfcpUdp.PfcpEventData{LSEID: ctx.PFCPContext[nodeIDtoIP].LocalSEID, ErrHandler: HandlePfcpSendError}
+	lseid := ctx.PFCPContext[nodeIDtoIP].LocalSEID
+	ctx.AddPendingPfcpReq(seqNum, nodeIDtoIP, pfcp.PFCP_SESSION_DELETION_REQUEST, lseid)
+
+	eventData := pfcpUdp.PfcpEventData{LSEID: lseid, ErrHandler: HandlePfcpSendError}
 
 	udp.SendPfcp(message, upaddr, eventData)
 
@@ -455,44 +462,19 @@ func handleSendPfcpSessEstReqError(msg *pfcp.Message, pfcpErr error) {
 
 	SEID := pfcpEstReq.CPFSEID.Seid
 	smContext := smf_context.GetSMContextBySEID(SEID)
-	smContext.SubPfcpLog.Errorf("PFCP Session Establishment send failure, %v", pfcpErr.Error())
-	//N1N2 Request towards AMF
-	n1n2Request := models.N1N2MessageTransferRequest{}
-
-	//N1 Container Info
-	n1MsgContainer := models.N1MessageContainer{
-		N1MessageClass:   "SM",
-		N1MessageContent: &models.RefToBinaryData{ContentId: "GSM_NAS"},
-	}
-
-	//N1N2 Json Data
-	n1n2Request.JsonData = &models.N1N2MessageTransferReqData{PduSessionId: smContext.PDUSessionID}
-
-	if smNasBuf, err := smf_context.BuildGSMPDUSessionEstablishmentReject(smContext,
-		nasMessage.Cause5GSMRequestRejectedUnspecified); err != nil {
-		smContext.SubPduSessLog.Errorf("Build GSM PDUSessionEstablishmentReject failed: %s", err)
-	} else {
-		n1n2Request.BinaryDataN1Message = smNasBuf
-		n1n2Request.JsonData.N1MessageContainer = &n1MsgContainer
-	}
-
-	//Send N1N2 Reject request
-	rspData, _, err := smContext.
-		CommunicationClient.
-		N1N2MessageCollectionDocumentApi.
-		N1N2MessageTransfer(context.Background(), smContext.Supi, n1n2Request)
-	smContext.ChangeState(smf_context.SmStateInit)
-	smContext.SubCtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
-	if err != nil {
-		smContext.SubPfcpLog.Warnf("Send N1N2Transfer failed")
-	}
-	if rspData.Cause == models.N1N2MessageTransferCause_N1_MSG_NOT_TRANSFERRED {
-		smContext.SubPfcpLog.Warnf("%v", rspData.Cause)
+	if smContext == nil {
+		logger.PfcpLog.Errorf("PFCP Session Establishment send failure, SM context not found for SEID[%v]", SEID)
+		return
 	}
-	smContext.SubPfcpLog.Errorf("PFCP send N1N2Transfer Reject initiated for id[%v], pduSessId[%v]", smContext.Identifier, smContext.PDUSessionID)
+	smContext.SubPfcpLog.Errorf("PFCP Session Establishment send failure, %v", pfcpErr.Error())
 
-	//clear subscriber
-	smf_context.RemoveSMContext(smContext.Ref)
+	//Deliver as failure response, procedure fails once all UPFs have answered
+	smContext.PostPfcpRsp(&smf_context.PfcpRsp{
+		SeqNum:    msg.Header.SequenceNumber,
+		LocalSEID: SEID,
+		ReqType:   pfcp.PFCP_SESSION_ESTABLISHMENT_REQUEST,
+		Timeout:   true,
+	})
 }
 
 func handleSendPfcpSessRelReqError(msg *pfcp.Message, pfcpErr error) {
@@ -503,8 +485,12 @@ func handleSendPfcpSessRelReqError(msg *pfcp.Message, pfcpErr error) {
 	smContext := smf_context.GetSMContextBySEID(SEID)
 	if smContext != nil {
 		smContext.SubPfcpLog.Errorf("PFCP Session Delete send failure, %v", pfcpErr.Error())
-		//Always send success
-		smContext.SBIPFCPCommunicationChan <- smf_context.SessionReleaseSuccess
+		smContext.PostPfcpRsp(&smf_context.PfcpRsp{
+			SeqNum:    msg.Header.SequenceNumber,
+			LocalSEID: SEID,
+			ReqType:   pfcp.PFCP_SESSION_DELETION_REQUEST,
+			Timeout:   true,
+		})
 	}
 }
 
@@ -514,7 +500,16 @@ func handleSendPfcpSessModReqError(msg *pfcp.Message, pfcpErr error) {
 
 	SEID := pfcpModReq.CPFSEID.Seid
 	smContext := smf_context.GetSMContextBySEID(SEID)
+	if smContext == nil {
+		logger.PfcpLog.Errorf("PFCP Session Modification send failure, SM context not found for SEID[%v]", SEID)
+		return
+	}
 	smContext.SubPfcpLog.Errorf("PFCP Session Modification send failure, %v", pfcpErr.Error())
 
-	smContext.SBIPFCPCommunicationChan <- smf_context.SessionUpdateTimeout
+	smContext.PostPfcpRsp(&smf_context.PfcpRsp{
+		SeqNum:    msg.Header.SequenceNumber,
+		LocalSEID: SEID,
+		ReqType:   pfcp.PFCP_SESSION_MODIFICATION_REQUEST,
+		Timeout:   true,
+	})
 }
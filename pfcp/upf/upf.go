@@ -8,6 +8,7 @@ package upf
 import (
 	"time"
 
+	"github.com/free5gc/nas/nasMessage"
 	"github.com/free5gc/pfcp"
 	"github.com/free5gc/smf/context"
 	"github.com/free5gc/smf/logger"
@@ -27,6 +28,7 @@ func InitPfcpHeartbeatRequest(userplane *context.UserPlaneInformation) {
 	for {
 		time.Sleep(maxHeartbeatInterval * time.Second)
 		for _, upf := range userplane.UPFs {
+			failed := false
 			upf.UPF.UpfLock.Lock()
 			if (upf.UPF.UPFStatus == context.AssociatedSetUpSuccess) && upf.UPF.NHeartBeat < maxHeartbeatRetry {
 				err := message.SendHeartbeatRequest(upf.NodeID)
@@ -37,9 +39,16 @@ func InitPfcpHeartbeatRequest(userplane *context.UserPlaneInformation) {
 				}
 			} else if upf.UPF.NHeartBeat == maxHeartbeatRetry {
 				metrics.IncrementN4MsgStats(context.SMF_Self().NfInstanceID, pfcpmsgtypes.PfcpMsgTypeString(pfcp.PFCP_HEARTBEAT_REQUEST), "Out", "Failure", "Timeout")
+				failed = upf.UPF.UPFStatus == context.AssociatedSetUpSuccess
 				upf.UPF.UPFStatus = context.NotAssociated
 			}
 			upf.UPF.UpfLock.Unlock()
+
+			//UPF not answering, UE may reactivate its PDU sessions
+			if failed {
+				released := context.RequestNwReleaseOfUpfSessions(upf.NodeID, nasMessage.Cause5GSMReactivationRequested)
+				logger.PfcpLog.Warnf("upf [%v] not answering heartbeat, releasing [%v] PDU sessions", upf.NodeID, released)
+			}
 		}
 	}
 }
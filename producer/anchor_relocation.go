@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"github.com/free5gc/nas"
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/openapi/models"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/transaction"
+)
+
+//HandleAnchorRelocation asks UE of SSC mode 3 session to move to anchor UPF serving DNAI of its location
+//(TS 23.502 4.3.5.2): PDU Session Modification Command with cause #39 and PDU session address
+//lifetime, UE sets up new PDU session to DNN and this one is released once lifetime expires
+func HandleAnchorRelocation(eventData interface{}) error {
+	txn := eventData.(*transaction.Transaction)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+
+	//UE moved on meanwhile
+	dnai := smContext.AnchorRelocationTarget()
+	if dnai == "" {
+		return nil
+	}
+	//Tried again on next location change
+	if smContext.IsNwModificationPending() || smContext.IsNwReleaseInProgress() || smContext.IsAwaitingPfcpRsp() {
+		smContext.SubPduSessLog.Infof("anchor UPF relocation to DNAI[%s] deferred, procedure in progress", dnai)
+		return nil
+	}
+
+	var relocation *smf_context.AnchorRelocation
+	relocation = smContext.StartAnchorRelocation(dnai, func() {
+		smContext.SMLock.Lock()
+		expired := smContext.AnchorRelocation == relocation
+		smContext.SMLock.Unlock()
+		if expired {
+			smContext.SubPduSessLog.Infof("PDU session address lifetime expired, releasing PDU session of old anchor UPF")
+			smf_context.RequestNwRelease(smContext, nasMessage.Cause5GSMRegularDeactivation)
+		}
+	})
+
+	//Network initiated, AN resources are left as they are
+	smContext.Pti = 0
+	if _, err := sendPduSessModificationN1N2Transfer(smContext, false); err != nil {
+		smContext.SubPduSessLog.Errorf("anchor UPF relocation, %v", err)
+		smContext.StopAnchorRelocation()
+		return err
+	}
+	startT3591(smContext, smContext.NewGsmProcedure(0, 0, nas.MsgTypePDUSessionModificationCommand, nil))
+	return nil
+}
+
+//notifyAnchorRelocated reports UE IP address of new PDU session to subscribers of SSC mode 3
+//session UE set it up to replace, caller holds lock of new SM context
+func notifyAnchorRelocated(smContext *smf_context.SMContext) {
+	if smContext.OldPduSessionId == 0 {
+		return
+	}
+	ref, err := smf_context.ResolveRef(smContext.Identifier, smContext.OldPduSessionId)
+	if err != nil {
+		return
+	}
+	oldSmContext := smf_context.GetSMContext(ref)
+	if oldSmContext == nil {
+		return
+	}
+
+	oldSmContext.SMLock.Lock()
+	defer oldSmContext.SMLock.Unlock()
+	if oldSmContext.AnchorRelocation == nil {
+		return
+	}
+	smContext.SubPduSessLog.Infof("PDU session replaces PDU session[%d] of old anchor UPF", smContext.OldPduSessionId)
+	NotifySmfEvent(oldSmContext, models.SmfEvent_UE_IP_CH, models.EventNotification{
+		SourceUeIpv4Addr: oldSmContext.PDUAddress.String(),
+		TargetUeIpv4Addr: smContext.PDUAddress.String(),
+	})
+}
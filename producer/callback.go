@@ -5,15 +5,13 @@
 package producer
 
 import (
-	"context"
-	"fmt"
 	"net/http"
 
 	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/nas/nasMessage"
 	"github.com/free5gc/openapi/models"
 	smf_context "github.com/free5gc/smf/context"
 	"github.com/free5gc/smf/logger"
-	"github.com/free5gc/smf/qos"
 	"github.com/free5gc/smf/transaction"
 )
 
@@ -22,107 +20,61 @@ func HandleSMPolicyUpdateNotify(eventData interface{}) error {
 	request := txn.Req.(models.SmPolicyNotification)
 	smContext := txn.Ctxt.(*smf_context.SMContext)
 
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+
 	logger.PduSessLog.Infoln("In HandleSMPolicyUpdateNotify")
 	pcfPolicyDecision := request.SmPolicyDecision
 
-	if smContext.SMContextState != smf_context.SmStateActive {
-		// Wait till the state becomes SmStateActive again
-		// TODO: implement waiting in concurrent architecture
-		logger.PduSessLog.Warnf("SMContext[%s-%02d] should be SmStateActive, but actual %s",
-			smContext.Supi, smContext.PDUSessionID, smContext.SMContextState.String())
-	}
-
 	//TODO: Response data type -
 	//[200 OK] UeCampingRep
 	//[200 OK] array(PartialSuccessReport)
 	//[400 Bad Request] ErrorReport
 
-	//Derive QoS change(compare existing vs received Policy Decision)
-	policyUpdates := qos.BuildSmPolicyUpdate(&smContext.SmPolicyData, pcfPolicyDecision)
-	smContext.SmPolicyUpdates = append(smContext.SmPolicyUpdates, policyUpdates)
-
-	//Update UPF
-	//TODO
-
 	httpResponse := http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
 	txn.Rsp = httpResponse
 
-	//Form N1/N2 Msg based on QoS Change and Trigger N1/N2 Msg
-	if err := BuildAndSendQosN1N2TransferMsg(smContext); err != nil {
-		//smContext.CommitSmPolicyDecision(false)
+	//Committed to SM context on PDU Session Modification Complete
+	if err := applySmPolicyDecision(smContext, pcfPolicyDecision); err != nil {
 		//Send error rsp to PCF
 		httpResponse.Status = http.StatusBadRequest
 		txn.Err = err
 		return err
 	}
-
-	//N1N2 and UPF update Success
-	//Commit SM Policy Decision to SM Context
-	//TODO
-	//smContext.SMLock.Lock()
-	//defer smContext.SMLock.Unlock()
-	//smContext.CommitSmPolicyDecision(true)
 	return nil
 }
 
-func BuildAndSendQosN1N2TransferMsg(smContext *smf_context.SMContext) error {
-	//N1N2 Request towards AMF
-	n1n2Request := models.N1N2MessageTransferRequest{}
-
-	//N2 Container Info
-	n2InfoContainer := models.N2InfoContainer{
-		N2InformationClass: models.N2InformationClass_SM,
-		SmInfo: &models.N2SmInformation{
-			PduSessionId: smContext.PDUSessionID,
-			N2InfoContent: &models.N2InfoContent{
-				NgapIeType: models.NgapIeType_PDU_RES_SETUP_REQ,
-				NgapData: &models.RefToBinaryData{
-					ContentId: "N2SmInformation",
-				},
-			},
-			SNssai: smContext.Snssai,
-		},
-	}
+//HandleSMPolicyTerminateNotify releases PDU session whose SM policy association PCF terminates,
+//network requested release follows once PCF has the answer to its notification and deletes
+//policy association with SM context
+func HandleSMPolicyTerminateNotify(eventData interface{}) error {
+	txn := eventData.(*transaction.Transaction)
+	request := txn.Req.(models.TerminationNotification)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
 
-	//N1 Container Info
-	n1MsgContainer := models.N1MessageContainer{
-		N1MessageClass:   "SM",
-		N1MessageContent: &models.RefToBinaryData{ContentId: "GSM_NAS"},
-	}
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
 
-	//N1N2 Json Data
-	n1n2Request.JsonData = &models.N1N2MessageTransferReqData{PduSessionId: smContext.PDUSessionID}
+	smContext.SubPduSessLog.Infof("SM policy termination notification, cause [%v]", request.Cause)
+	txn.Rsp = http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
 
-	//N1 Msg
-	if smNasBuf, err := smf_context.BuildGSMPDUSessionModificationCommand(smContext); err != nil {
-		logger.PduSessLog.Errorf("Build GSM BuildGSMPDUSessionModificationCommand failed: %s", err)
-	} else {
-		n1n2Request.BinaryDataN1Message = smNasBuf
-		n1n2Request.JsonData.N1MessageContainer = &n1MsgContainer
+	//Release already underway, it deletes policy association
+	if smContext.SMContextState != smf_context.SmStateActive {
+		smContext.SubPduSessLog.Infof("SM policy termination notification, PDU session release in progress, state [%v]",
+			smContext.SMContextState.String())
+		return nil
 	}
 
-	//N2 Msg
-	n2Pdu, err := smf_context.BuildPDUSessionResourceModifyRequestTransfer(smContext)
-	if err != nil {
-		smContext.SubPduSessLog.Errorf("SMPolicyUpdate, build PDUSession Resource Modify Request Transfer Error(%s)", err.Error())
-	} else {
-		n1n2Request.BinaryDataN2Information = n2Pdu
-		n1n2Request.JsonData.N2InfoContainer = &n2InfoContainer
-	}
+	smf_context.RequestNwRelease(smContext, smPolicyReleaseCauseTo5gSm(request.Cause))
+	return nil
+}
 
-	smContext.SubPduSessLog.Infof("QoS N1N2 transfer initiated")
-	rspData, _, err := smContext.
-		CommunicationClient.
-		N1N2MessageCollectionDocumentApi.
-		N1N2MessageTransfer(context.Background(), smContext.Supi, n1n2Request)
-	if err != nil {
-		smContext.SubPfcpLog.Warnf("Send N1N2Transfer failed, %v ", err.Error())
-		return err
+//smPolicyReleaseCauseTo5gSm maps PCF release cause to 5GSM cause of PDU Session Release Command
+func smPolicyReleaseCauseTo5gSm(cause models.PolicyAssociationReleaseCause) uint8 {
+	switch cause {
+	case models.PolicyAssociationReleaseCause_INSUFFICIENT_RES:
+		return nasMessage.Cause5GSMInsufficientResources
+	default:
+		return nasMessage.Cause5GSMRegularDeactivation
 	}
-	if rspData.Cause == models.N1N2MessageTransferCause_N1_MSG_NOT_TRANSFERRED {
-		smContext.SubPfcpLog.Errorf("N1N2MessageTransfer failure, %v", rspData.Cause)
-		return fmt.Errorf("N1N2MessageTransfer failure, %v", rspData.Cause)
-	}
-	smContext.SubPduSessLog.Infof("QoS N1N2 Transfer completed")
-	return nil
 }
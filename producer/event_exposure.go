@@ -0,0 +1,211 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/consumer"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/logger"
+)
+
+func eeProblemRsp(status int, cause, detail string) *http_wrapper.Response {
+	return &http_wrapper.Response{
+		Status: status,
+		Body: models.ProblemDetails{
+			Title:  http.StatusText(status),
+			Status: int32(status),
+			Cause:  cause,
+			Detail: detail,
+		},
+	}
+}
+
+func HandleSMFEventExposureSubscriptionsPost(request models.NsmfEventExposure) *http_wrapper.Response {
+	if err := smf_context.ValidateEventExposure(&request); err != nil {
+		logger.CtxLog.Warnf("event exposure subscription rejected, %v", err)
+		return eeProblemRsp(http.StatusBadRequest, "MANDATORY_IE_INCORRECT", err.Error())
+	}
+
+	subId := smf_context.NewEESubscription(request)
+	request.SubId = subId
+	logger.CtxLog.Infof("event exposure subscription [%v] created, notifUri [%v]", subId, request.NotifUri)
+
+	self := smf_context.SMF_Self()
+	location := fmt.Sprintf("%s://%s:%d/nsmf_event-exposure/v1/subscriptions/%s",
+		self.URIScheme, self.RegisterIPv4, self.SBIPort, subId)
+	return &http_wrapper.Response{
+		Header: http.Header{"Location": {location}},
+		Status: http.StatusCreated,
+		Body:   request,
+	}
+}
+
+func HandleSMFEventExposureSubscriptionGet(subId string) *http_wrapper.Response {
+	sub, ok := smf_context.GetEESubscription(subId)
+	if !ok {
+		return eeProblemRsp(http.StatusNotFound, "SUBSCRIPTION_NOT_FOUND", "")
+	}
+	return &http_wrapper.Response{
+		Status: http.StatusOK,
+		Body:   sub,
+	}
+}
+
+func HandleSMFEventExposureSubscriptionPut(subId string, request models.NsmfEventExposure) *http_wrapper.Response {
+	if request.SubId != "" && request.SubId != subId {
+		return eeProblemRsp(http.StatusBadRequest, "MANDATORY_IE_INCORRECT", "subId mismatch")
+	}
+	if err := smf_context.ValidateEventExposure(&request); err != nil {
+		logger.CtxLog.Warnf("event exposure subscription [%v] update rejected, %v", subId, err)
+		return eeProblemRsp(http.StatusBadRequest, "MANDATORY_IE_INCORRECT", err.Error())
+	}
+	if !smf_context.UpdateEESubscription(subId, request) {
+		return eeProblemRsp(http.StatusNotFound, "SUBSCRIPTION_NOT_FOUND", "")
+	}
+
+	logger.CtxLog.Infof("event exposure subscription [%v] updated", subId)
+	request.SubId = subId
+	return &http_wrapper.Response{
+		Status: http.StatusOK,
+		Body:   request,
+	}
+}
+
+func HandleSMFEventExposureSubscriptionDelete(subId string) *http_wrapper.Response {
+	if !smf_context.RemoveEESubscription(subId) {
+		return eeProblemRsp(http.StatusNotFound, "SUBSCRIPTION_NOT_FOUND", "")
+	}
+	logger.CtxLog.Infof("event exposure subscription [%v] deleted", subId)
+	return http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+}
+
+//NotifySmfEvent sends event notification to all matching subscribers of SM context event,
+//notifications are sent asynchronously so that SM context procedures are not held up
+func NotifySmfEvent(smContext *smf_context.SMContext, event models.SmfEvent, eventNotif models.EventNotification) {
+	subs := smContext.EESubscriptionsForEvent(event)
+	if len(subs) == 0 {
+		return
+	}
+
+	now := time.Now()
+	eventNotif.Event = event
+	eventNotif.TimeStamp = &now
+	eventNotif.Supi = smContext.Supi
+	eventNotif.Gpsi = smContext.Gpsi
+	eventNotif.PduSeId = smContext.PDUSessionID
+
+	for _, sub := range subs {
+		notification := models.NsmfEventExposureNotification{
+			NotifId:     sub.NotifId,
+			EventNotifs: []models.EventNotification{eventNotif},
+		}
+		smContext.SubPduSessLog.Infof("event [%v] notification to subscription [%v]", event, sub.SubId)
+		go func(uri string) {
+			if err := consumer.SendSmfEventExposureNotification(uri, notification); err != nil {
+				smContext.SubPduSessLog.Warnf("event [%v] notification failed, %v", event, err)
+			}
+		}(sub.NotifUri)
+	}
+}
+
+//NotifyUeIpChange reports UE IP address change of PDU session
+func NotifyUeIpChange(smContext *smf_context.SMContext, oldIp, newIp net.IP) {
+	eventNotif := models.EventNotification{}
+	if oldIp != nil {
+		eventNotif.SourceUeIpv4Addr = oldIp.String()
+	}
+	if newIp != nil {
+		eventNotif.TargetUeIpv4Addr = newIp.String()
+	}
+	NotifySmfEvent(smContext, models.SmfEvent_UE_IP_CH, eventNotif)
+
+	updateData := models.SmPolicyUpdateContextData{
+		RepPolicyCtrlReqTriggers: []models.PolicyControlRequestTrigger{models.PolicyControlRequestTrigger_UE_IP_CH},
+	}
+	if oldIp != nil {
+		updateData.RelIpv4Address = oldIp.String()
+	}
+	reportPolicyCtrlReqTriggers(smContext, updateData)
+}
+
+//updateUeAccessInfo records PLMN, access type, RAT and location change reported by AMF
+func updateUeAccessInfo(smContext *smf_context.SMContext, updateData *models.SmContextUpdateData) {
+	if updateData == nil {
+		return
+	}
+	triggers := make([]models.PolicyControlRequestTrigger, 0)
+	ladnPresence := smContext.LadnPresence()
+
+	if plmn := updateData.ServingNetwork; plmn != nil && smContext.ServingNetwork != nil &&
+		(plmn.Mcc != smContext.ServingNetwork.Mcc || plmn.Mnc != smContext.ServingNetwork.Mnc) {
+		smContext.SubPduSessLog.Infof("serving network changed [%v] -> [%v]", *smContext.ServingNetwork, *plmn)
+		smContext.ServingNetwork = plmn
+		NotifySmfEvent(smContext, models.SmfEvent_PLMN_CH, models.EventNotification{PlmnId: plmn})
+		triggers = append(triggers, models.PolicyControlRequestTrigger_PLMN_CH)
+	}
+
+	if updateData.AnType != "" && updateData.AnType != smContext.AnType {
+		smContext.SubPduSessLog.Infof("access type changed [%v] -> [%v]", smContext.AnType, updateData.AnType)
+		smContext.AnType = updateData.AnType
+		NotifySmfEvent(smContext, models.SmfEvent_AC_TY_CH, models.EventNotification{AccType: updateData.AnType})
+		triggers = append(triggers, models.PolicyControlRequestTrigger_AC_TY_CH)
+	}
+
+	if updateData.RatType != "" && updateData.RatType != smContext.RatType {
+		smContext.SubPduSessLog.Infof("RAT type changed [%v] -> [%v]", smContext.RatType, updateData.RatType)
+		smContext.RatType = updateData.RatType
+		triggers = append(triggers, models.PolicyControlRequestTrigger_RAT_TY_CH)
+	}
+
+	if updateData.UeLocation != nil {
+		if !reflect.DeepEqual(ueLocationTai(updateData.UeLocation), ueLocationTai(smContext.UeLocation)) {
+			triggers = append(triggers, models.PolicyControlRequestTrigger_SAREA_CH)
+		}
+		smContext.UeLocation = updateData.UeLocation
+
+		//Run once Update SM Context is answered
+		if smContext.AnchorRelocationTarget() != "" {
+			smf_context.RequestAnchorRelocation(smContext)
+		}
+	}
+
+	if updateData.PresenceInLadn != "" {
+		smContext.PresenceInLadn = updateData.PresenceInLadn
+	}
+	//Run once Update SM Context is answered
+	if smContext.IsLadn() && smContext.LadnPresence() != ladnPresence {
+		smf_context.RequestLadnPresenceChange(smContext)
+	}
+
+	if updateData.UeTimeZone != "" && updateData.UeTimeZone != smContext.UeTimeZone {
+		smContext.UeTimeZone = updateData.UeTimeZone
+		triggers = append(triggers, models.PolicyControlRequestTrigger_UE_TZ_CH)
+	}
+
+	if len(triggers) > 0 {
+		reportPolicyCtrlReqTriggers(smContext, models.SmPolicyUpdateContextData{RepPolicyCtrlReqTriggers: triggers})
+	}
+}
+
+//ueLocationTai is tracking area UE is located in, if known
+func ueLocationTai(ueLocation *models.UserLocation) *models.Tai {
+	switch {
+	case ueLocation == nil:
+		return nil
+	case ueLocation.NrLocation != nil:
+		return ueLocation.NrLocation.Tai
+	case ueLocation.EutraLocation != nil:
+		return ueLocation.EutraLocation.Tai
+	}
+	return nil
+}
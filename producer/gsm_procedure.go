@@ -0,0 +1,34 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"github.com/free5gc/nas"
+	"github.com/free5gc/openapi/models"
+	smf_context "github.com/free5gc/smf/context"
+)
+
+//Content id of N1 SM message answering UE request, by message type
+var gsmRspContentId = map[uint8]string{
+	nas.MsgTypePDUSessionModificationCommand: "PDUSessionModificationCommand",
+	nas.MsgTypePDUSessionModificationReject:  "PDUSessionModificationReject",
+	nas.MsgTypePDUSessionReleaseCommand:      "PDUSessionReleaseCommand",
+}
+
+//resendGsmResponse answers retransmitted UE request with network message its procedure already
+//sent(TS 24.501 6.4.2, 6.4.3), false if request isn't a duplicate. Caller holds SM context lock
+func resendGsmResponse(smContext *smf_context.SMContext, msgType, pti uint8,
+	response *models.UpdateSmContextResponse) bool {
+	procedure := smContext.GsmProcedure(pti)
+	if procedure == nil || procedure.ReqMsgType != msgType || procedure.RspN1SmMsg == nil {
+		return false
+	}
+
+	smContext.SubPduSessLog.Infof("duplicate N1 Msg type [%v] PTI [%v], procedure [%v], network message resent",
+		msgType, pti, procedure.State.String())
+	response.BinaryDataN1SmMessage = procedure.RspN1SmMsg
+	response.JsonData.N1SmMsg = &models.RefToBinaryData{ContentId: gsmRspContentId[procedure.RspMsgType]}
+	return true
+}
@@ -0,0 +1,176 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"strconv"
+
+	"github.com/free5gc/nas"
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/openapi/models"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/metrics"
+)
+
+//PTI values UE can't assign to procedure it initiates(TS 24.007 11.2.3.1a)
+const (
+	ptiNoProcedure uint8 = 0x00
+	ptiReserved    uint8 = 0xff
+)
+
+//gsmMessagePti is PTI in header of 5GSM message, octet 3 after EPD and PDU session id
+func gsmMessagePti(buf []byte) uint8 {
+	if len(buf) < 3 {
+		return ptiNoProcedure
+	}
+	return buf[2]
+}
+
+//gsmHeaderLength is length of 5GSM message header, EPD, PDU session id, PTI and message type
+const gsmHeaderLength = 4
+
+//gsmMandatoryIeLength is least length of mandatory IEs after header of messages UE sends
+//(TS 24.501 8.3), length octets only for LV-E
+var gsmMandatoryIeLength = map[uint8]int{
+	nas.MsgTypePDUSessionEstablishmentRequest:      2,
+	nas.MsgTypePDUSessionAuthenticationComplete:    2,
+	nas.MsgTypePDUSessionModificationRequest:       0,
+	nas.MsgTypePDUSessionModificationComplete:      0,
+	nas.MsgTypePDUSessionModificationCommandReject: 1,
+	nas.MsgTypePDUSessionReleaseRequest:            0,
+	nas.MsgTypePDUSessionReleaseComplete:           0,
+	nas.MsgTypeStatus5GSM:                          1,
+}
+
+//checkGsmMessageFormat returns 5GSM cause of 5GSM STATUS answering message which can't be
+//decoded, by message type in header, 0 if format is fine(TS 24.501 7.4, 7.5)
+func checkGsmMessageFormat(buf []byte) uint8 {
+	msgType := buf[gsmHeaderLength-1]
+	switch msgType {
+	case nas.MsgTypePDUSessionEstablishmentAccept,
+		nas.MsgTypePDUSessionEstablishmentReject,
+		nas.MsgTypePDUSessionAuthenticationCommand,
+		nas.MsgTypePDUSessionAuthenticationResult,
+		nas.MsgTypePDUSessionModificationReject,
+		nas.MsgTypePDUSessionModificationCommand,
+		nas.MsgTypePDUSessionReleaseReject,
+		nas.MsgTypePDUSessionReleaseCommand:
+		//Network to UE messages, refused once decoded
+		return 0
+	}
+
+	ieLength, ok := gsmMandatoryIeLength[msgType]
+	if !ok {
+		return nasMessage.Cause5GSMMessageTypeNonExistentOrNotImplemented
+	}
+	if len(buf) < gsmHeaderLength+ieLength {
+		return nasMessage.Cause5GSMInvalidMandatoryInformation
+	}
+	return 0
+}
+
+//checkGsmMessage returns 5GSM cause of 5GSM STATUS answering message received from UE,
+//0 if message fits protocol state(TS 24.501 7.3, 7.4). Caller holds SM context lock
+func checkGsmMessage(smContext *smf_context.SMContext, msgType, pti uint8) uint8 {
+	switch msgType {
+	case nas.MsgTypePDUSessionModificationRequest,
+		nas.MsgTypePDUSessionReleaseRequest:
+		//UE initiated procedure
+		if pti == ptiNoProcedure || pti == ptiReserved {
+			return nasMessage.Cause5GSMInvalidPTIValue
+		}
+
+	case nas.MsgTypePDUSessionModificationComplete,
+		nas.MsgTypePDUSessionModificationCommandReject:
+		//Home-routed session, H-SMF runs the procedure
+		if smContext.IsVsmf() {
+			break
+		}
+		procedure := smContext.PendingGsmProcedure(nas.MsgTypePDUSessionModificationCommand)
+		if procedure == nil {
+			return nasMessage.Cause5GSMMessageTypeNotCompatibleWithTheProtocolState
+		}
+		if pti != procedure.Pti {
+			return nasMessage.Cause5GSMPTIMismatch
+		}
+
+	case nas.MsgTypePDUSessionReleaseComplete:
+		procedure := smContext.PendingGsmProcedure(nas.MsgTypePDUSessionReleaseCommand)
+		if procedure != nil && pti != procedure.Pti {
+			return nasMessage.Cause5GSMPTIMismatch
+		}
+
+	case nas.MsgTypeStatus5GSM:
+
+	case nas.MsgTypePDUSessionEstablishmentRequest,
+		nas.MsgTypePDUSessionAuthenticationComplete:
+		//Not on established session
+		return nasMessage.Cause5GSMMessageTypeNotCompatibleWithTheProtocolState
+
+	default:
+		//Network to UE messages
+		return nasMessage.Cause5GSMMessageTypeNonExistentOrNotImplemented
+	}
+	return 0
+}
+
+//sendStatus5GSM answers N1 SM message from UE with 5GSM STATUS in Update SM Context response
+func sendStatus5GSM(smContext *smf_context.SMContext, response *models.UpdateSmContextResponse, pti, cause uint8) {
+	buf, err := smf_context.BuildGSMStatus5GSM(smContext, pti, cause)
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("build GSM Status5GSM failed: %+v", err)
+		return
+	}
+	smContext.SubPduSessLog.Warnf("5GSM STATUS sent, PTI [%v], cause [%v]", pti, cause)
+	metrics.IncrementGsmStatusStats(smf_context.SMF_Self().NfInstanceID, "Out", strconv.Itoa(int(cause)))
+
+	response.BinaryDataN1SmMessage = buf
+	response.JsonData.N1SmMsg = &models.RefToBinaryData{ContentId: "Status5GSM"}
+}
+
+//HandleStatus5GSM handles 5GSM STATUS from UE, procedure with PTI UE reported error in is
+//aborted(TS 24.501 6.5.3). Caller holds SM context lock
+func HandleStatus5GSM(smContext *smf_context.SMContext, status *nasMessage.Status5GSM) {
+	pti, cause := status.GetPTI(), status.GetCauseValue()
+	smContext.SubPduSessLog.Warnf("5GSM STATUS received, PTI [%v], cause [%v]", pti, cause)
+	metrics.IncrementGsmStatusStats(smf_context.SMF_Self().NfInstanceID, "In", strconv.Itoa(int(cause)))
+
+	switch cause {
+	case nasMessage.Cause5GSMInvalidPDUSessionIdentity:
+		//UE has no such PDU session
+		if smContext.IsNwModificationPending() {
+			abortPduSessModification(smContext)
+		}
+		stopT3592(smContext)
+		smContext.SubPduSessLog.Warnf("PDU session unknown to UE, releasing PDU session locally")
+		releaseSMContextLocally(smContext, true)
+
+	case nasMessage.Cause5GSMPTIMismatch,
+		nasMessage.Cause5GSMInvalidPTIValue,
+		nasMessage.Cause5GSMMessageTypeNonExistentOrNotImplemented,
+		nasMessage.Cause5GSMMessageTypeNotCompatibleWithTheProtocolState:
+		abortGsmProcedure(smContext, pti)
+	}
+}
+
+//abortGsmProcedure aborts network command with PTI awaiting UE, caller holds SM context lock
+func abortGsmProcedure(smContext *smf_context.SMContext, pti uint8) {
+	procedure := smContext.GsmProcedure(pti)
+	if procedure == nil || procedure.State != smf_context.GsmProcedurePending {
+		return
+	}
+
+	switch procedure.RspMsgType {
+	case nas.MsgTypePDUSessionModificationCommand:
+		smContext.SubPduSessLog.Warnf("PDU session modification aborted on 5GSM STATUS")
+		abortPduSessModification(smContext)
+
+	case nas.MsgTypePDUSessionReleaseCommand:
+		//Release Command can't be completed, release locally
+		smContext.SubPduSessLog.Warnf("PDU session release aborted on 5GSM STATUS, releasing PDU session locally")
+		stopT3592(smContext)
+		releaseSMContextLocally(smContext, true)
+	}
+}
@@ -0,0 +1,360 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/nas"
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/openapi/Nsmf_PDUSession"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/consumer"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/metrics"
+	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
+	"github.com/free5gc/smf/transaction"
+)
+
+func formPduSessionCreateErrRsp(httpStatus int, problemBody *models.ProblemDetails) *http_wrapper.Response {
+	return &http_wrapper.Response{
+		Status: httpStatus,
+		Body: models.PostPduSessionsErrorResponse{
+			JsonData: &models.PduSessionCreateError{
+				Error: problemBody,
+			},
+		},
+	}
+}
+
+func formPduSessionUpdateErrRsp(httpStatus int, problemBody *models.ProblemDetails) *http_wrapper.Response {
+	return &http_wrapper.Response{
+		Status: httpStatus,
+		Body: models.UpdatePduSessionErrorResponse{
+			JsonData: &models.HsmfUpdateError{
+				Error: problemBody,
+			},
+		},
+	}
+}
+
+//HandlePDUSessionCreate handles Create of home-routed PDU session received from V-SMF, SMF acts as H-SMF
+func HandlePDUSessionCreate(eventData interface{}) error {
+	txn := eventData.(*transaction.Transaction)
+	request := txn.Req.(smf_context.PduSessionCreateRequest)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+	createData := request.JsonData
+
+	// Check has PDU Session Establishment Request
+	m := nas.NewMessage()
+	if request.BinaryDataN1SmInfoFromUe == nil {
+		smContext.SubPduSessLog.Errorln("PDUSessionCreate, N1 SM info from UE missing")
+		txn.Rsp = formPduSessionCreateErrRsp(http.StatusForbidden, &Nsmf_PDUSession.N1SmError)
+		return fmt.Errorf("GsmMsgDecodeError")
+	}
+	if err := m.GsmMessageDecode(&request.BinaryDataN1SmInfoFromUe); err != nil ||
+		m.GsmHeader.GetMessageType() != nas.MsgTypePDUSessionEstablishmentRequest {
+		smContext.SubPduSessLog.Errorf("PDUSessionCreate, GsmMessageDecode Error: %v", err)
+		txn.Rsp = formPduSessionCreateErrRsp(http.StatusForbidden, &Nsmf_PDUSession.N1SmError)
+		return fmt.Errorf("GsmMsgDecodeError")
+	}
+
+	if createData.ServingNetwork == nil || createData.SNssai == nil ||
+		createData.VsmfPduSessionUri == "" || createData.VcnTunnelInfo == nil {
+		smContext.SubPduSessLog.Errorln("PDUSessionCreate, mandatory IE missing")
+		txn.Rsp = formPduSessionCreateErrRsp(http.StatusBadRequest, &models.ProblemDetails{
+			Title:  "Mandatory IE missing",
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_MISSING",
+		})
+		return fmt.Errorf("MandatoryIeMissing")
+	}
+
+	smContext.SubPduSessLog.Infof("PDUSessionCreate, home-routed session from V-SMF[%v]", createData.VsmfId)
+	smContext.SetPduSessionCreateData(createData)
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+
+	if cause, err := checkPduSession(smContext, createData.ServingNetwork, m.PDUSessionEstablishmentRequest); err != nil {
+		txn.Rsp = smContext.GeneratePduSessionCreateReject(cause)
+		return err
+	}
+	if cause, err := setupPduSession(smContext, m.PDUSessionEstablishmentRequest, nil); err != nil {
+		txn.Rsp = smContext.GeneratePduSessionCreateReject(cause)
+		return err
+	}
+
+	//DL traffic goes to V-UPF
+	if _, err := smContext.SetVcnTunnel(createData.VcnTunnelInfo); err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionCreate, %v", err)
+		txn.Rsp = formPduSessionCreateErrRsp(http.StatusBadRequest, &models.ProblemDetails{
+			Title:  "Invalid V-CN tunnel info",
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_INCORRECT",
+			Detail: err.Error(),
+		})
+		return fmt.Errorf("VcnTunnelInfoError")
+	}
+
+	createdData, err := smContext.BuildPduSessionCreatedData()
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionCreate, build created data failed: %v", err)
+		txn.Rsp = smContext.GeneratePduSessionCreateReject("UPFDataPathError")
+		return fmt.Errorf("CreatedDataError")
+	}
+
+	n1Msg, err := smf_context.BuildGSMPDUSessionEstablishmentAccept(smContext)
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionCreate, build GSM PDUSessionEstablishmentAccept failed: %v", err)
+		txn.Rsp = smContext.GeneratePduSessionCreateReject("UPFDataPathError")
+		return fmt.Errorf("N1BuildError")
+	}
+
+	registerWithUdm(smContext)
+
+	self := smf_context.SMF_Self()
+	location := fmt.Sprintf("%s://%s:%d/nsmf-pdusession/v1/pdu-sessions/%s",
+		self.URIScheme, self.RegisterIPv4, self.SBIPort, smContext.Ref)
+	txn.Rsp = &http_wrapper.Response{
+		Header: http.Header{"Location": {location}},
+		Status: http.StatusCreated,
+		Body: models.PostPduSessionsResponse{
+			JsonData:               createdData,
+			BinaryDataN1SmInfoToUe: n1Msg,
+		},
+	}
+
+	smContext.SubPduSessLog.Infof("PDUSessionCreate, home-routed PDU session create success")
+	return nil
+}
+
+//HandlePDUSessionUpdate handles Update of home-routed PDU session received from V-SMF
+func HandlePDUSessionUpdate(eventData interface{}) error {
+	txn := eventData.(*transaction.Transaction)
+	request := txn.Req.(models.UpdatePduSessionRequest)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+	updateData := request.JsonData
+
+	smContext.SubPduSessLog.Infof("PDUSessionUpdate, update [%v] received", updateData.RequestIndication)
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+
+	//PLMN, access type, RAT and location change
+	updateUeAccessInfo(smContext, &models.SmContextUpdateData{
+		ServingNetwork: updateData.ServingNetwork,
+		AnType:         updateData.AnType,
+		RatType:        updateData.RatType,
+		UeLocation:     updateData.UeLocation,
+		UeTimeZone:     updateData.UeTimeZone,
+	})
+
+	response := models.UpdatePduSessionResponse{
+		JsonData: new(models.HsmfUpdatedData),
+	}
+
+	switch updateData.RequestIndication {
+	case models.RequestIndication_UE_REQ_PDU_SES_REL:
+		m := nas.NewMessage()
+		if err := m.GsmMessageDecode(&request.BinaryDataN1SmInfoFromUe); err != nil ||
+			m.GsmHeader.GetMessageType() != nas.MsgTypePDUSessionReleaseRequest {
+			smContext.SubPduSessLog.Errorf("PDUSessionUpdate, GsmMessageDecode Error: %v", err)
+			txn.Rsp = formPduSessionUpdateErrRsp(http.StatusForbidden, &Nsmf_PDUSession.N1SmError)
+			return fmt.Errorf("GsmMsgDecodeError")
+		}
+		smContext.HandlePDUSessionReleaseRequest(m.PDUSessionReleaseRequest)
+
+		buf, err := smf_context.BuildGSMPDUSessionReleaseCommand(smContext, nasMessage.Cause5GSMRegularDeactivation)
+		if err != nil {
+			smContext.SubPduSessLog.Errorf("PDUSessionUpdate, build GSM PDUSessionReleaseCommand failed: %+v", err)
+			return err
+		}
+		response.JsonData.N1SmInfoToUe = &models.RefToBinaryData{ContentId: smf_context.N1SmInfoToUe}
+		response.BinaryDataN1SmInfoToUe = buf
+
+		//Release UP, context is released on Release from V-SMF
+		if err := smContext.ChangeState(smf_context.SmStatePfcpRelease); err != nil {
+			return err
+		}
+		txn.Rsp = &http_wrapper.Response{
+			Status: http.StatusOK,
+			Body:   response,
+		}
+		if !SendPfcpSessionReleaseReq(smContext, txn, onPfcpReleaseInActivePending(smContext)) {
+			return smContext.ChangeState(smf_context.SmStateInActivePending)
+		}
+		return nil
+
+	case models.RequestIndication_UE_REQ_PDU_SES_MOD:
+		smContext.SubPduSessLog.Warnf("PDUSessionUpdate, UE requested modification not supported")
+		txn.Rsp = formPduSessionUpdateErrRsp(http.StatusForbidden, &models.ProblemDetails{
+			Title:  "UE requested PDU session modification not supported",
+			Status: http.StatusForbidden,
+			Cause:  "REQUEST_REJECTED",
+		})
+		return fmt.Errorf("ModificationNotSupported")
+
+	default:
+		//Mobility, V-UPF may have changed
+		if updateData.VcnTunnelInfo != nil {
+			txn.Rsp = http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+			return updateVcnTunnel(smContext, txn, updateData.VcnTunnelInfo)
+		}
+	}
+
+	txn.Rsp = http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+	return nil
+}
+
+//updateVcnTunnel moves DL of home-routed session to new V-UPF tunnel, txn is answered once UPF answered
+func updateVcnTunnel(smContext *smf_context.SMContext, txn *transaction.Transaction, tunnelInfo *models.TunnelInfo) error {
+	if vcn := smContext.Vsmf.VcnTunnelInfo; vcn != nil &&
+		vcn.Ipv4Addr == tunnelInfo.Ipv4Addr && vcn.GtpTeid == tunnelInfo.GtpTeid {
+		return nil
+	}
+
+	pdrList, err := smContext.SetVcnTunnel(tunnelInfo)
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionUpdate, %v", err)
+		txn.Rsp = formVcnTunnelUpdateErrRsp(err.Error())
+		return err
+	}
+
+	pfcpParam := &pfcpParam{
+		pdrList: []*smf_context.PDR{},
+		farList: []*smf_context.FAR{},
+		barList: []*smf_context.BAR{},
+		qerList: []*smf_context.QER{},
+	}
+	for _, DLPDR := range pdrList {
+		DLPDR.FAR.State = smf_context.RULE_UPDATE
+		pfcpParam.farList = append(pfcpParam.farList, DLPDR.FAR)
+	}
+
+	if err := smContext.ChangeState(smf_context.SmStatePfcpModify); err != nil {
+		return err
+	}
+	smContext.SubPduSessLog.Infof("PDUSessionUpdate, V-CN tunnel changed, send PFCP Modification")
+	onRsp := func(status smf_context.PFCPSessionResponseStatus) smf_context.SMContextState {
+		if status != smf_context.SessionUpdateSuccess {
+			smContext.SubCtxLog.Errorf("PDUSessionUpdate, pfcp session modify error: %v ", status)
+			txn.Rsp = formVcnTunnelUpdateErrRsp(status.String())
+			return smf_context.SmStateActive
+		}
+		NotifySmfEvent(smContext, models.SmfEvent_UP_PATH_CH, models.EventNotification{})
+		return smf_context.SmStateActive
+	}
+	if !SendPfcpSessionModifyReq(smContext, pfcpParam, txn, onRsp) {
+		return smContext.ChangeState(onRsp(smf_context.SessionUpdateFailed))
+	}
+	return nil
+}
+
+func formVcnTunnelUpdateErrRsp(detail string) *http_wrapper.Response {
+	return formPduSessionUpdateErrRsp(http.StatusInternalServerError, &models.ProblemDetails{
+		Title:  "PFCP session modification failure",
+		Status: http.StatusInternalServerError,
+		Cause:  "UPF_NOT_RESPONDING",
+		Detail: detail,
+	})
+}
+
+//HandlePDUSessionRelease handles Release of home-routed PDU session received from V-SMF
+func HandlePDUSessionRelease(eventData interface{}) error {
+	txn := eventData.(*transaction.Transaction)
+	body := txn.Req.(models.ReleaseData)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+
+	smContext.SubPduSessLog.Infof("PDUSessionRelease, home-routed PDU session release received")
+	deregisterFromUdm(smContext)
+
+	//Send Policy delete
+	releaseReq := models.ReleaseSmContextRequest{
+		JsonData: &models.SmContextReleaseData{
+			Cause:             body.Cause,
+			NgApCause:         body.NgApCause,
+			Var5gMmCauseValue: body.Var5gMmCauseValue,
+			UeLocation:        body.UeLocation,
+			UeTimeZone:        body.UeTimeZone,
+			AddUeLocation:     body.AddUeLocation,
+		},
+	}
+	metrics.IncrementSvcPcfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmPolicyAssociationDelete), "Out", "", "")
+	if httpStatus, err := consumer.SendSMPolicyAssociationDelete(smContext, &releaseReq); err != nil {
+		metrics.IncrementSvcPcfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmPolicyAssociationDelete), "In", http.StatusText(httpStatus), err.Error())
+		smContext.SubCtxLog.Errorf("PDUSessionRelease, SM policy delete error [%v] ", err.Error())
+	} else {
+		metrics.IncrementSvcPcfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmPolicyAssociationDelete), "In", http.StatusText(httpStatus), "")
+	}
+
+	//Release User-plane, if not done on UE requested release
+	onRsp := func(status smf_context.PFCPSessionResponseStatus) smf_context.SMContextState {
+		if status != smf_context.SessionReleaseSuccess {
+			smContext.SubCtxLog.Errorf("PDUSessionRelease, pfcp session release error: %v ", status)
+		}
+		txn.Rsp = http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+		NotifySmfEvent(smContext, models.SmfEvent_PDU_SES_REL, models.EventNotification{})
+		smf_context.RemoveSMContext(smContext.Ref)
+		return smf_context.SmStateInit
+	}
+	if err := smContext.ChangeState(smf_context.SmStatePfcpRelease); err != nil {
+		return err
+	}
+	if !SendPfcpSessionReleaseReq(smContext, txn, onRsp) {
+		return smContext.ChangeState(onRsp(smf_context.SessionReleaseSuccess))
+	}
+	return nil
+}
+
+//CompleteHsmfPduSessEstablishment ends home-routed session setup once UPFs are programmed,
+//N1/N2 to UE goes through V-SMF so there is nothing to send to AMF
+func CompleteHsmfPduSessEstablishment(smContext *smf_context.SMContext) {
+	smContext.CommitSmPolicyDecision(true)
+	smContext.SubPduSessLog.Infof("home-routed PDU session established")
+	NotifySmfEvent(smContext, smf_context.SmfEventPduSesEst, models.EventNotification{
+		TargetUeIpv4Addr: smContext.PDUAddress.String(),
+		AccType:          smContext.AnType,
+	})
+}
+
+//sendVsmfPduSessionRelease asks V-SMF to release home-routed session, with PDU Session Release Command to UE
+func sendVsmfPduSessionRelease(smContext *smf_context.SMContext, cause uint8) error {
+	request := smf_context.VsmfUpdateRequest{
+		JsonData: &models.VsmfUpdateData{
+			RequestIndication: models.RequestIndication_NW_REQ_PDU_SES_REL,
+		},
+	}
+	if buf, err := smf_context.BuildGSMPDUSessionReleaseCommand(smContext, cause); err != nil {
+		smContext.SubPduSessLog.Errorf("build GSM PDUSessionReleaseCommand failed: %+v", err)
+	} else {
+		request.JsonData.N1SmInfoToUe = &models.RefToBinaryData{ContentId: smf_context.N1SmInfoToUe}
+		request.BinaryDataN1SmInfoToUe = buf
+	}
+	return consumer.SendVsmfPduSessionUpdate(smContext, request)
+}
+
+//buildVsmfPduSessionModification builds request asking V-SMF to modify home-routed PDU session towards UE
+func buildVsmfPduSessionModification(smContext *smf_context.SMContext,
+	sessionAmbr *models.Ambr) (smf_context.VsmfUpdateRequest, error) {
+	request := smf_context.VsmfUpdateRequest{
+		JsonData: &models.VsmfUpdateData{
+			RequestIndication: models.RequestIndication_NW_REQ_PDU_SES_MOD,
+			SessionAmbr:       sessionAmbr,
+		},
+	}
+	buf, err := smf_context.BuildGSMPDUSessionModificationCommand(smContext)
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("build GSM PDUSessionModificationCommand failed: %+v", err)
+		return request, err
+	}
+	request.JsonData.N1SmInfoToUe = &models.RefToBinaryData{ContentId: smf_context.N1SmInfoToUe}
+	request.BinaryDataN1SmInfoToUe = buf
+	return request, nil
+}
@@ -0,0 +1,180 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/pfcp/pfcpType"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/transaction"
+)
+
+//HandleLadnPresenceChange acts on UE leaving or returning to service area of LADN DNN(TS 23.501 5.6.5):
+//user plane is deactivated once UE left and session is released unless UE returns in time,
+//user plane is activated again once it does. Txn is answered once UPF updated downlink FARs
+func HandleLadnPresenceChange(eventData interface{}) error {
+	txn := eventData.(*transaction.Transaction)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+
+	switch smContext.SMContextState {
+	case smf_context.SmStateActive:
+		if smContext.Tunnel == nil {
+			smContext.SubPduSessLog.Infof("LADN presence change ignored, no user plane")
+			return nil
+		}
+	case smf_context.SmStateInActivePending:
+		//User plane is being released, only release timer is tracked
+		txn = nil
+	default:
+		//Acted on at next presence change
+		smContext.SubPduSessLog.Infof("LADN presence change ignored, SM context state [%v]", smContext.SMContextState)
+		return nil
+	}
+
+	switch smContext.LadnPresence() {
+	case models.PresenceState_OUT_OF_AREA:
+		if smContext.IsLadnReleasePending() {
+			return nil
+		}
+		startLadnRelease(smContext)
+		if txn != nil {
+			return deactivateLadnUserPlane(smContext, txn)
+		}
+	case models.PresenceState_IN_AREA:
+		if !smContext.IsLadnReleasePending() {
+			return nil
+		}
+		smContext.StopLadnRelease()
+		if txn != nil {
+			return activateLadnUserPlane(smContext, txn)
+		}
+	}
+	return nil
+}
+
+//startLadnRelease releases PDU session unless UE returns to LADN service area in time
+func startLadnRelease(smContext *smf_context.SMContext) {
+	var timer *time.Timer
+	timer = smContext.StartLadnRelease(func() {
+		smContext.SMLock.Lock()
+		expired := smContext.IsLadnRelease(timer)
+		smContext.SMLock.Unlock()
+		if expired {
+			smContext.SubPduSessLog.Infof("UE didn't return to LADN service area, releasing PDU session")
+			smf_context.RequestNwRelease(smContext, nasMessage.Cause5GSMOutOfLADNServiceArea)
+		}
+	})
+}
+
+//modifyLadnDownlinkFARs updates downlink FARs of session at UPF, onModified follows once UPF
+//accepted it and txn is answered then. Caller holds SM context lock
+func modifyLadnDownlinkFARs(smContext *smf_context.SMContext, txn *transaction.Transaction,
+	applyAction pfcpType.ApplyAction, onModified func() error) error {
+	pfcpParam := &pfcpParam{
+		pdrList: []*smf_context.PDR{},
+		farList: setDownlinkFARs(smContext, applyAction),
+		barList: []*smf_context.BAR{},
+		qerList: []*smf_context.QER{},
+	}
+	if err := smContext.ChangeState(smf_context.SmStatePfcpModify); err != nil {
+		return err
+	}
+	smContext.SubCtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
+	onRsp := func(status smf_context.PFCPSessionResponseStatus) smf_context.SMContextState {
+		if status != smf_context.SessionUpdateSuccess {
+			txn.Err = fmt.Errorf("pfcp session modify error: %v", status)
+			smContext.SubPduSessLog.Errorf("LADN presence change, %v", txn.Err)
+		} else if err := onModified(); err != nil {
+			smContext.SubPduSessLog.Errorf("LADN presence change, %v", err)
+		}
+		return smf_context.SmStateActive
+	}
+	if !SendPfcpSessionModifyReq(smContext, pfcpParam, txn, onRsp) {
+		return smContext.ChangeState(onRsp(smf_context.SessionUpdateFailed))
+	}
+	return nil
+}
+
+//deactivateLadnUserPlane drops downlink data of UE out of LADN service area, it isn't buffered
+//nor is UE paged for it, and releases AN resources of session unless it is idle
+func deactivateLadnUserPlane(smContext *smf_context.SMContext, txn *transaction.Transaction) error {
+	return modifyLadnDownlinkFARs(smContext, txn, pfcpType.ApplyAction{Drop: true}, func() error {
+		if smContext.UpCnxState == models.UpCnxState_DEACTIVATED {
+			smContext.SubPduSessLog.Infof("UE out of LADN service area, downlink data of idle session dropped")
+			return nil
+		}
+
+		n2Pdu, err := smf_context.BuildPDUSessionResourceReleaseCommandTransfer(smContext)
+		if err != nil {
+			return fmt.Errorf("build PDUSessionResourceReleaseCommandTransfer failed, %v", err)
+		}
+		smContext.UpCnxState = models.UpCnxState_DEACTIVATED
+		smContext.LadnUpDeactivated = true
+		smContext.SubPduSessLog.Infof("UE out of LADN service area, user plane deactivated")
+		return sendLadnN2Transfer(smContext, models.NgapIeType_PDU_RES_REL_CMD, n2Pdu)
+	})
+}
+
+//activateLadnUserPlane restores downlink FARs of idle session, downlink data is buffered and
+//reported again. AN resources released as UE left are set up again(TS 23.502 4.2.3.3)
+func activateLadnUserPlane(smContext *smf_context.SMContext, txn *transaction.Transaction) error {
+	return modifyLadnDownlinkFARs(smContext, txn, pfcpType.ApplyAction{Buff: true, Nocp: true}, func() error {
+		if !smContext.LadnUpDeactivated || smContext.UpCnxState != models.UpCnxState_DEACTIVATED {
+			smContext.SubPduSessLog.Infof("UE back in LADN service area, downlink data buffered")
+			return nil
+		}
+		smContext.LadnUpDeactivated = false
+
+		n2Pdu, err := smf_context.BuildPDUSessionResourceSetupRequestTransfer(smContext)
+		if err != nil {
+			return fmt.Errorf("build PDUSessionResourceSetupRequestTransfer failed, %v", err)
+		}
+		smContext.SubPduSessLog.Infof("UE back in LADN service area, activating user plane")
+		return sendLadnN2Transfer(smContext, models.NgapIeType_PDU_RES_SETUP_REQ, n2Pdu)
+	})
+}
+
+func sendLadnN2Transfer(smContext *smf_context.SMContext, ngapIeType models.NgapIeType, n2Pdu []byte) error {
+	n1n2Request := models.N1N2MessageTransferRequest{
+		JsonData: &models.N1N2MessageTransferReqData{
+			PduSessionId: smContext.PDUSessionID,
+			N1n2FailureTxfNotifURI: fmt.Sprintf("%s://%s:%d%s",
+				smf_context.SMF_Self().URIScheme,
+				smf_context.SMF_Self().RegisterIPv4,
+				smf_context.SMF_Self().SBIPort,
+				"/nsmf-callback/sm-n1n2failnotify/"+smContext.Ref),
+			N2InfoContainer: &models.N2InfoContainer{
+				N2InformationClass: models.N2InformationClass_SM,
+				SmInfo: &models.N2SmInformation{
+					PduSessionId: smContext.PDUSessionID,
+					N2InfoContent: &models.N2InfoContent{
+						NgapIeType: ngapIeType,
+						NgapData:   &models.RefToBinaryData{ContentId: "N2SmInformation"},
+					},
+					SNssai: smContext.Snssai,
+				},
+			},
+		},
+		BinaryDataN2Information: n2Pdu,
+	}
+
+	rspData, _, err := smContext.
+		CommunicationClient.
+		N1N2MessageCollectionDocumentApi.
+		N1N2MessageTransfer(context.Background(), smContext.Supi, n1n2Request)
+	if err != nil {
+		return err
+	}
+	smContext.SubPduSessLog.Infof("N2 %v sent, N1N2 transfer [%v]", ngapIeType, rspData.Cause)
+	return nil
+}
@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/openapi/models"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+	"github.com/free5gc/smf/factory"
+	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
+	"github.com/free5gc/smf/producer"
+	"github.com/free5gc/smf/transaction"
+)
+
+//LADN DNN served in tracking area 000001
+func newLadnDnnInfo() *smf_context.SnssaiSmfDnnInfo {
+	return &smf_context.SnssaiSmfDnnInfo{
+		Ladn: smf_context.NewLadnInfo(&factory.Ladn{Tais: []models.Tai{{Tac: "000001"}}, ReleaseTimer: 3600}),
+	}
+}
+
+func TestCreateRejectedOutOfLadnServiceArea(t *testing.T) {
+	snssai := &models.Snssai{Sst: 1, Sd: "010203"}
+	setDnnInfo(t, snssai, "ladn", newLadnDnnInfo())
+
+	createData := models.SmContextCreateData{
+		Supi:           "imsi-2089300007487",
+		PduSessionId:   10,
+		Dnn:            "ladn",
+		SNssai:         snssai,
+		ServingNetwork: &models.PlmnId{Mcc: "208", Mnc: "93"},
+		UeLocation:     smctxtest.UeLocation("000002"),
+	}
+	smContext := smctxtest.NewSMContext(t, createData.Supi, 10)
+	rsp, err := createSMContext(smContext, createData, newEstablishmentRequest(t, 10, nil))
+	require.Error(t, err)
+	require.Equal(t, http.StatusForbidden, rsp.Status)
+	require.Equal(t, nasMessage.Cause5GSMOutOfLADNServiceArea, establishmentReject(t, rsp).GetCauseValue())
+}
+
+func TestLadnPresenceChange(t *testing.T) {
+	handle := func(smContext *smf_context.SMContext) {
+		txn := transaction.NewTransaction(nil, nil, svcmsgtypes.LadnPresenceChange)
+		txn.Ctxt = smContext
+		require.NoError(t, producer.HandleLadnPresenceChange(txn))
+	}
+
+	//User plane is being released, UE leaving service area starts release timer only
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 10,
+		smctxtest.WithDnnInfo(newLadnDnnInfo()),
+		smctxtest.WithUeLocation("000002"),
+		smctxtest.WithState(smf_context.SmStateInActivePending))
+	handle(smContext)
+	require.True(t, smContext.IsLadnReleasePending())
+	require.Equal(t, smf_context.SmStateInActivePending, smContext.SMContextState)
+
+	//Leaving again doesn't restart it
+	handle(smContext)
+	require.True(t, smContext.IsLadnReleasePending())
+
+	//UE returned in time, session is kept
+	smContext.UeLocation = smctxtest.UeLocation("000001")
+	handle(smContext)
+	require.False(t, smContext.IsLadnReleasePending())
+	require.Equal(t, smf_context.SmStateInActivePending, smContext.SMContextState)
+
+	//Active session without user plane is left alone
+	smContext = smctxtest.NewSMContext(t, "imsi-2089300007487", 11,
+		smctxtest.WithDnnInfo(newLadnDnnInfo()),
+		smctxtest.WithUeLocation("000002"),
+		smctxtest.WithState(smf_context.SmStateActive))
+	handle(smContext)
+	require.False(t, smContext.IsLadnReleasePending())
+	require.Equal(t, smf_context.SmStateActive, smContext.SMContextState)
+}
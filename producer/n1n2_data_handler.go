@@ -10,6 +10,7 @@ import (
 
 	"github.com/free5gc/http_wrapper"
 	"github.com/free5gc/nas"
+	"github.com/free5gc/nas/nasMessage"
 	"github.com/free5gc/openapi/Nsmf_PDUSession"
 	"github.com/free5gc/openapi/models"
 	"github.com/free5gc/pfcp/pfcpType"
@@ -36,9 +37,24 @@ func HandleUpdateN1Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 
 	if body.BinaryDataN1SmMessage != nil {
 		smContext.SubPduSessLog.Traceln("PDUSessionSMContextUpdate, Binary Data N1 SmMessage isn't nil!")
+		pti := gsmMessagePti(body.BinaryDataN1SmMessage)
+		if len(body.BinaryDataN1SmMessage) >= gsmHeaderLength {
+			//Header is there, unknown or malformed message is answered by 5GSM STATUS
+			if cause := checkGsmMessageFormat(body.BinaryDataN1SmMessage); cause != 0 {
+				smContext.SubPduSessLog.Warnf("PDUSessionSMContextUpdate, N1 Msg type [%v] malformed or unknown",
+					body.BinaryDataN1SmMessage[gsmHeaderLength-1])
+				sendStatus5GSM(smContext, response, pti, cause)
+				return nil
+			}
+		}
 		m := nas.NewMessage()
 		err := m.GsmMessageDecode(&body.BinaryDataN1SmMessage)
 		smContext.SubPduSessLog.Traceln("PDUSessionSMContextUpdate, Update SM Context Request N1SmMessage: ", m)
+		if err != nil && len(body.BinaryDataN1SmMessage) >= gsmHeaderLength {
+			smContext.SubPduSessLog.Warnf("PDUSessionSMContextUpdate, %v", err)
+			sendStatus5GSM(smContext, response, pti, nasMessage.Cause5GSMSemanticallyIncorrectMessage)
+			return nil
+		}
 		if err != nil {
 			smContext.SubPduSessLog.Error(err)
 			txn.Rsp = &http_wrapper.Response{
@@ -51,9 +67,30 @@ func HandleUpdateN1Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 			}
 			return err
 		}
+		if cause := checkGsmMessage(smContext, m.GsmHeader.GetMessageType(), pti); cause != 0 {
+			smContext.SubPduSessLog.Warnf("PDUSessionSMContextUpdate, N1 Msg type [%v] PTI [%v] unexpected",
+				m.GsmHeader.GetMessageType(), pti)
+			sendStatus5GSM(smContext, response, pti, cause)
+			return nil
+		}
+
+		//Retransmitted request is answered as before
+		if resendGsmResponse(smContext, m.GsmHeader.GetMessageType(), pti, response) {
+			return nil
+		}
+
 		switch m.GsmHeader.GetMessageType() {
+		case nas.MsgTypeStatus5GSM:
+			smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, N1 Msg 5GSM STATUS received")
+			HandleStatus5GSM(smContext, m.Status5GSM)
+
 		case nas.MsgTypePDUSessionReleaseRequest:
 			smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, N1 Msg PDU Session Release Request received")
+			//Network requested release takes precedence, UE has the Release Command already
+			if smContext.IsNwReleaseInProgress() {
+				smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, network requested release in progress, request ignored")
+				break
+			}
 			if smContext.SMContextState != smf_context.SmStateActive {
 				// Wait till the state becomes SmStateActive again
 				// TODO: implement sleep wait in concurrent architecture
@@ -61,13 +98,26 @@ func HandleUpdateN1Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 			}
 
 			smContext.HandlePDUSessionReleaseRequest(m.PDUSessionReleaseRequest)
-			if buf, err := smf_context.BuildGSMPDUSessionReleaseCommand(smContext); err != nil {
+			if smContext.IsVsmf() {
+				//Home-routed session, Release Command comes from H-SMF
+				if buf, err := relayN1ToHsmf(smContext, models.RequestIndication_UE_REQ_PDU_SES_REL,
+					body.BinaryDataN1SmMessage); err != nil {
+					smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, relay PDUSessionReleaseRequest failed: %+v", err)
+				} else {
+					response.BinaryDataN1SmMessage = buf
+				}
+			} else if buf, err := smf_context.BuildGSMPDUSessionReleaseCommand(smContext, nasMessage.Cause5GSMRegularDeactivation); err != nil {
 				smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, build GSM PDUSessionReleaseCommand failed: %+v", err)
 			} else {
 				response.BinaryDataN1SmMessage = buf
 			}
 
 			response.JsonData.N1SmMsg = &models.RefToBinaryData{ContentId: "PDUSessionReleaseCommand"}
+			if response.BinaryDataN1SmMessage != nil {
+				//Kept to answer retransmitted request
+				smContext.CompleteGsmProcedure(smContext.NewGsmProcedure(pti, nas.MsgTypePDUSessionReleaseRequest,
+					nas.MsgTypePDUSessionReleaseCommand, response.BinaryDataN1SmMessage))
+			}
 
 			response.JsonData.N2SmInfo = &models.RefToBinaryData{ContentId: "PDUResourceReleaseCommand"}
 			response.JsonData.N2SmInfoType = models.N2SmInfoType_PDU_RES_REL_CMD
@@ -79,16 +129,46 @@ func HandleUpdateN1Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 			}
 
 			if smContext.Tunnel != nil {
-				smContext.ChangeState(smf_context.SmStatePfcpModify)
+				if err := smContext.ChangeState(smf_context.SmStatePfcpModify); err != nil {
+					return err
+				}
 				smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 				//Send release to UPF
 				//releaseTunnel(smContext)
 				pfcpAction.sendPfcpDelete = true
 			} else {
-				smContext.ChangeState(smf_context.SmStateModify)
+				if err := smContext.ChangeState(smf_context.SmStateModify); err != nil {
+					return err
+				}
 				smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 			}
 
+		case nas.MsgTypePDUSessionModificationRequest:
+			smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, N1 Msg PDU Session Modification Request received")
+			if !smContext.IsVsmf() {
+				HandlePDUSessionModificationRequest(smContext, m.PDUSessionModificationRequest, response)
+				break
+			}
+			//Home-routed session, H-SMF answers with Modification Command or Reject
+			if buf, err := relayN1ToHsmf(smContext, models.RequestIndication_UE_REQ_PDU_SES_MOD,
+				body.BinaryDataN1SmMessage); buf != nil {
+				response.BinaryDataN1SmMessage = buf
+				response.JsonData.N1SmMsg = &models.RefToBinaryData{ContentId: "PDUSessionModificationCommand"}
+			} else if err != nil {
+				smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, relay PDUSessionModificationRequest failed: %+v", err)
+			}
+
+		case nas.MsgTypePDUSessionModificationComplete:
+			smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, N1 Msg PDU Session Modification Complete received")
+			if err := HandleNwModificationComplete(smContext); err != nil {
+				return err
+			}
+
+		case nas.MsgTypePDUSessionModificationCommandReject:
+			smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, N1 Msg PDU Session Modification Command Reject received")
+			HandleNwModificationCommandReject(smContext,
+				m.PDUSessionModificationCommandReject.Cause5GSM.GetCauseValue())
+
 		case nas.MsgTypePDUSessionReleaseComplete:
 			smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, N1 Msg PDU Session Release Complete received")
 			if smContext.SMContextState != smf_context.SmStateInActivePending {
@@ -98,7 +178,13 @@ func HandleUpdateN1Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 			}
 			// Send Release Notify to AMF
 			smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, send Update SmContext Response")
-			smContext.ChangeState(smf_context.SmStateInit)
+			//Network requested release, SMF releases SM context and notifies AMF
+			if smContext.IsNwReleaseInProgress() {
+				HandleNwReleaseComplete(smContext)
+			}
+			if err := smContext.ChangeState(smf_context.SmStateInit); err != nil {
+				return err
+			}
 			smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 			response.JsonData.UpCnxState = models.UpCnxState_DEACTIVATED
 			/*problemDetails, err := consumer.SendSMContextStatusNotification(smContext.SmStatusNotifyUri)
@@ -131,12 +217,20 @@ func HandleUpCnxState(txn *transaction.Transaction, response *models.UpdateSmCon
 	switch smContextUpdateData.UpCnxState {
 	case models.UpCnxState_ACTIVATING:
 		smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, UP cnx state %v received", smContextUpdateData.UpCnxState)
+		if smContext.IsOutOfLadnServiceArea() {
+			//UP connection of LADN DNN isn't activated outside its service area(TS 23.502 4.2.3.2)
+			smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, UE out of LADN service area, UP cnx stays deactivated")
+			response.JsonData.UpCnxState = models.UpCnxState_DEACTIVATED
+			break
+		}
 		if smContext.SMContextState != smf_context.SmStateActive {
 			// Wait till the state becomes SmStateActive again
 			// TODO: implement sleep wait in concurrent architecture
 			smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, SMContext State[%v] should be SmStateActive State", smContext.SMContextState.String())
 		}
-		smContext.ChangeState(smf_context.SmStateModify)
+		if err := smContext.ChangeState(smf_context.SmStateModify); err != nil {
+			return err
+		}
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 		response.JsonData.N2SmInfo = &models.RefToBinaryData{ContentId: "PDUSessionResourceSetupRequestTransfer"}
 		response.JsonData.UpCnxState = models.UpCnxState_ACTIVATING
@@ -157,45 +251,56 @@ func HandleUpCnxState(txn *transaction.Transaction, response *models.UpdateSmCon
 			smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, SMContext State[%v] should be Active State", smContext.SMContextState.String())
 		}
 		if smContext.Tunnel != nil {
-			smContext.ChangeState(smf_context.SmStateModify)
+			if err := smContext.ChangeState(smf_context.SmStateModify); err != nil {
+				return err
+			}
 			smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 			response.JsonData.UpCnxState = models.UpCnxState_DEACTIVATED
 			smContext.UpCnxState = body.JsonData.UpCnxState
 			smContext.UeLocation = body.JsonData.UeLocation
 			// TODO: Deactivate N2 downlink tunnel
 			// Set FAR and An, N3 Release Info
-			farList := []*smf_context.FAR{}
-			smContext.PendingUPF = make(smf_context.PendingUPF)
-			for _, dataPath := range smContext.Tunnel.DataPathPool {
-				ANUPF := dataPath.FirstDPNode
-				for _, DLPDR := range ANUPF.DownLinkTunnel.PDR {
-					if DLPDR == nil {
-						smContext.SubPduSessLog.Errorf("AN Release Error")
-					} else {
-						DLPDR.FAR.State = smf_context.RULE_UPDATE
-						DLPDR.FAR.ApplyAction.Forw = false
-						DLPDR.FAR.ApplyAction.Buff = true
-						DLPDR.FAR.ApplyAction.Nocp = true
-						//Set DL Tunnel info to nil
-						if DLPDR.FAR.ForwardingParameters != nil {
-							DLPDR.FAR.ForwardingParameters.OuterHeaderCreation = nil
-						}
-						smContext.PendingUPF[ANUPF.GetNodeIP()] = true
-						farList = append(farList, DLPDR.FAR)
-					}
-				}
+			applyAction := pfcpType.ApplyAction{Buff: true, Nocp: true}
+			//UE out of LADN service area, downlink data is still dropped
+			if smContext.IsLadnReleasePending() {
+				applyAction = pfcpType.ApplyAction{Drop: true}
 			}
-
+			farList := setDownlinkFARs(smContext, applyAction)
 			pfcpParam.farList = append(pfcpParam.farList, farList...)
 
 			pfcpAction.sendPfcpModify = true
-			smContext.ChangeState(smf_context.SmStatePfcpModify)
+			if err := smContext.ChangeState(smf_context.SmStatePfcpModify); err != nil {
+				return err
+			}
 			smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 		}
 	}
 	return nil
 }
 
+//setDownlinkFARs sets action of downlink FARs at AN side UPF of session, DL tunnel info is
+//removed. Returns FARs to be updated at UPF
+func setDownlinkFARs(smContext *smf_context.SMContext, applyAction pfcpType.ApplyAction) []*smf_context.FAR {
+	farList := []*smf_context.FAR{}
+	for _, dataPath := range smContext.Tunnel.DataPathPool {
+		ANUPF := dataPath.FirstDPNode
+		for _, DLPDR := range ANUPF.DownLinkTunnel.PDR {
+			if DLPDR == nil {
+				smContext.SubPduSessLog.Errorf("AN Release Error")
+				continue
+			}
+			DLPDR.FAR.State = smf_context.RULE_UPDATE
+			DLPDR.FAR.ApplyAction = applyAction
+			//Set DL Tunnel info to nil
+			if DLPDR.FAR.ForwardingParameters != nil {
+				DLPDR.FAR.ForwardingParameters.OuterHeaderCreation = nil
+			}
+			farList = append(farList, DLPDR.FAR)
+		}
+	}
+	return farList
+}
+
 func HandleUpdateHoState(txn *transaction.Transaction, response *models.UpdateSmContextResponse) error {
 	body := txn.Req.(models.UpdateSmContextRequest)
 	smContext := txn.Ctxt.(*smf_context.SMContext)
@@ -211,7 +316,9 @@ func HandleUpdateHoState(txn *transaction.Transaction, response *models.UpdateSm
 			smContext.SubPduSessLog.Warnf("PDUSessionSMContextUpdate, SMContext state[%v] should be SmStateActive",
 				smContext.SMContextState.String())
 		}
-		smContext.ChangeState(smf_context.SmStateModify)
+		if err := smContext.ChangeState(smf_context.SmStateModify); err != nil {
+			return err
+		}
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 		smContext.HoState = models.HoState_PREPARING
 		if err := smf_context.HandleHandoverRequiredTransfer(body.BinaryDataN2SmInformation, smContext); err != nil {
@@ -238,7 +345,9 @@ func HandleUpdateHoState(txn *transaction.Transaction, response *models.UpdateSm
 			smContext.SubPduSessLog.Warnf("PDUSessionSMContextUpdate, SMContext state [%v] should be SmStateActive",
 				smContext.SMContextState.String())
 		}
-		smContext.ChangeState(smf_context.SmStateModify)
+		if err := smContext.ChangeState(smf_context.SmStateModify); err != nil {
+			return err
+		}
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 		smContext.HoState = models.HoState_PREPARED
 		response.JsonData.HoState = models.HoState_PREPARED
@@ -267,10 +376,13 @@ func HandleUpdateHoState(txn *transaction.Transaction, response *models.UpdateSm
 			smContext.SubPduSessLog.Warnf("PDUSessionSMContextUpdate, SMContext state[%v] should be SmStateActive",
 				smContext.SMContextState.String())
 		}
-		smContext.ChangeState(smf_context.SmStateModify)
+		if err := smContext.ChangeState(smf_context.SmStateModify); err != nil {
+			return err
+		}
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 		smContext.HoState = models.HoState_COMPLETED
 		response.JsonData.HoState = models.HoState_COMPLETED
+		NotifySmfEvent(smContext, models.SmfEvent_UP_PATH_CH, models.EventNotification{})
 	}
 	return nil
 }
@@ -303,7 +415,9 @@ func HandleUpdateCause(txn *transaction.Transaction, response *models.UpdateSmCo
 
 		smContext.SubCtxLog.Infof("PDUSessionSMContextUpdate, Cause_REL_DUE_TO_DUPLICATE_SESSION_ID")
 
-		smContext.ChangeState(smf_context.SmStatePfcpModify)
+		if err := smContext.ChangeState(smf_context.SmStatePfcpModify); err != nil {
+			return err
+		}
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 
 		//releaseTunnel(smContext)
@@ -330,12 +444,13 @@ func HandleUpdateN2Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 			smContext.SubPduSessLog.Warnf("PDUSessionSMContextUpdate, SMContext state[%v] should be Active",
 				smContext.SMContextState.String())
 		}
-		smContext.ChangeState(smf_context.SmStateModify)
+		if err := smContext.ChangeState(smf_context.SmStateModify); err != nil {
+			return err
+		}
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 		pdrList := []*smf_context.PDR{}
 		farList := []*smf_context.FAR{}
 
-		smContext.PendingUPF = make(smf_context.PendingUPF)
 		for _, dataPath := range tunnel.DataPathPool {
 			if dataPath.Activated {
 				ANUPF := dataPath.FirstDPNode
@@ -355,9 +470,6 @@ func HandleUpdateN2Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 					pdrList = append(pdrList, DLPDR)
 					farList = append(farList, DLPDR.FAR)
 
-					if _, exist := smContext.PendingUPF[ANUPF.GetNodeIP()]; !exist {
-						smContext.PendingUPF[ANUPF.GetNodeIP()] = true
-					}
 				}
 			}
 		}
@@ -371,7 +483,9 @@ func HandleUpdateN2Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 		pfcpParam.farList = append(pfcpParam.farList, farList...)
 
 		pfcpAction.sendPfcpModify = true
-		smContext.ChangeState(smf_context.SmStatePfcpModify)
+		if err := smContext.ChangeState(smf_context.SmStatePfcpModify); err != nil {
+			return err
+		}
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 	case models.N2SmInfoType_PDU_RES_SETUP_FAIL:
 		smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, N2 SM info type %v received",
@@ -391,12 +505,15 @@ func HandleUpdateN2Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 				smContext.SubPduSessLog.Warnf("PDUSessionSMContextUpdate, SMContext state[%v] should be ActivePending",
 					smContext.SMContextState.String())
 			}
-			smContext.ChangeState(smf_context.SmStateInit)
+			if err := smContext.ChangeState(smf_context.SmStateInit); err != nil {
+				return err
+			}
 			smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 			smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, send Update SmContext Response")
 			response.JsonData.UpCnxState = models.UpCnxState_DEACTIVATED
 
 			smContext.PDUSessionRelease_DUE_TO_DUP_PDU_ID = false
+			NotifySmfEvent(smContext, models.SmfEvent_PDU_SES_REL, models.EventNotification{})
 			smf_context.RemoveSMContext(smContext.Ref)
 			problemDetails, err := consumer.SendSMContextStatusNotification(smContext.SmStatusNotifyUri)
 			if problemDetails != nil || err != nil {
@@ -410,6 +527,13 @@ func HandleUpdateN2Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 			} else {
 				smContext.SubPduSessLog.Traceln("PDUSessionSMContextUpdate, send SMContext Status Notification successfully")
 			}
+		} else if smContext.SMContextState == smf_context.SmStateActive && smContext.IsLadnReleasePending() {
+			//AN resources released, UE left LADN service area but PDU session is kept
+			if err := smContext.ChangeState(smf_context.SmStateModify); err != nil {
+				return err
+			}
+			smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
+			response.JsonData.UpCnxState = models.UpCnxState_DEACTIVATED
 		} else { // normal case
 			if smContext.SMContextState != smf_context.SmStateInActivePending {
 				// Wait till the state becomes Active again
@@ -418,9 +542,30 @@ func HandleUpdateN2Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 					smContext.SMContextState.String())
 			}
 			smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, send Update SmContext Response")
-			smContext.ChangeState(smf_context.SmStateInActivePending)
+			if err := smContext.ChangeState(smf_context.SmStateInActivePending); err != nil {
+				return err
+			}
 			smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 		}
+	case models.N2SmInfoType_PDU_RES_MOD_RSP:
+		smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, N2 SM info type %v received",
+			smContextUpdateData.N2SmInfoType)
+		//Policy update is committed once UE and UPFs accepted it
+		if failedFlows, err := smf_context.HandlePDUSessionResourceModifyResponseTransfer(
+			body.BinaryDataN2SmInformation, smContext); err != nil {
+			smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, handle PDUSessionResourceModifyResponseTransfer: %+v", err)
+		} else if len(failedFlows) > 0 {
+			HandleNwModificationResourceFailure(smContext, failedFlows)
+		}
+	case models.N2SmInfoType_PDU_RES_NTY:
+		smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, N2 SM info type %v received",
+			smContextUpdateData.N2SmInfoType)
+		if notifiedFlows, err := smf_context.HandlePDUSessionResourceNotifyTransfer(
+			body.BinaryDataN2SmInformation, smContext); err != nil {
+			smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, handle PDUSessionResourceNotifyTransfer: %+v", err)
+		} else {
+			reportQosNotification(smContext, notifiedFlows)
+		}
 	case models.N2SmInfoType_PATH_SWITCH_REQ:
 		smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, N2 SM info type %v received",
 			smContextUpdateData.N2SmInfoType)
@@ -431,11 +576,15 @@ func HandleUpdateN2Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 			smContext.SubPduSessLog.Warnf("PDUSessionSMContextUpdate, SMContext state[%v] should be Active",
 				smContext.SMContextState.String())
 		}
-		smContext.ChangeState(smf_context.SmStateModify)
+		if err := smContext.ChangeState(smf_context.SmStateModify); err != nil {
+			return err
+		}
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 
 		if err := smf_context.HandlePathSwitchRequestTransfer(body.BinaryDataN2SmInformation, smContext); err != nil {
 			smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, handle PathSwitchRequestTransfer: %+v", err)
+		} else {
+			NotifySmfEvent(smContext, models.SmfEvent_UP_PATH_CH, models.EventNotification{})
 		}
 
 		if n2Buf, err := smf_context.BuildPathSwitchRequestAcknowledgeTransfer(smContext); err != nil {
@@ -451,7 +600,6 @@ func HandleUpdateN2Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 
 		pdrList := []*smf_context.PDR{}
 		farList := []*smf_context.FAR{}
-		smContext.PendingUPF = make(smf_context.PendingUPF)
 		for _, dataPath := range tunnel.DataPathPool {
 			if dataPath.Activated {
 				ANUPF := dataPath.FirstDPNode
@@ -460,9 +608,6 @@ func HandleUpdateN2Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 					pdrList = append(pdrList, DLPDR)
 					farList = append(farList, DLPDR.FAR)
 
-					if _, exist := smContext.PendingUPF[ANUPF.GetNodeIP()]; !exist {
-						smContext.PendingUPF[ANUPF.GetNodeIP()] = true
-					}
 				}
 			}
 		}
@@ -471,7 +616,9 @@ func HandleUpdateN2Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 		pfcpParam.farList = append(pfcpParam.farList, farList...)
 
 		pfcpAction.sendPfcpModify = true
-		smContext.ChangeState(smf_context.SmStatePfcpModify)
+		if err := smContext.ChangeState(smf_context.SmStatePfcpModify); err != nil {
+			return err
+		}
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 	case models.N2SmInfoType_PATH_SWITCH_SETUP_FAIL:
 		smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, N2 SM info type %v received",
@@ -482,7 +629,9 @@ func HandleUpdateN2Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 			smContext.SubPduSessLog.Warnf("PDUSessionSMContextUpdate, SMContext state[%v] should be SmStateActive",
 				smContext.SMContextState.String())
 		}
-		smContext.ChangeState(smf_context.SmStateModify)
+		if err := smContext.ChangeState(smf_context.SmStateModify); err != nil {
+			return err
+		}
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 		if err :=
 			smf_context.HandlePathSwitchRequestSetupFailedTransfer(body.BinaryDataN2SmInformation, smContext); err != nil {
@@ -497,7 +646,9 @@ func HandleUpdateN2Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 			smContext.SubPduSessLog.Warnf("PDUSessionSMContextUpdate, SMContext state[%v] should be SmStateActive",
 				smContext.SMContextState.String())
 		}
-		smContext.ChangeState(smf_context.SmStateModify)
+		if err := smContext.ChangeState(smf_context.SmStateModify); err != nil {
+			return err
+		}
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 		response.JsonData.N2SmInfo = &models.RefToBinaryData{ContentId: "Handover"}
 	}
@@ -0,0 +1,317 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/free5gc/nas"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/consumer"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/transaction"
+)
+
+//startPduSessModification sends PDU Session Modification Command for policy update at head of
+//SmPolicyUpdates(TS 23.502 4.3.3.2), UPFs are updated on Modification Complete and update is
+//committed once they accepted it. Update is dropped if UE rejects it or can't be reached.
+//Caller holds SM context lock
+func startPduSessModification(smContext *smf_context.SMContext, pti uint8) error {
+	smContext.Pti = pti
+
+	rspCause, err := sendPduSessModificationN1N2Transfer(smContext, true)
+	if err != nil {
+		smContext.CommitSmPolicyDecisionLocked(false)
+		return err
+	}
+	switch rspCause {
+	case models.N1N2MessageTransferCause_ATTEMPTING_TO_REACH_UE:
+		//Failure to reach UE comes as N1N2 transfer failure notification
+		smContext.SubPduSessLog.Infof("PDU session modification, UE is being paged")
+	case models.N1N2MessageTransferCause_WAITING_FOR_ASYNCHRONOUS_TRANSFER:
+		smContext.SubPduSessLog.Infof("PDU session modification, AMF delivers once UE is reachable")
+	}
+
+	//Network initiated
+	startT3591(smContext, smContext.NewGsmProcedure(pti, 0, nas.MsgTypePDUSessionModificationCommand, nil))
+	return nil
+}
+
+//continuePduSessModification runs policy updates queued while modification was in progress,
+//caller holds SM context lock
+func continuePduSessModification(smContext *smf_context.SMContext) {
+	//Session is being released, queued updates are dropped
+	switch smContext.SMContextState {
+	case smf_context.SmStatePfcpRelease, smf_context.SmStateInActivePending, smf_context.SmStateInit:
+		for len(smContext.SmPolicyUpdates) > 0 {
+			smContext.CommitSmPolicyDecisionLocked(false)
+		}
+		return
+	}
+
+	for len(smContext.SmPolicyUpdates) > 0 && !smContext.IsNwModificationPending() {
+		if !smContext.SmPolicyUpdates[0].IsQosChanged() {
+			smContext.CommitSmPolicyDecisionLocked(true)
+			continue
+		}
+		//Network initiated
+		if err := startPduSessModification(smContext, 0); err != nil {
+			smContext.SubPduSessLog.Errorf("queued PDU session modification failed, %v", err)
+		}
+	}
+}
+
+//startT3591 retransmits PDU Session Modification Command of procedure till UE answers, modification
+//is aborted once retransmissions run out. Caller holds SM context lock
+func startT3591(smContext *smf_context.SMContext, procedure *smf_context.GsmProcedure) {
+	var t3591 *smf_context.GsmTimer
+	t3591 = smf_context.NewGsmTimer(smf_context.SMF_Self().T3591,
+		func(expireTimes int) {
+			smContext.SMLock.Lock()
+			defer smContext.SMLock.Unlock()
+			//Stopped meanwhile
+			if procedure.Timer != t3591 {
+				return
+			}
+			smContext.SubPduSessLog.Warnf("T3591 expired [%v] times, resending PDU Session Modification Command", expireTimes)
+			procedure.RetransmitTimes = expireTimes
+			smContext.Pti = procedure.Pti
+			//AN resources were modified with first Modification Command
+			if _, err := sendPduSessModificationN1N2Transfer(smContext, false); err != nil {
+				smContext.SubPduSessLog.Warnf("PDU Session Modification Command resend failed, %v", err)
+			}
+		},
+		func() {
+			smContext.SMLock.Lock()
+			defer smContext.SMLock.Unlock()
+			if procedure.Timer != t3591 {
+				return
+			}
+			smContext.SubPduSessLog.Warnf("T3591 retransmissions exhausted, PDU session modification aborted")
+			abortPduSessModification(smContext)
+		})
+	procedure.Timer = t3591
+	t3591.Start()
+}
+
+//stopT3591 completes modification procedure awaiting UE, caller holds SM context lock
+func stopT3591(smContext *smf_context.SMContext) {
+	if procedure := smContext.PendingGsmProcedure(nas.MsgTypePDUSessionModificationCommand); procedure != nil {
+		smContext.CompleteGsmProcedure(procedure)
+	}
+}
+
+//resumePduSessModification runs queued policy updates once SM context lock is released, AMF may
+//be waiting for answer to Update SM Context and isn't blocked on it. Caller holds SM context lock
+func resumePduSessModification(smContext *smf_context.SMContext) {
+	if len(smContext.SmPolicyUpdates) == 0 {
+		return
+	}
+	go func() {
+		smContext.SMLock.Lock()
+		defer smContext.SMLock.Unlock()
+		continuePduSessModification(smContext)
+	}()
+}
+
+//abortPduSessModification drops policy update or anchor UPF relocation UE didn't accept, session
+//goes on with previous one and queued policy updates are run. Caller holds SM context lock
+func abortPduSessModification(smContext *smf_context.SMContext) {
+	stopT3591(smContext)
+	if smContext.IsAnchorRelocationPending() {
+		smContext.SubPduSessLog.Warnf("anchor UPF relocation aborted")
+		smContext.StopAnchorRelocation()
+		return
+	}
+	smContext.CommitSmPolicyDecisionLocked(false)
+	resumePduSessModification(smContext)
+}
+
+//HandleNwModificationComplete updates UPFs with policy update UE accepted, caller holds SM context lock
+func HandleNwModificationComplete(smContext *smf_context.SMContext) error {
+	if !smContext.IsNwModificationPending() {
+		smContext.SubPduSessLog.Warnf("PDU Session Modification Complete, no modification in progress")
+		return nil
+	}
+	stopT3591(smContext)
+	if smContext.IsAnchorRelocationPending() {
+		smContext.AnchorRelocation.Acknowledged = true
+		smContext.SubPduSessLog.Infof("anchor UPF relocation accepted by UE, released once address lifetime expires")
+		resumePduSessModification(smContext)
+		return nil
+	}
+	smContext.SubPduSessLog.Infof("PDU session modification accepted by UE")
+	return modifyPduSessUserPlane(smContext)
+}
+
+//modifyPduSessUserPlane sends PFCP Session Modification built from PCC rules of policy update at
+//head of SmPolicyUpdates(TS 23.502 4.3.3.2 step 11), update is committed once UPFs accepted it
+//and rolled back otherwise. Caller holds SM context lock
+func modifyPduSessUserPlane(smContext *smf_context.SMContext) error {
+	updates, err := smContext.BuildPccRulePdrs()
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("PDU session modification, PFCP rules not built, %v", err)
+		abortPduSessModification(smContext)
+		return nil
+	}
+	if len(updates) == 0 {
+		smContext.CommitSmPolicyDecisionLocked(true)
+		smContext.SubPduSessLog.Infof("PDU session modification completed")
+		resumePduSessModification(smContext)
+		return nil
+	}
+
+	onRsp := func(status smf_context.PFCPSessionResponseStatus) smf_context.SMContextState {
+		accepted := status == smf_context.SessionUpdateSuccess
+		smContext.CommitPccRulePdrs(updates, accepted)
+		if accepted {
+			smContext.CommitSmPolicyDecisionLocked(true)
+			smContext.SubPduSessLog.Infof("PDU session modification completed")
+		} else {
+			smContext.SubPduSessLog.Errorf("PDU session modification, pfcp session modify error: %v", status)
+			smContext.CommitSmPolicyDecisionLocked(false)
+		}
+		resumePduSessModification(smContext)
+		return smf_context.SmStateActive
+	}
+	if err := smContext.ChangeState(smf_context.SmStatePfcpModify); err != nil {
+		smContext.CommitPccRulePdrs(updates, false)
+		abortPduSessModification(smContext)
+		return err
+	}
+	smContext.SubCtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
+	if !sendPccRulePfcpSessionModifyReq(smContext, updates, onRsp) {
+		if err := smContext.ChangeState(onRsp(smf_context.SessionUpdateFailed)); err != nil {
+			return err
+		}
+		smContext.SubCtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
+	}
+	return nil
+}
+
+//HandleNwModificationCommandReject rolls back policy update UE rejected, caller holds SM context lock
+func HandleNwModificationCommandReject(smContext *smf_context.SMContext, cause uint8) {
+	if !smContext.IsNwModificationPending() {
+		smContext.SubPduSessLog.Warnf("PDU Session Modification Command Reject, no modification in progress")
+		return
+	}
+	smContext.SubPduSessLog.Warnf("PDU Session Modification Command rejected, cause [%v]", cause)
+	abortPduSessModification(smContext)
+}
+
+//HandleNwModificationResourceFailure rolls back policy update RAN failed to set up QoS flows of,
+//PCF is told PCC rules bound to them are inactive(TS 29.512 4.2.4.15). Caller holds SM context lock
+func HandleNwModificationResourceFailure(smContext *smf_context.SMContext, failedFlows []uint8) {
+	if !smContext.IsNwModificationPending() || smContext.IsAnchorRelocationPending() {
+		return
+	}
+	smContext.SubPduSessLog.Warnf("PDU session resource modify failed for QoS flows %v, PDU session modification aborted",
+		failedFlows)
+
+	ruleReport := models.RuleReport{
+		RuleStatus:  models.RuleStatus_INACTIVE,
+		FailureCode: models.FailureCode_RES_ALLO_FAIL,
+	}
+	for _, qfi := range failedFlows {
+		ruleReport.PccRuleIds = append(ruleReport.PccRuleIds, smContext.SmPolicyUpdates[0].PccRuleIdsOfQosFlow(qfi)...)
+	}
+	abortPduSessModification(smContext)
+	if len(ruleReport.PccRuleIds) == 0 {
+		return
+	}
+
+	smPolicyDecision, _, err := consumer.SendSMPolicyAssociationUpdate(smContext,
+		models.SmPolicyUpdateContextData{RuleReports: []models.RuleReport{ruleReport}})
+	if err != nil {
+		smContext.SubPduSessLog.Warnf("PCC rules %v failure report to PCF failed, %v", ruleReport.PccRuleIds, err)
+		return
+	}
+	if err := applySmPolicyDecision(smContext, smPolicyDecision); err != nil {
+		smContext.SubPduSessLog.Errorf("SM policy decision on PCC rule failure not applied, %v", err)
+	}
+}
+
+//HandleNwModificationN1N2TransFailInd rolls back policy update if UE couldn't be reached
+//with PDU Session Modification Command
+func HandleNwModificationN1N2TransFailInd(eventData interface{}) error {
+	txn := eventData.(*transaction.Transaction)
+	request := txn.Req.(models.N1N2MsgTxfrFailureNotification)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+
+	if !smContext.IsNwModificationPending() {
+		return nil
+	}
+	smContext.SubPduSessLog.Warnf("N1N2 transfer failure notification, cause [%v], PDU session modification aborted",
+		request.Cause)
+	abortPduSessModification(smContext)
+	return nil
+}
+
+//sendPduSessModificationN1N2Transfer sends PDU Session Modification Command to UE, with
+//AN resource modification if asked for. AMF pages UE if idle
+func sendPduSessModificationN1N2Transfer(smContext *smf_context.SMContext,
+	withN2 bool) (models.N1N2MessageTransferCause, error) {
+	n1n2Request := models.N1N2MessageTransferRequest{
+		JsonData: &models.N1N2MessageTransferReqData{
+			PduSessionId: smContext.PDUSessionID,
+			N1n2FailureTxfNotifURI: fmt.Sprintf("%s://%s:%d%s",
+				smf_context.SMF_Self().URIScheme,
+				smf_context.SMF_Self().RegisterIPv4,
+				smf_context.SMF_Self().SBIPort,
+				"/nsmf-callback/sm-n1n2failnotify/"+smContext.Ref),
+		},
+	}
+
+	//N1 Msg
+	smNasBuf, err := smf_context.BuildGSMPDUSessionModificationCommand(smContext)
+	if err != nil {
+		return "", fmt.Errorf("build GSM PDUSessionModificationCommand failed, %v", err)
+	}
+	n1n2Request.BinaryDataN1Message = smNasBuf
+	n1n2Request.JsonData.N1MessageContainer = &models.N1MessageContainer{
+		N1MessageClass:   "SM",
+		N1MessageContent: &models.RefToBinaryData{ContentId: "GSM_NAS"},
+	}
+
+	//N2 Msg
+	if withN2 {
+		if n2Pdu, err := smf_context.BuildPDUSessionResourceModifyRequestTransfer(smContext); err != nil {
+			smContext.SubPduSessLog.Errorf("build PDUSessionResourceModifyRequestTransfer failed, %v", err)
+		} else {
+			n1n2Request.BinaryDataN2Information = n2Pdu
+			n1n2Request.JsonData.N2InfoContainer = &models.N2InfoContainer{
+				N2InformationClass: models.N2InformationClass_SM,
+				SmInfo: &models.N2SmInformation{
+					PduSessionId: smContext.PDUSessionID,
+					N2InfoContent: &models.N2InfoContent{
+						NgapIeType: models.NgapIeType_PDU_RES_MOD_REQ,
+						NgapData:   &models.RefToBinaryData{ContentId: "N2SmInformation"},
+					},
+					SNssai: smContext.Snssai,
+				},
+			}
+		}
+	}
+
+	rspData, _, err := smContext.
+		CommunicationClient.
+		N1N2MessageCollectionDocumentApi.
+		N1N2MessageTransfer(context.Background(), smContext.Supi, n1n2Request)
+	if err != nil {
+		return "", err
+	}
+	switch rspData.Cause {
+	case models.N1N2MessageTransferCause_N1_MSG_NOT_TRANSFERRED,
+		models.N1N2MessageTransferCause_UE_NOT_REACHABLE_FOR_SESSION,
+		models.N1N2MessageTransferCause_UE_NOT_RESPONDING:
+		return rspData.Cause, fmt.Errorf("N1N2MessageTransfer failure, %v", rspData.Cause)
+	}
+	smContext.SubPduSessLog.Infof("PDU Session Modification Command sent, N1N2 transfer [%v]", rspData.Cause)
+	return rspData.Cause, nil
+}
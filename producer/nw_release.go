@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/free5gc/nas"
+	"github.com/free5gc/openapi/models"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/transaction"
+)
+
+//HandleNwInitiatedPduSessionRelease releases PDU session on network's request(TS 23.502 4.3.4.2),
+//txn carries 5GSM cause of PDU Session Release Command
+func HandleNwInitiatedPduSessionRelease(eventData interface{}) error {
+	txn := eventData.(*transaction.Transaction)
+	cause := txn.Req.(uint8)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+
+	return releasePduSessionByNetwork(smContext, txn, cause)
+}
+
+//releasePduSessionByNetwork releases UP resources and sends PDU Session Release Command to UE,
+//SM context is released on Release Complete or once UE can't be reached. txn is answered
+//once UPFs answered. Caller holds SM context lock
+func releasePduSessionByNetwork(smContext *smf_context.SMContext, txn *transaction.Transaction, cause uint8) error {
+	if smContext.SMContextState != smf_context.SmStateActive {
+		smContext.SubPduSessLog.Infof("network requested release, PDU session in state [%v], skipped",
+			smContext.SMContextState.String())
+		return nil
+	}
+
+	smContext.SubPduSessLog.Infof("network requested release, cause [%v]", cause)
+	if smContext.IsNwModificationPending() {
+		abortPduSessModification(smContext)
+	}
+	smContext.ReleaseCause5gSMValue = cause
+	//Network initiated procedure
+	smContext.Pti = 0
+
+	onRsp := func(status smf_context.PFCPSessionResponseStatus) smf_context.SMContextState {
+		if status != smf_context.SessionReleaseSuccess {
+			smContext.SubCtxLog.Errorf("NwInitiatedPduSessionRelease, pfcp session release error: %v ", status)
+		}
+		sendNwPduSessRelease(smContext, cause)
+		return smf_context.SmStateInActivePending
+	}
+	if err := smContext.ChangeState(smf_context.SmStatePfcpRelease); err != nil {
+		return err
+	}
+	smContext.SubCtxLog.Traceln("NwInitiatedPduSessionRelease, SMContextState Change State: ", smContext.SMContextState.String())
+	if !SendPfcpSessionReleaseReq(smContext, txn, onRsp) {
+		if err := smContext.ChangeState(onRsp(smf_context.SessionReleaseSuccess)); err != nil {
+			return err
+		}
+		smContext.SubCtxLog.Traceln("NwInitiatedPduSessionRelease, SMContextState Change State: ", smContext.SMContextState.String())
+	}
+	return nil
+}
+
+//sendNwPduSessRelease sends PDU Session Release Command once UP is released, session waits
+//for PDU Session Release Complete. Caller holds SM context lock
+func sendNwPduSessRelease(smContext *smf_context.SMContext, cause uint8) {
+	if smContext.IsHsmf() {
+		//V-SMF may be waiting on this H-SMF, it releases H-SMF side after Release Complete
+		go func() {
+			if err := sendVsmfPduSessionRelease(smContext, cause); err != nil {
+				smContext.SubPduSessLog.Errorf("V-SMF PDU session release failed, %v", err)
+			}
+		}()
+		return
+	}
+
+	rspCause, err := sendPduSessReleaseN1N2Transfer(smContext, smContext.UpCnxState != models.UpCnxState_DEACTIVATED)
+	if err != nil {
+		smContext.SubPduSessLog.Warnf("network requested release, PDU Session Release Command not delivered, %v", err)
+		releaseSMContextLocally(smContext, true)
+		return
+	}
+	if rspCause == models.N1N2MessageTransferCause_ATTEMPTING_TO_REACH_UE {
+		//Failure to reach UE comes as N1N2 transfer failure notification
+		smContext.SubPduSessLog.Infof("network requested release, UE is being paged")
+	}
+
+	startT3592(smContext)
+}
+
+//startT3592 retransmits PDU Session Release Command till UE answers, SM context is
+//released locally once retransmissions run out. Caller holds SM context lock
+func startT3592(smContext *smf_context.SMContext) {
+	//Network initiated
+	procedure := smContext.NewGsmProcedure(smContext.Pti, 0, nas.MsgTypePDUSessionReleaseCommand, nil)
+
+	var t3592 *smf_context.GsmTimer
+	t3592 = smf_context.NewGsmTimer(smf_context.SMF_Self().T3592,
+		func(expireTimes int) {
+			smContext.SMLock.Lock()
+			defer smContext.SMLock.Unlock()
+			//Stopped meanwhile
+			if procedure.Timer != t3592 {
+				return
+			}
+			smContext.SubPduSessLog.Warnf("T3592 expired [%v] times, resending PDU Session Release Command", expireTimes)
+			procedure.RetransmitTimes = expireTimes
+			smContext.Pti = procedure.Pti
+			//AN resources were released with first Release Command
+			if _, err := sendPduSessReleaseN1N2Transfer(smContext, false); err != nil {
+				smContext.SubPduSessLog.Warnf("PDU Session Release Command resend failed, %v", err)
+			}
+		},
+		func() {
+			smContext.SMLock.Lock()
+			if procedure.Timer != t3592 {
+				smContext.SMLock.Unlock()
+				return
+			}
+			smContext.CompleteGsmProcedure(procedure)
+			smContext.SMLock.Unlock()
+
+			smContext.SubPduSessLog.Warnf("T3592 retransmissions exhausted, releasing PDU session locally")
+			ReleaseSMContextLocally(smContext, true)
+		})
+	procedure.Timer = t3592
+	t3592.Start()
+}
+
+//stopT3592 completes release procedure awaiting UE, caller holds SM context lock
+func stopT3592(smContext *smf_context.SMContext) {
+	if procedure := smContext.PendingGsmProcedure(nas.MsgTypePDUSessionReleaseCommand); procedure != nil {
+		smContext.CompleteGsmProcedure(procedure)
+	}
+}
+
+//HandleNwReleaseComplete releases SM context once UE confirmed network requested release,
+//AMF is notified. Caller holds SM context lock
+func HandleNwReleaseComplete(smContext *smf_context.SMContext) {
+	stopT3592(smContext)
+	releaseSMContextLocally(smContext, true)
+}
+
+//HandleNwReleaseN1N2TransFailInd releases SM context locally if UE couldn't be reached
+//with PDU Session Release Command
+func HandleNwReleaseN1N2TransFailInd(eventData interface{}) error {
+	txn := eventData.(*transaction.Transaction)
+	request := txn.Req.(models.N1N2MsgTxfrFailureNotification)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+
+	if !smContext.IsNwReleaseInProgress() {
+		smContext.SubPduSessLog.Infof("N1N2 transfer failure notification, cause [%v], no network requested release in progress",
+			request.Cause)
+		return nil
+	}
+
+	smContext.SubPduSessLog.Infof("N1N2 transfer failure notification, cause [%v], releasing PDU session locally", request.Cause)
+	stopT3592(smContext)
+	releaseSMContextLocally(smContext, true)
+	return nil
+}
+
+//sendPduSessReleaseN1N2Transfer sends network requested PDU Session Release Command to UE,
+//with AN resource release if asked for. AMF pages UE if idle
+func sendPduSessReleaseN1N2Transfer(smContext *smf_context.SMContext,
+	withN2 bool) (models.N1N2MessageTransferCause, error) {
+	n1n2Request := models.N1N2MessageTransferRequest{
+		JsonData: &models.N1N2MessageTransferReqData{
+			PduSessionId: smContext.PDUSessionID,
+			N1n2FailureTxfNotifURI: fmt.Sprintf("%s://%s:%d%s",
+				smf_context.SMF_Self().URIScheme,
+				smf_context.SMF_Self().RegisterIPv4,
+				smf_context.SMF_Self().SBIPort,
+				"/nsmf-callback/sm-n1n2failnotify/"+smContext.Ref),
+		},
+	}
+
+	//N1 Msg
+	smNasBuf, err := smf_context.BuildGSMPDUSessionReleaseCommand(smContext, smContext.ReleaseCause5gSMValue)
+	if err != nil {
+		return "", fmt.Errorf("build GSM PDUSessionReleaseCommand failed, %v", err)
+	}
+	n1n2Request.BinaryDataN1Message = smNasBuf
+	n1n2Request.JsonData.N1MessageContainer = &models.N1MessageContainer{
+		N1MessageClass:   "SM",
+		N1MessageContent: &models.RefToBinaryData{ContentId: "GSM_NAS"},
+	}
+
+	//N2 Msg
+	if withN2 {
+		if n2Pdu, err := smf_context.BuildPDUSessionResourceReleaseCommandTransfer(smContext); err != nil {
+			smContext.SubPduSessLog.Errorf("build PDUSessionResourceReleaseCommandTransfer failed, %v", err)
+		} else {
+			n1n2Request.BinaryDataN2Information = n2Pdu
+			n1n2Request.JsonData.N2InfoContainer = &models.N2InfoContainer{
+				N2InformationClass: models.N2InformationClass_SM,
+				SmInfo: &models.N2SmInformation{
+					PduSessionId: smContext.PDUSessionID,
+					N2InfoContent: &models.N2InfoContent{
+						NgapIeType: models.NgapIeType_PDU_RES_REL_CMD,
+						NgapData:   &models.RefToBinaryData{ContentId: "N2SmInformation"},
+					},
+					SNssai: smContext.Snssai,
+				},
+			}
+		}
+	}
+
+	rspData, _, err := smContext.
+		CommunicationClient.
+		N1N2MessageCollectionDocumentApi.
+		N1N2MessageTransfer(context.Background(), smContext.Supi, n1n2Request)
+	if err != nil {
+		return "", err
+	}
+	switch rspData.Cause {
+	case models.N1N2MessageTransferCause_N1_MSG_NOT_TRANSFERRED,
+		models.N1N2MessageTransferCause_UE_NOT_REACHABLE_FOR_SESSION,
+		models.N1N2MessageTransferCause_UE_NOT_RESPONDING:
+		return rspData.Cause, fmt.Errorf("N1N2MessageTransfer failure, %v", rspData.Cause)
+	}
+	smContext.SubPduSessLog.Infof("PDU Session Release Command sent, cause [%v], N1N2 transfer [%v]",
+		smContext.ReleaseCause5gSMValue, rspData.Cause)
+	return rspData.Cause, nil
+}
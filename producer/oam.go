@@ -7,10 +7,13 @@ package producer
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/nas/nasMessage"
 	"github.com/free5gc/openapi/models"
 	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/logger"
 )
 
 type PDUSessionInfo struct {
@@ -58,3 +61,113 @@ func HandleOAMGetUEPDUSessionInfo(smContextRef string) *http_wrapper.Response {
 	}
 	return httpResponse
 }
+
+type PDUSessionHistory struct {
+	Ref          string
+	Supi         string
+	PDUSessionID string
+	State        string
+	History      []context.SMTxnRecord
+}
+
+func HandleOAMGetSMContextHistory(smContextRef string) *http_wrapper.Response {
+	smContext := context.GetSMContext(smContextRef)
+	if smContext == nil {
+		httpResponse := &http_wrapper.Response{
+			Header: nil,
+			Status: http.StatusNotFound,
+			Body:   nil,
+		}
+
+		return httpResponse
+	}
+
+	httpResponse := &http_wrapper.Response{
+		Header: nil,
+		Status: http.StatusOK,
+		Body: PDUSessionHistory{
+			Ref:          smContext.Ref,
+			Supi:         smContext.Supi,
+			PDUSessionID: strconv.Itoa(int(smContext.PDUSessionID)),
+			State:        smContext.SMContextState.String(),
+			History:      smContext.TxnHistory(),
+		},
+	}
+	return httpResponse
+}
+
+//HandleOAMReleasePDUSession starts network requested release of PDU session, it is accepted
+//before UE is informed
+func HandleOAMReleasePDUSession(smContextRef string) *http_wrapper.Response {
+	smContext := context.GetSMContext(smContextRef)
+	if smContext == nil {
+		return &http_wrapper.Response{
+			Header: nil,
+			Status: http.StatusNotFound,
+			Body:   nil,
+		}
+	}
+
+	smContext.SubPduSessLog.Infof("OAM requested PDU session release")
+	context.RequestNwRelease(smContext, nasMessage.Cause5GSMRegularDeactivation)
+	return &http_wrapper.Response{
+		Header: nil,
+		Status: http.StatusAccepted,
+		Body:   nil,
+	}
+}
+
+//CongestionRuleInfo is congestion rule over OAM, back-off timer in seconds
+type CongestionRuleInfo struct {
+	SNssai       *models.Snssai `json:"sNssai,omitempty"`
+	Dnn          string         `json:"dnn,omitempty"`
+	MaxSessions  int            `json:"maxSessions,omitempty"`
+	BackOffTimer int            `json:"backOffTimer,omitempty"`
+	Active       bool           `json:"active"`
+}
+
+func HandleOAMGetCongestionControl() *http_wrapper.Response {
+	rules := context.SMF_Self().CongestionControl.Rules()
+	body := make([]CongestionRuleInfo, 0, len(rules))
+	for _, rule := range rules {
+		body = append(body, CongestionRuleInfo{
+			SNssai:       rule.Snssai,
+			Dnn:          rule.Dnn,
+			MaxSessions:  rule.MaxSessions,
+			BackOffTimer: int(rule.BackOffTimer.Seconds()),
+			Active:       rule.Active,
+		})
+	}
+
+	return &http_wrapper.Response{
+		Header: nil,
+		Status: http.StatusOK,
+		Body:   body,
+	}
+}
+
+//HandleOAMSetCongestionControl activates or deactivates congestion of S-NSSAI and/or DNN
+func HandleOAMSetCongestionControl(request CongestionRuleInfo) *http_wrapper.Response {
+	if request.SNssai == nil && request.Dnn == "" {
+		return &http_wrapper.Response{
+			Header: nil,
+			Status: http.StatusBadRequest,
+			Body: models.ProblemDetails{
+				Title:  "Invalid congestion rule",
+				Status: http.StatusBadRequest,
+				Detail: "sNssai or dnn is required",
+			},
+		}
+	}
+
+	logger.PduSessLog.Infof("OAM congestion control of S-NSSAI [%+v] DNN [%v] set active [%v]",
+		request.SNssai, request.Dnn, request.Active)
+	context.SMF_Self().CongestionControl.Activate(request.SNssai, request.Dnn, request.Active,
+		time.Duration(request.BackOffTimer)*time.Second)
+
+	return &http_wrapper.Response{
+		Header: nil,
+		Status: http.StatusNoContent,
+		Body:   nil,
+	}
+}
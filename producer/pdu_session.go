@@ -7,7 +7,9 @@ package producer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 
 	"github.com/antihax/optional"
@@ -15,6 +17,7 @@ import (
 	"github.com/free5gc/smf/metrics"
 	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
 	"github.com/free5gc/smf/qos"
+	"github.com/free5gc/smf/radius"
 	"github.com/free5gc/smf/transaction"
 
 	"github.com/free5gc/http_wrapper"
@@ -72,10 +75,10 @@ func HandlePduSessionContextReplacement(smCtxtRef string) error {
 	return nil
 }
 
-func HandlePDUSessionSMContextCreate(eventData interface{}) error {
+func HandlePDUSessionSMContextCreate(eventData interface{}) (err error) {
 
 	txn := eventData.(*transaction.Transaction)
-	request := txn.Req.(models.PostSmContextsRequest)
+	request := txn.Req.(smf_context.PostSmContextsRequest)
 	smContext := txn.Ctxt.(*smf_context.SMContext)
 
 	//GSM State
@@ -93,7 +96,7 @@ func HandlePDUSessionSMContextCreate(eventData interface{}) error {
 		return fmt.Errorf("GsmMsgDecodeError")
 	}
 
-	createData := request.JsonData
+	createData := &request.JsonData.SmContextCreateData
 
 	//Create SM context
 	//smContext := smf_context.NewSMContext(createData.Supi, createData.PduSessionId)
@@ -106,49 +109,159 @@ func HandlePDUSessionSMContextCreate(eventData interface{}) error {
 	smContext.SMLock.Lock()
 	defer smContext.SMLock.Unlock()
 
+	//Session transferred from another SMF keeps its UE IP if possible
+	var transfer *smf_context.SMContextTransfer
+	if request.JsonData.SmContextTransfer == "" && createData.UeEpsPdnConnection != "" {
+		//Moved from EPS, PDN connection maps to PDU session
+		conn, err := smf_context.DecodeEpsPdnConnection(createData.UeEpsPdnConnection)
+		if err != nil {
+			smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, %v", err)
+			txn.Rsp = formContextCreateErrRsp(http.StatusBadRequest, &models.ProblemDetails{
+				Title:  "Invalid UE EPS PDN connection",
+				Status: http.StatusBadRequest,
+				Cause:  "MANDATORY_IE_INCORRECT",
+				Detail: err.Error(),
+			}, nil)
+			return fmt.Errorf("UeEpsPdnConnectionError")
+		}
+		transfer = conn.SMContextTransfer()
+	} else if request.JsonData.SmContextTransfer != "" {
+		var err error
+		if transfer, err = smf_context.DecodeSMContextTransfer(request.JsonData.SmContextTransfer); err != nil {
+			smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, %v", err)
+			txn.Rsp = formContextCreateErrRsp(http.StatusBadRequest, &models.ProblemDetails{
+				Title:  "Invalid SM context transfer",
+				Status: http.StatusBadRequest,
+				Cause:  "MANDATORY_IE_INCORRECT",
+				Detail: err.Error(),
+			}, nil)
+			return fmt.Errorf("SmContextTransferError")
+		}
+	}
+
+	//DNN/S-NSSAI based congestion control once local checks passed, UE is rejected with back-off
+	//timer. Admitted session stops counting if it's rejected later on
+	admitted := false
+	defer func() {
+		if admitted && err != nil {
+			smf_context.SMF_Self().CongestionControl.Release(smContext)
+		}
+	}()
+	admit := func() error {
+		if cause, ok := smf_context.SMF_Self().CongestionControl.Admit(smContext); !ok {
+			smContext.SubPduSessLog.Warnf("PDUSessionSMContextCreate, session not admitted, %v", cause)
+			txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject(cause)
+			return errors.New(cause)
+		}
+		admitted = true
+		return nil
+	}
+
+	//UDM-Fetch Subscription Data based on servingnetwork.plmn and dnn, snssai
+	var smPlmnID *models.PlmnId
+	if createData.ServingNetwork != nil {
+		smPlmnID = createData.ServingNetwork
+	} else {
+		smContext.SubPduSessLog.Infof("ServingNetwork not received from AMF, so taking from guami")
+		smPlmnID = createData.Guami.PlmnId
+	}
+
+	if smf_context.IsHomeRoutedSession(createData) {
+		//Home-routed roaming, SMF acts as V-SMF
+		if err := admit(); err != nil {
+			return err
+		}
+		if rsp, err := setupVsmfPduSession(smContext, createData, m.PDUSessionEstablishmentRequest,
+			request.BinaryDataN1SmMessage); err != nil {
+			txn.Rsp = rsp
+			return err
+		}
+	} else if cause, err := checkPduSession(smContext, smPlmnID, m.PDUSessionEstablishmentRequest); err != nil {
+		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject(cause)
+		return err
+	} else if err := admit(); err != nil {
+		return err
+	} else if smContext.DNNInfo.SecondaryAuth != nil {
+		//Rest of establishment follows authentication of UE by DN-AAA
+		smContext.StartSecondaryAuth(m.PDUSessionEstablishmentRequest, transfer)
+	} else if cause, err := setupPduSession(smContext, m.PDUSessionEstablishmentRequest, transfer); err != nil {
+		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject(cause)
+		return err
+	}
+
+	//AMF Selection for SMF -> AMF communication
+	if problemDetails, err := consumer.SendNFDiscoveryServingAMF(smContext); err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, send NF Discovery Serving AMF Error[%v]", err)
+		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("AMFDiscoveryFailure")
+		return fmt.Errorf("AmfError")
+	} else if problemDetails != nil {
+		smContext.SubPduSessLog.Warnf("PDUSessionSMContextCreate, send NF Discovery Serving AMF Problem[%+v]", problemDetails)
+		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("AMFDiscoveryFailure")
+		return fmt.Errorf("AmfError")
+	} else {
+		smContext.SubPduSessLog.Traceln("PDUSessionSMContextCreate, Send NF Discovery Serving AMF success")
+	}
+
+	for _, service := range *smContext.AMFProfile.NfServices {
+		if service.ServiceName == models.ServiceName_NAMF_COMM {
+			communicationConf := Namf_Communication.NewConfiguration()
+			communicationConf.SetBasePath(service.ApiPrefix)
+			smContext.CommunicationClient = Namf_Communication.NewAPIClient(communicationConf)
+		}
+	}
+
+	//Serving SMF registration, home-routed session is registered by H-SMF
+	if !smContext.IsVsmf() {
+		registerWithUdm(smContext)
+	}
+
+	response.JsonData = smContext.BuildCreatedData()
+	txn.Rsp = &http_wrapper.Response{
+		Header: http.Header{
+			"Location": {smContext.Ref},
+		},
+		Status: http.StatusCreated,
+		Body:   response,
+	}
+
+	smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, PDU session context create success ")
+
+	return nil
+}
+
+//checkPduSession checks DNN and SSC mode of new PDU session against config and subscription
+//retrieved from UDM(TS 23.502 4.3.2.2.1), returns cause of PDU Session Establishment Reject on failure
+func checkPduSession(smContext *smf_context.SMContext, smPlmnID *models.PlmnId,
+	establishmentRequest *nasMessage.PDUSessionEstablishmentRequest) (string, error) {
+
 	// DNN Information from config
-	smContext.DNNInfo = smf_context.RetrieveDnnInformation(*createData.SNssai, createData.Dnn)
+	smContext.DNNInfo = smf_context.RetrieveDnnInformation(*smContext.Snssai, smContext.Dnn)
 	if smContext.DNNInfo == nil {
 		smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, S-NSSAI[sst: %d, sd: %s] DNN[%s] not matched DNN Config",
-			createData.SNssai.Sst, createData.SNssai.Sd, createData.Dnn)
-		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("DnnNotSupported")
-		return fmt.Errorf("SnssaiError")
+			smContext.Snssai.Sst, smContext.Snssai.Sd, smContext.Dnn)
+		return "DnnNotSupported", fmt.Errorf("SnssaiError")
+	}
+
+	//LADN DNN is available in its service area only(TS 23.501 5.6.5)
+	if smContext.IsOutOfLadnServiceArea() {
+		smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, UE out of LADN service area of DNN[%s]", smContext.Dnn)
+		return "OutOfLadnServiceArea", fmt.Errorf("OutOfLadnServiceArea")
 	}
 
 	// Query UDM
 	if problemDetails, err := consumer.SendNFDiscoveryUDM(); err != nil {
 		smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, send NF Discovery Serving UDM Error[%v]", err)
-		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("UDMDiscoveryFailure")
-		return fmt.Errorf("UdmError")
+		return "UDMDiscoveryFailure", fmt.Errorf("UdmError")
 	} else if problemDetails != nil {
 		smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, send NF Discovery Serving UDM Problem[%+v]", problemDetails)
-		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("UDMDiscoveryFailure")
-		return fmt.Errorf("UdmError")
+		return "UDMDiscoveryFailure", fmt.Errorf("UdmError")
 	} else {
 		smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, send NF Discovery Serving UDM Successful")
 	}
 
-	// IP Allocation
-	if ip, err := smContext.DNNInfo.UeIPAllocator.Allocate(); err != nil {
-		smContext.SubPduSessLog.Errorln("PDUSessionSMContextCreate, failed allocate IP address: ", err)
-		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("IpAllocError")
-		return fmt.Errorf("IpAllocError")
-	} else {
-		smContext.PDUAddress = ip
-		smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, IP alloc success IP[%s]",
-			smContext.PDUAddress.String())
-	}
-
 	//UDM-Fetch Subscription Data based on servingnetwork.plmn and dnn, snssai
-	var smPlmnID *models.PlmnId
-	if createData.ServingNetwork != nil {
-		smPlmnID = createData.ServingNetwork
-	} else {
-		smContext.SubPduSessLog.Infof("ServingNetwork not received from AMF, so taking from guami")
-		smPlmnID = createData.Guami.PlmnId
-	}
 	smDataParams := &Nudm_SubscriberDataManagement.GetSmDataParamOpts{
-		Dnn:         optional.NewString(createData.Dnn),
+		Dnn:         optional.NewString(smContext.Dnn),
 		PlmnId:      optional.NewInterface(smPlmnID.Mcc + smPlmnID.Mnc),
 		SingleNssai: optional.NewInterface(openapi.MarshToJsonString(smContext.Snssai)),
 	}
@@ -161,8 +274,7 @@ func HandlePDUSessionSMContextCreate(eventData interface{}) error {
 		GetSmData(context.Background(), smContext.Supi, smDataParams); err != nil {
 		metrics.IncrementSvcUdmMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmSubscriptionDataRetrieval), "In", http.StatusText(rsp.StatusCode), err.Error())
 		smContext.SubPduSessLog.Errorln("PDUSessionSMContextCreate, get SessionManagementSubscriptionData error: ", err)
-		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("SubscriptionDataFetchError")
-		return fmt.Errorf("SubscriptionError")
+		return "SubscriptionDataFetchError", fmt.Errorf("SubscriptionError")
 	} else {
 		defer func() {
 			if rspCloseErr := rsp.Body.Close(); rspCloseErr != nil {
@@ -176,19 +288,54 @@ func HandlePDUSessionSMContextCreate(eventData interface{}) error {
 		} else {
 			metrics.IncrementSvcUdmMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmSubscriptionDataRetrieval), "In", http.StatusText(rsp.StatusCode), "NilSubscriptionData")
 			smContext.SubPduSessLog.Errorln("PDUSessionSMContextCreate, SessionManagementSubscriptionData from UDM is nil")
-			txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("SubscriptionDataLenError")
-			return fmt.Errorf("NoSubscriptionError")
+			return "SubscriptionDataLenError", fmt.Errorf("NoSubscriptionError")
 		}
 	}
 
+	if err := smContext.SelectSscMode(establishmentRequest); err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, %v", err)
+		return "SscModeNotAllowed", err
+	}
+	return "", nil
+}
+
+//setupPduSession does UE IP allocation, PCF interaction and UP path selection of new PDU session
+//checkPduSession accepted, returns cause of PDU Session Establishment Reject on failure
+func setupPduSession(smContext *smf_context.SMContext,
+	establishmentRequest *nasMessage.PDUSessionEstablishmentRequest,
+	transfer *smf_context.SMContextTransfer) (string, error) {
+
+	// IP Allocation
+	if transfer != nil && smContext.ApplySMContextTransfer(transfer) {
+		smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, transferred IP[%s] retained",
+			smContext.PDUAddress.String())
+	} else if smContext.ApplySecondaryAuthIP() {
+		smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, IP[%s] assigned by DN-AAA",
+			smContext.PDUAddress.String())
+	} else if ip, err := smContext.DNNInfo.UeIPAllocator.Allocate(); err != nil {
+		smContext.SubPduSessLog.Errorln("PDUSessionSMContextCreate, failed allocate IP address: ", err)
+		return "IpAllocError", fmt.Errorf("IpAllocError")
+	} else {
+		smContext.PDUAddress = ip
+		smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, IP alloc success IP[%s]",
+			smContext.PDUAddress.String())
+		if transfer != nil {
+			NotifyUeIpChange(smContext, net.ParseIP(transfer.UeIpv4Addr), ip)
+		}
+		notifyAnchorRelocated(smContext)
+	}
+
+	//Session AMBR authorized by DN-AAA is sent to PCF as subscribed one
+	if auth := smContext.SecondaryAuth; auth != nil && auth.SessionAmbr != nil {
+		smContext.DnnConfiguration.SessionAmbr = auth.SessionAmbr
+	}
+
 	//Decode UE content(PCO)
-	establishmentRequest := m.PDUSessionEstablishmentRequest
 	smContext.HandlePDUSessionEstablishmentRequest(establishmentRequest)
 
 	if err := smContext.PCFSelection(); err != nil {
 		smContext.SubPduSessLog.Errorln("PDUSessionSMContextCreate, send NF Discovery Serving PCF Error[%v]", err)
-		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("PCFDiscoveryFailure")
-		return fmt.Errorf("PcfError")
+		return "PCFDiscoveryFailure", fmt.Errorf("PcfError")
 	}
 	smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, send NF Discovery Serving PCF success")
 
@@ -198,13 +345,11 @@ func HandlePDUSessionSMContextCreate(eventData interface{}) error {
 	if smPolicyDecisionRsp, httpStatus, err := consumer.SendSMPolicyAssociationCreate(smContext); err != nil {
 		metrics.IncrementSvcPcfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmPolicyAssociationCreate), "In", http.StatusText(httpStatus), err.Error())
 		smContext.SubPduSessLog.Errorln("PDUSessionSMContextCreate, SMPolicyAssociationCreate error: ", err)
-		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("PCFPolicyCreateFailure")
-		return fmt.Errorf("PcfAssoError")
+		return "PCFPolicyCreateFailure", fmt.Errorf("PcfAssoError")
 	} else if httpStatus != http.StatusCreated {
 		metrics.IncrementSvcPcfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmPolicyAssociationCreate), "In", http.StatusText(httpStatus), "error")
 		smContext.SubPduSessLog.Errorln("PDUSessionSMContextCreate, SMPolicyAssociationCreate http status: ", http.StatusText(httpStatus))
-		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("PCFPolicyCreateFailure")
-		return fmt.Errorf("PcfAssoError")
+		return "PCFPolicyCreateFailure", fmt.Errorf("PcfAssoError")
 	} else {
 		smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, Policy association create success")
 		smPolicyDecision = smPolicyDecisionRsp
@@ -223,81 +368,47 @@ func HandlePDUSessionSMContextCreate(eventData interface{}) error {
 	smContext.Tunnel = smf_context.NewUPTunnel()
 	var defaultPath *smf_context.DataPath
 	upfSelectionParams := &smf_context.UPFSelectionParams{
-		Dnn: createData.Dnn,
+		Dnn: smContext.Dnn,
 		SNssai: &smf_context.SNssai{
-			Sst: createData.SNssai.Sst,
-			Sd:  createData.SNssai.Sd,
+			Sst: smContext.Snssai.Sst,
+			Sd:  smContext.Snssai.Sd,
 		},
 	}
 
-	if smf_context.SMF_Self().ULCLSupport && smf_context.CheckUEHasPreConfig(createData.Supi) {
-		smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, SUPI[%s] has pre-config route", createData.Supi)
-		uePreConfigPaths := smf_context.GetUEPreConfigPaths(createData.Supi)
+	if smf_context.SMF_Self().ULCLSupport && smf_context.CheckUEHasPreConfig(smContext.Supi) {
+		smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, SUPI[%s] has pre-config route", smContext.Supi)
+		uePreConfigPaths := smf_context.GetUEPreConfigPaths(smContext.Supi)
 		smContext.Tunnel.DataPathPool = uePreConfigPaths.DataPathPool
 		smContext.Tunnel.PathIDGenerator = uePreConfigPaths.PathIDGenerator
 		defaultPath = smContext.Tunnel.DataPathPool.GetDefaultPath()
 		defaultPath.ActivateTunnelAndPDR(smContext, 255)
-		smContext.BPManager = smf_context.NewBPManager(createData.Supi)
+		smContext.BPManager = smf_context.NewBPManager(smContext.Supi)
 	} else {
 		// UE has no pre-config path.
 		// Use default route
 		smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, no pre-config route")
-		defaultUPPath := smf_context.GetUserPlaneInformation().GetDefaultUserPlanePathByDNN(upfSelectionParams)
+		defaultUPPath := smContext.SelectUPPath(upfSelectionParams)
 		defaultPath = smf_context.GenerateDataPath(defaultUPPath, smContext)
 		if defaultPath != nil {
 			defaultPath.IsDefaultPath = true
 			smContext.Tunnel.AddDataPath(defaultPath)
 			if err := defaultPath.ActivateTunnelAndPDR(smContext, 255); err != nil {
 				smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, data path error: %v", err.Error())
-				txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("UPFDataPathError")
-				return fmt.Errorf("DataPathError")
+				return "UPFDataPathError", fmt.Errorf("DataPathError")
 			}
 		}
 	}
 
 	if defaultPath == nil {
-		smContext.ChangeState(smf_context.SmStateInit)
+		if err := smContext.ChangeState(smf_context.SmStateInit); err != nil {
+			return "InsufficientResourceSliceDnn", err
+		}
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextCreate, SMContextState Change State: ", smContext.SMContextState.String())
 		smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, data path not found for selection param %v", upfSelectionParams.String())
-
-		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("InsufficientResourceSliceDnn")
-		return fmt.Errorf("InsufficientResourceSliceDnn")
-	}
-
-	//AMF Selection for SMF -> AMF communication
-	if problemDetails, err := consumer.SendNFDiscoveryServingAMF(smContext); err != nil {
-		smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, send NF Discovery Serving AMF Error[%v]", err)
-		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("AMFDiscoveryFailure")
-		return fmt.Errorf("AmfError")
-	} else if problemDetails != nil {
-		smContext.SubPduSessLog.Warnf("PDUSessionSMContextCreate, send NF Discovery Serving AMF Problem[%+v]", problemDetails)
-		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("AMFDiscoveryFailure")
-		return fmt.Errorf("AmfError")
-	} else {
-		smContext.SubPduSessLog.Traceln("PDUSessionSMContextCreate, Send NF Discovery Serving AMF success")
-	}
-
-	for _, service := range *smContext.AMFProfile.NfServices {
-		if service.ServiceName == models.ServiceName_NAMF_COMM {
-			communicationConf := Namf_Communication.NewConfiguration()
-			communicationConf.SetBasePath(service.ApiPrefix)
-			smContext.CommunicationClient = Namf_Communication.NewAPIClient(communicationConf)
-		}
-	}
-
-	response.JsonData = smContext.BuildCreatedData()
-	txn.Rsp = &http_wrapper.Response{
-		Header: http.Header{
-			"Location": {smContext.Ref},
-		},
-		Status: http.StatusCreated,
-		Body:   response,
+		return "InsufficientResourceSliceDnn", fmt.Errorf("InsufficientResourceSliceDnn")
 	}
 
-	smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, PDU session context create success ")
-
-	return nil
-	// TODO: UECM registration
+	return "", nil
 }
 
 func HandlePDUSessionSMContextUpdate(eventData interface{}) error {
@@ -313,6 +424,9 @@ func HandlePDUSessionSMContextUpdate(eventData interface{}) error {
 	var response models.UpdateSmContextResponse
 	response.JsonData = new(models.SmContextUpdatedData)
 
+	//PLMN, access type, RAT and location change
+	updateUeAccessInfo(smContext, txn.Req.(models.UpdateSmContextRequest).JsonData)
+
 	//N1 Msg Handling
 	if err := HandleUpdateN1Msg(txn, &response, pfcpAction); err != nil {
 		return err
@@ -351,64 +465,68 @@ func HandlePDUSessionSMContextUpdate(eventData interface{}) error {
 	case smf_context.SmStatePfcpModify:
 
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, ctxt in PFCP Modification State")
-		var err error
 
 		//Initiate PFCP Delete
 		if pfcpAction.sendPfcpDelete {
 			smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, send PFCP Deletion")
-			smContext.ChangeState(smf_context.SmStatePfcpRelease)
-			smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
-
-			//Initiate PFCP Release
-			if err = SendPfcpSessionReleaseReq(smContext); err != nil {
-				smContext.SubCtxLog.Errorf("pfcp session release error: %v ", err.Error())
+			if err := smContext.ChangeState(smf_context.SmStatePfcpRelease); err != nil {
+				return err
 			}
-
-			//Change state to InactivePending
-			smContext.ChangeState(smf_context.SmStateInActivePending)
 			smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 
 			//Update response to success
-			httpResponse = &http_wrapper.Response{
+			txn.Rsp = &http_wrapper.Response{
 				Status: http.StatusOK,
 				Body:   response,
 			}
 
+			//Initiate PFCP Release, wait for PDU Session Release Complete
+			if !SendPfcpSessionReleaseReq(smContext, txn, onPfcpReleaseInActivePending(smContext)) {
+				if err := smContext.ChangeState(smf_context.SmStateInActivePending); err != nil {
+					return err
+				}
+				smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
+			}
+			return nil
+
 		} else if pfcpAction.sendPfcpModify {
-			smContext.ChangeState(smf_context.SmStatePfcpModify)
+			if err := smContext.ChangeState(smf_context.SmStatePfcpModify); err != nil {
+				return err
+			}
 			smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 			smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, send PFCP Modification")
 
-			//Initiate PFCP Modify
-			if err = SendPfcpSessionModifyReq(smContext, pfcpParam); err != nil {
-				//Modify failure
-				smContext.SubCtxLog.Errorf("pfcp session modify error: %v ", err.Error())
-
-				//Form Modify err rsp
-				httpResponse = makePduCtxtModifyErrRsp(smContext, err.Error())
-
-				//PFCP Modify Err, initiate release
-				SendPfcpSessionReleaseReq(smContext)
-
-				//Change state to InactivePending
-				smContext.ChangeState(smf_context.SmStateInActivePending)
-				smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
-
-			} else {
-				//Modify Success
-				httpResponse = &http_wrapper.Response{
-					Status: http.StatusOK,
-					Body:   response,
+			//Initiate PFCP Modify, update is answered once UPF answered
+			onRsp := func(status smf_context.PFCPSessionResponseStatus) smf_context.SMContextState {
+				if status == smf_context.SessionUpdateSuccess {
+					//Modify Success
+					txn.Rsp = &http_wrapper.Response{
+						Status: http.StatusOK,
+						Body:   response,
+					}
+					return smf_context.SmStateActive
 				}
-
-				smContext.ChangeState(smf_context.SmStateActive)
-				smContext.SubCtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
+				return failPduCtxtModify(smContext, txn, status)
+			}
+			if !SendPfcpSessionModifyReq(smContext, pfcpParam, txn, onRsp) {
+				if err := smContext.ChangeState(failPduCtxtModify(smContext, txn, smf_context.SessionUpdateFailed)); err != nil {
+					return err
+				}
+				smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 			}
+			return nil
+		}
+		//UPFs are updated by procedure of its own(e.g. policy update UE accepted)
+		httpResponse = &http_wrapper.Response{
+			Status: http.StatusOK,
+			Body:   response,
 		}
 
 	case smf_context.SmStateModify:
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, ctxt in Modification Pending")
-		smContext.ChangeState(smf_context.SmStateActive)
+		if err := smContext.ChangeState(smf_context.SmStateActive); err != nil {
+			return err
+		}
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
 		httpResponse = &http_wrapper.Response{
 			Status: http.StatusOK,
@@ -432,6 +550,34 @@ func HandlePDUSessionSMContextUpdate(eventData interface{}) error {
 	return nil
 }
 
+//failPduCtxtModify answers update with PDU session release once PFCP modification failed,
+//UP of session is released. Returns state SM context settles in
+func failPduCtxtModify(smContext *smf_context.SMContext, txn *transaction.Transaction,
+	status smf_context.PFCPSessionResponseStatus) smf_context.SMContextState {
+	//Modify failure
+	smContext.SubCtxLog.Errorf("pfcp session modify error: %v ", status)
+
+	//Form Modify err rsp
+	txn.Rsp = makePduCtxtModifyErrRsp(smContext, "pfcp modification failure")
+
+	//PFCP Modify Err, initiate release
+	if SendPfcpSessionReleaseReq(smContext, txn, onPfcpReleaseInActivePending(smContext)) {
+		return smf_context.SmStatePfcpRelease
+	}
+	return smf_context.SmStateInActivePending
+}
+
+//onPfcpReleaseInActivePending completes PFCP release of session waiting for
+//PDU Session Release Complete or release of SM context
+func onPfcpReleaseInActivePending(smContext *smf_context.SMContext) func(smf_context.PFCPSessionResponseStatus) smf_context.SMContextState {
+	return func(status smf_context.PFCPSessionResponseStatus) smf_context.SMContextState {
+		if status != smf_context.SessionReleaseSuccess {
+			smContext.SubCtxLog.Errorf("pfcp session release error: %v ", status)
+		}
+		return smf_context.SmStateInActivePending
+	}
+}
+
 func makePduCtxtModifyErrRsp(smContext *smf_context.SMContext, errStr string) *http_wrapper.Response {
 
 	problemDetail := models.ProblemDetails{
@@ -442,7 +588,7 @@ func makePduCtxtModifyErrRsp(smContext *smf_context.SMContext, errStr string) *h
 	}
 	var n1buf, n2buf []byte
 	var err error
-	if n1buf, err = smf_context.BuildGSMPDUSessionReleaseCommand(smContext); err != nil {
+	if n1buf, err = smf_context.BuildGSMPDUSessionReleaseCommand(smContext, nasMessage.Cause5GSMRegularDeactivation); err != nil {
 		smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, build GSM PDUSessionReleaseCommand failed: %+v", err)
 	}
 
@@ -468,28 +614,6 @@ func makePduCtxtModifyErrRsp(smContext *smf_context.SMContext, errStr string) *h
 	return httpResponse
 }
 
-/*
-func HandleNwInitiatedPduSessionRelease(smContextRef string) {
-	smContext := smf_context.GetSMContext(smContextRef)
-	PFCPResponseStatus := <-smContext.SBIPFCPCommunicationChan
-
-	switch PFCPResponseStatus {
-	case smf_context.SessionReleaseSuccess:
-		smContext.SubCtxLog.Traceln("PDUSessionSMContextRelease, PFCP SessionReleaseSuccess")
-		smContext.ChangeState(smf_context.SmStateInActivePending)
-		smContext.SubCtxLog.Traceln("PDUSessionSMContextRelease, SMContextState Change State: ", smContext.SMContextState.String())
-	//TODO: i will uncomment this in next PR SDCORE-209
-	//case smf_context.SessionReleaseTimeout:
-	//	fallthrough
-	case smf_context.SessionReleaseFailed:
-		smContext.SubCtxLog.Traceln("PDUSessionSMContextRelease, PFCP SessionReleaseFailed")
-		smContext.ChangeState(smf_context.SmStateInActivePending)
-		smContext.SubCtxLog.Traceln("PDUSessionSMContextRelease,  SMContextState Change State: ", smContext.SMContextState.String())
-	}
-
-	smf_context.RemoveSMContext(smContext.Ref)
-}
-*/
 func HandlePDUSessionSMContextRelease(eventData interface{}) error {
 	txn := eventData.(*transaction.Transaction)
 	body := txn.Req.(models.ReleaseSmContextRequest)
@@ -500,48 +624,43 @@ func HandlePDUSessionSMContextRelease(eventData interface{}) error {
 
 	smContext.SubPduSessLog.Infof("PDUSessionSMContextRelease, PDU Session SMContext Release received")
 
-	//Send Policy delete
-	metrics.IncrementSvcPcfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmPolicyAssociationDelete), "Out", "", "")
-	if httpStatus, err := consumer.SendSMPolicyAssociationDelete(smContext, &body); err != nil {
-		metrics.IncrementSvcPcfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmPolicyAssociationDelete), "In", http.StatusText(httpStatus), err.Error())
-		smContext.SubCtxLog.Errorf("PDUSessionSMContextRelease, SM policy delete error [%v] ", err.Error())
-	} else {
-		metrics.IncrementSvcPcfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmPolicyAssociationDelete), "In", http.StatusText(httpStatus), "")
-		smContext.SubCtxLog.Infof("PDUSessionSMContextRelease, SM policy delete success with http status [%v] ", httpStatus)
-	}
+	deregisterFromUdm(smContext)
 
-	//Release UE IP-Address
-	if ip := smContext.PDUAddress; ip != nil {
-		smContext.SubPduSessLog.Infof("Release IP[%s]", smContext.PDUAddress.String())
-		smContext.DNNInfo.UeIPAllocator.Release(ip)
+	//Home-routed session, policy and UE IP are owned by H-SMF
+	if smContext.IsVsmf() {
+		releaseHsmfPduSession(smContext)
+	} else {
+		releaseSmPolicyAndUeIp(smContext, &body)
 	}
 
 	//Initiate PFCP release
-	smContext.ChangeState(smf_context.SmStatePfcpRelease)
+	if err := smContext.ChangeState(smf_context.SmStatePfcpRelease); err != nil {
+		return err
+	}
 	smContext.SubCtxLog.Traceln("PDUSessionSMContextRelease, SMContextState Change State: ", smContext.SMContextState.String())
 
-	var httpResponse *http_wrapper.Response
-
-	//Release User-plane
-	if ok := releaseTunnel(smContext); !ok {
-		//already released
-		httpResponse = &http_wrapper.Response{
-			Status: http.StatusNoContent,
-			Body:   nil,
-		}
-
-		txn.Rsp = httpResponse
+	//Release User-plane, SM context is released once UPFs answered
+	onRsp := func(status smf_context.PFCPSessionResponseStatus) smf_context.SMContextState {
+		txn.Rsp = makePduCtxtReleaseRsp(smContext, status)
+		NotifySmfEvent(smContext, models.SmfEvent_PDU_SES_REL, models.EventNotification{})
 		smf_context.RemoveSMContext(smContext.Ref)
-		return nil
+		return smf_context.SmStateInit
 	}
+	if !SendPfcpSessionReleaseReq(smContext, txn, onRsp) {
+		//already released
+		return smContext.ChangeState(onRsp(smf_context.SessionReleaseSuccess))
+	}
+	return nil
+}
 
-	PFCPResponseStatus := <-smContext.SBIPFCPCommunicationChan
+//makePduCtxtReleaseRsp answers Release SM Context depending on PFCP release outcome
+func makePduCtxtReleaseRsp(smContext *smf_context.SMContext,
+	PFCPResponseStatus smf_context.PFCPSessionResponseStatus) *http_wrapper.Response {
+	var httpResponse *http_wrapper.Response
 
 	switch PFCPResponseStatus {
 	case smf_context.SessionReleaseSuccess:
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextRelease, PFCP SessionReleaseSuccess")
-		smContext.ChangeState(smf_context.SmStateInit)
-		smContext.SubCtxLog.Traceln("PDUSessionSMContextRelease, SMContextState Change State: ", smContext.SMContextState.String())
 		httpResponse = &http_wrapper.Response{
 			Status: http.StatusNoContent,
 			Body:   nil,
@@ -549,12 +668,11 @@ func HandlePDUSessionSMContextRelease(eventData interface{}) error {
 
 	case smf_context.SessionReleaseTimeout:
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextRelease, PFCP SessionReleaseTimeout")
-		smContext.ChangeState(smf_context.SmStateActive)
 		httpResponse = &http_wrapper.Response{
 			Status: int(http.StatusInternalServerError),
 		}
 
-	case smf_context.SessionReleaseFailed:
+	default:
 		// Update SmContext Request(N1 PDU Session Release Request)
 		// Send PDU Session Release Reject
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextRelease, PFCP SessionReleaseFailed")
@@ -565,8 +683,6 @@ func HandlePDUSessionSMContextRelease(eventData interface{}) error {
 		httpResponse = &http_wrapper.Response{
 			Status: int(problemDetail.Status),
 		}
-		smContext.ChangeState(smf_context.SmStateActive)
-		smContext.SubCtxLog.Traceln("PDUSessionSMContextRelease,  SMContextState Change State: ", smContext.SMContextState.String())
 		errResponse := models.UpdateSmContextErrorResponse{
 			JsonData: &models.SmContextUpdateError{
 				Error: &problemDetail,
@@ -580,47 +696,73 @@ func HandlePDUSessionSMContextRelease(eventData interface{}) error {
 
 		errResponse.JsonData.N1SmMsg = &models.RefToBinaryData{ContentId: "PDUSessionReleaseReject"}
 		httpResponse.Body = errResponse
-	default:
-		smContext.SubCtxLog.Warnf("PDUSessionSMContextRelease, The state shouldn't be [%s]\n", PFCPResponseStatus)
+	}
+	return httpResponse
+}
 
-		smContext.SubCtxLog.Traceln("PDUSessionSMContextRelease, in case Unknown")
-		problemDetail := models.ProblemDetails{
-			Status: http.StatusInternalServerError,
-			Cause:  "SYSTEM_FAILULE",
-		}
-		httpResponse = &http_wrapper.Response{
-			Status: int(problemDetail.Status),
-		}
-		smContext.ChangeState(smf_context.SmStateActive)
-		smContext.SubCtxLog.Traceln("PDUSessionSMContextRelease, SMContextState Change State: ", smContext.SMContextState.String())
-		errResponse := models.UpdateSmContextErrorResponse{
-			JsonData: &models.SmContextUpdateError{
-				Error: &problemDetail,
-			},
-		}
-		if buf, err := smf_context.BuildGSMPDUSessionReleaseReject(smContext); err != nil {
-			smContext.SubPduSessLog.Errorf("PDUSessionSMContextRelease, build GSM PDUSessionReleaseReject failed: %+v", err)
-		} else {
-			errResponse.BinaryDataN1SmMessage = buf
-		}
+//releaseSmPolicyAndUeIp deletes SM policy association and frees UE IP of released session
+func releaseSmPolicyAndUeIp(smContext *smf_context.SMContext, body *models.ReleaseSmContextRequest) {
+	//Send Policy delete
+	metrics.IncrementSvcPcfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmPolicyAssociationDelete), "Out", "", "")
+	if httpStatus, err := consumer.SendSMPolicyAssociationDelete(smContext, body); err != nil {
+		metrics.IncrementSvcPcfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmPolicyAssociationDelete), "In", http.StatusText(httpStatus), err.Error())
+		smContext.SubCtxLog.Errorf("PDUSessionSMContextRelease, SM policy delete error [%v] ", err.Error())
+	} else {
+		metrics.IncrementSvcPcfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmPolicyAssociationDelete), "In", http.StatusText(httpStatus), "")
+		smContext.SubCtxLog.Infof("PDUSessionSMContextRelease, SM policy delete success with http status [%v] ", httpStatus)
+	}
 
-		errResponse.JsonData.N1SmMsg = &models.RefToBinaryData{ContentId: "PDUSessionReleaseReject"}
-		httpResponse.Body = errResponse
+	//Release UE IP-Address
+	if ip := smContext.PDUAddress; ip != nil {
+		smContext.SubPduSessLog.Infof("Release IP[%s]", smContext.PDUAddress.String())
+		smContext.DNNInfo.UeIPAllocator.Release(ip)
 	}
+}
 
-	txn.Rsp = httpResponse
-	smf_context.RemoveSMContext(smContext.Ref)
+func HandlePDUSessionSMContextRetrieve(eventData interface{}) error {
+	txn := eventData.(*transaction.Transaction)
+	body := txn.Req.(smf_context.SmContextRetrieveData)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+
+	smContextType := body.RequestedType()
+	smContext.SubPduSessLog.Infof("PDUSessionSMContextRetrieve, SM context retrieve received, type [%v]", smContextType)
 
+	var retrievedData smf_context.SmContextRetrievedData
+	var err error
+	if smContextType == smf_context.SmContextTypeEpsPdnConnection {
+		retrievedData.UeEpsPdnConnection = smContext.BuildEpsPdnConnection().Encode()
+	} else if retrievedData.SmContext, err = smContext.BuildSMContextTransfer(smContextType); err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionSMContextRetrieve, %v", err)
+		txn.Rsp = &http_wrapper.Response{
+			Status: http.StatusBadRequest,
+			Body: models.ProblemDetails{
+				Title:  "Invalid SM context type",
+				Status: http.StatusBadRequest,
+				Cause:  "MANDATORY_IE_INCORRECT",
+				Detail: err.Error(),
+			},
+		}
+		return err
+	}
+
+	txn.Rsp = &http_wrapper.Response{
+		Status: http.StatusOK,
+		Body:   retrievedData,
+	}
+	smContext.SubPduSessLog.Infof("PDUSessionSMContextRetrieve, SM context retrieved")
 	return nil
 }
 
+//releaseTunnel deletes PFCP sessions of session at all UPFs, returns false if none was deleted
 func releaseTunnel(smContext *smf_context.SMContext) bool {
 	if smContext.Tunnel == nil {
 		smContext.SubPduSessLog.Errorf("releaseTunnel, pfcp tunnel already released")
 		return false
 	}
 	deletedPFCPNode := make(map[string]bool)
-	smContext.PendingUPF = make(smf_context.PendingUPF)
 	for _, dataPath := range smContext.Tunnel.DataPathPool {
 		dataPath.DeactivateTunnelAndPDR(smContext)
 		for curDataPathNode := dataPath.FirstDPNode; curDataPathNode != nil; curDataPathNode = curDataPathNode.Next() {
@@ -630,14 +772,14 @@ func releaseTunnel(smContext *smf_context.SMContext) bool {
 				continue
 			}
 			if _, exist := deletedPFCPNode[curUPFID]; !exist {
-				pfcp_message.SendPfcpSessionDeletionRequest(curDataPathNode.UPF.NodeID, smContext)
-				deletedPFCPNode[curUPFID] = true
-				smContext.PendingUPF[curDataPathNode.GetNodeIP()] = true
+				if seqNum := pfcp_message.SendPfcpSessionDeletionRequest(curDataPathNode.UPF.NodeID, smContext); seqNum != 0 {
+					deletedPFCPNode[curUPFID] = true
+				}
 			}
 		}
 	}
 	smContext.Tunnel = nil
-	return true
+	return len(deletedPFCPNode) != 0
 }
 
 func SendPduSessN1N2Transfer(smContext *smf_context.SMContext, success bool) error {
@@ -670,7 +812,15 @@ func SendPduSessN1N2Transfer(smContext *smf_context.SMContext, success bool) err
 	n1n2Request.JsonData = &models.N1N2MessageTransferReqData{PduSessionId: smContext.PDUSessionID}
 
 	if success {
-		if smNasBuf, err := smf_context.BuildGSMPDUSessionEstablishmentAccept(smContext); err != nil {
+		var smNasBuf []byte
+		var err error
+		if smContext.IsVsmf() {
+			//Home-routed session, Accept comes from H-SMF
+			smNasBuf = smContext.Hsmf.N1SmInfoToUe
+		} else {
+			smNasBuf, err = smf_context.BuildGSMPDUSessionEstablishmentAccept(smContext)
+		}
+		if err != nil {
 			logger.PduSessLog.Errorf("Build GSM PDUSessionEstablishmentAccept failed: %s", err)
 		} else {
 			n1n2Request.BinaryDataN1Message = smNasBuf
@@ -685,7 +835,7 @@ func SendPduSessN1N2Transfer(smContext *smf_context.SMContext, success bool) err
 		}
 	} else {
 		if smNasBuf, err := smf_context.BuildGSMPDUSessionEstablishmentReject(smContext,
-			nasMessage.Cause5GSMRequestRejectedUnspecified); err != nil {
+			nasMessage.Cause5GSMRequestRejectedUnspecified, 0); err != nil {
 			logger.PduSessLog.Errorf("Build GSM PDUSessionEstablishmentReject failed: %s", err)
 		} else {
 			n1n2Request.BinaryDataN1Message = smNasBuf
@@ -711,6 +861,13 @@ func SendPduSessN1N2Transfer(smContext *smf_context.SMContext, success bool) err
 
 	smContext.CommitSmPolicyDecision(true)
 	smContext.SubPduSessLog.Infof("N1N2 Transfer completed")
+	if success {
+		NotifySmfEvent(smContext, smf_context.SmfEventPduSesEst, models.EventNotification{
+			TargetUeIpv4Addr: smContext.PDUAddress.String(),
+			AccType:          smContext.AnType,
+		})
+		smContext.SecondaryAuthAccounting(radius.AcctStatusStart)
+	}
 	return nil
 }
 
@@ -721,66 +878,73 @@ func HandlePduSessN1N2TransFailInd(eventData interface{}) error {
 
 	smContext.SubPduSessLog.Infof("In HandlePduSessN1N2TransFailInd, N1N2 Transfer Failure Notification received")
 
-	var httpResponse *http_wrapper.Response
+	pfcpParam := &pfcpParam{
+		pdrList: []*smf_context.PDR{},
+		farList: []*smf_context.FAR{},
+		barList: []*smf_context.BAR{},
+		qerList: []*smf_context.QER{},
+	}
 
-	pdrList := []*smf_context.PDR{}
-	farList := []*smf_context.FAR{}
-	qerList := []*smf_context.QER{}
-	barList := []*smf_context.BAR{}
-
-	if smContext.Tunnel != nil {
-		smContext.PendingUPF = make(smf_context.PendingUPF)
-		for _, dataPath := range smContext.Tunnel.DataPathPool {
-			ANUPF := dataPath.FirstDPNode
-			for _, DLPDR := range ANUPF.DownLinkTunnel.PDR {
-
-				if DLPDR == nil {
-					smContext.SubPduSessLog.Errorf("AN Release Error")
-					return fmt.Errorf("AN Release Error")
-				} else {
-					DLPDR.FAR.ApplyAction = pfcpType.ApplyAction{Buff: false, Drop: true, Dupl: false, Forw: false, Nocp: false}
-					DLPDR.FAR.State = smf_context.RULE_UPDATE
-					smContext.PendingUPF[ANUPF.GetNodeIP()] = true
-					farList = append(farList, DLPDR.FAR)
-				}
-			}
-		}
+	if smContext.Tunnel == nil {
+		httpResponse, nextState := HandlePFCPResponse(smContext, txn, smf_context.SessionUpdateSuccess)
+		txn.Rsp = httpResponse
+		return smContext.ChangeState(nextState)
+	}
 
-		defaultPath := smContext.Tunnel.DataPathPool.GetDefaultPath()
-		ANUPF := defaultPath.FirstDPNode
+	for _, dataPath := range smContext.Tunnel.DataPathPool {
+		ANUPF := dataPath.FirstDPNode
+		for _, DLPDR := range ANUPF.DownLinkTunnel.PDR {
 
-		//Sending PFCP modification with flag set to DROP the packets.
-		pfcp_message.SendPfcpSessionModificationRequest(ANUPF.UPF.NodeID, smContext, pdrList, farList, barList, qerList)
+			if DLPDR == nil {
+				smContext.SubPduSessLog.Errorf("AN Release Error")
+				return fmt.Errorf("AN Release Error")
+			} else {
+				DLPDR.FAR.ApplyAction = pfcpType.ApplyAction{Buff: false, Drop: true, Dupl: false, Forw: false, Nocp: false}
+				DLPDR.FAR.State = smf_context.RULE_UPDATE
+				pfcpParam.farList = append(pfcpParam.farList, DLPDR.FAR)
+			}
+		}
 	}
 
-	//Listening PFCP modification response.
-	PFCPResponseStatus := <-smContext.SBIPFCPCommunicationChan
-
-	httpResponse = HandlePFCPResponse(smContext, PFCPResponseStatus)
-	txn.Rsp = httpResponse
+	//Sending PFCP modification with flag set to DROP the packets, notification is
+	//answered once UPF answered
+	if err := smContext.ChangeState(smf_context.SmStatePfcpModify); err != nil {
+		return err
+	}
+	onRsp := func(status smf_context.PFCPSessionResponseStatus) smf_context.SMContextState {
+		httpResponse, nextState := HandlePFCPResponse(smContext, txn, status)
+		txn.Rsp = httpResponse
+		return nextState
+	}
+	if !SendPfcpSessionModifyReq(smContext, pfcpParam, txn, onRsp) {
+		httpResponse, nextState := HandlePFCPResponse(smContext, txn, smf_context.SessionUpdateFailed)
+		txn.Rsp = httpResponse
+		return smContext.ChangeState(nextState)
+	}
 	return nil
 }
 
 //Handles PFCP response depending upon response cause recevied.
-func HandlePFCPResponse(smContext *smf_context.SMContext,
-	PFCPResponseStatus smf_context.PFCPSessionResponseStatus) *http_wrapper.Response {
+//UP of session is released if UPF didn't answer, txn is answered once done.
+//Returns state SM context settles in
+func HandlePFCPResponse(smContext *smf_context.SMContext, txn *transaction.Transaction,
+	PFCPResponseStatus smf_context.PFCPSessionResponseStatus) (*http_wrapper.Response, smf_context.SMContextState) {
 
 	smContext.SubPfcpLog.Traceln("In HandlePFCPResponse")
 	var httpResponse *http_wrapper.Response
+	nextState := smContext.SMContextState
 
 	switch PFCPResponseStatus {
 	case smf_context.SessionUpdateSuccess:
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, PFCP Session Update Success")
-		smContext.ChangeState(smf_context.SmStateActive)
-		smContext.SubCtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
+		nextState = smf_context.SmStateActive
 		httpResponse = &http_wrapper.Response{
 			Status: http.StatusNoContent,
 			Body:   nil,
 		}
 	case smf_context.SessionUpdateFailed:
 		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, PFCP Session Update Failed")
-		smContext.ChangeState(smf_context.SmStateActive)
-		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
+		nextState = smf_context.SmStateActive
 		// It is just a template
 		httpResponse = &http_wrapper.Response{
 			Status: http.StatusForbidden,
@@ -804,7 +968,7 @@ func HandlePFCPResponse(smContext *smf_context.SMContext,
 		}
 		var n1buf, n2buf []byte
 		var err error
-		if n1buf, err = smf_context.BuildGSMPDUSessionReleaseCommand(smContext); err != nil {
+		if n1buf, err = smf_context.BuildGSMPDUSessionReleaseCommand(smContext, nasMessage.Cause5GSMRegularDeactivation); err != nil {
 			smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, build GSM PDUSessionReleaseCommand failed: %+v", err)
 		}
 
@@ -812,9 +976,6 @@ func HandlePFCPResponse(smContext *smf_context.SMContext,
 			smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, build PDUSessionResourceReleaseCommandTransfer failed: %+v", err)
 		}
 
-		smContext.ChangeState(smf_context.SmStatePfcpModify)
-		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, SMContextState Change State: ", smContext.SMContextState.String())
-
 		// It is just a template
 		httpResponse = &http_wrapper.Response{
 			Status: http.StatusServiceUnavailable,
@@ -830,7 +991,11 @@ func HandlePFCPResponse(smContext *smf_context.SMContext,
 			}, // Depends on the reason why N4 fail
 		}
 
-		SendPfcpSessionReleaseReq(smContext)
+		if SendPfcpSessionReleaseReq(smContext, txn, onPfcpReleaseInActivePending(smContext)) {
+			nextState = smf_context.SmStatePfcpRelease
+		} else {
+			nextState = smf_context.SmStateInActivePending
+		}
 
 	default:
 		smContext.SubPduSessLog.Warnf("PDUSessionSMContextUpdate, SM Context State [%s] shouldn't be here\n", smContext.SMContextState)
@@ -841,5 +1006,5 @@ func HandlePFCPResponse(smContext *smf_context.SMContext,
 	}
 
 	smContext.SubPfcpLog.Traceln("Out HandlePFCPResponse")
-	return httpResponse
+	return httpResponse, nextState
 }
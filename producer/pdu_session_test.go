@@ -0,0 +1,622 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/http2_util"
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/nas"
+	"github.com/free5gc/nas/nasConvert"
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/nas/nasType"
+	"github.com/free5gc/openapi"
+	"github.com/free5gc/openapi/Namf_Communication"
+	"github.com/free5gc/openapi/Nnrf_NFDiscovery"
+	"github.com/free5gc/openapi/models"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/context/smctxtest"
+	"github.com/free5gc/smf/factory"
+	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
+	"github.com/free5gc/smf/producer"
+	"github.com/free5gc/smf/qos"
+	"github.com/free5gc/smf/transaction"
+)
+
+func startStubServer(t *testing.T, router *gin.Engine) *httptest.Server {
+	h2Server, err := http2_util.NewServer("", "", router)
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(router)
+	server.Config = h2Server
+	server.Start()
+	return server
+}
+
+//newEstablishmentRequest encodes PDU Session Establishment Request of UE, modify sets optional IEs
+func newEstablishmentRequest(t *testing.T, pduSessionID uint8,
+	modify func(req *nasMessage.PDUSessionEstablishmentRequest)) []byte {
+	m := nas.NewMessage()
+	m.GsmMessage = nas.NewGsmMessage()
+	m.GsmHeader.SetMessageType(nas.MsgTypePDUSessionEstablishmentRequest)
+	m.GsmHeader.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	m.PDUSessionEstablishmentRequest = nasMessage.NewPDUSessionEstablishmentRequest(0)
+	req := m.PDUSessionEstablishmentRequest
+	req.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	req.SetMessageType(nas.MsgTypePDUSessionEstablishmentRequest)
+	req.SetPDUSessionID(pduSessionID)
+	req.SetPTI(1)
+	if modify != nil {
+		modify(req)
+	}
+
+	buf, err := m.PlainNasEncode()
+	require.NoError(t, err)
+	return buf
+}
+
+//createSMContext runs Create SM Context of AMF on SM context
+func createSMContext(smContext *smf_context.SMContext, createData models.SmContextCreateData,
+	n1SmMsg []byte) (*http_wrapper.Response, error) {
+	txn := transaction.NewTransaction(smf_context.PostSmContextsRequest{
+		JsonData:              &smf_context.SmContextCreateData{SmContextCreateData: createData},
+		BinaryDataN1SmMessage: n1SmMsg,
+	}, nil, svcmsgtypes.CreateSmContext)
+	txn.Ctxt = smContext
+	err := producer.HandlePDUSessionSMContextCreate(txn)
+	return txn.Rsp.(*http_wrapper.Response), err
+}
+
+//establishmentReject decodes PDU Session Establishment Reject Create SM Context is answered with
+func establishmentReject(t *testing.T, rsp *http_wrapper.Response) *nasMessage.PDUSessionEstablishmentReject {
+	body, ok := rsp.Body.(models.PostSmContextsErrorResponse)
+	require.True(t, ok, "not rejected: %+v", rsp.Body)
+	m := nas.NewMessage()
+	require.NoError(t, m.GsmMessageDecode(&body.BinaryDataN1SmMessage))
+	require.Equal(t, nas.MsgTypePDUSessionEstablishmentReject, m.GsmHeader.GetMessageType())
+	return m.PDUSessionEstablishmentReject
+}
+
+func TestCreateRejectedByCongestionControl(t *testing.T) {
+	snssai := &models.Snssai{Sst: 1, Sd: "010203"}
+	self := smf_context.SMF_Self()
+	defer func(cc *smf_context.CongestionControl) { self.CongestionControl = cc }(self.CongestionControl)
+	self.CongestionControl = smf_context.NewCongestionControl(&factory.CongestionControl{
+		Rules: []factory.CongestionRule{
+			{Dnn: "internet", MaxSessions: 1, BackOffTimer: 120},
+		},
+	})
+	//Session passes local checks
+	allocator, err := smf_context.NewIPAllocator("10.60.0.0/24")
+	require.NoError(t, err)
+	setDnnInfo(t, snssai, "internet", &smf_context.SnssaiSmfDnnInfo{UeIPAllocator: allocator})
+	server, _ := stubCoreNetwork(t, models.DnnConfiguration{
+		PduSessionTypes: &models.PduSessionTypes{DefaultSessionType: models.PduSessionType_IPV4},
+		SscModes:        &models.SscModes{DefaultSscMode: models.SscMode__1},
+		SessionAmbr:     &models.Ambr{Uplink: "100 Mbps", Downlink: "100 Mbps"},
+	})
+	defer server.Close()
+
+	//DNN is full
+	admitted := smctxtest.NewSMContext(t, "imsi-2089300007487", 10, smctxtest.WithDnn("internet", snssai))
+	_, ok := self.CongestionControl.Admit(admitted)
+	require.True(t, ok)
+
+	createData := models.SmContextCreateData{
+		Supi:           "imsi-2089300007488",
+		PduSessionId:   10,
+		Dnn:            "internet",
+		SNssai:         snssai,
+		ServingNetwork: &models.PlmnId{Mcc: "208", Mnc: "93"},
+	}
+	smContext := smctxtest.NewSMContext(t, createData.Supi, 10)
+	rsp, err := createSMContext(smContext, createData, newEstablishmentRequest(t, 10, nil))
+	require.Error(t, err)
+	require.Equal(t, http.StatusInternalServerError, rsp.Status)
+
+	//Rejected with T3396 of rule
+	reject := establishmentReject(t, rsp)
+	require.Equal(t, nasMessage.Cause5GSMInsufficientResources, reject.GetCauseValue())
+	require.NotNil(t, reject.BackoffTimerValue)
+	require.Equal(t, nasConvert.GPRSTimer3ToNas(120), reject.BackoffTimerValue.Octet)
+
+	//UE retrying while T3396 runs is rejected even once DNN has room
+	smf_context.RemoveSMContext(admitted.Ref)
+	retry := smctxtest.NewSMContext(t, createData.Supi, 11)
+	createData.PduSessionId = 11
+	rsp, err = createSMContext(retry, createData, newEstablishmentRequest(t, 11, nil))
+	require.Error(t, err)
+	reject = establishmentReject(t, rsp)
+	require.Equal(t, nasMessage.Cause5GSMInsufficientResources, reject.GetCauseValue())
+	require.NotNil(t, reject.BackoffTimerValue)
+}
+
+func TestCreateRejectedReleasesAdmission(t *testing.T) {
+	snssai := &models.Snssai{Sst: 1, Sd: "010203"}
+	self := smf_context.SMF_Self()
+	defer func(cc *smf_context.CongestionControl) { self.CongestionControl = cc }(self.CongestionControl)
+	self.CongestionControl = smf_context.NewCongestionControl(&factory.CongestionControl{
+		Rules: []factory.CongestionRule{{Dnn: "internet", MaxSessions: 1}},
+	})
+	//No UE IP left in DNN pool
+	allocator, err := smf_context.NewIPAllocator("10.60.0.0/30")
+	require.NoError(t, err)
+	for err == nil {
+		_, err = allocator.Allocate()
+	}
+	setDnnInfo(t, snssai, "internet", &smf_context.SnssaiSmfDnnInfo{UeIPAllocator: allocator})
+	setUserPlane(t, singleUPConfig)
+	server, _ := stubCoreNetwork(t, models.DnnConfiguration{
+		PduSessionTypes: &models.PduSessionTypes{DefaultSessionType: models.PduSessionType_IPV4},
+		SscModes:        &models.SscModes{DefaultSscMode: models.SscMode__1},
+		SessionAmbr:     &models.Ambr{Uplink: "100 Mbps", Downlink: "100 Mbps"},
+	})
+	defer server.Close()
+
+	sessions := func() int { return self.CongestionControl.Rules()[0].Sessions() }
+	create := func(supi string, dnn string) *nasMessage.PDUSessionEstablishmentReject {
+		createData := models.SmContextCreateData{
+			Supi:           supi,
+			PduSessionId:   10,
+			Dnn:            dnn,
+			SNssai:         snssai,
+			ServingNetwork: &models.PlmnId{Mcc: "208", Mnc: "93"},
+			AnType:         models.AccessType__3_GPP_ACCESS,
+		}
+		rsp, err := createSMContext(smctxtest.NewSMContext(t, supi, 10), createData, newEstablishmentRequest(t, 10, nil))
+		require.Error(t, err)
+		return establishmentReject(t, rsp)
+	}
+
+	//Failed UE IP allocation after admission
+	create("imsi-2089300007487", "internet")
+	require.Zero(t, sessions())
+	//Failed local checks before admission
+	require.Equal(t, nasMessage.Cause5GMMDNNNotSupportedOrNotSubscribedInTheSlice,
+		create("imsi-2089300007488", "ims").GetCauseValue())
+	require.Zero(t, sessions())
+}
+
+//stubAmf answers N1N2 Message Transfer of SMF, transfers are passed on to test
+func stubAmf(t *testing.T) (*httptest.Server, <-chan models.N1N2MessageTransferRequest) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	transfers := addAmfRoutes(t, router)
+	return startStubServer(t, router), transfers
+}
+
+func addAmfRoutes(t *testing.T, router *gin.Engine) <-chan models.N1N2MessageTransferRequest {
+	transfers := make(chan models.N1N2MessageTransferRequest, 4)
+	router.POST("/namf-comm/v1/ue-contexts/:ueContextId/n1-n2-messages", func(c *gin.Context) {
+		var request models.N1N2MessageTransferRequest
+		require.NoError(t, c.ShouldBindWith(&request, openapi.MultipartRelatedBinding{}))
+		transfers <- request
+		c.JSON(http.StatusOK, models.N1N2MessageTransferRspData{
+			Cause: models.N1N2MessageTransferCause_N1_N2_TRANSFER_INITIATED,
+		})
+	})
+	return transfers
+}
+
+//stubCoreNetwork answers SMF as NRF, UDM, PCF and AMF of UE subscribed to dnnConfiguration,
+//NRF discovers stub for any NF type
+func stubCoreNetwork(t *testing.T, dnnConfiguration models.DnnConfiguration) (*httptest.Server,
+	<-chan models.N1N2MessageTransferRequest) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	var server *httptest.Server
+
+	router.GET("/nnrf-disc/v1/nf-instances", func(c *gin.Context) {
+		services := make([]models.NfService, 0)
+		for _, name := range []models.ServiceName{
+			models.ServiceName_NUDM_SDM, models.ServiceName_NUDM_UECM,
+			models.ServiceName_NPCF_SMPOLICYCONTROL, models.ServiceName_NAMF_COMM,
+		} {
+			services = append(services, models.NfService{ServiceName: name, ApiPrefix: server.URL})
+		}
+		c.JSON(http.StatusOK, models.SearchResult{NfInstances: []models.NfProfile{
+			{NfType: models.NfType(c.Query("target-nf-type")), NfServices: &services},
+		}})
+	})
+	router.GET("/nudm-sdm/v1/:supi/sm-data", func(c *gin.Context) {
+		c.JSON(http.StatusOK, []models.SessionManagementSubscriptionData{{
+			SingleNssai:       &models.Snssai{Sst: 1, Sd: "010203"},
+			DnnConfigurations: map[string]models.DnnConfiguration{c.Query("dnn"): dnnConfiguration},
+		}})
+	})
+	router.POST("/npcf-smpolicycontrol/v1/sm-policies", func(c *gin.Context) {
+		var policyContext models.SmPolicyContextData
+		require.NoError(t, c.ShouldBindJSON(&policyContext))
+		c.Header("Location", server.URL+"/npcf-smpolicycontrol/v1/sm-policies/"+policyContext.Supi)
+		c.JSON(http.StatusCreated, models.SmPolicyDecision{
+			SessRules: map[string]*models.SessionRule{
+				"SessRuleId-1": {
+					SessRuleId:   "SessRuleId-1",
+					AuthSessAmbr: policyContext.SubsSessAmbr,
+					AuthDefQos:   &models.AuthorizedDefaultQos{Var5qi: 9},
+				},
+			},
+		})
+	})
+	transfers := addAmfRoutes(t, router)
+	server = startStubServer(t, router)
+
+	self := smf_context.SMF_Self()
+	nrf, sdm, uecm := self.NFDiscoveryClient, self.SubscriberDataManagementClient, self.UEContextManagementClient
+	t.Cleanup(func() {
+		self.NFDiscoveryClient, self.SubscriberDataManagementClient, self.UEContextManagementClient = nrf, sdm, uecm
+	})
+	configuration := Nnrf_NFDiscovery.NewConfiguration()
+	configuration.SetBasePath(server.URL)
+	self.NFDiscoveryClient = Nnrf_NFDiscovery.NewAPIClient(configuration)
+	return server, transfers
+}
+
+//setDnnInfo configures DNN of S-NSSAI at SMF for test
+func setDnnInfo(t *testing.T, snssai *models.Snssai, dnn string, dnnInfo *smf_context.SnssaiSmfDnnInfo) {
+	self := smf_context.SMF_Self()
+	snssaiInfos := self.SnssaiInfos
+	t.Cleanup(func() { self.SnssaiInfos = snssaiInfos })
+	self.SnssaiInfos = []smf_context.SnssaiSmfInfo{{
+		Snssai:   smf_context.SNssai{Sst: snssai.Sst, Sd: snssai.Sd},
+		DnnInfos: map[string]*smf_context.SnssaiSmfDnnInfo{dnn: dnnInfo},
+	}}
+}
+
+//establishmentAccept decodes PDU Session Establishment Accept transferred to AMF
+func establishmentAccept(t *testing.T, transfer models.N1N2MessageTransferRequest) *nasMessage.PDUSessionEstablishmentAccept {
+	m := nas.NewMessage()
+	require.NoError(t, m.GsmMessageDecode(&transfer.BinaryDataN1Message))
+	require.Equal(t, nas.MsgTypePDUSessionEstablishmentAccept, m.GsmHeader.GetMessageType())
+	return m.PDUSessionEstablishmentAccept
+}
+
+//setUserPlane sets up UP topology for test, UPFs are associated
+func setUserPlane(t *testing.T, upConfig *factory.UserPlaneInformation) {
+	self := smf_context.SMF_Self()
+	upi := self.UserPlaneInformation
+	self.UserPlaneInformation = smf_context.NewUserPlaneInformation(upConfig)
+	t.Cleanup(func() { self.UserPlaneInformation = upi })
+	for _, upf := range self.UserPlaneInformation.UPFs {
+		upf.UPF.UPFStatus = smf_context.AssociatedSetUpSuccess
+	}
+}
+
+var singleUPConfig = &factory.UserPlaneInformation{
+	UPNodes: map[string]factory.UPNode{
+		"GNodeB": {
+			Type:   "AN",
+			NodeID: "192.168.179.100",
+		},
+		"UPF": {
+			Type:   "UPF",
+			NodeID: "192.168.179.1",
+			SNssaiInfos: []models.SnssaiUpfInfoItem{
+				{
+					SNssai:         &models.Snssai{Sst: 1, Sd: "010203"},
+					DnnUpfInfoList: []models.DnnUpfInfoItem{{Dnn: "internet"}},
+				},
+			},
+			InterfaceUpfInfoList: []factory.InterfaceUpfInfoItem{
+				{InterfaceType: models.UpInterfaceType_N3, Endpoints: []string{"192.168.179.1"}, NetworkInstance: "internet"},
+			},
+		},
+	},
+	Links: []factory.UPLink{
+		{A: "GNodeB", B: "UPF"},
+	},
+}
+
+//activateSession sets up default data path and SM policy of PDU session as if established,
+//AMF is reached at amfUri
+func activateSession(t *testing.T, smContext *smf_context.SMContext, amfUri string) {
+	smContext.SelectedPDUSessionType = nasMessage.PDUSessionTypeIPv4
+	smContext.SmPolicyUpdates = append(smContext.SmPolicyUpdates, qos.BuildSmPolicyUpdate(&smContext.SmPolicyData,
+		&models.SmPolicyDecision{
+			SessRules: map[string]*models.SessionRule{
+				"SessRuleId-1": {
+					SessRuleId:   "SessRuleId-1",
+					AuthSessAmbr: &models.Ambr{Uplink: "100 Mbps", Downlink: "100 Mbps"},
+					AuthDefQos:   &models.AuthorizedDefaultQos{Var5qi: 9},
+				},
+			},
+		}))
+
+	path := smContext.SelectUPPath(&smf_context.UPFSelectionParams{
+		Dnn:    smContext.Dnn,
+		SNssai: &smf_context.SNssai{Sst: smContext.Snssai.Sst, Sd: smContext.Snssai.Sd},
+	})
+	require.NotEmpty(t, path)
+	dataPath := smf_context.GenerateDataPath(path, smContext)
+	dataPath.IsDefaultPath = true
+	smContext.Tunnel = smf_context.NewUPTunnel()
+	smContext.Tunnel.AddDataPath(dataPath)
+	require.NoError(t, dataPath.ActivateTunnelAndPDR(smContext, 255))
+
+	configuration := Namf_Communication.NewConfiguration()
+	configuration.SetBasePath(amfUri)
+	smContext.CommunicationClient = Namf_Communication.NewAPIClient(configuration)
+}
+
+func TestEstablishmentAcceptPCO(t *testing.T) {
+	setUserPlane(t, singleUPConfig)
+	server, transfers := stubAmf(t)
+	defer server.Close()
+
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 10,
+		smctxtest.WithDnn("internet", &models.Snssai{Sst: 1, Sd: "010203"}),
+		smctxtest.WithDnnInfo(&smf_context.SnssaiSmfDnnInfo{
+			DNS: smf_context.DNS{IPv4Addr: net.ParseIP("8.8.8.8").To4()},
+			MTU: 1400,
+		}))
+	smContext.Gpsi = "msisdn-4412345678"
+	activateSession(t, smContext, server.URL)
+
+	//UE asks for DNS, MSISDN and MTU, legacy UE for DNS over IPCP too
+	pco := nasConvert.NewProtocolConfigurationOptions()
+	for id, contents := range map[uint16][]byte{
+		nasMessage.DNSServerIPv4AddressRequestUL:     nil,
+		nasMessage.MSISDNRequestUL:                   nil,
+		nasMessage.IPv4LinkMTURequestUL:              nil,
+		nasMessage.InternetProtocolControlProtocolUL: {0x01, 0x01, 0x00, 0x0a, 0x81, 0x06, 0, 0, 0, 0},
+	} {
+		pco.ProtocolOrContainerList = append(pco.ProtocolOrContainerList, &nasConvert.ProtocolOrContainerUnit{
+			ProtocolOrContainerID: id,
+			LengthOfContents:      uint8(len(contents)),
+			Contents:              contents,
+		})
+	}
+	contents := pco.Marshal()
+	request := nasMessage.NewPDUSessionEstablishmentRequest(0)
+	request.ExtendedProtocolConfigurationOptions = nasType.NewExtendedProtocolConfigurationOptions(
+		nasMessage.PDUSessionEstablishmentRequestExtendedProtocolConfigurationOptionsType)
+	request.ExtendedProtocolConfigurationOptions.SetLen(uint16(len(contents)))
+	request.ExtendedProtocolConfigurationOptions.SetExtendedProtocolConfigurationOptionsContents(contents)
+	smContext.HandlePDUSessionEstablishmentRequest(request)
+
+	require.NoError(t, producer.SendPduSessN1N2Transfer(smContext, true))
+	accept := establishmentAccept(t, <-transfers)
+	require.NotNil(t, accept.ExtendedProtocolConfigurationOptions)
+
+	response := nasConvert.NewProtocolConfigurationOptions()
+	require.NoError(t, response.UnMarshal(
+		accept.ExtendedProtocolConfigurationOptions.GetExtendedProtocolConfigurationOptionsContents()))
+	containers := make(map[uint16][]byte)
+	for _, container := range response.ProtocolOrContainerList {
+		containers[container.ProtocolOrContainerID] = container.Contents
+	}
+	require.Len(t, containers, 4)
+	require.Equal(t, []byte{8, 8, 8, 8}, containers[nasMessage.DNSServerIPv4AddressDL])
+	require.Equal(t, []byte{0x91, 0x44, 0x21, 0x43, 0x65, 0x87}, containers[nasMessage.MSISDNDL])
+	require.Equal(t, []byte{0x05, 0x78}, containers[nasMessage.IPv4LinkMTUDL])
+	//Nak with configured DNS
+	require.Equal(t, []byte{0x03, 0x01, 0x00, 0x0a, 0x81, 0x06, 8, 8, 8, 8},
+		containers[nasMessage.InternetProtocolControlProtocolUL])
+}
+
+func TestCreateSelectsSscMode(t *testing.T) {
+	snssai := &models.Snssai{Sst: 1, Sd: "010203"}
+	allocator, err := smf_context.NewIPAllocator("10.60.0.0/24")
+	require.NoError(t, err)
+	setDnnInfo(t, snssai, "internet", &smf_context.SnssaiSmfDnnInfo{UeIPAllocator: allocator, AlwaysOn: true})
+	setUserPlane(t, singleUPConfig)
+	server, transfers := stubCoreNetwork(t, models.DnnConfiguration{
+		PduSessionTypes: &models.PduSessionTypes{DefaultSessionType: models.PduSessionType_IPV4},
+		SscModes: &models.SscModes{
+			DefaultSscMode:  models.SscMode__1,
+			AllowedSscModes: []models.SscMode{models.SscMode__3},
+		},
+		SessionAmbr: &models.Ambr{Uplink: "100 Mbps", Downlink: "100 Mbps"},
+	})
+	defer server.Close()
+
+	withSscMode := func(sscMode uint8) func(req *nasMessage.PDUSessionEstablishmentRequest) {
+		return func(req *nasMessage.PDUSessionEstablishmentRequest) {
+			req.SSCMode = nasType.NewSSCMode(nasMessage.PDUSessionEstablishmentRequestSSCModeType)
+			req.SSCMode.SetSSCMode(sscMode)
+			req.AlwaysonPDUSessionRequested = nasType.NewAlwaysonPDUSessionRequested(
+				nasMessage.PDUSessionEstablishmentRequestAlwaysonPDUSessionRequestedType)
+			req.AlwaysonPDUSessionRequested.SetAPSR(1)
+		}
+	}
+	createData := models.SmContextCreateData{
+		Supi:           "imsi-2089300007487",
+		PduSessionId:   10,
+		Dnn:            "internet",
+		SNssai:         snssai,
+		ServingNetwork: &models.PlmnId{Mcc: "208", Mnc: "93"},
+		AnType:         models.AccessType__3_GPP_ACCESS,
+	}
+
+	//SSC mode 2 isn't allowed by subscription
+	smContext := smctxtest.NewSMContext(t, createData.Supi, 10)
+	rsp, err := createSMContext(smContext, createData, newEstablishmentRequest(t, 10, withSscMode(smf_context.SscMode2)))
+	require.Error(t, err)
+	require.Equal(t, nasMessage.Cause5GSMNotSupportedSSCMode, establishmentReject(t, rsp).GetCauseValue())
+
+	//SSC mode 3 session is marked for anchor relocation
+	createData.PduSessionId = 11
+	smContext = smctxtest.NewSMContext(t, createData.Supi, 11)
+	rsp, err = createSMContext(smContext, createData, newEstablishmentRequest(t, 11, withSscMode(smf_context.SscMode3)))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, rsp.Status)
+	require.Equal(t, smf_context.SscMode3, smContext.SscMode)
+	require.True(t, smContext.AnchorRelocatable)
+
+	//Accept tells UE selected SSC mode and that DNN keeps session always-on
+	require.NoError(t, producer.SendPduSessN1N2Transfer(smContext, true))
+	accept := establishmentAccept(t, <-transfers)
+	require.Equal(t, smf_context.SscMode3, accept.GetSSCMode())
+	require.NotNil(t, accept.AlwaysonPDUSessionIndication)
+	require.Equal(t, smf_context.AlwaysOnRequired, accept.AlwaysonPDUSessionIndication.GetAPSI())
+}
+
+func TestCreateFromEpsPdnConnection(t *testing.T) {
+	snssai := &models.Snssai{Sst: 1, Sd: "010203"}
+	allocator, err := smf_context.NewIPAllocator("10.60.0.0/24")
+	require.NoError(t, err)
+	setDnnInfo(t, snssai, "internet", &smf_context.SnssaiSmfDnnInfo{UeIPAllocator: allocator})
+	setUserPlane(t, singleUPConfig)
+	server, _ := stubCoreNetwork(t, models.DnnConfiguration{
+		PduSessionTypes: &models.PduSessionTypes{DefaultSessionType: models.PduSessionType_IPV4},
+		SscModes:        &models.SscModes{DefaultSscMode: models.SscMode__1},
+		SessionAmbr:     &models.Ambr{Uplink: "100 Mbps", Downlink: "100 Mbps"},
+	})
+	defer server.Close()
+
+	//MME asked for PDN connection of session, UE moves back to 5GS with it
+	old := smctxtest.NewSMContext(t, "imsi-2089300007487", 10, smctxtest.WithDnn("internet", snssai),
+		smctxtest.WithState(smf_context.SmStateActive))
+	ueIP := net.ParseIP("10.60.0.7").To4()
+	old.PDUAddress = ueIP
+	old.DnnConfiguration.Var5gQosProfile = &models.SubscribedDefaultQos{Var5qi: 9}
+	txn := transaction.NewTransaction(smf_context.SmContextRetrieveData{
+		SmContextRetrieveData: models.SmContextRetrieveData{TargetMmeCap: &models.MmeCapabilities{}},
+	}, nil, svcmsgtypes.RetrieveSmContext)
+	txn.Ctxt = old
+	require.NoError(t, producer.HandlePDUSessionSMContextRetrieve(txn))
+	retrieved := txn.Rsp.(*http_wrapper.Response).Body.(smf_context.SmContextRetrievedData)
+	require.Nil(t, retrieved.SmContext)
+	require.NotEmpty(t, retrieved.UeEpsPdnConnection)
+	//Address isn't from DNN pool of test
+	old.PDUAddress = nil
+
+	createData := models.SmContextCreateData{
+		Supi:               "imsi-2089300007487",
+		PduSessionId:       10,
+		Dnn:                "internet",
+		SNssai:             snssai,
+		ServingNetwork:     &models.PlmnId{Mcc: "208", Mnc: "93"},
+		AnType:             models.AccessType__3_GPP_ACCESS,
+		UeEpsPdnConnection: "AAE=",
+	}
+	smContext := smctxtest.NewSMContext(t, createData.Supi, 10)
+	rsp, err := createSMContext(smContext, createData, newEstablishmentRequest(t, 10, nil))
+	require.Error(t, err)
+	require.Equal(t, http.StatusBadRequest, rsp.Status)
+
+	//UE keeps IP address of PDN connection
+	createData.UeEpsPdnConnection = retrieved.UeEpsPdnConnection
+	smContext = smctxtest.NewSMContext(t, createData.Supi, 10)
+	rsp, err = createSMContext(smContext, createData, newEstablishmentRequest(t, 10, nil))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, rsp.Status)
+	require.True(t, smContext.PDUAddress.Equal(ueIP))
+}
+
+//Central UPF is default anchor of DNN, edge UPF serves DNAI edge-1
+var relocationUPConfig = &factory.UserPlaneInformation{
+	UPNodes: map[string]factory.UPNode{
+		"GNodeB": {
+			Type:   "AN",
+			NodeID: "192.168.179.100",
+		},
+		"CentralUPF": {
+			Type:   "UPF",
+			NodeID: "192.168.179.1",
+			SNssaiInfos: []models.SnssaiUpfInfoItem{
+				{
+					SNssai:         &models.Snssai{Sst: 1, Sd: "010203"},
+					DnnUpfInfoList: []models.DnnUpfInfoItem{{Dnn: "enterprise"}},
+				},
+			},
+			InterfaceUpfInfoList: []factory.InterfaceUpfInfoItem{
+				{InterfaceType: models.UpInterfaceType_N3, Endpoints: []string{"192.168.179.1"}, NetworkInstance: "enterprise"},
+			},
+		},
+		"EdgeUPF": {
+			Type:   "UPF",
+			NodeID: "192.168.179.2",
+			SNssaiInfos: []models.SnssaiUpfInfoItem{
+				{
+					SNssai:         &models.Snssai{Sst: 1, Sd: "010203"},
+					DnnUpfInfoList: []models.DnnUpfInfoItem{{Dnn: "enterprise", DnaiList: []string{"edge-1"}}},
+				},
+			},
+			InterfaceUpfInfoList: []factory.InterfaceUpfInfoItem{
+				{InterfaceType: models.UpInterfaceType_N3, Endpoints: []string{"192.168.179.2"}, NetworkInstance: "enterprise"},
+			},
+		},
+	},
+	Links: []factory.UPLink{
+		{A: "GNodeB", B: "CentralUPF"},
+		{A: "GNodeB", B: "EdgeUPF"},
+	},
+}
+
+func TestUpdateRelocatesAnchor(t *testing.T) {
+	setUserPlane(t, relocationUPConfig)
+	server, transfers := stubAmf(t)
+	defer server.Close()
+	//Modification Command isn't resent while test runs
+	t3591 := smf_context.SMF_Self().T3591
+	t.Cleanup(func() { smf_context.SMF_Self().T3591 = t3591 })
+	smf_context.SMF_Self().T3591 = smf_context.GsmTimerConfig{ExpireTime: time.Hour, MaxRetryTimes: 1}
+
+	smContext := smctxtest.NewSMContext(t, "imsi-2089300007487", 10,
+		smctxtest.WithDnn("enterprise", &models.Snssai{Sst: 1, Sd: "010203"}),
+		smctxtest.WithDnnInfo(&smf_context.SnssaiSmfDnnInfo{
+			Dnais:              []factory.DnaiArea{{Dnai: "edge-1", Tacs: []string{"000002"}}},
+			PduAddressLifetime: 30 * time.Second,
+		}),
+		smctxtest.WithUeLocation("000001"),
+		smctxtest.WithState(smf_context.SmStateActive))
+	smContext.SscMode, smContext.AnchorRelocatable = smf_context.SscMode3, true
+	activateSession(t, smContext, server.URL)
+	t.Cleanup(func() {
+		smContext.SMLock.Lock()
+		defer smContext.SMLock.Unlock()
+		smContext.StopGsmProcedures()
+	})
+
+	//Relocation runs as txn of its own
+	requested := make(chan *smf_context.SMContext, 1)
+	smf_context.RegisterAnchorRelocationHandler(func(smContext *smf_context.SMContext) { requested <- smContext })
+	defer smf_context.RegisterAnchorRelocationHandler(nil)
+
+	//AMF reports UE moved to edge
+	txn := transaction.NewTransaction(models.UpdateSmContextRequest{
+		JsonData: &models.SmContextUpdateData{UeLocation: smctxtest.UeLocation("000002")},
+	}, nil, svcmsgtypes.UpdateSmContext)
+	txn.Ctxt = smContext
+	require.NoError(t, producer.HandlePDUSessionSMContextUpdate(txn))
+	require.Equal(t, http.StatusOK, txn.Rsp.(*http_wrapper.Response).Status)
+	require.Equal(t, smContext, <-requested)
+
+	txn = transaction.NewTransaction(nil, nil, svcmsgtypes.AnchorRelocation)
+	txn.Ctxt = smContext
+	require.NoError(t, producer.HandleAnchorRelocation(txn))
+
+	//UE is asked to reactivate session within address lifetime, anchored at edge UPF then
+	var transfer models.N1N2MessageTransferRequest
+	select {
+	case transfer = <-transfers:
+	case <-time.After(5 * time.Second):
+		t.Fatal("PDU Session Modification Command wasn't sent to AMF")
+	}
+	m := nas.NewMessage()
+	require.NoError(t, m.GsmMessageDecode(&transfer.BinaryDataN1Message))
+	require.Equal(t, nas.MsgTypePDUSessionModificationCommand, m.GsmHeader.GetMessageType())
+	command := m.PDUSessionModificationCommand
+	require.Equal(t, nasMessage.Cause5GSMReactivationRequested, command.Cause5GSM.GetCauseValue())
+	epco := nasConvert.NewProtocolConfigurationOptions()
+	require.NoError(t, epco.UnMarshal(command.ExtendedProtocolConfigurationOptions.GetExtendedProtocolConfigurationOptionsContents()))
+	require.Len(t, epco.ProtocolOrContainerList, 1)
+	require.Equal(t, nasMessage.PDUSessionAddressLifetimeDL, epco.ProtocolOrContainerList[0].ProtocolOrContainerID)
+	require.Equal(t, []byte{nasConvert.GPRSTimer3ToNas(30)}, epco.ProtocolOrContainerList[0].Contents)
+	require.Nil(t, transfer.BinaryDataN2Information)
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+	require.True(t, smContext.IsAnchorRelocationPending())
+	require.NotNil(t, smContext.PendingGsmProcedure(nas.MsgTypePDUSessionModificationCommand))
+}
@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/consumer"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/metrics"
+	"github.com/free5gc/smf/msgtypes/svcmsgtypes"
+	"github.com/free5gc/smf/transaction"
+)
+
+//HandleSdmDataChangeNotify handles SM subscription data change notified by UDM,
+//session AMBR/default QoS change is run through PCF and modifies the session,
+//removal of DNN from subscription releases it
+func HandleSdmDataChangeNotify(eventData interface{}) error {
+	txn := eventData.(*transaction.Transaction)
+	request := txn.Req.(models.ModificationNotification)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+
+	for _, item := range request.NotifyItems {
+		smContext.SubPduSessLog.Infof("SDM data change notification, resource [%v], [%v] changes",
+			item.ResourceId, len(item.Changes))
+	}
+
+	//Notification carries changed items only, re-fetch DNN configuration as whole
+	dnnConfiguration, err := consumer.SendSmDataRetrieval(smContext)
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("SDM data change notification, %v", err)
+		txn.Rsp = formSdmNotifyErrRsp(err)
+		return err
+	}
+
+	txn.Rsp = http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+	if dnnConfiguration == nil {
+		smContext.SubPduSessLog.Infof("SDM data change notification, DNN [%v] unsubscribed, releasing PDU session",
+			smContext.Dnn)
+		smf_context.RequestNwRelease(smContext, nasMessage.Cause5GSMRegularDeactivation)
+		return nil
+	}
+
+	ambrChanged := !reflect.DeepEqual(dnnConfiguration.SessionAmbr, smContext.DnnConfiguration.SessionAmbr)
+	defQosChanged := !reflect.DeepEqual(dnnConfiguration.Var5gQosProfile, smContext.DnnConfiguration.Var5gQosProfile)
+	if !ambrChanged && !defQosChanged {
+		smContext.SMLock.Lock()
+		smContext.DnnConfiguration = *dnnConfiguration
+		smContext.SMLock.Unlock()
+		return nil
+	}
+
+	//Subscribed values are input to PCF, authorised ones come back in decision
+	updateData := models.SmPolicyUpdateContextData{}
+	if ambrChanged {
+		updateData.RepPolicyCtrlReqTriggers = append(updateData.RepPolicyCtrlReqTriggers,
+			models.PolicyControlRequestTrigger_SE_AMBR_CH)
+		updateData.SubsSessAmbr = dnnConfiguration.SessionAmbr
+	}
+	if defQosChanged {
+		updateData.RepPolicyCtrlReqTriggers = append(updateData.RepPolicyCtrlReqTriggers,
+			models.PolicyControlRequestTrigger_DEF_QOS_CH)
+		updateData.SubsDefQos = dnnConfiguration.Var5gQosProfile
+	}
+
+	metrics.IncrementSvcPcfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmPolicyAssociationUpdate), "Out", "", "")
+	smPolicyDecision, httpStatus, err := consumer.SendSMPolicyAssociationUpdate(smContext, updateData)
+	if err != nil {
+		metrics.IncrementSvcPcfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmPolicyAssociationUpdate), "In", http.StatusText(httpStatus), err.Error())
+		smContext.SubPduSessLog.Errorf("SDM data change notification, SMPolicyAssociationUpdate error, %v", err)
+		txn.Rsp = formSdmNotifyErrRsp(err)
+		return err
+	}
+	metrics.IncrementSvcPcfMsgStats(smf_context.SMF_Self().NfInstanceID, string(svcmsgtypes.SmPolicyAssociationUpdate), "In", http.StatusText(httpStatus), "")
+
+	//Network initiated modification, via V-SMF if home-routed. New subscription is kept
+	//only once modification is applied, so that failed change is detected on next notification
+	smContext.SMLock.Lock()
+	err = applySmPolicyDecision(smContext, smPolicyDecision)
+	if err == nil {
+		smContext.DnnConfiguration = *dnnConfiguration
+	}
+	smContext.SMLock.Unlock()
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("SDM data change notification, PDU session modification failed, %v", err)
+		txn.Rsp = formSdmNotifyErrRsp(err)
+		return err
+	}
+	return nil
+}
+
+func formSdmNotifyErrRsp(err error) *http_wrapper.Response {
+	return &http_wrapper.Response{
+		Status: http.StatusInternalServerError,
+		Body: &models.ProblemDetails{
+			Title:  "SM data change not applied",
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+			Detail: err.Error(),
+		},
+	}
+}
@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/nas"
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/openapi/models"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/transaction"
+)
+
+//SendSecondaryAuthCommand starts authentication of UE by DN-AAA with EAP-Request/Identity
+//in PDU Session Authentication Command(TS 23.502 4.3.2.3)
+func SendSecondaryAuthCommand(smContext *smf_context.SMContext) error {
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+
+	smNasBuf, err := smf_context.BuildGSMPDUSessionAuthenticationCommand(smContext,
+		smContext.SecondaryAuth.IdentityRequest())
+	if err != nil {
+		return fmt.Errorf("build GSM PDUSessionAuthenticationCommand failed, %v", err)
+	}
+
+	n1n2Request := models.N1N2MessageTransferRequest{
+		JsonData: &models.N1N2MessageTransferReqData{
+			PduSessionId: smContext.PDUSessionID,
+			N1MessageContainer: &models.N1MessageContainer{
+				N1MessageClass:   "SM",
+				N1MessageContent: &models.RefToBinaryData{ContentId: "GSM_NAS"},
+			},
+			N1n2FailureTxfNotifURI: fmt.Sprintf("%s://%s:%d%s",
+				smf_context.SMF_Self().URIScheme,
+				smf_context.SMF_Self().RegisterIPv4,
+				smf_context.SMF_Self().SBIPort,
+				"/nsmf-callback/sm-n1n2failnotify/"+smContext.Ref),
+		},
+		BinaryDataN1Message: smNasBuf,
+	}
+
+	rspData, _, err := smContext.
+		CommunicationClient.
+		N1N2MessageCollectionDocumentApi.
+		N1N2MessageTransfer(context.Background(), smContext.Supi, n1n2Request)
+	if err != nil {
+		return err
+	}
+	switch rspData.Cause {
+	case models.N1N2MessageTransferCause_N1_MSG_NOT_TRANSFERRED,
+		models.N1N2MessageTransferCause_UE_NOT_REACHABLE_FOR_SESSION,
+		models.N1N2MessageTransferCause_UE_NOT_RESPONDING:
+		return fmt.Errorf("N1N2MessageTransfer failure, %v", rspData.Cause)
+	}
+	smContext.SubPduSessLog.Infof("PDU Session Authentication Command sent, N1N2 transfer [%v]", rspData.Cause)
+	return nil
+}
+
+//HandleSecondaryAuthUpdate relays EAP of PDU Session Authentication Complete to DN-AAA. Once
+//DN-AAA authorizes UE rest of PDU session establishment is done, UE not authorized or session
+//failing to be set up is rejected and SM context released at end of txn
+func HandleSecondaryAuthUpdate(eventData interface{}) (smf_context.SecondaryAuthResult, error) {
+	txn := eventData.(*transaction.Transaction)
+	request := txn.Req.(models.UpdateSmContextRequest)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+
+	var response models.UpdateSmContextResponse
+	response.JsonData = new(models.SmContextUpdatedData)
+	defer func() {
+		txn.Rsp = &http_wrapper.Response{
+			Status: http.StatusOK,
+			Body:   response,
+		}
+	}()
+
+	updateUeAccessInfo(smContext, request.JsonData)
+
+	//Nothing but authentication is expected before session is established
+	if request.BinaryDataN1SmMessage == nil {
+		return smf_context.SecondaryAuthChallenge, nil
+	}
+	m := nas.NewMessage()
+	pti := gsmMessagePti(request.BinaryDataN1SmMessage)
+	if err := m.GsmMessageDecode(&request.BinaryDataN1SmMessage); err != nil ||
+		m.GsmHeader.GetMessageType() != nas.MsgTypePDUSessionAuthenticationComplete {
+		smContext.SubPduSessLog.Warnf("secondary authentication pending, N1 Msg unexpected")
+		sendStatus5GSM(smContext, &response, pti,
+			nasMessage.Cause5GSMMessageTypeNotCompatibleWithTheProtocolState)
+		return smf_context.SecondaryAuthChallenge, nil
+	}
+
+	auth := smContext.SecondaryAuth
+	result, eap, err := smContext.RelaySecondaryAuthEap(
+		m.PDUSessionAuthenticationComplete.EAPMessage.GetEAPMessage())
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("secondary authentication error, %v", err)
+	}
+
+	switch result {
+	case smf_context.SecondaryAuthChallenge:
+		buf, err := smf_context.BuildGSMPDUSessionAuthenticationCommand(smContext, eap)
+		if err != nil {
+			return result, fmt.Errorf("build GSM PDUSessionAuthenticationCommand failed, %v", err)
+		}
+		response.BinaryDataN1SmMessage = buf
+		response.JsonData.N1SmMsg = &models.RefToBinaryData{ContentId: "PDUSessionAuthenticationCommand"}
+		return result, nil
+
+	case smf_context.SecondaryAuthSuccess:
+		smContext.SubPduSessLog.Infof("UE[%s] authorized by DN-AAA", auth.Identity)
+		if cause, err := setupPduSession(smContext, auth.EstablishmentRequest, auth.Transfer); err != nil {
+			smContext.SubPduSessLog.Errorf("PDU session setup after secondary authentication failed, %v", err)
+			rejectSecondaryAuthSession(smContext, &response, cause)
+			return smf_context.SecondaryAuthFailure, nil
+		}
+		return result, nil
+	}
+
+	smContext.SubPduSessLog.Warnf("UE[%s] not authorized by DN-AAA", auth.Identity)
+	rejectSecondaryAuthSession(smContext, &response, "SecondaryAuthFailure")
+	return result, nil
+}
+
+//rejectSecondaryAuthSession sends PDU Session Establishment Reject in Update SM Context response,
+//caller holds SM context lock
+func rejectSecondaryAuthSession(smContext *smf_context.SMContext, response *models.UpdateSmContextResponse,
+	cause string) {
+	if buf, err := smContext.BuildSecondaryAuthReject(cause); err != nil {
+		smContext.SubPduSessLog.Errorf("build GSM PDUSessionEstablishmentReject failed, %v", err)
+	} else {
+		response.BinaryDataN1SmMessage = buf
+		response.JsonData.N1SmMsg = &models.RefToBinaryData{ContentId: "PDUSessionEstablishmentReject"}
+	}
+}
+
+//HandleSecondaryAuthRelease releases SM context AMF releases while UE is being authenticated,
+//nothing is set up at PCF or UPF yet
+func HandleSecondaryAuthRelease(eventData interface{}) {
+	txn := eventData.(*transaction.Transaction)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+
+	smContext.SubPduSessLog.Infof("PDUSessionSMContextRelease, released during secondary authentication")
+	ReleaseSMContextLocally(smContext, false)
+	txn.Rsp = &http_wrapper.Response{
+		Status: http.StatusNoContent,
+		Body:   nil,
+	}
+}
+
+//HandleSecondaryAuthN1N2TransFailInd releases SM context if UE couldn't be reached with
+//PDU Session Authentication Command
+func HandleSecondaryAuthN1N2TransFailInd(eventData interface{}) {
+	txn := eventData.(*transaction.Transaction)
+	request := txn.Req.(models.N1N2MsgTxfrFailureNotification)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+
+	smContext.SubPduSessLog.Infof("N1N2 transfer failure notification, cause [%v], secondary authentication aborted",
+		request.Cause)
+	ReleaseSMContextLocally(smContext, true)
+}
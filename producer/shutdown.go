@@ -0,0 +1,296 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/free5gc/openapi/Npcf_SMPolicyControl"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/consumer"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/factory"
+	"github.com/free5gc/smf/logger"
+	pfcp_message "github.com/free5gc/smf/pfcp/message"
+	"github.com/free5gc/smf/transaction"
+)
+
+const (
+	//Poll interval while waiting for in-flight txns
+	drainPollInterval = 100 * time.Millisecond
+	//Wait for UPF of persisted session to associate with SMF at startup
+	persistedUpfAssociationTimeout = 10 * time.Second
+)
+
+type PFCPSessionSnapshot struct {
+	NodeID     string
+	LocalSEID  uint64
+	RemoteSEID uint64
+}
+
+//SMContextSnapshot is the persisted state of a PDU session
+type SMContextSnapshot struct {
+	Ref               string
+	Supi              string
+	PDUSessionID      int32
+	Dnn               string
+	Snssai            *models.Snssai
+	PDUAddress        string
+	State             string
+	ServingNetwork    *models.PlmnId
+	ServingNfId       string
+	SmStatusNotifyUri string
+	//Npcf_SMPolicyControl API prefix of PCF holding SM policy association
+	PcfApiPrefix      string
+	UdmRegistered     bool
+	SdmSubscriptionId string
+	PFCPSessions      []PFCPSessionSnapshot
+}
+
+//HandleGracefulShutdown drains SMF before exit
+func HandleGracefulShutdown() {
+	shutdown := smf_context.SMF_Self().Shutdown
+	deadline := time.Now().Add(shutdown.DrainTimeout)
+
+	logger.AppLog.Infof("graceful shutdown, drain timeout [%v], session action [%v]",
+		shutdown.DrainTimeout, shutdown.SessionAction)
+
+	//Stop being selected by peers and reject new SM contexts
+	smf_context.SetShuttingDown()
+	if err := consumer.SendNFStatusUpdate(models.NfStatus_UNDISCOVERABLE); err != nil {
+		logger.AppLog.Warnf("graceful shutdown, NRF status update failed, %v", err)
+	}
+
+	//Finish in-flight transactions
+	for transaction.InFlightTxnCount() > 0 && time.Now().Before(deadline) {
+		time.Sleep(drainPollInterval)
+	}
+	if count := transaction.InFlightTxnCount(); count > 0 {
+		logger.AppLog.Warnf("graceful shutdown, [%v] transactions still in progress", count)
+	}
+
+	switch shutdown.SessionAction {
+	case factory.SHUTDOWN_SESSION_PERSIST:
+		if err := PersistSMContexts(shutdown.PersistPath); err != nil {
+			logger.AppLog.Errorf("graceful shutdown, persisting sessions failed, %v", err)
+		}
+	default:
+		ReleaseSMContexts()
+	}
+
+	//Let UPFs answer pending PFCP requests
+	time.Sleep(time.Until(deadline))
+
+	for _, upf := range smf_context.SMF_Self().UserPlaneInformation.UPFs {
+		if upf.UPF != nil && upf.UPF.UPFStatus == smf_context.AssociatedSetUpSuccess {
+			pfcp_message.SendPfcpAssociationReleaseRequest(upf.NodeID)
+		}
+	}
+	logger.AppLog.Infof("graceful shutdown, drain complete")
+}
+
+//PersistSMContexts writes remaining PDU sessions to file
+func PersistSMContexts(path string) error {
+	snapshots := make([]SMContextSnapshot, 0)
+	smf_context.RangeSMContexts(func(smContext *smf_context.SMContext) bool {
+		snapshot := SMContextSnapshot{
+			Ref:               smContext.Ref,
+			Supi:              smContext.Supi,
+			PDUSessionID:      smContext.PDUSessionID,
+			Dnn:               smContext.Dnn,
+			Snssai:            smContext.Snssai,
+			PDUAddress:        smContext.PDUAddress.String(),
+			State:             smContext.SMContextState.String(),
+			ServingNetwork:    smContext.ServingNetwork,
+			ServingNfId:       smContext.ServingNfId,
+			SmStatusNotifyUri: smContext.SmStatusNotifyUri,
+			UdmRegistered:     smContext.UdmRegistered,
+			SdmSubscriptionId: smContext.SdmSubscriptionId,
+		}
+		if smContext.SMPolicyClient != nil && smContext.SelectedPCFProfile.NfServices != nil {
+			for _, service := range *smContext.SelectedPCFProfile.NfServices {
+				if service.ServiceName == models.ServiceName_NPCF_SMPOLICYCONTROL {
+					snapshot.PcfApiPrefix = service.ApiPrefix
+				}
+			}
+		}
+		for nodeIP, pfcpCtxt := range smContext.PFCPContext {
+			snapshot.PFCPSessions = append(snapshot.PFCPSessions, PFCPSessionSnapshot{
+				NodeID:     nodeIP,
+				LocalSEID:  pfcpCtxt.LocalSEID,
+				RemoteSEID: pfcpCtxt.RemoteSEID,
+			})
+		}
+		snapshots = append(snapshots, snapshot)
+		return true
+	})
+
+	buf, err := json.Marshal(snapshots)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, buf, 0600); err != nil {
+		return err
+	}
+	logger.AppLog.Infof("persisted [%v] sessions to [%v]", len(snapshots), path)
+	return nil
+}
+
+//RestorePersistedSMContexts takes up PDU sessions persisted at last shutdown. User plane state
+//isn't persisted, so sessions are released the way local release does: PFCP sessions are deleted
+//at UPFs, SM policy association, UDM registration and SDM subscription are removed and AMF is
+//told session is gone for UE to re-establish it. File is removed once done
+func RestorePersistedSMContexts(path string) error {
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var snapshots []SMContextSnapshot
+	if err := json.Unmarshal(buf, &snapshots); err != nil {
+		return err
+	}
+	for _, snapshot := range snapshots {
+		releasePersistedSMContext(snapshot)
+	}
+	logger.AppLog.Infof("released [%v] sessions persisted to [%v]", len(snapshots), path)
+	return os.Remove(path)
+}
+
+//releasePersistedSMContext rebuilds SM context of persisted session far enough to release it locally
+func releasePersistedSMContext(snapshot SMContextSnapshot) {
+	smContext := smf_context.NewSMContext(snapshot.Supi, snapshot.PDUSessionID)
+	smContext.Supi = snapshot.Supi
+	smContext.Dnn = snapshot.Dnn
+	smContext.Snssai = snapshot.Snssai
+	smContext.ServingNetwork = snapshot.ServingNetwork
+	smContext.ServingNfId = snapshot.ServingNfId
+	smContext.SmStatusNotifyUri = snapshot.SmStatusNotifyUri
+	smContext.UdmRegistered = snapshot.UdmRegistered
+	smContext.SdmSubscriptionId = snapshot.SdmSubscriptionId
+	smContext.SubPduSessLog.Infof("releasing session persisted at last shutdown in state [%v]", snapshot.State)
+
+	if snapshot.PcfApiPrefix != "" {
+		configuration := Npcf_SMPolicyControl.NewConfiguration()
+		configuration.SetBasePath(snapshot.PcfApiPrefix)
+		smContext.SMPolicyClient = Npcf_SMPolicyControl.NewAPIClient(configuration)
+	}
+
+	//UDM isn't discovered yet at startup
+	self := smf_context.SMF_Self()
+	if (smContext.UdmRegistered || smContext.SdmSubscriptionId != "") &&
+		(self.UEContextManagementClient == nil || self.SubscriberDataManagementClient == nil) {
+		if problemDetails, err := consumer.SendNFDiscoveryUDM(); err != nil {
+			smContext.SubPduSessLog.Warnf("UDM discovery failed, %v", err)
+		} else if problemDetails != nil {
+			smContext.SubPduSessLog.Warnf("UDM discovery failed, %+v", problemDetails)
+		}
+	}
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+	deletePersistedPfcpSessions(smContext, snapshot.PFCPSessions)
+	releaseSMContextLocally(smContext, true)
+}
+
+//deletePersistedPfcpSessions deletes PFCP sessions of persisted session at UPFs once they associated
+//with SMF, responses aren't awaited. Caller holds SM context lock
+func deletePersistedPfcpSessions(smContext *smf_context.SMContext, sessions []PFCPSessionSnapshot) {
+	smContext.LocalPurged = true
+	for _, session := range sessions {
+		upNode := smf_context.SMF_Self().UserPlaneInformation.GetUPFNodeByIP(session.NodeID)
+		if upNode == nil || upNode.UPF == nil {
+			smContext.SubPfcpLog.Warnf("UPF [%v] of persisted PFCP session not configured", session.NodeID)
+			continue
+		}
+		if !waitUpfAssociated(upNode.UPF) {
+			smContext.SubPfcpLog.Warnf("UPF [%v] of persisted PFCP session not associated", session.NodeID)
+			continue
+		}
+		smContext.PFCPContext[session.NodeID] = &smf_context.PFCPSessionContext{
+			NodeID:     upNode.NodeID,
+			LocalSEID:  session.LocalSEID,
+			RemoteSEID: session.RemoteSEID,
+		}
+		pfcp_message.SendPfcpSessionDeletionRequest(upNode.NodeID, smContext)
+	}
+	//SEIDs of last run may be in use by sessions of this run
+	smContext.PFCPContext = make(map[string]*smf_context.PFCPSessionContext)
+}
+
+func waitUpfAssociated(upf *smf_context.UPF) bool {
+	deadline := time.Now().Add(persistedUpfAssociationTimeout)
+	for upf.UPFStatus != smf_context.AssociatedSetUpSuccess {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(drainPollInterval)
+	}
+	return true
+}
+
+//ReleaseSMContexts releases all remaining PDU sessions
+func ReleaseSMContexts() {
+	smContexts := make([]*smf_context.SMContext, 0)
+	smf_context.RangeSMContexts(func(smContext *smf_context.SMContext) bool {
+		smContexts = append(smContexts, smContext)
+		return true
+	})
+
+	for _, smContext := range smContexts {
+		ReleaseSMContextLocally(smContext, true)
+	}
+	logger.AppLog.Infof("released [%v] sessions", len(smContexts))
+}
+
+//ReleaseSMContextLocally releases SM context without UE signalling,
+//UPF sessions, SM policy and UE IP are freed and AMF is optionally notified
+func ReleaseSMContextLocally(smContext *smf_context.SMContext, notifyAmf bool) {
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+
+	releaseSMContextLocally(smContext, notifyAmf)
+}
+
+//releaseSMContextLocally is ReleaseSMContextLocally for caller holding SM context lock
+func releaseSMContextLocally(smContext *smf_context.SMContext, notifyAmf bool) {
+	smContext.SubPduSessLog.Infof("local release of SM context in state [%v]", smContext.SMContextState.String())
+
+	smContext.StopGsmProcedures()
+
+	//Responses to PFCP deletion aren't awaited
+	smContext.LocalPurged = true
+	if smContext.Tunnel != nil {
+		releaseTunnel(smContext)
+	}
+
+	if smContext.SMPolicyClient != nil && smContext.ServingNetwork != nil {
+		smDelReq := models.ReleaseSmContextRequest{JsonData: &models.SmContextReleaseData{}}
+		if _, err := consumer.SendSMPolicyAssociationDelete(smContext, &smDelReq); err != nil {
+			smContext.SubPduSessLog.Warnf("SM policy delete failed, %v", err)
+		}
+	}
+
+	releaseHsmfPduSession(smContext)
+	deregisterFromUdm(smContext)
+
+	if notifyAmf && smContext.SmStatusNotifyUri != "" {
+		if problemDetails, err := consumer.SendSMContextStatusNotification(smContext.SmStatusNotifyUri); err != nil {
+			smContext.SubPduSessLog.Warnf("SM context status notification failed, %v", err)
+		} else if problemDetails != nil {
+			smContext.SubPduSessLog.Warnf("SM context status notification failed, %+v", problemDetails)
+		}
+	}
+
+	NotifySmfEvent(smContext, models.SmfEvent_PDU_SES_REL, models.EventNotification{})
+
+	//Releases UE IP as well
+	smf_context.RemoveSMContext(smContext.Ref)
+}
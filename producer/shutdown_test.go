@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/Nudm_SubscriberDataManagement"
+	"github.com/free5gc/openapi/Nudm_UEContextManagement"
+	"github.com/free5gc/openapi/models"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/producer"
+)
+
+func TestRestorePersistedSMContexts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	notified := make(chan models.SmContextStatusNotification, 1)
+	router.POST("/sm-context-status/:ref", func(c *gin.Context) {
+		var notification models.SmContextStatusNotification
+		require.NoError(t, c.ShouldBindJSON(&notification))
+		notified <- notification
+		c.Status(http.StatusNoContent)
+	})
+	released := make(chan string, 3)
+	router.POST("/npcf-smpolicycontrol/v1/sm-policies/:smPolicyId/delete", func(c *gin.Context) {
+		released <- "sm-policy " + c.Param("smPolicyId")
+		c.Status(http.StatusNoContent)
+	})
+	router.DELETE("/nudm-uecm/v1/:ueId/registrations/smf-registrations/:pduSessionId", func(c *gin.Context) {
+		released <- "smf-registration " + c.Param("ueId") + "/" + c.Param("pduSessionId")
+		c.Status(http.StatusNoContent)
+	})
+	router.DELETE("/nudm-sdm/v1/:supi/sdm-subscriptions/:subscriptionId", func(c *gin.Context) {
+		released <- "sdm-subscription " + c.Param("supi") + "/" + c.Param("subscriptionId")
+		c.Status(http.StatusNoContent)
+	})
+	server := startStubServer(t, router)
+	defer server.Close()
+
+	self := smf_context.SMF_Self()
+	sdm, uecm := self.SubscriberDataManagementClient, self.UEContextManagementClient
+	defer func() {
+		self.SubscriberDataManagementClient, self.UEContextManagementClient = sdm, uecm
+	}()
+	sdmConfiguration := Nudm_SubscriberDataManagement.NewConfiguration()
+	sdmConfiguration.SetBasePath(server.URL)
+	self.SubscriberDataManagementClient = Nudm_SubscriberDataManagement.NewAPIClient(sdmConfiguration)
+	uecmConfiguration := Nudm_UEContextManagement.NewConfiguration()
+	uecmConfiguration.SetBasePath(server.URL)
+	self.UEContextManagementClient = Nudm_UEContextManagement.NewAPIClient(uecmConfiguration)
+
+	dir, err := ioutil.TempDir("", "smf")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sessions.json")
+
+	//Nothing persisted
+	require.NoError(t, producer.RestorePersistedSMContexts(path))
+
+	buf, err := json.Marshal([]producer.SMContextSnapshot{{
+		Supi:              "imsi-2089300007487",
+		PDUSessionID:      5,
+		Dnn:               "internet",
+		Snssai:            &models.Snssai{Sst: 1, Sd: "010203"},
+		ServingNetwork:    &models.PlmnId{Mcc: "208", Mnc: "93"},
+		SmStatusNotifyUri: server.URL + "/sm-context-status/1",
+		PcfApiPrefix:      server.URL,
+		UdmRegistered:     true,
+		SdmSubscriptionId: "1",
+	}})
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path, buf, 0600))
+
+	//SM policy, UDM registration and SDM subscription are released, AMF is told session is gone
+	//and file is consumed
+	require.NoError(t, producer.RestorePersistedSMContexts(path))
+	require.ElementsMatch(t, []string{
+		"sm-policy imsi-2089300007487-5",
+		"smf-registration imsi-2089300007487/5",
+		"sdm-subscription imsi-2089300007487/1",
+	}, []string{<-released, <-released, <-released})
+	notification := <-notified
+	require.Equal(t, models.ResourceStatus_RELEASED, notification.StatusInfo.ResourceStatus)
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+}
@@ -6,53 +6,132 @@
 package producer
 
 import (
-	"fmt"
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/pfcp"
 	smf_context "github.com/free5gc/smf/context"
 	pfcp_message "github.com/free5gc/smf/pfcp/message"
+	"github.com/free5gc/smf/transaction"
 )
 
-
-func SendPfcpSessionModifyReq(smContext *smf_context.SMContext, pfcpParam *pfcpParam) error {
+//SendPfcpSessionModifyReq sends PFCP Session Modification to AN UPF of session. Procedure is
+//completed by onRsp once UPF answered, txn(if any) is answered after that. Returns false if
+//request couldn't be sent, onRsp isn't run then. Caller holds SM context lock
+func SendPfcpSessionModifyReq(smContext *smf_context.SMContext, pfcpParam *pfcpParam, txn *transaction.Transaction,
+	onRsp func(status smf_context.PFCPSessionResponseStatus) smf_context.SMContextState) bool {
 	defaultPath := smContext.Tunnel.DataPathPool.GetDefaultPath()
 	ANUPF := defaultPath.FirstDPNode
-	pfcp_message.SendPfcpSessionModificationRequest(ANUPF.UPF.NodeID, smContext,
-		pfcpParam.pdrList, pfcpParam.farList, pfcpParam.barList, pfcpParam.qerList)
 
-	PFCPResponseStatus := <-smContext.SBIPFCPCommunicationChan
+	smContext.AwaitPfcpRsp(&smf_context.PfcpProcedure{
+		ReqType: pfcp.PFCP_SESSION_MODIFICATION_REQUEST,
+		Txn:     txn,
+		OnRsp:   onRsp,
+	})
+	if seqNum := pfcp_message.SendPfcpSessionModificationRequest(ANUPF.UPF.NodeID, smContext,
+		pfcpParam.pdrList, pfcpParam.farList, pfcpParam.barList, pfcpParam.qerList); seqNum == 0 {
+		smContext.TakePfcpProcedure(pfcp.PFCP_SESSION_MODIFICATION_REQUEST)
+		return false
+	}
+	return true
+}
+
+//sendPccRulePfcpSessionModifyReq sends PFCP Session Modification of PCC rule PDRs to their UPFs,
+//procedure fails if request couldn't be sent to any of them. Returns false if no request was sent,
+//onRsp isn't run then. Caller holds SM context lock
+func sendPccRulePfcpSessionModifyReq(smContext *smf_context.SMContext, updates []*smf_context.PccRulePdrs,
+	onRsp func(status smf_context.PFCPSessionResponseStatus) smf_context.SMContextState) bool {
+	procedure := &smf_context.PfcpProcedure{
+		ReqType: pfcp.PFCP_SESSION_MODIFICATION_REQUEST,
+		OnRsp:   onRsp,
+	}
+	smContext.AwaitPfcpRsp(procedure)
 
-	switch PFCPResponseStatus {
-	case smf_context.SessionUpdateSuccess:
-		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, PFCP Session Update Success")
+	sent, unsent := 0, 0
+	for _, update := range updates {
+		pdrList, farList, qerList := update.Rules()
+		if seqNum := pfcp_message.SendPfcpSessionModificationRequest(update.Node.UPF.NodeID, smContext,
+			pdrList, farList, nil, qerList); seqNum == 0 {
+			unsent++
+		} else {
+			sent++
+		}
+	}
+	if sent == 0 {
+		smContext.TakePfcpProcedure(pfcp.PFCP_SESSION_MODIFICATION_REQUEST)
+		return false
+	}
+	if unsent != 0 {
+		procedure.OnRsp = func(smf_context.PFCPSessionResponseStatus) smf_context.SMContextState {
+			return onRsp(smf_context.SessionUpdateFailed)
+		}
+	}
+	return true
+}
 
-	case smf_context.SessionUpdateFailed:
-		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, PFCP Session Update Failed")
-		fallthrough
-	case smf_context.SessionUpdateTimeout:
-		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, PFCP Session Modification Timeout")
+//SendPfcpSessionReleaseReq deletes PFCP sessions of session at all UPFs. Procedure is completed
+//by onRsp once UPFs answered, txn(if any) is answered after that. Returns false if UP was
+//released already, onRsp isn't run then. Caller holds SM context lock
+func SendPfcpSessionReleaseReq(smContext *smf_context.SMContext, txn *transaction.Transaction,
+	onRsp func(status smf_context.PFCPSessionResponseStatus) smf_context.SMContextState) bool {
+	smContext.AwaitPfcpRsp(&smf_context.PfcpProcedure{
+		ReqType: pfcp.PFCP_SESSION_DELETION_REQUEST,
+		Txn:     txn,
+		OnRsp:   onRsp,
+	})
 
-		err := fmt.Errorf("pfcp modification failure")
-		return err
+	//release UPF data tunnel
+	if !releaseTunnel(smContext) {
+		smContext.TakePfcpProcedure(pfcp.PFCP_SESSION_DELETION_REQUEST)
+		return false
 	}
+	return true
+}
+
+//HandlePfcpProcedureRsp completes procedure waiting for UPFs to answer its PFCP session
+//modification or deletion, returns state SM context settles in and txn of procedure
+func HandlePfcpProcedureRsp(smContext *smf_context.SMContext,
+	rsp *smf_context.PfcpProcedureRsp) (smf_context.SMContextState, *transaction.Transaction) {
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
 
-	return nil
+	procedure := smContext.TakePfcpProcedure(rsp.ReqType)
+	if procedure == nil {
+		//Completed meanwhile
+		smContext.SubPfcpLog.Infof("no procedure waiting for pfcp responses of type [%v]", rsp.ReqType)
+		return smContext.SMContextState, nil
+	}
+	smContext.SubPfcpLog.Infof("pfcp responses received, [%v]", rsp.Status)
+	return procedure.OnRsp(rsp.Status), procedure.Txn
 }
 
-func SendPfcpSessionReleaseReq(smContext *smf_context.SMContext) error {
+//HandlePfcpSessEstFailure rejects PDU session if PFCP session establishment failed at any UPF
+func HandlePfcpSessEstFailure(smContext *smf_context.SMContext, failed []*smf_context.PfcpRsp) {
+	for _, rsp := range failed {
+		smContext.SubPfcpLog.Errorf("PFCP Session Establishment failed, %v", rsp.String())
+	}
 
-	//release UPF data tunnel
+	//Release PFCP sessions established at other UPFs
 	releaseTunnel(smContext)
+	deregisterFromUdm(smContext)
+
+	//Home-routed session, V-SMF releases its side and informs UE
+	if smContext.IsHsmf() {
+		if err := sendVsmfPduSessionRelease(smContext, nasMessage.Cause5GSMRequestRejectedUnspecified); err != nil {
+			smContext.SubPfcpLog.Warnf("Send V-SMF PDU session release failed, %v", err.Error())
+		}
+		smf_context.RemoveSMContext(smContext.Ref)
+		return
+	}
+
+	//Home-routed session, H-SMF side is released as well
+	releaseHsmfPduSession(smContext)
+
+	//Send PDU Session Establishment Reject
+	if err := SendPduSessN1N2Transfer(smContext, false); err != nil {
+		smContext.SubPfcpLog.Warnf("Send N1N2Transfer Reject failed, %v", err.Error())
+	}
+	smContext.SubPfcpLog.Errorf("PFCP send N1N2Transfer Reject initiated for id[%v], pduSessId[%v]",
+		smContext.Identifier, smContext.PDUSessionID)
 
-	PFCPResponseStatus := <-smContext.SBIPFCPCommunicationChan
-	switch PFCPResponseStatus {
-	case smf_context.SessionReleaseSuccess:
-		smContext.SubCtxLog.Traceln("PDUSessionSMContextUpdate, PFCP Session Release Success")
-		return nil
-	case smf_context.SessionReleaseTimeout:
-		smContext.SubCtxLog.Error("PDUSessionSMContextUpdate, PFCP Session Release Failed")
-		return fmt.Errorf("pfcp session release timeout")
-	case smf_context.SessionReleaseFailed:
-		smContext.SubCtxLog.Error("PDUSessionSMContextUpdate, PFCP Session Release Failed")
-		return fmt.Errorf("pfcp session release failed")
-	}
-	return nil
+	//clear subscriber
+	smf_context.RemoveSMContext(smContext.Ref)
 }
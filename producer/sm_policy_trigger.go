@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/pfcp"
+	"github.com/free5gc/smf/consumer"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/qos"
+)
+
+//Usage Report Trigger octet 5 (TS 29.244 8.2.41), volume/time threshold reached
+const (
+	usageReportTriggerVolth uint8 = 0x02
+	usageReportTriggerTimth uint8 = 0x04
+)
+
+//reportPolicyCtrlReqTriggers reports fired triggers to PCF if armed and applies returned decision,
+//caller holds SM context lock. Session goes on with current policy if PCF can't be reached
+func reportPolicyCtrlReqTriggers(smContext *smf_context.SMContext, updateData models.SmPolicyUpdateContextData) {
+	smPolicyDecision, _, err := consumer.SendSMPolicyAssociationModify(smContext, updateData)
+	if err != nil {
+		smContext.SubPduSessLog.Warnf("SM policy update on triggers %v failed, %v", updateData.RepPolicyCtrlReqTriggers, err)
+		return
+	}
+	//None of triggers armed
+	if smPolicyDecision == nil {
+		return
+	}
+
+	if err := applySmPolicyDecision(smContext, smPolicyDecision); err != nil {
+		smContext.SubPduSessLog.Errorf("SM policy decision on triggers %v not applied, %v", updateData.RepPolicyCtrlReqTriggers, err)
+	}
+}
+
+//applySmPolicyDecision runs updated decision from PCF through QoS pipeline, UE and RAN are
+//signalled by network initiated modification if rules or QoS flows changed.
+//Caller holds SM context lock
+func applySmPolicyDecision(smContext *smf_context.SMContext, smPolicyDecision *models.SmPolicyDecision) error {
+	//Derive QoS change(compare existing vs received Policy Decision)
+	policyUpdates := qos.BuildSmPolicyUpdate(&smContext.SmPolicyData, smPolicyDecision)
+	smContext.SmPolicyUpdates = append(smContext.SmPolicyUpdates, policyUpdates)
+
+	//Applied once UE answered modification in progress
+	if smContext.IsNwModificationPending() {
+		smContext.SubPduSessLog.Infof("PDU session modification in progress, SM policy update queued")
+		return nil
+	}
+
+	if !policyUpdates.IsQosChanged() {
+		return smContext.CommitSmPolicyDecisionLocked(true)
+	}
+
+	if smContext.IsHsmf() {
+		request, err := buildVsmfPduSessionModification(smContext, authorizedSessionAmbr(smPolicyDecision))
+		if err != nil {
+			smContext.CommitSmPolicyDecisionLocked(false)
+			return err
+		}
+		//V-SMF may be waiting on this H-SMF, don't block on it
+		go func() {
+			if err := consumer.SendVsmfPduSessionUpdate(smContext, request); err != nil {
+				smContext.SubPduSessLog.Errorf("V-SMF PDU session modification failed, %v", err)
+			}
+		}()
+		return smContext.CommitSmPolicyDecisionLocked(true)
+	}
+
+	//Network initiated
+	return startPduSessModification(smContext, 0)
+}
+
+//authorizedSessionAmbr is session AMBR of first session rule carrying one
+func authorizedSessionAmbr(smPolicyDecision *models.SmPolicyDecision) *models.Ambr {
+	for _, sessRule := range smPolicyDecision.SessRules {
+		if sessRule.AuthSessAmbr != nil {
+			return sessRule.AuthSessAmbr
+		}
+	}
+	return nil
+}
+
+//reportQosNotification reports QoS flows RAN can(not) guarantee GFBR of anymore,
+//caller holds SM context lock
+func reportQosNotification(smContext *smf_context.SMContext, notifiedFlows map[uint8]bool) {
+	updateData := models.SmPolicyUpdateContextData{
+		RepPolicyCtrlReqTriggers: []models.PolicyControlRequestTrigger{models.PolicyControlRequestTrigger_QOS_NOTIF},
+	}
+	for qfi, fulfilled := range notifiedFlows {
+		report := models.QosNotificationControlInfo{
+			RefPccRuleIds: smContext.SmPolicyData.GetPccRuleIdsOfQosFlow(qfi),
+			NotifType:     models.QosNotifType_NOT_GUARANTEED,
+		}
+		if fulfilled {
+			report.NotifType = models.QosNotifType_GUARANTEED
+		}
+		if len(report.RefPccRuleIds) == 0 {
+			smContext.SubPduSessLog.Warnf("QoS notification of QFI [%v] matches no PCC rule", qfi)
+			continue
+		}
+		updateData.QncReports = append(updateData.QncReports, report)
+	}
+	if len(updateData.QncReports) > 0 {
+		reportPolicyCtrlReqTriggers(smContext, updateData)
+	}
+}
+
+//HandleUsageReport reports usage of URR installed for usage monitoring that reached its volume
+//or time threshold to PCF, caller holds SM context lock
+func HandleUsageReport(smContext *smf_context.SMContext, usageReport *pfcp.UsageReportPFCPSessionReportRequest) {
+	if usageReport.URRID == nil || usageReport.UsageReportTrigger == nil ||
+		len(usageReport.UsageReportTrigger.UsageReportTriggerdata) == 0 {
+		return
+	}
+	umId, ok := smContext.UsageMonUrrs[usageReport.URRID.UrrIdValue]
+	if !ok {
+		smContext.SubPfcpLog.Warnf("usage report of unknown URR [%v] discarded", usageReport.URRID.UrrIdValue)
+		return
+	}
+	triggerData := usageReport.UsageReportTrigger.UsageReportTriggerdata[0]
+	if triggerData&(usageReportTriggerVolth|usageReportTriggerTimth) == 0 {
+		smContext.SubPfcpLog.Debugf("usage report of URR [%v], trigger [%#x] not reported to PCF",
+			usageReport.URRID.UrrIdValue, triggerData)
+		return
+	}
+
+	accuUsageReport := models.AccuUsageReport{
+		RefUmIds: umId,
+	}
+	if volume := usageReport.VolumeMeasurement; volume != nil {
+		accuUsageReport.VolUsage = int64(volume.TotalVolume)
+		accuUsageReport.VolUsageUplink = int64(volume.UplinkVolume)
+		accuUsageReport.VolUsageDownlink = int64(volume.DownlinkVolume)
+	}
+	if duration := usageReport.DurationMeasurement; duration != nil {
+		accuUsageReport.TimeUsage = int32(duration.DurationValue)
+	}
+
+	smContext.SubPfcpLog.Infof("usage threshold of URR [%v], usage monitoring [%v] reached",
+		usageReport.URRID.UrrIdValue, umId)
+	reportPolicyCtrlReqTriggers(smContext, models.SmPolicyUpdateContextData{
+		RepPolicyCtrlReqTriggers: []models.PolicyControlRequestTrigger{models.PolicyControlRequestTrigger_US_RE},
+		AccuUsageReports:         []models.AccuUsageReport{accuUsageReport},
+	})
+}
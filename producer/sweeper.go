@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"time"
+
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/logger"
+	"github.com/free5gc/smf/metrics"
+	"github.com/free5gc/smf/transaction"
+)
+
+//StartSMContextSweeper periodically cleans up SM contexts stuck in pending states
+func StartSMContextSweeper() {
+	sweeper := smf_context.SMF_Self().Sweeper
+	if !sweeper.Enable {
+		return
+	}
+
+	logger.CtxLog.Infof("SM context sweeper started, interval [%v], max age [%v]", sweeper.Interval, sweeper.MaxAge)
+	go func() {
+		ticker := time.NewTicker(sweeper.Interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			SweepSMContexts(now)
+		}
+	}()
+}
+
+//SweepSMContexts requests release of stale SM contexts, returns number of contexts requested
+func SweepSMContexts(now time.Time) int {
+	stale := smf_context.StaleSMContexts(now, smf_context.SMF_Self().Sweeper.MaxAge)
+
+	for smContext, since := range stale {
+		smf_context.RequestStaleRelease(smContext, since)
+	}
+	return len(stale)
+}
+
+//HandleStaleSMContextRelease releases SM context stuck in pending state locally, AMF is notified.
+//txn carries time SM context entered the state, release is skipped if it moved on meanwhile
+func HandleStaleSMContextRelease(eventData interface{}) error {
+	txn := eventData.(*transaction.Transaction)
+	since := txn.Req.(time.Time)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+
+	state := smContext.SMContextState.String()
+	if !smContext.IsStale(since) {
+		smContext.SubCtxLog.Infof("SM context in state [%v] no longer stale, release skipped", state)
+		return nil
+	}
+
+	smContext.SubCtxLog.Warnf("SM context stuck in state [%v] since [%v], cleaning up", state, since)
+	releaseSMContextLocally(smContext, true)
+	metrics.IncrementStaleSessStats(smf_context.SMF_Self().NfInstanceID, state)
+	return nil
+}
@@ -0,0 +1,178 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/free5gc/nas"
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/consumer"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/qos"
+)
+
+//HandlePDUSessionModificationRequest runs UE requested modification(TS 23.502 4.3.3.2), requested
+//QoS rules go to PCF as resource modification request and UE gets Modification Command for
+//authorized change or Modification Reject. Caller holds SM context lock
+func HandlePDUSessionModificationRequest(smContext *smf_context.SMContext,
+	request *nasMessage.PDUSessionModificationRequest, response *models.UpdateSmContextResponse) {
+	pti := request.GetPTI()
+	smContext.Pti = pti
+
+	cause, err := requestPduSessModification(smContext, request)
+	if err != nil {
+		smContext.SubPduSessLog.Warnf("UE requested modification rejected, cause [%v], %v", cause, err)
+		buf, err := smf_context.BuildGSMPDUSessionModificationReject(smContext, cause)
+		if err != nil {
+			smContext.SubPduSessLog.Errorf("build GSM PDUSessionModificationReject failed: %+v", err)
+			return
+		}
+		response.BinaryDataN1SmMessage = buf
+		response.JsonData.N1SmMsg = &models.RefToBinaryData{ContentId: "PDUSessionModificationReject"}
+
+		//Kept to answer retransmitted request
+		smContext.CompleteGsmProcedure(smContext.NewGsmProcedure(pti, nas.MsgTypePDUSessionModificationRequest,
+			nas.MsgTypePDUSessionModificationReject, buf))
+		return
+	}
+
+	//Policy update at head of SmPolicyUpdates is committed on Modification Complete
+	buf, err := smf_context.BuildGSMPDUSessionModificationCommand(smContext)
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("build GSM PDUSessionModificationCommand failed: %+v", err)
+		smContext.CommitSmPolicyDecisionLocked(false)
+		return
+	}
+	response.BinaryDataN1SmMessage = buf
+	response.JsonData.N1SmMsg = &models.RefToBinaryData{ContentId: "PDUSessionModificationCommand"}
+
+	if smContext.UpCnxState != models.UpCnxState_DEACTIVATED {
+		if buf, err := smf_context.BuildPDUSessionResourceModifyRequestTransfer(smContext); err != nil {
+			smContext.SubPduSessLog.Errorf("build PDUSessionResourceModifyRequestTransfer failed: %+v", err)
+		} else {
+			response.BinaryDataN2SmInformation = buf
+			response.JsonData.N2SmInfo = &models.RefToBinaryData{ContentId: "PDUResourceModifyRequest"}
+			response.JsonData.N2SmInfoType = models.N2SmInfoType_PDU_RES_MOD_REQ
+		}
+	}
+
+	smContext.SubPduSessLog.Infof("UE requested modification authorized, PDU Session Modification Command sent")
+	startT3591(smContext, smContext.NewGsmProcedure(pti, nas.MsgTypePDUSessionModificationRequest,
+		nas.MsgTypePDUSessionModificationCommand, buf))
+}
+
+//requestPduSessModification gets requested QoS authorized by PCF and queues resulting policy
+//update, 5GSM cause for Modification Reject is returned on failure
+func requestPduSessModification(smContext *smf_context.SMContext,
+	request *nasMessage.PDUSessionModificationRequest) (uint8, error) {
+	if smContext.IsNwModificationPending() {
+		return nasMessage.Cause5GSMRequestRejectedUnspecified, fmt.Errorf("PDU session modification in progress")
+	}
+	if smContext.SMPolicyClient == nil {
+		return nasMessage.Cause5GSMRequestRejectedUnspecified, fmt.Errorf("no PCF selected")
+	}
+	if request.RequestedQosRules == nil {
+		return nasMessage.Cause5GSMRequestRejectedUnspecified, fmt.Errorf("no QoS rules requested")
+	}
+
+	var qosRules qos.QoSRules
+	if err := qosRules.UnmarshalBinary(request.RequestedQosRules.GetQoSRules()); err != nil {
+		return qosErrorTo5gSmCause(err), err
+	}
+	var qosFlowDescs qos.QoSFlowDescriptions
+	if request.RequestedQosFlowDescriptions != nil {
+		if err := qosFlowDescs.UnmarshalBinary(request.RequestedQosFlowDescriptions.GetQoSFlowDescriptions()); err != nil {
+			return nasMessage.Cause5GSMSyntacticalErrorInTheQoSOperation, err
+		}
+	}
+
+	ueInitResReqs, err := qos.BuildUeInitiatedResourceRequests(&smContext.SmPolicyData, qosRules, qosFlowDescs)
+	if err != nil {
+		return qosErrorTo5gSmCause(err), err
+	}
+
+	//SM policy update carries one resource request, decisions PCF returns add up. UE resource
+	//modification request is reported without being armed(TS 29.512 4.2.4.17)
+	var smPolicyDecision *models.SmPolicyDecision
+	for i := range ueInitResReqs {
+		decision, _, err := consumer.SendSMPolicyAssociationUpdate(smContext, models.SmPolicyUpdateContextData{
+			RepPolicyCtrlReqTriggers: []models.PolicyControlRequestTrigger{models.PolicyControlRequestTrigger_RES_MO_RE},
+			UeInitResReq:             &ueInitResReqs[i],
+		})
+		if err != nil {
+			return nasMessage.Cause5GSMRequestRejectedUnspecified, fmt.Errorf("SM policy update failed, %v", err)
+		}
+		smPolicyDecision = mergeSmPolicyDecision(smPolicyDecision, decision)
+	}
+	if smPolicyDecision == nil {
+		return nasMessage.Cause5GSMRequestRejectedUnspecified, fmt.Errorf("no SM policy decision from PCF")
+	}
+
+	policyUpdates := qos.BuildSmPolicyUpdate(&smContext.SmPolicyData, smPolicyDecision)
+	smContext.SmPolicyUpdates = append(smContext.SmPolicyUpdates, policyUpdates)
+	if !policyUpdates.IsQosChanged() {
+		smContext.CommitSmPolicyDecisionLocked(true)
+		return nasMessage.Cause5GSMRequestRejectedUnspecified, fmt.Errorf("requested QoS not authorized by PCF")
+	}
+	return 0, nil
+}
+
+//mergeSmPolicyDecision adds rules and decisions of next to decision, nil decision is taken over
+func mergeSmPolicyDecision(decision, next *models.SmPolicyDecision) *models.SmPolicyDecision {
+	if decision == nil || next == nil {
+		if decision == nil {
+			return next
+		}
+		return decision
+	}
+	if decision.PccRules == nil && len(next.PccRules) > 0 {
+		decision.PccRules = make(map[string]*models.PccRule)
+	}
+	for id, pccRule := range next.PccRules {
+		decision.PccRules[id] = pccRule
+	}
+	if decision.QosDecs == nil && len(next.QosDecs) > 0 {
+		decision.QosDecs = make(map[string]*models.QosData)
+	}
+	for id, qosData := range next.QosDecs {
+		decision.QosDecs[id] = qosData
+	}
+	if decision.TraffContDecs == nil && len(next.TraffContDecs) > 0 {
+		decision.TraffContDecs = make(map[string]*models.TrafficControlData)
+	}
+	for id, tcData := range next.TraffContDecs {
+		decision.TraffContDecs[id] = tcData
+	}
+	if decision.Conds == nil && len(next.Conds) > 0 {
+		decision.Conds = make(map[string]*models.ConditionData)
+	}
+	for id, condData := range next.Conds {
+		decision.Conds[id] = condData
+	}
+	if decision.SessRules == nil && len(next.SessRules) > 0 {
+		decision.SessRules = make(map[string]*models.SessionRule)
+	}
+	for id, sessRule := range next.SessRules {
+		decision.SessRules[id] = sessRule
+	}
+	return decision
+}
+
+//qosErrorTo5gSmCause is 5GSM cause for error decoding QoS rules requested by UE(TS 24.501 6.4.2.4)
+func qosErrorTo5gSmCause(err error) uint8 {
+	switch {
+	case errors.Is(err, qos.ErrPacketFilterSyntax):
+		return nasMessage.Cause5GSMSyntacticalErrorInPacketFilter
+	case errors.Is(err, qos.ErrPacketFilterSemantic):
+		return nasMessage.Cause5GSMSemanticErrorsInPacketFilter
+	case errors.Is(err, qos.ErrQosOperationSemantic):
+		return nasMessage.Cause5GSMSemanticErrorInTheQoSOperation
+	default:
+		return nasMessage.Cause5GSMSyntacticalErrorInTheQoSOperation
+	}
+}
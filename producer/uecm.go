@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"net/http"
+
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/consumer"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/logger"
+)
+
+//registerWithUdm registers SMF as serving SMF of PDU session at UDM and subscribes
+//to SM data changes, session goes on without either if UDM doesn't accept it.
+//Caller holds SM context lock
+func registerWithUdm(smContext *smf_context.SMContext) {
+	if err := consumer.SendUeContextManagementRegistration(smContext); err != nil {
+		smContext.SubPduSessLog.Warnf("UDM SMF registration error, %v", err)
+	} else {
+		smContext.UdmRegistered = true
+	}
+	if err := consumer.SendSdmSubscription(smContext); err != nil {
+		smContext.SubPduSessLog.Warnf("UDM SDM subscription error, %v", err)
+	}
+}
+
+//deregisterFromUdm removes SMF registration and SM data subscription of released PDU session at UDM.
+//Caller holds SM context lock
+func deregisterFromUdm(smContext *smf_context.SMContext) {
+	if err := consumer.SendSdmUnsubscription(smContext); err != nil {
+		smContext.SubPduSessLog.Warnf("UDM SDM unsubscription error, %v", err)
+	}
+	if !smContext.UdmRegistered {
+		return
+	}
+	smContext.UdmRegistered = false
+	if err := consumer.SendUeContextManagementDeregistration(smContext); err != nil {
+		smContext.SubPduSessLog.Warnf("UDM SMF deregistration error, %v", err)
+	}
+}
+
+//HandleUdmDeregistrationNotification releases PDU session UDM no longer has SMF registered for
+func HandleUdmDeregistrationNotification(smContextRef string, request models.DeregistrationData) *http_wrapper.Response {
+	smContext := smf_context.GetSMContext(smContextRef)
+	if smContext == nil {
+		logger.PduSessLog.Warnf("UDM deregistration notification, SM context [%v] not found", smContextRef)
+		return &http_wrapper.Response{
+			Status: http.StatusNotFound,
+			Body: &models.ProblemDetails{
+				Title:  "SM context not found",
+				Status: http.StatusNotFound,
+				Cause:  "CONTEXT_NOT_FOUND",
+			},
+		}
+	}
+
+	smContext.SubPduSessLog.Infof("UDM deregistration notification, reason [%v]", request.DeregReason)
+	//UDM already dropped the registration
+	smContext.SMLock.Lock()
+	smContext.UdmRegistered = false
+	smContext.SMLock.Unlock()
+
+	smf_context.RequestNwRelease(smContext, nasMessage.Cause5GSMRegularDeactivation)
+	return http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+}
@@ -9,6 +9,7 @@ import (
 	"reflect"
 
 	"github.com/free5gc/flowdesc"
+	"github.com/free5gc/openapi/models"
 	"github.com/free5gc/pfcp/pfcpType"
 	"github.com/free5gc/pfcp/pfcpUdp"
 	"github.com/free5gc/smf/context"
@@ -106,6 +107,9 @@ func AddPDUSessionAnchorAndULCL(smContext *context.SMContext, nodeID pfcpType.No
 			bpMGR.AddingPSAState = context.Finished
 			bpMGR.BPStatus = context.AddPSASuccess
 			logger.CtxLog.Infoln("[SMF] Add PSA success")
+			NotifySmfEvent(smContext, models.SmfEvent_UP_PATH_CH, models.EventNotification{
+				DnaiChgType: models.DnaiChangeType_EARLY,
+			})
 		}
 	}
 }
@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/consumer"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/transaction"
+)
+
+//setupVsmfPduSession sets up home-routed PDU session as V-SMF, UE IP and QoS come from H-SMF,
+//returns error response to AMF on failure
+func setupVsmfPduSession(smContext *smf_context.SMContext, createData *models.SmContextCreateData,
+	establishmentRequest *nasMessage.PDUSessionEstablishmentRequest, n1SmMsg []byte) (*http_wrapper.Response, error) {
+	smContext.Pti = establishmentRequest.GetPTI()
+	smContext.SetRequestedPDUSessionType(establishmentRequest)
+
+	//H-SMF selection, AMF may have picked it already
+	if createData.HSmfUri != "" {
+		smContext.SetHsmf("", createData.HSmfUri)
+	} else if problemDetails, err := consumer.SendNFDiscoveryHSMF(smContext); err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, send NF Discovery H-SMF Error[%v]", err)
+		return smContext.GeneratePDUSessionEstablishmentReject("HSMFDiscoveryFailure"), fmt.Errorf("HsmfError")
+	} else if problemDetails != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, send NF Discovery H-SMF Problem[%+v]", problemDetails)
+		return smContext.GeneratePDUSessionEstablishmentReject("HSMFDiscoveryFailure"), fmt.Errorf("HsmfError")
+	}
+	smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, home-routed session via H-SMF[%v]", smContext.Hsmf.ApiRoot)
+
+	//V-UPF and its N9 tunnel towards H-UPF
+	if _, err := smContext.SetupVcnTunnel(); err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, V-CN tunnel setup failed: %v", err)
+		smContext.ReleaseVcnTunnel()
+		return smContext.GeneratePDUSessionEstablishmentReject("InsufficientResourceSliceDnn"),
+			fmt.Errorf("InsufficientResourceSliceDnn")
+	}
+
+	createdData, n1SmInfoToUe, err := consumer.SendHsmfPduSessionCreate(smContext,
+		smContext.BuildPduSessionCreateData(createData), n1SmMsg)
+	if err != nil {
+		smContext.ReleaseVcnTunnel()
+		//Relay H-SMF reject to UE as is
+		if n1SmInfoToUe != nil {
+			return &http_wrapper.Response{
+				Status: http.StatusForbidden,
+				Body: models.PostSmContextsErrorResponse{
+					JsonData: &models.SmContextCreateError{
+						Error: &models.ProblemDetails{
+							Title:  "H-SMF rejected PDU session",
+							Status: http.StatusForbidden,
+							Cause:  "REQUEST_REJECTED",
+							Detail: err.Error(),
+						},
+						N1SmMsg: &models.RefToBinaryData{ContentId: "n1SmMsg"},
+					},
+					BinaryDataN1SmMessage: n1SmInfoToUe,
+				},
+			}, err
+		}
+		return smContext.GeneratePDUSessionEstablishmentReject("HSMFCreateFailure"), err
+	}
+
+	if err := smContext.ApplyPduSessionCreatedData(createdData); err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, invalid H-SMF created data: %v", err)
+		releaseHsmfPduSession(smContext)
+		smContext.ReleaseVcnTunnel()
+		return smContext.GeneratePDUSessionEstablishmentReject("HSMFCreateFailure"), fmt.Errorf("HsmfCreatedDataError")
+	}
+	smContext.Hsmf.N1SmInfoToUe = n1SmInfoToUe
+
+	smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, H-SMF PDU session created, UE IP[%s]",
+		smContext.PDUAddress.String())
+	return nil, nil
+}
+
+//releaseHsmfPduSession releases home-routed session at H-SMF unless H-SMF released it already
+func releaseHsmfPduSession(smContext *smf_context.SMContext) {
+	if !smContext.IsVsmf() || smContext.Hsmf.Released || smContext.Hsmf.PduSessionUri == "" {
+		return
+	}
+	releaseData := &models.ReleaseData{
+		UeLocation: smContext.UeLocation,
+		UeTimeZone: smContext.UeTimeZone,
+	}
+	if err := consumer.SendHsmfPduSessionRelease(smContext, releaseData); err != nil {
+		smContext.SubPduSessLog.Warnf("H-SMF PDU session release failed, %v", err)
+	}
+}
+
+//relayN1ToHsmf forwards UE requested release/modification to H-SMF, returns H-SMF answer to UE
+func relayN1ToHsmf(smContext *smf_context.SMContext, indication models.RequestIndication,
+	n1SmMsg []byte) ([]byte, error) {
+	updateData := &models.HsmfUpdateData{
+		RequestIndication: indication,
+		Pti:               int32(smContext.Pti),
+		UeLocation:        smContext.UeLocation,
+		UeTimeZone:        smContext.UeTimeZone,
+		AnType:            smContext.AnType,
+		RatType:           smContext.RatType,
+	}
+	smContext.SubPduSessLog.Infof("relay [%v] to H-SMF", indication)
+	return consumer.SendHsmfPduSessionUpdate(smContext, updateData, n1SmMsg)
+}
+
+//HandleVsmfPduSessionUpdate handles H-SMF initiated Update of home-routed PDU session, SMF acts as V-SMF
+func HandleVsmfPduSessionUpdate(eventData interface{}) error {
+	txn := eventData.(*transaction.Transaction)
+	request := txn.Req.(smf_context.VsmfUpdateRequest)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+	updateData := request.JsonData
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+
+	smContext.SubPduSessLog.Infof("VsmfPDUSessionUpdate, update [%v] received from H-SMF", updateData.RequestIndication)
+
+	switch updateData.RequestIndication {
+	case models.RequestIndication_NW_REQ_PDU_SES_REL:
+		n1n2Request := models.N1N2MessageTransferRequest{
+			JsonData: &models.N1N2MessageTransferReqData{
+				PduSessionId: smContext.PDUSessionID,
+				N2InfoContainer: &models.N2InfoContainer{
+					N2InformationClass: models.N2InformationClass_SM,
+					SmInfo: &models.N2SmInformation{
+						PduSessionId: smContext.PDUSessionID,
+						N2InfoContent: &models.N2InfoContent{
+							NgapIeType: models.NgapIeType_PDU_RES_REL_CMD,
+							NgapData:   &models.RefToBinaryData{ContentId: "N2SmInformation"},
+						},
+						SNssai: smContext.Snssai,
+					},
+				},
+			},
+		}
+		if n2Pdu, err := smf_context.BuildPDUSessionResourceReleaseCommandTransfer(smContext); err != nil {
+			smContext.SubPduSessLog.Errorf("VsmfPDUSessionUpdate, build PDUSessionResourceReleaseCommandTransfer failed: %v", err)
+		} else {
+			n1n2Request.BinaryDataN2Information = n2Pdu
+		}
+		setN1FromHsmf(&n1n2Request, request.BinaryDataN1SmInfoToUe)
+		if err := sendVsmfN1N2Transfer(smContext, n1n2Request); err != nil {
+			txn.Rsp = formVsmfUpdateErrRsp(err)
+			return err
+		}
+
+		smContext.Hsmf.Released = true
+		if err := smContext.ChangeState(smf_context.SmStatePfcpRelease); err != nil {
+			return err
+		}
+		txn.Rsp = http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+		if !SendPfcpSessionReleaseReq(smContext, txn, onPfcpReleaseInActivePending(smContext)) {
+			return smContext.ChangeState(smf_context.SmStateInActivePending)
+		}
+		return nil
+
+	case models.RequestIndication_NW_REQ_PDU_SES_MOD:
+		n1n2Request := models.N1N2MessageTransferRequest{
+			JsonData: &models.N1N2MessageTransferReqData{PduSessionId: smContext.PDUSessionID},
+		}
+		setN1FromHsmf(&n1n2Request, request.BinaryDataN1SmInfoToUe)
+		if err := sendVsmfN1N2Transfer(smContext, n1n2Request); err != nil {
+			txn.Rsp = formVsmfUpdateErrRsp(err)
+			return err
+		}
+
+	default:
+		txn.Rsp = &http_wrapper.Response{
+			Status: http.StatusForbidden,
+			Body: models.VsmfUpdateError{
+				Error: &models.ProblemDetails{
+					Title:  "Request indication not supported",
+					Status: http.StatusForbidden,
+					Cause:  "REQUEST_REJECTED",
+				},
+			},
+		}
+		return fmt.Errorf("RequestIndicationNotSupported")
+	}
+
+	txn.Rsp = http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+	return nil
+}
+
+func setN1FromHsmf(n1n2Request *models.N1N2MessageTransferRequest, n1SmInfoToUe []byte) {
+	if n1SmInfoToUe == nil {
+		return
+	}
+	n1n2Request.BinaryDataN1Message = n1SmInfoToUe
+	n1n2Request.JsonData.N1MessageContainer = &models.N1MessageContainer{
+		N1MessageClass:   "SM",
+		N1MessageContent: &models.RefToBinaryData{ContentId: "GSM_NAS"},
+	}
+}
+
+func sendVsmfN1N2Transfer(smContext *smf_context.SMContext, n1n2Request models.N1N2MessageTransferRequest) error {
+	rspData, _, err := smContext.
+		CommunicationClient.
+		N1N2MessageCollectionDocumentApi.
+		N1N2MessageTransfer(context.Background(), smContext.Supi, n1n2Request)
+	if err != nil {
+		smContext.SubPduSessLog.Warnf("VsmfPDUSessionUpdate, send N1N2Transfer failed, %v", err.Error())
+		return err
+	}
+	if rspData.Cause == models.N1N2MessageTransferCause_N1_MSG_NOT_TRANSFERRED {
+		smContext.SubPduSessLog.Errorf("VsmfPDUSessionUpdate, N1N2MessageTransfer failure, %v", rspData.Cause)
+		return fmt.Errorf("N1N2MessageTransfer failure, %v", rspData.Cause)
+	}
+	return nil
+}
+
+func formVsmfUpdateErrRsp(err error) *http_wrapper.Response {
+	return &http_wrapper.Response{
+		Status: http.StatusInternalServerError,
+		Body: models.VsmfUpdateError{
+			Error: &models.ProblemDetails{
+				Title:  "N1/N2 transfer to AMF failed",
+				Status: http.StatusInternalServerError,
+				Cause:  "SYSTEM_FAILURE",
+				Detail: err.Error(),
+			},
+		},
+	}
+}
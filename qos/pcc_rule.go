@@ -74,3 +74,44 @@ func GetPccRuleChanges(s, d *models.PccRule) bool {
 func (upd *PccRulesUpdate) GetAddPccRuleUpdate() map[string]*models.PccRule {
 	return upd.add
 }
+
+func (upd *PccRulesUpdate) GetDelPccRuleUpdate() map[string]*models.PccRule {
+	return upd.del
+}
+
+func (upd *PccRulesUpdate) isChanged() bool {
+	return upd != nil && len(upd.add)+len(upd.mod)+len(upd.del) > 0
+}
+
+//GetPccRuleIdsOfQosFlow returns ids of PCC rules bound to QoS flow
+func (obj *SmCtxtPolicyData) GetPccRuleIdsOfQosFlow(qfi uint8) []string {
+	pccRuleIds := make([]string, 0)
+	for _, pccRule := range obj.SmCtxtPccRules.PccRules {
+		for _, refQosData := range pccRule.RefQosData {
+			if qosData := obj.SmCtxtQosData.QosData[refQosData]; qosData != nil &&
+				GetQosFlowIdFromQosId(qosData.QosId) == qfi {
+				pccRuleIds = append(pccRuleIds, pccRule.PccRuleId)
+				break
+			}
+		}
+	}
+	return pccRuleIds
+}
+
+//PccRuleIdsOfQosFlow returns ids of PCC rules added by update bound to QoS flow
+func (upd *PolicyUpdate) PccRuleIdsOfQosFlow(qfi uint8) []string {
+	pccRuleIds := make([]string, 0)
+	if upd.PccRuleUpdate == nil || upd.SmPolicyDecision == nil {
+		return pccRuleIds
+	}
+	for name, pccRule := range upd.PccRuleUpdate.add {
+		for _, refQosData := range pccRule.RefQosData {
+			if qosData := upd.SmPolicyDecision.QosDecs[refQosData]; qosData != nil &&
+				GetQosFlowIdFromQosId(qosData.QosId) == qfi {
+				pccRuleIds = append(pccRuleIds, name)
+				break
+			}
+		}
+	}
+	return pccRuleIds
+}
@@ -5,6 +5,8 @@
 package qos
 
 import (
+	"encoding/binary"
+	"fmt"
 	"log"
 	"strconv"
 	"strings"
@@ -382,3 +384,88 @@ func (d *QosFlowDescriptionsAuthorized) AddDefaultQosFlowDescription(sessRule *m
 func (upd *QosFlowsUpdate) GetAddQosFlowUpdate() map[string]*models.QosData {
 	return upd.add
 }
+
+func (upd *QosFlowsUpdate) isChanged() bool {
+	return upd != nil && len(upd.add)+len(upd.mod)+len(upd.del) > 0
+}
+
+//QoSFlowDescriptions are QoS flow descriptions requested by UE
+type QoSFlowDescriptions []QoSFlowDescription
+
+//UnmarshalBinary decodes QoS flow descriptions IE contents(TS 24.501 9.11.4.12)
+func (ds *QoSFlowDescriptions) UnmarshalBinary(data []byte) error {
+	for len(data) > 0 {
+		if len(data) < int(QFDFixLen) {
+			return fmt.Errorf("%w, QoS flow description truncated", ErrQosOperationSyntax)
+		}
+		qfd := QoSFlowDescription{
+			Qfi:        data[0] & QFDQfiBitmask,
+			OpCode:     data[1] & QFDOpCodeBitmask,
+			NumOfParam: data[2],
+		}
+		data = data[QFDFixLen:]
+
+		for i := 0; i < int(qfd.NumOfParam&^QFDEbit); i++ {
+			if len(data) < 2 || len(data) < 2+int(data[1]) {
+				return fmt.Errorf("%w, QoS flow description [%v] parameter list truncated", ErrQosOperationSyntax, qfd.Qfi)
+			}
+			param := QosFlowParameter{
+				ParamId:      data[0],
+				ParamLen:     data[1],
+				ParamContent: data[2 : 2+int(data[1])],
+			}
+			qfd.ParamList = append(qfd.ParamList, param)
+			data = data[2+int(param.ParamLen):]
+		}
+		*ds = append(*ds, qfd)
+	}
+	return nil
+}
+
+//Find returns QoS flow description of QFI, nil if there's none
+func (ds QoSFlowDescriptions) Find(qfi uint8) *QoSFlowDescription {
+	for i := range ds {
+		if ds[i].Qfi == qfi {
+			return &ds[i]
+		}
+	}
+	return nil
+}
+
+//RequestedQos is QoS UE asks for in flow description, nil if it carries no 5QI
+func (qfd *QoSFlowDescription) RequestedQos() *models.RequestedQos {
+	reqQos := &models.RequestedQos{}
+	has5qi := false
+	for _, param := range qfd.ParamList {
+		switch param.ParamId {
+		case QFDParameterId5Qi:
+			if len(param.ParamContent) == 1 {
+				reqQos.Var5qi = int32(param.ParamContent[0])
+				has5qi = true
+			}
+		case QFDParameterIdGfbrUl:
+			reqQos.GbrUl = GetBitRateString(param.ParamContent)
+		case QFDParameterIdGfbrDl:
+			reqQos.GbrDl = GetBitRateString(param.ParamContent)
+		}
+	}
+	if !has5qi {
+		return nil
+	}
+	return reqQos
+}
+
+//GetBitRateString decodes bit rate parameter(unit + 2 octets value) to "<value> <unit>",
+//units step by factor 4 from 1Kbps(TS 24.501 9.11.4.14)
+func GetBitRateString(content []byte) string {
+	if len(content) != 3 || content[0] == 0 {
+		return ""
+	}
+	units := []string{"Kbps", "Mbps", "Gbps", "Tbps", "Pbps"}
+	unit := int(content[0]) - 1
+	if unit/5 >= len(units) {
+		return ""
+	}
+	value := uint64(binary.BigEndian.Uint16(content[1:3])) << (2 * uint(unit%5))
+	return fmt.Sprintf("%d %s", value, units[unit/5])
+}
@@ -7,6 +7,9 @@ package qos
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"log"
 	"net"
 	"strconv"
@@ -638,3 +641,233 @@ func (rs QoSRules) MarshalBinary() (data []byte, err error) {
 	}
 	return qosRulesBuffer.Bytes(), nil
 }
+
+//Errors decoding QoS rules requested by UE, answered with 5GSM cause(TS 24.501 6.4.2.4)
+var (
+	ErrQosOperationSyntax   = errors.New("syntactical error in the QoS operation")
+	ErrQosOperationSemantic = errors.New("semantic error in the QoS operation")
+	ErrPacketFilterSyntax   = errors.New("syntactical error in packet filter")
+	ErrPacketFilterSemantic = errors.New("semantic error in packet filter")
+)
+
+//Length of packet filter component value, TS 24.501 Table 9.11.4.13.1
+var pfComponentValueLen = map[uint8]int{
+	PFComponentTypeMatchAll:                       0,
+	PFComponentTypeIPv4RemoteAddress:              8,
+	PFComponentTypeIPv4LocalAddress:               8,
+	PFComponentTypeIPv6RemoteAddress:              17,
+	PFComponentTypeIPv6LocalAddress:               17,
+	PFComponentTypeProtocolIdentifierOrNextHeader: 1,
+	PFComponentTypeSingleLocalPort:                2,
+	PFComponentTypeLocalPortRange:                 4,
+	PFComponentTypeSingleRemotePort:               2,
+	PFComponentTypeRemotePortRange:                4,
+	PFComponentTypeSecurityParameterIndex:         4,
+	PFComponentTypeTypeOfServiceOrTrafficClass:    2,
+	PFComponentTypeFlowLabel:                      3,
+	PFComponentTypeDestinationMACAddress:          6,
+	PFComponentTypeSourceMACAddress:               6,
+	PFComponentType8021Q_CTAG_VID:                 2,
+	PFComponentType8021Q_STAG_VID:                 2,
+	PFComponentType8021Q_CTAG_PCPOrDEI:            1,
+	PFComponentType8021Q_STAG_PCPOrDEI:            1,
+	PFComponentTypeEthertype:                      2,
+}
+
+//UnmarshalBinary decodes QoS rules IE contents(TS 24.501 9.11.4.13), as requested by UE
+func (rs *QoSRules) UnmarshalBinary(data []byte) error {
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return fmt.Errorf("%w, QoS rule header truncated", ErrQosOperationSyntax)
+		}
+		ruleLen := int(binary.BigEndian.Uint16(data[1:3]))
+		if len(data) < 3+ruleLen {
+			return fmt.Errorf("%w, QoS rule [%v] length [%v] exceeds IE", ErrQosOperationSyntax, data[0], ruleLen)
+		}
+
+		rule := QosRule{Identifier: data[0]}
+		if err := rule.unmarshalContent(data[3 : 3+ruleLen]); err != nil {
+			return err
+		}
+		*rs = append(*rs, rule)
+		data = data[3+ruleLen:]
+	}
+	return nil
+}
+
+func (r *QosRule) unmarshalContent(content []byte) error {
+	if len(content) == 0 {
+		return fmt.Errorf("%w, QoS rule [%v] is empty", ErrQosOperationSyntax, r.Identifier)
+	}
+	r.OperationCode = content[0] >> 5
+	r.DQR = (content[0] >> 4) & 0x01
+	numOfPf := int(content[0] & 0x0f)
+	content = content[1:]
+
+	for i := 0; i < numOfPf; i++ {
+		pf := PacketFilter{}
+		//Packet filters to delete carry identifier only
+		if r.OperationCode == OperationCodeModifyExistingQoSRuleAndDeletePacketFilters {
+			if len(content) < 1 {
+				return fmt.Errorf("%w, QoS rule [%v] packet filter list truncated", ErrQosOperationSyntax, r.Identifier)
+			}
+			pf.Identifier = content[0] & PacketFilterIdBitmask
+			content = content[1:]
+			r.PacketFilterList = append(r.PacketFilterList, pf)
+			continue
+		}
+
+		if len(content) < 2 {
+			return fmt.Errorf("%w, QoS rule [%v] packet filter list truncated", ErrQosOperationSyntax, r.Identifier)
+		}
+		pf.Direction = (content[0] >> 4) & 0x03
+		pf.Identifier = content[0] & PacketFilterIdBitmask
+		pf.ContentLength = content[1]
+		if len(content) < 2+int(pf.ContentLength) {
+			return fmt.Errorf("%w, packet filter [%v] length [%v] exceeds QoS rule [%v]",
+				ErrPacketFilterSyntax, pf.Identifier, pf.ContentLength, r.Identifier)
+		}
+		if err := pf.unmarshalContent(content[2 : 2+int(pf.ContentLength)]); err != nil {
+			return err
+		}
+		content = content[2+int(pf.ContentLength):]
+		r.PacketFilterList = append(r.PacketFilterList, pf)
+	}
+
+	//Precedence and QFI are left out when rule is deleted
+	if len(content) >= 2 {
+		r.Precedence = content[0]
+		r.Segregation = (content[1] >> 6) & 0x01
+		r.QFI = content[1] & 0x3f
+	}
+	return nil
+}
+
+func (pf *PacketFilter) unmarshalContent(content []byte) error {
+	for len(content) > 0 {
+		pfc := PacketFilterComponent{ComponentType: content[0]}
+		valueLen, ok := pfComponentValueLen[pfc.ComponentType]
+		if !ok {
+			return fmt.Errorf("%w, packet filter [%v] component type [%#x] unknown",
+				ErrPacketFilterSyntax, pf.Identifier, pfc.ComponentType)
+		}
+		if len(content) < 1+valueLen {
+			return fmt.Errorf("%w, packet filter [%v] component [%v] truncated",
+				ErrPacketFilterSyntax, pf.Identifier, PfcString(pfc.ComponentType))
+		}
+		pfc.ComponentValue = content[1 : 1+valueLen]
+		pf.Content = append(pf.Content, pfc)
+		content = content[1+valueLen:]
+	}
+	return nil
+}
+
+//FlowDescription is IPFilterRule(TS 29.212 5.4.2) matching packet filter. ToS/traffic class,
+//SPI and flow label are carried next to it, filter with components IPFilterRule can't express
+//(e.g. Ethernet ones, non-contiguous address mask) is rejected
+func (pf *PacketFilter) FlowDescription() (string, error) {
+	protoId, remoteAddr, localAddr := "ip", "any", "assigned"
+	var remotePort, localPort string
+	var v4, v6 bool
+
+	seen := make(map[uint8]bool)
+	for _, pfc := range pf.Content {
+		value := pfc.ComponentValue
+		if seen[pfc.ComponentType] {
+			return "", fmt.Errorf("%w, packet filter [%v] has component [%v] more than once",
+				ErrPacketFilterSemantic, pf.Identifier, PfcString(pfc.ComponentType))
+		}
+		seen[pfc.ComponentType] = true
+
+		var err error
+		switch pfc.ComponentType {
+		case PFComponentTypeMatchAll:
+			if len(pf.Content) != 1 {
+				return "", fmt.Errorf("%w, packet filter [%v] combines match-all with other components",
+					ErrPacketFilterSemantic, pf.Identifier)
+			}
+			return "permit out ip from any to assigned", nil
+		case PFComponentTypeProtocolIdentifierOrNextHeader:
+			protoId = strconv.Itoa(int(value[0]))
+		case PFComponentTypeIPv4RemoteAddress:
+			v4 = true
+			remoteAddr, err = ipv4PrefixString(value)
+		case PFComponentTypeIPv4LocalAddress:
+			v4 = true
+			localAddr, err = ipv4PrefixString(value)
+		case PFComponentTypeIPv6RemoteAddress:
+			v6 = true
+			remoteAddr, err = ipv6PrefixString(value)
+		case PFComponentTypeIPv6LocalAddress:
+			v6 = true
+			localAddr, err = ipv6PrefixString(value)
+		case PFComponentTypeSingleRemotePort:
+			remotePort = strconv.Itoa(int(binary.BigEndian.Uint16(value)))
+		case PFComponentTypeRemotePortRange:
+			remotePort, err = portRangeString(value)
+		case PFComponentTypeSingleLocalPort:
+			localPort = strconv.Itoa(int(binary.BigEndian.Uint16(value)))
+		case PFComponentTypeLocalPortRange:
+			localPort, err = portRangeString(value)
+		case PFComponentTypeSecurityParameterIndex,
+			PFComponentTypeTypeOfServiceOrTrafficClass,
+			PFComponentTypeFlowLabel:
+		default:
+			err = fmt.Errorf("%w, no IPFilterRule equivalent", ErrPacketFilterSemantic)
+		}
+		if err != nil {
+			return "", fmt.Errorf("packet filter [%v] component [%v], %w", pf.Identifier, PfcString(pfc.ComponentType), err)
+		}
+	}
+	if v4 && v6 {
+		return "", fmt.Errorf("%w, packet filter [%v] mixes IPv4 and IPv6 addresses", ErrPacketFilterSemantic, pf.Identifier)
+	}
+	if (seen[PFComponentTypeSingleRemotePort] && seen[PFComponentTypeRemotePortRange]) ||
+		(seen[PFComponentTypeSingleLocalPort] && seen[PFComponentTypeLocalPortRange]) {
+		return "", fmt.Errorf("%w, packet filter [%v] has both single port and port range",
+			ErrPacketFilterSemantic, pf.Identifier)
+	}
+
+	flowDesc := fmt.Sprintf("permit out %s from %s", protoId, remoteAddr)
+	if remotePort != "" {
+		flowDesc += " " + remotePort
+	}
+	flowDesc += " to " + localAddr
+	if localPort != "" {
+		flowDesc += " " + localPort
+	}
+	return flowDesc, nil
+}
+
+//ComponentValueString is hex value of first component of type, empty if filter has none
+func (pf *PacketFilter) ComponentValueString(pfcType uint8) string {
+	for _, pfc := range pf.Content {
+		if pfc.ComponentType == pfcType {
+			return hex.EncodeToString(pfc.ComponentValue)
+		}
+	}
+	return ""
+}
+
+func ipv4PrefixString(value []byte) (string, error) {
+	ones, bits := net.IPMask(value[4:8]).Size()
+	if bits == 0 {
+		return "", fmt.Errorf("%w, non-contiguous address mask %v", ErrPacketFilterSemantic, net.IP(value[4:8]))
+	}
+	return fmt.Sprintf("%s/%d", net.IP(value[0:4]).String(), ones), nil
+}
+
+func ipv6PrefixString(value []byte) (string, error) {
+	if value[16] > 128 {
+		return "", fmt.Errorf("%w, prefix length [%v]", ErrPacketFilterSyntax, value[16])
+	}
+	return fmt.Sprintf("%s/%d", net.IP(value[0:16]).String(), value[16]), nil
+}
+
+func portRangeString(value []byte) (string, error) {
+	low, high := binary.BigEndian.Uint16(value[0:2]), binary.BigEndian.Uint16(value[2:4])
+	if low > high {
+		return "", fmt.Errorf("%w, port range low limit [%v] above high limit [%v]", ErrPacketFilterSemantic, low, high)
+	}
+	return fmt.Sprintf("%d-%d", low, high), nil
+}
@@ -5,7 +5,9 @@
 package qos_test
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"testing"
 
 	"github.com/free5gc/openapi/models"
@@ -38,6 +40,48 @@ func TestGetPfContent(t *testing.T) {
 	}
 }
 
+func TestUnmarshalRequestedQosRules(t *testing.T) {
+	//Create rule 1, bidirectional filter 1: UDP from 10.0.0.1:80 to UE ports 5000-6000, precedence 10, QFI 5
+	ruleBytes := []byte{0x01, 0x00, 0x18, 0x21,
+		0x31, 0x13,
+		0x30, 0x11,
+		0x10, 0x0a, 0x00, 0x00, 0x01, 0xff, 0xff, 0xff, 0xff,
+		0x50, 0x00, 0x50,
+		0x41, 0x13, 0x88, 0x17, 0x70,
+		0x0a, 0x05}
+
+	var qosRules qos.QoSRules
+	require.Nil(t, qosRules.UnmarshalBinary(ruleBytes))
+	require.Len(t, qosRules, 1)
+	require.Equal(t, qos.OperationCodeCreateNewQoSRule, qosRules[0].OperationCode)
+	require.Equal(t, uint8(10), qosRules[0].Precedence)
+	require.Equal(t, uint8(5), qosRules[0].QFI)
+	require.Len(t, qosRules[0].PacketFilterList, 1)
+	flowDesc, err := qosRules[0].PacketFilterList[0].FlowDescription()
+	require.Nil(t, err)
+	require.Equal(t, "permit out 17 from 10.0.0.1/32 80 to assigned 5000-6000", flowDesc)
+
+	ueInitResReqs, err := qos.BuildUeInitiatedResourceRequests(&qos.SmCtxtPolicyData{}, qosRules, nil)
+	require.Nil(t, err)
+	require.Len(t, ueInitResReqs, 1)
+	require.Equal(t, models.RuleOperation_CREATE_PCC_RULE, ueInitResReqs[0].RuleOp)
+	require.Equal(t, models.FlowDirection_BIDIRECTIONAL, ueInitResReqs[0].PackFiltInfo[0].FlowDirection)
+
+	//Unknown packet filter component
+	ruleBytes[6] = 0xee
+	qosRules = nil
+	require.True(t, errors.Is(qosRules.UnmarshalBinary(ruleBytes), qos.ErrPacketFilterSyntax))
+
+	//Rule length exceeds IE
+	qosRules = nil
+	require.True(t, errors.Is(qosRules.UnmarshalBinary(ruleBytes[:10]), qos.ErrQosOperationSyntax))
+
+	//Modification of rule not installed
+	qosRules = qos.QoSRules{{Identifier: 2, OperationCode: qos.OperationCodeModifyExistingQoSRuleAndAddPacketFilters}}
+	_, err = qos.BuildUeInitiatedResourceRequests(&qos.SmCtxtPolicyData{}, qosRules, nil)
+	require.True(t, errors.Is(err, qos.ErrQosOperationSemantic))
+}
+
 func TestBuildQosRules(t *testing.T) {
 	//make SM Policy Decision
 	smPolicyDecision := &models.SmPolicyDecision{}
@@ -165,3 +209,46 @@ func makeSampleSessionRule() map[string]*models.SessionRule {
 		"SessRule2": &sessRule2,
 	}
 }
+
+func TestPacketFilterFlowDescription(t *testing.T) {
+	ipv6Addr := append(net.ParseIP("2001:db8::1").To16(), 64)
+
+	//IPv6 remote prefix, protocol
+	pf := qos.PacketFilter{Content: []qos.PacketFilterComponent{
+		{ComponentType: qos.PFComponentTypeIPv6RemoteAddress, ComponentValue: ipv6Addr},
+		{ComponentType: qos.PFComponentTypeProtocolIdentifierOrNextHeader, ComponentValue: []byte{6}},
+	}}
+	flowDesc, err := pf.FlowDescription()
+	require.Nil(t, err)
+	require.Equal(t, "permit out 6 from 2001:db8::1/64 to assigned", flowDesc)
+
+	//Non-contiguous IPv4 mask
+	pf = qos.PacketFilter{Content: []qos.PacketFilterComponent{
+		{ComponentType: qos.PFComponentTypeIPv4RemoteAddress,
+			ComponentValue: []byte{0x0a, 0x00, 0x00, 0x01, 0xff, 0x00, 0xff, 0x00}},
+	}}
+	_, err = pf.FlowDescription()
+	require.True(t, errors.Is(err, qos.ErrPacketFilterSemantic))
+
+	//Inverted port range
+	pf = qos.PacketFilter{Content: []qos.PacketFilterComponent{
+		{ComponentType: qos.PFComponentTypeLocalPortRange, ComponentValue: []byte{0x17, 0x70, 0x13, 0x88}},
+	}}
+	_, err = pf.FlowDescription()
+	require.True(t, errors.Is(err, qos.ErrPacketFilterSemantic))
+
+	//Ethernet component
+	pf = qos.PacketFilter{Content: []qos.PacketFilterComponent{
+		{ComponentType: qos.PFComponentTypeEthertype, ComponentValue: []byte{0x08, 0x00}},
+	}}
+	_, err = pf.FlowDescription()
+	require.True(t, errors.Is(err, qos.ErrPacketFilterSemantic))
+
+	//IPv6 prefix length out of range
+	ipv6Addr[16] = 129
+	pf = qos.PacketFilter{Content: []qos.PacketFilterComponent{
+		{ComponentType: qos.PFComponentTypeIPv6LocalAddress, ComponentValue: ipv6Addr},
+	}}
+	_, err = pf.FlowDescription()
+	require.True(t, errors.Is(err, qos.ErrPacketFilterSyntax))
+}
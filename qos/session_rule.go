@@ -5,6 +5,8 @@
 package qos
 
 import (
+	"reflect"
+
 	"github.com/free5gc/openapi/models"
 )
 
@@ -45,10 +47,17 @@ func GetSessionRulesUpdate(pcfSessRules, ctxtSessRules map[string]*models.Sessio
 			change.activeRuleName = name
 			change.ActiveSessRule = sessRule
 
-		} else {
-			change.mod[name] = sessRule
+		} else if !reflect.DeepEqual(sessRule, ctxtSessRules[name]) {
 			//Rules to be modified
-			//TODO
+			change.mod[name] = sessRule
+		}
+	}
+
+	//Modified rule stays active unless new one is added
+	if change.ActiveSessRule == nil {
+		for name, sessRule := range change.mod {
+			change.activeRuleName = name
+			change.ActiveSessRule = sessRule
 		}
 	}
 	return &change
@@ -65,7 +74,9 @@ func CommitSessionRulesUpdate(smCtxtPolData *SmCtxtPolicyData, update *SessRules
 	}
 
 	//Mod rules
-	//TODO
+	for name, rule := range update.mod {
+		smCtxtPolData.SmCtxtSessionRules.SessionRules[name] = rule
+	}
 
 	//Del Rules
 	if len(update.del) > 0 {
@@ -74,7 +85,16 @@ func CommitSessionRulesUpdate(smCtxtPolData *SmCtxtPolicyData, update *SessRules
 		}
 	}
 
-	//Set Active Rule
-	smCtxtPolData.SmCtxtSessionRules.ActiveRule = update.ActiveSessRule
-	smCtxtPolData.SmCtxtSessionRules.ActiveRuleName = update.activeRuleName
+	//Set Active Rule, unchanged active rule stays
+	if update.ActiveSessRule != nil {
+		smCtxtPolData.SmCtxtSessionRules.ActiveRule = update.ActiveSessRule
+		smCtxtPolData.SmCtxtSessionRules.ActiveRuleName = update.activeRuleName
+	} else if _, ok := smCtxtPolData.SmCtxtSessionRules.SessionRules[smCtxtPolData.SmCtxtSessionRules.ActiveRuleName]; !ok {
+		smCtxtPolData.SmCtxtSessionRules.ActiveRule = nil
+		smCtxtPolData.SmCtxtSessionRules.ActiveRuleName = ""
+	}
+}
+
+func (upd *SessRulesUpdate) isChanged() bool {
+	return upd != nil && len(upd.add)+len(upd.mod)+len(upd.del) > 0
 }
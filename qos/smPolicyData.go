@@ -28,6 +28,10 @@ type SmCtxtPolicyData struct {
 	SmCtxtTCData       SmCtxtTrafficControlData
 	SmCtxtChargingData SmCtxtChargingData
 	SmCtxtCondData     SmCtxtCondData
+	SmCtxtUsageMonData SmCtxtUsageMonData
+
+	//policy control request triggers armed by PCF
+	PolicyCtrlReqTriggers []models.PolicyControlRequestTrigger
 }
 
 //maintain all session rule-info and current active sess rule
@@ -58,6 +62,10 @@ type SmCtxtCondData struct {
 	CondData map[string]*models.ConditionData
 }
 
+type SmCtxtUsageMonData struct {
+	UsageMonData map[string]*models.UsageMonitoringData
+}
+
 func (obj *SmCtxtPolicyData) Initialize() {
 	obj.SmCtxtSessionRules.SessionRules = make(map[string]*models.SessionRule)
 	obj.SmCtxtPccRules.PccRules = make(map[string]*models.PccRule)
@@ -65,6 +73,7 @@ func (obj *SmCtxtPolicyData) Initialize() {
 	obj.SmCtxtCondData.CondData = make(map[string]*models.ConditionData)
 	obj.SmCtxtChargingData.ChargingData = make(map[string]*models.ChargingData)
 	obj.SmCtxtTCData.TrafficControlData = make(map[string]*models.TrafficControlData)
+	obj.SmCtxtUsageMonData.UsageMonData = make(map[string]*models.UsageMonitoringData)
 }
 
 func BuildSmPolicyUpdate(smCtxtPolData *SmCtxtPolicyData, smPolicyDecision *models.SmPolicyDecision) *PolicyUpdate {
@@ -119,5 +128,36 @@ func CommitSmPolicyDecision(smCtxtPolData *SmCtxtPolicyData, smPolicyUpdate *Pol
 		CommitConditionDataUpdate(smCtxtPolData, smPolicyUpdate.CondDataUpdate)
 	}
 
+	//Update Usage Monitoring data, removed if nulled by PCF
+	if smPolicyUpdate.SmPolicyDecision != nil {
+		for umId, umData := range smPolicyUpdate.SmPolicyDecision.UmDecs {
+			if umData == nil {
+				delete(smCtxtPolData.SmCtxtUsageMonData.UsageMonData, umId)
+			} else {
+				smCtxtPolData.SmCtxtUsageMonData.UsageMonData[umId] = umData
+			}
+		}
+	}
+
+	//Triggers provided by PCF replace armed ones
+	if smPolicyUpdate.SmPolicyDecision != nil && smPolicyUpdate.SmPolicyDecision.PolicyCtrlReqTriggers != nil {
+		smCtxtPolData.PolicyCtrlReqTriggers = smPolicyUpdate.SmPolicyDecision.PolicyCtrlReqTriggers
+	}
+
 	return nil
 }
+
+//IsQosChanged tells if policy update changes rules or QoS flows signalled to UE and RAN
+func (upd *PolicyUpdate) IsQosChanged() bool {
+	return upd.SessRuleUpdate.isChanged() || upd.PccRuleUpdate.isChanged() || upd.QosFlowUpdate.isChanged()
+}
+
+//IsPolicyCtrlReqTriggerArmed tells if PCF asked to be reported of the trigger
+func (obj *SmCtxtPolicyData) IsPolicyCtrlReqTriggerArmed(trigger models.PolicyControlRequestTrigger) bool {
+	for _, armed := range obj.PolicyCtrlReqTriggers {
+		if armed == trigger {
+			return true
+		}
+	}
+	return false
+}
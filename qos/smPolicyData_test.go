@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package qos_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/qos"
+)
+
+func TestCommitSmPolicyDecisionUpdate(t *testing.T) {
+	smCtxtPolData := &qos.SmCtxtPolicyData{}
+	smCtxtPolData.Initialize()
+
+	sessRule := &models.SessionRule{
+		SessRuleId:   "SessRuleId-1",
+		AuthSessAmbr: &models.Ambr{Uplink: "100 Mbps", Downlink: "100 Mbps"},
+		AuthDefQos:   &models.AuthorizedDefaultQos{Var5qi: 9},
+	}
+	update := qos.BuildSmPolicyUpdate(smCtxtPolData, &models.SmPolicyDecision{
+		SessRules:             map[string]*models.SessionRule{"SessRuleId-1": sessRule},
+		PolicyCtrlReqTriggers: []models.PolicyControlRequestTrigger{models.PolicyControlRequestTrigger_UE_IP_CH},
+	})
+	require.True(t, update.IsQosChanged())
+	require.NoError(t, qos.CommitSmPolicyDecision(smCtxtPolData, update))
+	require.True(t, smCtxtPolData.IsPolicyCtrlReqTriggerArmed(models.PolicyControlRequestTrigger_UE_IP_CH))
+	require.False(t, smCtxtPolData.IsPolicyCtrlReqTriggerArmed(models.PolicyControlRequestTrigger_US_RE))
+
+	//Same rule again changes nothing, armed triggers stay
+	update = qos.BuildSmPolicyUpdate(smCtxtPolData, &models.SmPolicyDecision{
+		SessRules: map[string]*models.SessionRule{"SessRuleId-1": sessRule},
+	})
+	require.False(t, update.IsQosChanged())
+	require.NoError(t, qos.CommitSmPolicyDecision(smCtxtPolData, update))
+	require.Equal(t, sessRule, smCtxtPolData.SmCtxtSessionRules.ActiveRule)
+	require.True(t, smCtxtPolData.IsPolicyCtrlReqTriggerArmed(models.PolicyControlRequestTrigger_UE_IP_CH))
+
+	//Modified rule replaces active one
+	modRule := &models.SessionRule{
+		SessRuleId:   "SessRuleId-1",
+		AuthSessAmbr: &models.Ambr{Uplink: "10 Mbps", Downlink: "10 Mbps"},
+		AuthDefQos:   &models.AuthorizedDefaultQos{Var5qi: 9},
+	}
+	update = qos.BuildSmPolicyUpdate(smCtxtPolData, &models.SmPolicyDecision{
+		SessRules: map[string]*models.SessionRule{"SessRuleId-1": modRule},
+	})
+	require.True(t, update.IsQosChanged())
+	require.Equal(t, modRule, update.SessRuleUpdate.ActiveSessRule)
+	require.NoError(t, qos.CommitSmPolicyDecision(smCtxtPolData, update))
+	require.Equal(t, modRule, smCtxtPolData.SmCtxtSessionRules.ActiveRule)
+	require.Equal(t, "SessRuleId-1", smCtxtPolData.SmCtxtSessionRules.ActiveRuleName)
+}
+
+func TestPccRuleIdsOfQosFlow(t *testing.T) {
+	smCtxtPolData := &qos.SmCtxtPolicyData{}
+	smCtxtPolData.Initialize()
+
+	update := qos.BuildSmPolicyUpdate(smCtxtPolData, &models.SmPolicyDecision{
+		PccRules: map[string]*models.PccRule{
+			"PccRuleId-1": {PccRuleId: "PccRuleId-1", RefQosData: []string{"5"}},
+			"PccRuleId-2": {PccRuleId: "PccRuleId-2", RefQosData: []string{"6"}},
+		},
+		QosDecs: map[string]*models.QosData{
+			"5": {QosId: "5", Var5qi: 5},
+			"6": {QosId: "6", Var5qi: 6},
+		},
+	})
+	require.Equal(t, []string{"PccRuleId-1"}, update.PccRuleIdsOfQosFlow(5))
+	require.Len(t, update.PccRuleUpdate.GetDelPccRuleUpdate(), 0)
+	require.Empty(t, update.PccRuleIdsOfQosFlow(7))
+}
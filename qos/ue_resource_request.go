@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package qos
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/free5gc/openapi/models"
+)
+
+//QoS rule operation code to PCC rule operation requested of PCF
+var ueRuleOperation = map[uint8]models.RuleOperation{
+	OperationCodeCreateNewQoSRule:                                   models.RuleOperation_CREATE_PCC_RULE,
+	OperationCodeDeleteExistingQoSRule:                              models.RuleOperation_DELETE_PCC_RULE,
+	OperationCodeModifyExistingQoSRuleAndAddPacketFilters:           models.RuleOperation_MODIFY_PCC_RULE_AND_ADD_PACKET_FILTERS,
+	OperationCodeModifyExistingQoSRuleAndReplaceAllPacketFilters:    models.RuleOperation_MODIFY_PCC_RULE_AND_REPLACE_PACKET_FILTERS,
+	OperationCodeModifyExistingQoSRuleAndDeletePacketFilters:        models.RuleOperation_MODIFY_PCC_RULE_AND_DELETE_PACKET_FILTERS,
+	OperationCodeModifyExistingQoSRuleWithoutModifyingPacketFilters: models.RuleOperation_MODIFY_PCC_RULE_WITHOUT_MODIFY_PACKET_FILTERS,
+}
+
+//BuildUeInitiatedResourceRequests maps QoS rules requested by UE to resource modification
+//requests of PCF(TS 29.512 4.2.4.17), QoS is taken from flow description of rule's QFI
+func BuildUeInitiatedResourceRequests(smCtxtPolData *SmCtxtPolicyData, qosRules QoSRules,
+	qosFlowDescs QoSFlowDescriptions) ([]models.UeInitiatedResourceRequest, error) {
+	ueInitResReqs := make([]models.UeInitiatedResourceRequest, 0, len(qosRules))
+
+	for _, rule := range qosRules {
+		ruleOp, ok := ueRuleOperation[rule.OperationCode]
+		if !ok {
+			return nil, fmt.Errorf("%w, QoS rule [%v] operation code [%v]",
+				ErrQosOperationSemantic, rule.Identifier, rule.OperationCode)
+		}
+
+		ueInitResReq := models.UeInitiatedResourceRequest{
+			RuleOp:       ruleOp,
+			Precedence:   int32(rule.Precedence),
+			PackFiltInfo: make([]models.PacketFilterInfo, 0, len(rule.PacketFilterList)),
+		}
+
+		if rule.OperationCode == OperationCodeCreateNewQoSRule {
+			if len(rule.PacketFilterList) == 0 {
+				return nil, fmt.Errorf("%w, new QoS rule [%v] without packet filters",
+					ErrQosOperationSemantic, rule.Identifier)
+			}
+		} else {
+			//Rule to modify or delete is known to SMF by PCC rule it is derived of
+			pccRuleId := smCtxtPolData.pccRuleIdOfQosRule(rule.Identifier)
+			if pccRuleId == "" {
+				return nil, fmt.Errorf("%w, QoS rule [%v] doesn't exist", ErrQosOperationSemantic, rule.Identifier)
+			}
+			ueInitResReq.PccRuleId = pccRuleId
+		}
+
+		for i := range rule.PacketFilterList {
+			pfInfo, err := buildPacketFilterInfo(rule.OperationCode, &rule.PacketFilterList[i])
+			if err != nil {
+				return nil, fmt.Errorf("QoS rule [%v], %w", rule.Identifier, err)
+			}
+			ueInitResReq.PackFiltInfo = append(ueInitResReq.PackFiltInfo, pfInfo)
+		}
+
+		if qfd := qosFlowDescs.Find(rule.QFI); qfd != nil {
+			ueInitResReq.ReqQos = qfd.RequestedQos()
+		}
+		ueInitResReqs = append(ueInitResReqs, ueInitResReq)
+	}
+	return ueInitResReqs, nil
+}
+
+func buildPacketFilterInfo(opCode uint8, pf *PacketFilter) (models.PacketFilterInfo, error) {
+	pfInfo := models.PacketFilterInfo{
+		PackFiltId: strconv.Itoa(int(pf.Identifier)),
+	}
+	//Packet filters to delete are identified only
+	if opCode == OperationCodeModifyExistingQoSRuleAndDeletePacketFilters {
+		return pfInfo, nil
+	}
+
+	flowDesc, err := pf.FlowDescription()
+	if err != nil {
+		return pfInfo, err
+	}
+	pfInfo.PackFiltCont = flowDesc
+	pfInfo.TosTrafficClass = pf.ComponentValueString(PFComponentTypeTypeOfServiceOrTrafficClass)
+	pfInfo.Spi = pf.ComponentValueString(PFComponentTypeSecurityParameterIndex)
+	pfInfo.FlowLabel = pf.ComponentValueString(PFComponentTypeFlowLabel)
+
+	switch pf.Direction {
+	case PacketFilterDirectionDownlink:
+		pfInfo.FlowDirection = models.FlowDirection_DOWNLINK
+	case PacketFilterDirectionUplink:
+		pfInfo.FlowDirection = models.FlowDirection_UPLINK
+	case PacketFilterDirectionBidirectional:
+		pfInfo.FlowDirection = models.FlowDirection_BIDIRECTIONAL
+	default:
+		pfInfo.FlowDirection = models.FlowDirection_UNSPECIFIED
+	}
+	return pfInfo, nil
+}
+
+//pccRuleIdOfQosRule is id of installed PCC rule QoS rule is derived of, empty if none
+func (obj *SmCtxtPolicyData) pccRuleIdOfQosRule(qosRuleId uint8) string {
+	for pccRuleId := range obj.SmCtxtPccRules.PccRules {
+		if GetQosRuleIdFromPccRuleId(pccRuleId) == qosRuleId {
+			return pccRuleId
+		}
+	}
+	return ""
+}
@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package radius
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTimeout        = 3 * time.Second
+	DefaultRetries        = 2
+	defaultAccountingPort = "1813"
+)
+
+//Client sends requests to RADIUS authentication and accounting server
+type Client struct {
+	Server           string
+	AccountingServer string
+	Secret           []byte
+	Timeout          time.Duration
+	//Retransmissions of unanswered request
+	Retries int
+
+	lock       sync.Mutex
+	identifier uint8
+}
+
+//NewClient creates client of server, accounting server defaults to server host with port 1813
+func NewClient(server, accountingServer, secret string, timeout time.Duration, retries int) *Client {
+	if accountingServer == "" {
+		if host, _, err := net.SplitHostPort(server); err == nil {
+			accountingServer = net.JoinHostPort(host, defaultAccountingPort)
+		}
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if retries <= 0 {
+		retries = DefaultRetries
+	}
+	return &Client{
+		Server:           server,
+		AccountingServer: accountingServer,
+		Secret:           []byte(secret),
+		Timeout:          timeout,
+		Retries:          retries,
+	}
+}
+
+func (c *Client) nextIdentifier() uint8 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.identifier++
+	return c.identifier
+}
+
+//Exchange sends Access-Request and returns Access-Accept, Access-Reject or Access-Challenge
+func (c *Client) Exchange(request *Packet) (*Packet, error) {
+	request.Code = CodeAccessRequest
+	if _, err := rand.Read(request.Authenticator[:]); err != nil {
+		return nil, err
+	}
+
+	rsp, err := c.exchange(c.Server, request)
+	if err != nil {
+		return nil, err
+	}
+	switch rsp.Code {
+	case CodeAccessAccept, CodeAccessReject, CodeAccessChallenge:
+		return rsp, nil
+	}
+	return nil, fmt.Errorf("unexpected response code[%d] to Access-Request", rsp.Code)
+}
+
+//Account sends Accounting-Request and waits for Accounting-Response
+func (c *Client) Account(request *Packet) error {
+	request.Code = CodeAccountingRequest
+
+	rsp, err := c.exchange(c.AccountingServer, request)
+	if err != nil {
+		return err
+	}
+	if rsp.Code != CodeAccountingResponse {
+		return fmt.Errorf("unexpected response code[%d] to Accounting-Request", rsp.Code)
+	}
+	return nil
+}
+
+//exchange sends request until response is received or retries are exhausted, responses which
+//don't match request are silently discarded
+func (c *Client) exchange(server string, request *Packet) (*Packet, error) {
+	request.Identifier = c.nextIdentifier()
+	buf, err := request.Encode(c.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.Dial("udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	rspBuf := make([]byte, maxPacketLen)
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if _, err := conn.Write(buf); err != nil {
+			return nil, err
+		}
+		if err := conn.SetReadDeadline(time.Now().Add(c.Timeout)); err != nil {
+			return nil, err
+		}
+
+		for {
+			n, err := conn.Read(rspBuf)
+			if err != nil {
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					break
+				}
+				return nil, err
+			}
+			rsp, err := Decode(rspBuf[:n])
+			if err != nil || rsp.Identifier != request.Identifier {
+				continue
+			}
+			if err := VerifyResponse(rspBuf[:n], c.Secret, request); err != nil {
+				continue
+			}
+			return rsp, nil
+		}
+	}
+	return nil, fmt.Errorf("no response from RADIUS server %s", server)
+}
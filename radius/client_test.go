@@ -0,0 +1,198 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package radius_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/smf/radius"
+)
+
+const testSecret = "testing123"
+
+//stubServer is local DN-AAA, Access-Requests are answered by handle
+type stubServer struct {
+	conn       *net.UDPConn
+	secret     []byte
+	handle     func(req *radius.Packet) *radius.Packet
+	drop       int32
+	accounting chan *radius.Packet
+}
+
+func newStubServer(t *testing.T, secret string, handle func(req *radius.Packet) *radius.Packet) *stubServer {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.Nil(t, err)
+	s := &stubServer{
+		conn:       conn,
+		secret:     []byte(secret),
+		handle:     handle,
+		accounting: make(chan *radius.Packet, 10),
+	}
+	t.Cleanup(func() { conn.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *stubServer) addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+func (s *stubServer) serve() {
+	buf := make([]byte, 4096)
+	for {
+		n, peer, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if radius.VerifyRequest(buf[:n], s.secret) != nil {
+			continue
+		}
+		req, err := radius.Decode(buf[:n])
+		if err != nil {
+			continue
+		}
+		if atomic.LoadInt32(&s.drop) > 0 {
+			atomic.AddInt32(&s.drop, -1)
+			continue
+		}
+
+		var rsp *radius.Packet
+		if req.Code == radius.CodeAccountingRequest {
+			s.accounting <- req
+			rsp = radius.NewPacket(radius.CodeAccountingResponse)
+		} else {
+			rsp = s.handle(req)
+		}
+		if rspBuf, err := rsp.EncodeResponse(s.secret, req); err == nil {
+			s.conn.WriteToUDP(rspBuf, peer)
+		}
+	}
+}
+
+func TestPacketEncodeDecode(t *testing.T) {
+	eap := bytes.Repeat([]byte{0xab}, 600)
+	req := radius.NewPacket(radius.CodeAccessRequest)
+	req.AddString(radius.AttrUserName, "user@enterprise")
+	req.AddEAPMessage(eap)
+	req.AddVendor(radius.Vendor3GPP, 5, []byte("10 Mbps"))
+
+	buf, err := req.Encode([]byte(testSecret))
+	require.Nil(t, err)
+	require.Nil(t, radius.VerifyRequest(buf, []byte(testSecret)))
+	require.NotNil(t, radius.VerifyRequest(buf, []byte("wrong")))
+
+	decoded, err := radius.Decode(buf)
+	require.Nil(t, err)
+	require.Equal(t, radius.CodeAccessRequest, decoded.Code)
+	require.Equal(t, "user@enterprise", string(decoded.Get(radius.AttrUserName)))
+	require.Equal(t, eap, decoded.EAPMessage())
+	require.Len(t, decoded.Get(radius.AttrMessageAuthenticator), 16)
+	require.Equal(t, "10 Mbps", string(decoded.GetVendor(radius.Vendor3GPP, 5)))
+	require.Nil(t, decoded.GetVendor(radius.Vendor3GPP, 6))
+
+	eapAttrs := 0
+	for _, attr := range decoded.Attributes {
+		if attr.Type == radius.AttrEAPMessage {
+			eapAttrs++
+		}
+	}
+	require.Equal(t, 3, eapAttrs)
+
+	_, err = radius.Decode(buf[:10])
+	require.NotNil(t, err)
+}
+
+func TestVerifyResponse(t *testing.T) {
+	req := radius.NewPacket(radius.CodeAccessRequest)
+	req.AddEAPMessage([]byte{2, 1, 0, 9, 1, 'u', 's', 'e', 'r'})
+	_, err := req.Encode([]byte(testSecret))
+	require.Nil(t, err)
+
+	buf, err := radius.NewPacket(radius.CodeAccessReject).EncodeResponse([]byte(testSecret), req)
+	require.Nil(t, err)
+	require.Nil(t, radius.VerifyResponse(buf, []byte(testSecret), req))
+
+	//Access-Reject without Message-Authenticator, re-signed with Response Authenticator
+	require.Equal(t, byte(radius.AttrMessageAuthenticator), buf[20])
+	buf[20] = byte(radius.AttrClass)
+	copy(buf[4:20], req.Authenticator[:])
+	sum := md5.Sum(append(append([]byte{}, buf...), testSecret...))
+	copy(buf[4:20], sum[:])
+	require.NotNil(t, radius.VerifyResponse(buf, []byte(testSecret), req))
+}
+
+func TestClientExchange(t *testing.T) {
+	server := newStubServer(t, testSecret, func(req *radius.Packet) *radius.Packet {
+		//EAP identity is challenged, response to challenge accepted
+		if req.Get(radius.AttrState) == nil {
+			rsp := radius.NewPacket(radius.CodeAccessChallenge)
+			rsp.Add(radius.AttrState, []byte("round-1"))
+			rsp.AddEAPMessage([]byte{1, 2, 0, 6, 4, 0})
+			return rsp
+		}
+		rsp := radius.NewPacket(radius.CodeAccessAccept)
+		rsp.AddIPv4(radius.AttrFramedIPAddress, net.ParseIP("60.63.0.10"))
+		rsp.AddVendor(radius.Vendor3GPP, 5, []byte("100 Mbps"))
+		rsp.AddEAPMessage([]byte{3, 2, 0, 4})
+		return rsp
+	})
+
+	client := radius.NewClient(server.addr(), "", testSecret, time.Second, 0)
+	_, port, _ := net.SplitHostPort(client.AccountingServer)
+	require.Equal(t, "1813", port)
+
+	req := radius.NewPacket(radius.CodeAccessRequest)
+	req.AddEAPMessage([]byte{2, 1, 0, 9, 1, 'u', 's', 'e', 'r'})
+	rsp, err := client.Exchange(req)
+	require.Nil(t, err)
+	require.Equal(t, radius.CodeAccessChallenge, rsp.Code)
+	require.Equal(t, []byte{1, 2, 0, 6, 4, 0}, rsp.EAPMessage())
+
+	req = radius.NewPacket(radius.CodeAccessRequest)
+	req.Add(radius.AttrState, rsp.Get(radius.AttrState))
+	req.AddEAPMessage([]byte{2, 2, 0, 6, 4, 0})
+	rsp, err = client.Exchange(req)
+	require.Nil(t, err)
+	require.Equal(t, radius.CodeAccessAccept, rsp.Code)
+	require.True(t, net.ParseIP("60.63.0.10").Equal(rsp.GetIPv4(radius.AttrFramedIPAddress)))
+	require.Equal(t, "100 Mbps", string(rsp.GetVendor(radius.Vendor3GPP, 5)))
+
+	//Lost request is retransmitted
+	atomic.StoreInt32(&server.drop, 1)
+	req = radius.NewPacket(radius.CodeAccessRequest)
+	req.Add(radius.AttrState, []byte("round-2"))
+	client.Timeout = 100 * time.Millisecond
+	client.Retries = 1
+	rsp, err = client.Exchange(req)
+	require.Nil(t, err)
+	require.Equal(t, radius.CodeAccessAccept, rsp.Code)
+
+	//Responses signed with other secret are discarded
+	client = radius.NewClient(server.addr(), "", "wrong", 100*time.Millisecond, 0)
+	client.Retries = 0
+	_, err = client.Exchange(radius.NewPacket(radius.CodeAccessRequest))
+	require.NotNil(t, err)
+}
+
+func TestClientAccounting(t *testing.T) {
+	server := newStubServer(t, testSecret, nil)
+	client := radius.NewClient(server.addr(), server.addr(), testSecret, time.Second, 0)
+
+	req := radius.NewPacket(radius.CodeAccountingRequest)
+	req.AddUint32(radius.AttrAcctStatusType, radius.AcctStatusStart)
+	req.AddString(radius.AttrAcctSessionId, "session-1")
+	require.Nil(t, client.Account(req))
+
+	received := <-server.accounting
+	require.Equal(t, []byte{0, 0, 0, 1}, received.Get(radius.AttrAcctStatusType))
+	require.Equal(t, "session-1", string(received.Get(radius.AttrAcctSessionId)))
+}
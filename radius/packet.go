@@ -0,0 +1,352 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package radius
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+//Code is RADIUS packet type(RFC 2865 3, RFC 2866 3)
+type Code uint8
+
+const (
+	CodeAccessRequest      Code = 1
+	CodeAccessAccept       Code = 2
+	CodeAccessReject       Code = 3
+	CodeAccountingRequest  Code = 4
+	CodeAccountingResponse Code = 5
+	CodeAccessChallenge    Code = 11
+)
+
+type AttributeType uint8
+
+const (
+	AttrUserName             AttributeType = 1
+	AttrNASIPAddress         AttributeType = 4
+	AttrServiceType          AttributeType = 6
+	AttrFramedIPAddress      AttributeType = 8
+	AttrState                AttributeType = 24
+	AttrClass                AttributeType = 25
+	AttrVendorSpecific       AttributeType = 26
+	AttrCalledStationId      AttributeType = 30
+	AttrCallingStationId     AttributeType = 31
+	AttrNASIdentifier        AttributeType = 32
+	AttrAcctStatusType       AttributeType = 40
+	AttrAcctSessionId        AttributeType = 44
+	AttrAcctSessionTime      AttributeType = 46
+	AttrEAPMessage           AttributeType = 79
+	AttrMessageAuthenticator AttributeType = 80
+)
+
+//Acct-Status-Type values
+const (
+	AcctStatusStart uint32 = 1
+	AcctStatusStop  uint32 = 2
+)
+
+//Vendor-Id of 3GPP vendor-specific attributes
+const Vendor3GPP uint32 = 10415
+
+const (
+	headerLen          = 20
+	maxPacketLen       = 4096
+	maxAttrValueLen    = 253
+	authenticatorLen   = 16
+	authenticatorStart = 4
+)
+
+type Attribute struct {
+	Type  AttributeType
+	Value []byte
+}
+
+type Packet struct {
+	Code          Code
+	Identifier    uint8
+	Authenticator [authenticatorLen]byte
+	Attributes    []Attribute
+}
+
+func NewPacket(code Code) *Packet {
+	return &Packet{Code: code}
+}
+
+func (p *Packet) Add(attrType AttributeType, value []byte) {
+	p.Attributes = append(p.Attributes, Attribute{Type: attrType, Value: value})
+}
+
+func (p *Packet) AddString(attrType AttributeType, value string) {
+	p.Add(attrType, []byte(value))
+}
+
+func (p *Packet) AddUint32(attrType AttributeType, value uint32) {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, value)
+	p.Add(attrType, buf)
+}
+
+func (p *Packet) AddIPv4(attrType AttributeType, ip net.IP) {
+	if ip4 := ip.To4(); ip4 != nil {
+		p.Add(attrType, []byte(ip4))
+	}
+}
+
+//AddVendor adds Vendor-Specific attribute with one sub-attribute(RFC 2865 5.26)
+func (p *Packet) AddVendor(vendorId uint32, vendorType uint8, value []byte) {
+	buf := make([]byte, 6+len(value))
+	binary.BigEndian.PutUint32(buf, vendorId)
+	buf[4] = vendorType
+	buf[5] = uint8(2 + len(value))
+	copy(buf[6:], value)
+	p.Add(AttrVendorSpecific, buf)
+}
+
+//AddEAPMessage adds EAP packet, split over several attributes if needed(RFC 3579 3.1)
+func (p *Packet) AddEAPMessage(eap []byte) {
+	for len(eap) > maxAttrValueLen {
+		p.Add(AttrEAPMessage, eap[:maxAttrValueLen])
+		eap = eap[maxAttrValueLen:]
+	}
+	p.Add(AttrEAPMessage, eap)
+}
+
+//Get returns value of first attribute of type, nil if there is none
+func (p *Packet) Get(attrType AttributeType) []byte {
+	for _, attr := range p.Attributes {
+		if attr.Type == attrType {
+			return attr.Value
+		}
+	}
+	return nil
+}
+
+func (p *Packet) GetIPv4(attrType AttributeType) net.IP {
+	if value := p.Get(attrType); len(value) == net.IPv4len {
+		return net.IP(value)
+	}
+	return nil
+}
+
+//GetVendor returns value of vendor-specific sub-attribute, nil if there is none
+func (p *Packet) GetVendor(vendorId uint32, vendorType uint8) []byte {
+	for _, attr := range p.Attributes {
+		if attr.Type != AttrVendorSpecific || len(attr.Value) < 4 ||
+			binary.BigEndian.Uint32(attr.Value) != vendorId {
+			continue
+		}
+		for sub := attr.Value[4:]; len(sub) >= 2 && int(sub[1]) >= 2 && int(sub[1]) <= len(sub); sub = sub[sub[1]:] {
+			if sub[0] == vendorType {
+				return sub[2:sub[1]]
+			}
+		}
+	}
+	return nil
+}
+
+//EAPMessage returns EAP packet reassembled from EAP-Message attributes
+func (p *Packet) EAPMessage() []byte {
+	var eap []byte
+	for _, attr := range p.Attributes {
+		if attr.Type == AttrEAPMessage {
+			eap = append(eap, attr.Value...)
+		}
+	}
+	return eap
+}
+
+func (p *Packet) marshal() ([]byte, error) {
+	length := headerLen
+	for _, attr := range p.Attributes {
+		if len(attr.Value) > maxAttrValueLen {
+			return nil, fmt.Errorf("attribute[%d] too long", attr.Type)
+		}
+		length += 2 + len(attr.Value)
+	}
+	if length > maxPacketLen {
+		return nil, errors.New("packet too long")
+	}
+
+	buf := make([]byte, length)
+	buf[0] = byte(p.Code)
+	buf[1] = p.Identifier
+	binary.BigEndian.PutUint16(buf[2:], uint16(length))
+	copy(buf[authenticatorStart:headerLen], p.Authenticator[:])
+	offset := headerLen
+	for _, attr := range p.Attributes {
+		buf[offset] = byte(attr.Type)
+		buf[offset+1] = uint8(2 + len(attr.Value))
+		copy(buf[offset+2:], attr.Value)
+		offset += 2 + len(attr.Value)
+	}
+	return buf, nil
+}
+
+//isAccessResponse tells if packet code is Access-Accept, Access-Reject or Access-Challenge
+func isAccessResponse(code Code) bool {
+	return code == CodeAccessAccept || code == CodeAccessReject || code == CodeAccessChallenge
+}
+
+//Packet carrying EAP, and every Access-* response, has to be signed with
+//Message-Authenticator(RFC 3579 3.2, RFC 5080 2.2.2)
+func (p *Packet) addMessageAuthenticator() {
+	if (p.Get(AttrEAPMessage) != nil || isAccessResponse(p.Code)) && p.Get(AttrMessageAuthenticator) == nil {
+		p.Add(AttrMessageAuthenticator, make([]byte, authenticatorLen))
+	}
+}
+
+//Encode encodes Access-Request or Accounting-Request, Request Authenticator of
+//Access-Request has to be set by caller
+func (p *Packet) Encode(secret []byte) ([]byte, error) {
+	switch p.Code {
+	case CodeAccessRequest:
+		p.addMessageAuthenticator()
+		buf, err := p.marshal()
+		if err != nil {
+			return nil, err
+		}
+		signMessageAuthenticator(buf, secret)
+		return buf, nil
+
+	case CodeAccountingRequest:
+		p.Authenticator = [authenticatorLen]byte{}
+		buf, err := p.marshal()
+		if err != nil {
+			return nil, err
+		}
+		copy(buf[authenticatorStart:headerLen], md5Sum(buf, secret))
+		copy(p.Authenticator[:], buf[authenticatorStart:headerLen])
+		return buf, nil
+	}
+	return nil, fmt.Errorf("packet code[%d] is not a request", p.Code)
+}
+
+//EncodeResponse encodes response to request with Response Authenticator(RFC 2865 3)
+func (p *Packet) EncodeResponse(secret []byte, request *Packet) ([]byte, error) {
+	p.Identifier = request.Identifier
+	p.Authenticator = request.Authenticator
+	p.addMessageAuthenticator()
+	buf, err := p.marshal()
+	if err != nil {
+		return nil, err
+	}
+	signMessageAuthenticator(buf, secret)
+	copy(buf[authenticatorStart:headerLen], md5Sum(buf, secret))
+	copy(p.Authenticator[:], buf[authenticatorStart:headerLen])
+	return buf, nil
+}
+
+func Decode(buf []byte) (*Packet, error) {
+	if len(buf) < headerLen {
+		return nil, errors.New("packet too short")
+	}
+	length := int(binary.BigEndian.Uint16(buf[2:]))
+	if length < headerLen || length > len(buf) || length > maxPacketLen {
+		return nil, fmt.Errorf("invalid packet length[%d]", length)
+	}
+
+	p := &Packet{
+		Code:       Code(buf[0]),
+		Identifier: buf[1],
+	}
+	copy(p.Authenticator[:], buf[authenticatorStart:headerLen])
+	for attrs := buf[headerLen:length]; len(attrs) > 0; {
+		if len(attrs) < 2 || attrs[1] < 2 || int(attrs[1]) > len(attrs) {
+			return nil, errors.New("invalid attribute length")
+		}
+		value := make([]byte, attrs[1]-2)
+		copy(value, attrs[2:attrs[1]])
+		p.Add(AttributeType(attrs[0]), value)
+		attrs = attrs[attrs[1]:]
+	}
+	return p, nil
+}
+
+//VerifyResponse checks Response Authenticator and Message-Authenticator of response to request,
+//Access-* response without Message-Authenticator is discarded
+func VerifyResponse(buf []byte, secret []byte, request *Packet) error {
+	if len(buf) < headerLen {
+		return errors.New("packet too short")
+	}
+	signed := make([]byte, len(buf))
+	copy(signed, buf)
+	copy(signed[authenticatorStart:headerLen], request.Authenticator[:])
+	if !hmac.Equal(md5Sum(signed, secret), buf[authenticatorStart:headerLen]) {
+		return errors.New("response authenticator mismatch")
+	}
+	return verifyMessageAuthenticator(signed, secret, isAccessResponse(Code(buf[0])))
+}
+
+//VerifyRequest checks Accounting-Request Authenticator or Message-Authenticator of Access-Request
+func VerifyRequest(buf []byte, secret []byte) error {
+	if len(buf) < headerLen {
+		return errors.New("packet too short")
+	}
+	signed := make([]byte, len(buf))
+	copy(signed, buf)
+	if Code(buf[0]) == CodeAccountingRequest {
+		copy(signed[authenticatorStart:headerLen], make([]byte, authenticatorLen))
+		if !hmac.Equal(md5Sum(signed, secret), buf[authenticatorStart:headerLen]) {
+			return errors.New("request authenticator mismatch")
+		}
+		return nil
+	}
+	return verifyMessageAuthenticator(signed, secret, false)
+}
+
+func md5Sum(buf []byte, secret []byte) []byte {
+	h := md5.New()
+	h.Write(buf)
+	h.Write(secret)
+	return h.Sum(nil)
+}
+
+//messageAuthenticatorOffset returns offset of Message-Authenticator value, -1 if there is none
+func messageAuthenticatorOffset(buf []byte) int {
+	length := int(binary.BigEndian.Uint16(buf[2:]))
+	if length > len(buf) {
+		length = len(buf)
+	}
+	for offset := headerLen; offset+2 <= length && buf[offset+1] >= 2 &&
+		offset+int(buf[offset+1]) <= length; offset += int(buf[offset+1]) {
+		if AttributeType(buf[offset]) == AttrMessageAuthenticator && buf[offset+1] == 2+authenticatorLen {
+			return offset + 2
+		}
+	}
+	return -1
+}
+
+func messageAuthenticator(buf []byte, offset int, secret []byte) []byte {
+	copy(buf[offset:offset+authenticatorLen], make([]byte, authenticatorLen))
+	mac := hmac.New(md5.New, secret)
+	mac.Write(buf)
+	return mac.Sum(nil)
+}
+
+func signMessageAuthenticator(buf []byte, secret []byte) {
+	if offset := messageAuthenticatorOffset(buf); offset >= 0 {
+		copy(buf[offset:], messageAuthenticator(buf, offset, secret))
+	}
+}
+
+func verifyMessageAuthenticator(buf []byte, secret []byte, required bool) error {
+	offset := messageAuthenticatorOffset(buf)
+	if offset < 0 {
+		if required {
+			return errors.New("message authenticator missing")
+		}
+		return nil
+	}
+	received := make([]byte, authenticatorLen)
+	copy(received, buf[offset:offset+authenticatorLen])
+	if !hmac.Equal(messageAuthenticator(buf, offset, secret), received) {
+		return errors.New("message authenticator mismatch")
+	}
+	return nil
+}
@@ -43,6 +43,7 @@ import (
 	"github.com/free5gc/smf/pfcp/message"
 	"github.com/free5gc/smf/pfcp/udp"
 	"github.com/free5gc/smf/pfcp/upf"
+	"github.com/free5gc/smf/producer"
 	"github.com/free5gc/smf/util"
 )
 
@@ -354,6 +355,16 @@ func (smf *SMF) Start() {
 	//Trigger PFCP association towards not associated UPFs
 	go upf.ProbeInactiveUpfs(context.SMF_Self().UserPlaneInformation)
 
+	//Sessions persisted at last shutdown
+	go func() {
+		if err := producer.RestorePersistedSMContexts(context.SMF_Self().Shutdown.PersistPath); err != nil {
+			logger.AppLog.Errorf("restoring persisted sessions failed, %v", err)
+		}
+	}()
+
+	//Cleanup SM contexts stuck in pending states
+	producer.StartSMContextSweeper()
+
 	time.Sleep(1000 * time.Millisecond)
 
 	HTTPAddr := fmt.Sprintf("%s:%d", context.SMF_Self().BindingIPv4, context.SMF_Self().SBIPort)
@@ -382,6 +393,11 @@ func (smf *SMF) Start() {
 
 func (smf *SMF) Terminate() {
 	logger.InitLog.Infof("Terminating SMF...")
+
+	if context.SMF_Self().Shutdown.Graceful {
+		producer.HandleGracefulShutdown()
+	}
+
 	// deregister with NRF
 	problemDetails, err := consumer.SendDeregisterNFInstance()
 	if problemDetails != nil {
@@ -46,6 +46,48 @@ var (
 		Cause:         "INSUFFICIENT_RESOURCES",
 		InvalidParams: nil,
 	}
+	DnnCongestion = models.ProblemDetails{
+		Title:         "DNN Congestion",
+		Status:        http.StatusInternalServerError,
+		Detail:        "The request cannot be provided due to congestion of the DNN.",
+		Cause:         "INSUFFICIENT_RESOURCES",
+		InvalidParams: nil,
+	}
+	SliceDnnCongestion = models.ProblemDetails{
+		Title:         "Slice and DNN Congestion",
+		Status:        http.StatusInternalServerError,
+		Detail:        "The request cannot be provided due to congestion of the specific slice and DNN.",
+		Cause:         "INSUFFICIENT_RESOURCES_SLICE_DNN",
+		InvalidParams: nil,
+	}
+	SliceCongestion = models.ProblemDetails{
+		Title:         "Slice Congestion",
+		Status:        http.StatusInternalServerError,
+		Detail:        "The request cannot be provided due to congestion of the specific slice.",
+		Cause:         "INSUFFICIENT_RESOURCES_SLICE",
+		InvalidParams: nil,
+	}
+	SecondaryAuthFailure = models.ProblemDetails{
+		Title:         "Secondary Authentication Failure",
+		Status:        http.StatusForbidden,
+		Detail:        "The UE is not authenticated or authorized by the DN-AAA server.",
+		Cause:         "REQUEST_REJECTED",
+		InvalidParams: nil,
+	}
+	SscModeNotAllowed = models.ProblemDetails{
+		Title:         "SSC Mode Not Allowed",
+		Status:        http.StatusForbidden,
+		Detail:        "The requested SSC mode is not allowed by the subscription.",
+		Cause:         "REQUEST_REJECTED",
+		InvalidParams: nil,
+	}
+	OutOfLadnServiceArea = models.ProblemDetails{
+		Title:         "Out of LADN Service Area",
+		Status:        http.StatusForbidden,
+		Detail:        "The UE is outside of the service area of the LADN DNN.",
+		Cause:         "OUT_OF_LADN_SERVICE_AREA",
+		InvalidParams: nil,
+	}
 	SubscriptionDataFetchError = models.ProblemDetails{
 		Title:         "Subscription Data Fetch error",
 		Status:        http.StatusInternalServerError,
@@ -95,6 +137,27 @@ var (
 		Cause:         "REQUEST_REJECTED",
 		InvalidParams: nil,
 	}
+	HSMFDiscoveryFailure = models.ProblemDetails{
+		Title:         "H-SMF Discovery Failure",
+		Status:        http.StatusInternalServerError,
+		Detail:        "The request cannot be provided due to failure in H-SMF discovery.",
+		Cause:         "REQUEST_REJECTED",
+		InvalidParams: nil,
+	}
+	HSMFCreateFailure = models.ProblemDetails{
+		Title:         "H-SMF PDU Session Create Failure",
+		Status:        http.StatusInternalServerError,
+		Detail:        "The request cannot be provided due to failure in creating PDU session at H-SMF.",
+		Cause:         "REQUEST_REJECTED",
+		InvalidParams: nil,
+	}
+	SmfShuttingDown = models.ProblemDetails{
+		Title:         "SMF Shutting Down",
+		Status:        http.StatusServiceUnavailable,
+		Detail:        "The request cannot be provided since SMF is shutting down.",
+		Cause:         "NF_CONGESTION",
+		InvalidParams: nil,
+	}
 	ApplySMPolicyFailure = models.ProblemDetails{
 		Title:         "Apply SM Policy Error",
 		Status:        http.StatusInternalServerError,
@@ -109,6 +172,12 @@ var ErrorType = map[string]*models.ProblemDetails{
 	"DnnNotSupported":              &DnnNotSupported,
 	"InsufficientResourceSliceDnn": &InsufficientResourceSliceDnn,
 	"IpAllocError":                 &IpAllocError,
+	"DnnCongestion":                &DnnCongestion,
+	"SliceDnnCongestion":           &SliceDnnCongestion,
+	"SliceCongestion":              &SliceCongestion,
+	"SecondaryAuthFailure":         &SecondaryAuthFailure,
+	"SscModeNotAllowed":            &SscModeNotAllowed,
+	"OutOfLadnServiceArea":         &OutOfLadnServiceArea,
 	"SubscriptionDataFetchError":   &SubscriptionDataFetchError,
 	"SubscriptionDataLenError":     &SubscriptionDataLenError,
 	"UDMDiscoveryFailure":          &UDMDiscoveryFailure,
@@ -117,6 +186,8 @@ var ErrorType = map[string]*models.ProblemDetails{
 	"PCFPolicyCreateFailure":       &PCFPolicyCreateFailure,
 	"ApplySMPolicyFailure":         &ApplySMPolicyFailure,
 	"AMFDiscoveryFailure":          &AMFDiscoveryFailure,
+	"HSMFDiscoveryFailure":         &HSMFDiscoveryFailure,
+	"HSMFCreateFailure":            &HSMFCreateFailure,
 }
 
 var ErrorCause = map[string]uint8{
@@ -124,6 +195,12 @@ var ErrorCause = map[string]uint8{
 	"DnnNotSupported":              nasMessage.Cause5GMMDNNNotSupportedOrNotSubscribedInTheSlice,
 	"InsufficientResourceSliceDnn": nasMessage.Cause5GSMInsufficientResourcesForSpecificSliceAndDNN,
 	"IpAllocError":                 nasMessage.Cause5GSMInsufficientResources,
+	"DnnCongestion":                nasMessage.Cause5GSMInsufficientResources,
+	"SliceDnnCongestion":           nasMessage.Cause5GSMInsufficientResourcesForSpecificSliceAndDNN,
+	"SliceCongestion":              nasMessage.Cause5GSMInsufficientResourcesForSpecificSlice,
+	"SecondaryAuthFailure":         nasMessage.Cause5GSMUserAuthenticationOrAuthorizationFailed,
+	"SscModeNotAllowed":            nasMessage.Cause5GSMNotSupportedSSCMode,
+	"OutOfLadnServiceArea":         nasMessage.Cause5GSMOutOfLADNServiceArea,
 	"SubscriptionDataFetchError":   nasMessage.Cause5GSMRequestRejectedUnspecified,
 	"SubscriptionDataLenError":     nasMessage.Cause5GSMRequestRejectedUnspecified,
 	"UDMDiscoveryFailure":          nasMessage.Cause5GSMRequestRejectedUnspecified,
@@ -132,4 +209,6 @@ var ErrorCause = map[string]uint8{
 	"PCFPolicyCreateFailure":       nasMessage.Cause5GSMRequestRejectedUnspecified,
 	"ApplySMPolicyFailure":         nasMessage.Cause5GSMRequestRejectedUnspecified,
 	"AMFDiscoveryFailure":          nasMessage.Cause5GSMRequestRejectedUnspecified,
+	"HSMFDiscoveryFailure":         nasMessage.Cause5GSMRequestRejectedUnspecified,
+	"HSMFCreateFailure":            nasMessage.Cause5GSMRequestRejectedUnspecified,
 }
@@ -6,6 +6,7 @@ package transaction
 
 import (
 	"fmt"
+	"runtime/debug"
 	"sync/atomic"
 	"time"
 
@@ -95,6 +96,13 @@ func (e TxnEvent) String() string {
 
 var TxnId uint32
 
+//Txns running through txn FSM
+var inFlightTxns int32
+
+func InFlightTxnCount() int32 {
+	return atomic.LoadInt32(&inFlightTxns)
+}
+
 func getNewTxnId() uint32 {
 	atomic.AddUint32(&TxnId, 1)
 	return TxnId
@@ -116,6 +124,14 @@ func NewTransaction(req, rsp interface{}, msgType svcmsgtypes.SmfMsgType) *Trans
 	return t
 }
 
+func (t *Transaction) StartTime() time.Time {
+	return t.startTime
+}
+
+func (t *Transaction) EndTime() time.Time {
+	return t.endTime
+}
+
 func (t *Transaction) TransactionEnd() {
 	t.endTime = time.Now()
 	t.TxnFsmLog.Infof("txn ended, execution time [%v] ", t.endTime.Sub(t.startTime))
@@ -138,6 +154,18 @@ func (txnBus TxnBus) PopTxn() (*Transaction, TxnBus) {
 	return nil, txnBus
 }
 
+//PopTxnOfType pops first txn of given message types, others stay queued
+func (txnBus TxnBus) PopTxnOfType(msgTypes ...svcmsgtypes.SmfMsgType) (*Transaction, TxnBus) {
+	for i, txn := range txnBus {
+		for _, msgType := range msgTypes {
+			if txn.MsgType == msgType {
+				return txn, append(txnBus[:i:i], txnBus[i+1:]...)
+			}
+		}
+	}
+	return nil, txnBus
+}
+
 type txnFsm interface {
 	TxnInit(t *Transaction) (TxnEvent, error)
 	TxnDecode(t *Transaction) (TxnEvent, error)
@@ -158,6 +186,9 @@ type txnFsmHandler [TxnEventExit]func(t *Transaction) (TxnEvent, error)
 
 var TxnFsmHandler txnFsmHandler
 
+//CrashDumpHook is invoked with the crashing txn before panic is propagated
+var CrashDumpHook func(t *Transaction)
+
 func InitTxnFsm(fsm txnFsm) {
 	TxnFsmHandler[TxnEventInit] = fsm.TxnInit
 	TxnFsmHandler[TxnEventDecode] = fsm.TxnDecode
@@ -177,6 +208,19 @@ func (t *Transaction) StartTxnLifeCycle(fsm txnFsm) {
 	nextEvent := TxnEventInit
 	var err error
 
+	atomic.AddInt32(&inFlightTxns, 1)
+	defer atomic.AddInt32(&inFlightTxns, -1)
+
+	defer func() {
+		if p := recover(); p != nil {
+			t.TxnFsmLog.Errorf("txn panic, %v\n%s", p, debug.Stack())
+			if CrashDumpHook != nil {
+				CrashDumpHook(t)
+			}
+			panic(p)
+		}
+	}()
+
 	for {
 		currEvent := nextEvent
 		t.TxnFsmLog.Debugf("processing event[%v] ", currEvent.String())